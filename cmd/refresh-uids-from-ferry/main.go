@@ -38,11 +38,13 @@ import (
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
 
+	"github.com/fermitools/managed-tokens/internal/configLoader"
 	"github.com/fermitools/managed-tokens/internal/contextStore"
 	"github.com/fermitools/managed-tokens/internal/db"
 	"github.com/fermitools/managed-tokens/internal/environment"
 	"github.com/fermitools/managed-tokens/internal/metrics"
 	"github.com/fermitools/managed-tokens/internal/notifications"
+	"github.com/fermitools/managed-tokens/internal/secrets"
 	"github.com/fermitools/managed-tokens/internal/tracing"
 	"github.com/fermitools/managed-tokens/internal/utils"
 )
@@ -65,6 +67,9 @@ var timeouts = map[string]time.Duration{
 	"db":           time.Duration(10 * time.Second),
 }
 
+// cleanupGracePeriod is how long after the global timeout we allow for sending notifications
+const cleanupGracePeriod = 30 * time.Second
+
 // Metrics
 var (
 	promDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -96,6 +101,10 @@ var errExitOK = errors.New("exit 0")
 func setup() error {
 	startSetup = time.Now()
 
+	// Keep the secrets that are resolved from the configuration out of the logs.  This has to be the first hook, so that it runs before
+	// the hooks that write log entries out
+	log.AddHook(secrets.RedactHook{})
+
 	// Get current executable name
 	if exePath, err := os.Executable(); err != nil {
 		log.Error("Could not get path of current executable")
@@ -163,6 +172,8 @@ func initFlags() {
 	pflag.StringP("configfile", "c", "", "Specify alternate config file")
 	pflag.Bool("disable-notifications", false, "Do not send admin notifications")
 	pflag.Bool("dont-notify", false, "Same as --disable-notifications")
+	pflag.StringArray("ext-str", []string{}, "Set a jsonnet external variable, as key=value, if the config file is a .jsonnet file.  Can be given more than once")
+	pflag.StringSlice("jpath", []string{}, "Also search this directory for jsonnet imports, if the config file is a .jsonnet file.  Can be given more than once")
 	pflag.Bool("no-loki", false, "Disable sending logs to Loki (should only be used in testing or temporary debugging)")
 	pflag.BoolP("test", "t", false, "Test mode.  Query FERRY, but do not make any database changes")
 	pflag.BoolP("verbose", "v", false, "Turn on verbose mode")
@@ -186,24 +197,13 @@ func disableNotifyFlagWorkaround() {
 	}
 }
 
+// initConfig reads in the configuration
 func initConfig() error {
-	// Get config file
-	configFileName := "managedTokens"
-	// Check for override
-	if config := viper.GetString("configfile"); config != "" {
-		viper.SetConfigFile(config)
-	} else {
-		viper.SetConfigName(configFileName)
-	}
-
-	viper.AddConfigPath("/etc/managed-tokens/")
-	viper.AddConfigPath("$HOME/.managed-tokens/")
-	viper.AddConfigPath(".")
-	if err := viper.ReadInConfig(); err != nil {
-		log.WithField("executable", currentExecutable).Errorf("Error reading in config file: %v", err)
+	if _, err := configLoader.Load(context.Background(), viper.GetViper(), viper.GetString("configfile"), viper.GetStringSlice("jpath"),
+		viper.GetStringSlice("ext-str")); err != nil {
+		log.WithField("executable", currentExecutable).Errorf("Error reading in configuration: %v", err)
 		return err
 	}
-
 	return nil
 }
 
@@ -373,19 +373,28 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), globalTimeout)
 	defer cancel()
 
+	// If we get SIGINT or SIGTERM, cancel the run so that we can still clean up
+	ctx, stop := utils.ContextWithInterruptHandling(ctx)
+	defer stop()
+
 	// Tracing has to be initialized here and not in setup because we need our global context to pass to child spans
 	if tracingShutdown, err := initTracing(ctx); err == nil {
 		defer tracingShutdown(ctx)
 	}
 
+	// Make sure we're the only refresh-uids-from-ferry running
+	lock := acquireRunLockOrExit(ctx)
+	defer lock.Release()
+
 	// Run our actual operation
 	if err := run(ctx); err != nil {
+		lock.Release() // exeLogger.Fatal exits without running the deferred calls
 		exeLogger.Fatal("Error running operations to update database from FERRY.  Exiting")
 	}
 	log.Debug("Finished run")
 }
 
-func run(ctx context.Context) error {
+func run(ctx context.Context) (retErr error) {
 	// Order of operations:
 	// 1. Open database to record FERRY data
 	// 2. Set up admin notification emails
@@ -405,13 +414,8 @@ func run(ctx context.Context) error {
 		exeLogger.Debugf("Notifications disabled by %s", notificationsDisabledBy.String())
 	}
 
-	var dbLocation string
 	// Open connection to the SQLite database where UID info will be stored
-	if viper.IsSet("dbLocation") {
-		dbLocation = viper.GetString("dbLocation")
-	} else {
-		dbLocation = "/var/lib/managed-tokens/uid.db"
-	}
+	dbLocation := getDBLocation()
 	exeLogger.Debugf("Using db file at %s", dbLocation)
 
 	database, err := db.OpenOrCreateDatabase(dbLocation)
@@ -451,15 +455,32 @@ func run(ctx context.Context) error {
 	var adminNotifications []notifications.SendMessager
 
 	if !viper.GetBool("disableNotifications") {
-		admNotMgr, aReceiveChan, adminNotifications = setupAdminNotifications(ctx, database)
+		// The admin notification manager needs to keep running if the run is interrupted, so that we can still send notifications
+		notificationsCtx, notificationsCancel := utils.ContextWithoutInterrupt(ctx, cleanupGracePeriod)
+		admNotMgr, aReceiveChan, adminNotifications = setupAdminNotifications(notificationsCtx, database)
 
 		defer func() {
+			defer notificationsCancel()
 			// We don't check the error here, because we don't want to halt execution if the admin message can't be sent.  Just log it and move on
 			close(aReceiveChan)
-			sendAdminNotifications(ctx, admNotMgr, &adminNotifications)
+			sendAdminNotifications(notificationsCtx, admNotMgr, &adminNotifications)
 		}()
 	}
 
+	// If we were interrupted, let the admins know
+	defer func() {
+		if sig, ok := utils.GetInterruptSignal(ctx); ok {
+			msg := fmt.Sprintf("Run interrupted by signal %s.  The database may not have been updated", sig)
+			if !viper.GetBool("disableNotifications") {
+				sendSetupErrorToAdminMgr(aReceiveChan, msg)
+			}
+			tracing.LogErrorWithTrace(span, exeLogger, msg)
+			if retErr == nil {
+				retErr = errors.New(msg)
+			}
+		}
+	}()
+
 	// Send metrics anytime run() returns
 	defer func() {
 		if prometheusUp {
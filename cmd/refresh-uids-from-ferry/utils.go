@@ -23,6 +23,7 @@ import (
 	"os"
 	"os/user"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -37,6 +38,7 @@ import (
 	"github.com/fermitools/managed-tokens/internal/environment"
 	"github.com/fermitools/managed-tokens/internal/kerberos"
 	"github.com/fermitools/managed-tokens/internal/notifications"
+	"github.com/fermitools/managed-tokens/internal/runLock"
 	"github.com/fermitools/managed-tokens/internal/service"
 	"github.com/fermitools/managed-tokens/internal/tracing"
 	"github.com/fermitools/managed-tokens/internal/utils"
@@ -342,3 +344,42 @@ func getPrometheusJobName() string {
 	}
 	return fmt.Sprintf("%s_%s", jobName, devEnvironmentLabel)
 }
+
+// getDBLocation returns the location of the database file
+func getDBLocation() string {
+	if viper.IsSet("dbLocation") {
+		return viper.GetString("dbLocation")
+	}
+	return "/var/lib/managed-tokens/uid.db"
+}
+
+// acquireRunLockOrExit acquires the run lock, waiting up to runLock.waitTimeout for another instance of refresh-uids-from-ferry to
+// finish.  If another instance is still running after that, it notifies the admins and exits with runLock.ExitCodeLockHeld.
+func acquireRunLockOrExit(ctx context.Context) *runLock.Lock {
+	path := runLock.Path(viper.GetString("runLock.path"), filepath.Dir(getDBLocation()), currentExecutable)
+	return runLock.AcquireOrExit(ctx, path, currentExecutable, viper.GetDuration("runLock.waitTimeout"), getRunLockNotifier())
+}
+
+// getRunLockNotifier returns the runLock.Notifier that sends the run lock notification directly to the admin email and slack
+// channel, or nil if notifications are disabled
+func getRunLockNotifier() runLock.Notifier {
+	if viper.GetBool("disableNotifications") {
+		return nil
+	}
+	var prefix string
+	if viper.GetBool("test") {
+		prefix = "notifications_test."
+	} else {
+		prefix = "notifications."
+	}
+	return runLock.NewNotifier(
+		notifications.NewEmail(
+			viper.GetString("email.from"),
+			viper.GetStringSlice(prefix+"admin_email"),
+			"Managed Tokens: "+currentExecutable+" already running "+time.Now().Format(time.RFC822),
+			viper.GetString("email.smtphost"),
+			viper.GetInt("email.smtpport"),
+		),
+		notifications.NewSlackMessage(viper.GetString(prefix+"slack_alerts_url")),
+	)
+}
@@ -39,29 +39,24 @@ func setupAdminNotifications(ctx context.Context, database *db.ManagedTokensData
 	ctx, span := otel.GetTracerProvider().Tracer("token-push").Start(ctx, "setupAdminNotifications")
 	defer span.End()
 
-	var prefix string
-	if viper.GetBool("test") {
-		prefix = "notifications_test."
-	} else {
-		prefix = "notifications."
-	}
-
+	cfg := getConfigModel()
+	adminNotificationsCfg := cfg.adminNotifications(viper.GetBool("test"))
 	now := time.Now().Format(time.RFC822)
 	email := notifications.NewEmail(
-		viper.GetString("email.from"),
-		viper.GetStringSlice(prefix+"admin_email"),
+		cfg.Email.From,
+		adminNotificationsCfg.AdminEmail,
 		"Managed Tokens Errors "+now,
-		viper.GetString("email.smtphost"),
-		viper.GetInt("email.smtpport"),
+		cfg.Email.SMTPHost,
+		cfg.Email.SMTPPort,
 	)
-	slackMessage := notifications.NewSlackMessage(viper.GetString(prefix + "slack_alerts_url"))
+	slackMessage := notifications.NewSlackMessage(adminNotificationsCfg.SlackAlertsURL)
 	adminNotifications = append(adminNotifications, email, slackMessage)
 
 	// Functional options for AdminNotificationManager
 	funcOpts := make([]notifications.AdminNotificationManagerOption, 0)
 	setNotificationMinimum := func(a *notifications.AdminNotificationManager) error {
 		exeLogger.Debug("Setting AdminNotificationManager NotificationMinimum")
-		a.NotificationMinimum = viper.GetInt("errorCountToSendMessage")
+		a.NotificationMinimum = cfg.ErrorCountToSendMessage
 		return nil
 	}
 	funcOpts = append(funcOpts, setNotificationMinimum)
@@ -0,0 +1,395 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// circuitBreaker.go provides the per-node circuit breakers of token-push.  If pushing a service's vault tokens to a node fails in
+// circuitBreaker.failureThreshold consecutive runs, the circuit breaker for that service and node opens, and later runs skip the node
+// instead of pinging it and retrying the push until they time out.  Once circuitBreaker.cooldown has passed, the next run tries the
+// node again.  If that push succeeds, the circuit breaker closes.  If it fails, the circuit breaker opens again for another cooldown.
+// The state of the circuit breakers is kept in the ManagedTokensDatabase, and can be listed and reset with the circuit-breakers
+// subcommand.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+
+	"github.com/fermitools/managed-tokens/internal/db"
+	"github.com/fermitools/managed-tokens/internal/tracing"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+// circuitBreakersSubcommand is the positional argument that runs the circuit-breakers subcommand
+const circuitBreakersSubcommand = "circuit-breakers"
+
+// defaultCircuitBreakerCooldown is how long a circuit breaker stays open if circuitBreaker.cooldown is not set
+const defaultCircuitBreakerCooldown = 6 * time.Hour
+
+// States of a circuit breaker, as listed by the circuit-breakers subcommand
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// circuitBreakerSettings holds the circuitBreaker section of the configuration
+type circuitBreakerSettings struct {
+	failureThreshold int
+	cooldown         time.Duration
+}
+
+// enabled returns whether circuit breakers are used at all
+func (s circuitBreakerSettings) enabled() bool { return s.failureThreshold > 0 }
+
+// getCircuitBreakerSettings returns the circuit breaker settings from the configuration model.  Circuit breakers are disabled unless
+// circuitBreaker.failureThreshold is set to a positive number.
+func getCircuitBreakerSettings() (circuitBreakerSettings, error) {
+	return getConfigModel().CircuitBreaker.settings()
+}
+
+// nodeCircuitBreakerState implements db.NodeCircuitBreaker
+type nodeCircuitBreakerState struct {
+	service             string
+	node                string
+	consecutiveFailures int
+	opened              time.Time
+	notified            bool
+}
+
+func (n *nodeCircuitBreakerState) Service() string          { return n.service }
+func (n *nodeCircuitBreakerState) Node() string             { return n.node }
+func (n *nodeCircuitBreakerState) ConsecutiveFailures() int { return n.consecutiveFailures }
+func (n *nodeCircuitBreakerState) Opened() time.Time        { return n.opened }
+func (n *nodeCircuitBreakerState) Notified() bool           { return n.notified }
+
+// newNodeCircuitBreakerState copies the db.NodeCircuitBreaker b so that it can be modified
+func newNodeCircuitBreakerState(b db.NodeCircuitBreaker) *nodeCircuitBreakerState {
+	return &nodeCircuitBreakerState{
+		service:             b.Service(),
+		node:                b.Node(),
+		consecutiveFailures: b.ConsecutiveFailures(),
+		opened:              b.Opened(),
+		notified:            b.Notified(),
+	}
+}
+
+// circuitBreakerKey is the key that circuit breakers are looked up by
+type circuitBreakerKey struct {
+	service string
+	node    string
+}
+
+// state returns the state of the circuit breaker b at the time now.  An open circuit breaker whose cooldown has passed is half-open:
+// the next run will try to push to the node again.
+func (s circuitBreakerSettings) state(b db.NodeCircuitBreaker, now time.Time) string {
+	switch {
+	case b.Opened().IsZero():
+		return circuitClosed
+	case now.Before(b.Opened().Add(s.cooldown)):
+		return circuitOpen
+	default:
+		return circuitHalfOpen
+	}
+}
+
+// circuitOpenNotice is the notice that the circuit breaker for a service's node is open, and that the node is skipped
+type circuitOpenNotice struct {
+	service string
+	node    string
+	message string
+}
+
+// skipNodesWithOpenCircuits removes the nodes whose circuit breakers are open at the time now from the nodes of each service config in
+// serviceConfigs.  It returns a notice for each skipped node that no notice was sent for since its circuit breaker opened, and the
+// circuit breakers of those nodes, marked as notified.
+func skipNodesWithOpenCircuits(serviceConfigs map[string]*worker.Config, breakers []db.NodeCircuitBreaker, s circuitBreakerSettings, now time.Time) ([]circuitOpenNotice, []db.NodeCircuitBreaker) {
+	openBreakers := make(map[circuitBreakerKey]db.NodeCircuitBreaker)
+	for _, b := range breakers {
+		if s.state(b, now) == circuitOpen {
+			openBreakers[circuitBreakerKey{b.Service(), b.Node()}] = b
+		}
+	}
+
+	notices := make([]circuitOpenNotice, 0)
+	notified := make([]db.NodeCircuitBreaker, 0)
+	for _, serviceName := range slices.Sorted(maps.Keys(serviceConfigs)) {
+		c := serviceConfigs[serviceName]
+		// The config's nodes can be the slice that viper stores, so don't modify it in place
+		c.Nodes = slices.DeleteFunc(slices.Clone(c.Nodes), func(node string) bool {
+			b, ok := openBreakers[circuitBreakerKey{serviceName, node}]
+			if !ok {
+				return false
+			}
+			until := b.Opened().Add(s.cooldown)
+			exeLogger.WithFields(log.Fields{
+				"service": serviceName,
+				"node":    node,
+				"until":   until.Format(time.RFC3339),
+			}).Warn("Circuit breaker for node is open.  Skipping node")
+			if !b.Notified() {
+				notices = append(notices, circuitOpenNotice{
+					service: serviceName,
+					node:    node,
+					message: fmt.Sprintf(
+						"Circuit open for node %s:  pushing tokens to it failed in %d consecutive runs.  It will be skipped until %s, and no further notices will be sent unless a push to it succeeds and fails again.  Use token-push circuit-breakers reset to try it sooner",
+						node, b.ConsecutiveFailures(), until.Format(time.RFC822),
+					),
+				})
+				state := newNodeCircuitBreakerState(b)
+				state.notified = true
+				notified = append(notified, state)
+			}
+			return true
+		})
+	}
+	return notices, notified
+}
+
+// applyNodeCircuitBreakers skips the nodes of each service config in serviceConfigs whose circuit breakers in database are open, and
+// returns the notices that should be sent for them.  The circuit breakers of the returned notices are marked as notified in database.
+func applyNodeCircuitBreakers(ctx context.Context, database *db.ManagedTokensDatabase, serviceConfigs map[string]*worker.Config, s circuitBreakerSettings) ([]circuitOpenNotice, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("token-push").Start(ctx, "applyNodeCircuitBreakers")
+	defer span.End()
+
+	breakers, err := database.GetNodeCircuitBreakers(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.LogErrorWithTrace(span, exeLogger, "Could not get node circuit breakers from database")
+		return nil, err
+	}
+
+	notices, notified := skipNodesWithOpenCircuits(serviceConfigs, breakers, s, time.Now())
+	if len(notified) > 0 {
+		if err := database.UpdateNodeCircuitBreakersTable(ctx, notified); err != nil {
+			tracing.LogErrorWithTrace(span, exeLogger, "Could not record circuit open notices in database.  They may be sent again")
+			return notices, err
+		}
+	}
+	tracing.LogSuccessWithTrace(span, exeLogger, "Applied node circuit breakers")
+	return notices, nil
+}
+
+// nextNodeCircuitBreakers returns the circuit breakers that change because of nodeResults, given the current circuit breakers.  The
+// first returned slice holds the circuit breakers to record, and the second holds those to reset, since the push to their node
+// succeeded.  A failed push to a node whose circuit breaker is half-open opens it again right away.  Pushes that were canceled, for
+// example because the run was interrupted, say nothing about the node, so they leave its circuit breaker as it is.
+func nextNodeCircuitBreakers(breakers []db.NodeCircuitBreaker, nodeResults []db.NodePushResult, s circuitBreakerSettings, now time.Time) ([]db.NodeCircuitBreaker, []db.NodeCircuitBreaker) {
+	current := make(map[circuitBreakerKey]db.NodeCircuitBreaker, len(breakers))
+	for _, b := range breakers {
+		current[circuitBreakerKey{b.Service(), b.Node()}] = b
+	}
+
+	updated := make([]db.NodeCircuitBreaker, 0)
+	reset := make([]db.NodeCircuitBreaker, 0)
+	for _, r := range nodeResults {
+		if o, ok := r.(*nodePushOutcome); ok && o.errorClass == worker.ErrorClassCanceled {
+			continue
+		}
+		b, ok := current[circuitBreakerKey{r.Service(), r.Node()}]
+		if r.Success() {
+			if ok {
+				reset = append(reset, b)
+			}
+			continue
+		}
+
+		next := &nodeCircuitBreakerState{service: r.Service(), node: r.Node()}
+		if ok {
+			next = newNodeCircuitBreakerState(b)
+		}
+		next.consecutiveFailures++
+		switch {
+		case !next.opened.IsZero():
+			next.opened = now
+		case next.consecutiveFailures >= s.failureThreshold:
+			next.opened = now
+			next.notified = false
+		}
+		updated = append(updated, next)
+	}
+	return updated, reset
+}
+
+// updateNodeCircuitBreakers updates the circuit breakers in database with the results of pushing tokens to each node in the finalized
+// runReport r
+func updateNodeCircuitBreakers(ctx context.Context, database *db.ManagedTokensDatabase, r *runReport, s circuitBreakerSettings) {
+	if database == nil || r == nil {
+		return
+	}
+	ctx, span := otel.GetTracerProvider().Tracer("token-push").Start(ctx, "updateNodeCircuitBreakers")
+	defer span.End()
+
+	breakers, err := database.GetNodeCircuitBreakers(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		tracing.LogErrorWithTrace(span, exeLogger, "Could not get node circuit breakers from database")
+		return
+	}
+
+	_, nodeResults := getRunResultsFromReport(r)
+	now := time.Now()
+	updated, reset := nextNodeCircuitBreakers(breakers, nodeResults, s, now)
+	for _, b := range updated {
+		if b.Opened().Equal(now) {
+			exeLogger.WithFields(log.Fields{
+				"service":             b.Service(),
+				"node":                b.Node(),
+				"consecutiveFailures": b.ConsecutiveFailures(),
+			}).Warn("Opened circuit breaker for node")
+		}
+	}
+	if err := database.UpdateNodeCircuitBreakersTable(ctx, updated); err != nil {
+		tracing.LogErrorWithTrace(span, exeLogger, "Could not update node circuit breakers in database")
+		return
+	}
+	for _, b := range reset {
+		funcLogger := exeLogger.WithFields(log.Fields{"service": b.Service(), "node": b.Node()})
+		if err := database.ResetNodeCircuitBreakers(ctx, b.Service(), b.Node()); err != nil {
+			tracing.LogErrorWithTrace(span, funcLogger, "Could not close circuit breaker for node")
+			continue
+		}
+		funcLogger.Info("Push to node succeeded.  Closed circuit breaker for node")
+	}
+	tracing.LogSuccessWithTrace(span, exeLogger, "Updated node circuit breakers")
+}
+
+// Subcommand
+
+// circuitBreakerListing is a single circuit breaker as listed by the circuit-breakers subcommand
+type circuitBreakerListing struct {
+	Service             string     `json:"service"`
+	Node                string     `json:"node"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Opened              *time.Time `json:"opened,omitempty"`
+	Until               *time.Time `json:"until,omitempty"`
+}
+
+// runCircuitBreakersSubcommand runs the circuit-breakers subcommand given by args, and writes its output to w.  It returns errExitOK if
+// the subcommand succeeded.  The reset subcommand resets the circuit breakers selected by the service and node flags, or all of them
+// if neither is given.
+func runCircuitBreakersSubcommand(ctx context.Context, w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("no circuit-breakers subcommand given.  Supported subcommands: list, reset")
+	}
+	if args[0] != "list" && args[0] != "reset" {
+		return fmt.Errorf("unknown circuit-breakers subcommand %s.  Supported subcommands: list, reset", args[0])
+	}
+	s, err := getCircuitBreakerSettings()
+	if err != nil {
+		return err
+	}
+
+	// We need the circuit breakers recorded by earlier runs, so don't create a new database here
+	dbLocation := getDBLocation()
+	if _, err := os.Stat(dbLocation); err != nil {
+		return fmt.Errorf("could not find database: %w", err)
+	}
+	// Listing the circuit breakers must not modify the database, so only open it read-write (and migrate it) for reset
+	openDatabase := db.OpenOrCreateDatabase
+	if args[0] == "list" {
+		openDatabase = db.OpenDatabaseReadOnly
+	}
+	database, err := openDatabase(dbLocation)
+	if err != nil {
+		return fmt.Errorf("could not open database: %w", err)
+	}
+	defer database.Close()
+
+	breakers, err := database.GetNodeCircuitBreakers(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("could not get circuit breakers from database: %w", err)
+	}
+
+	if args[0] == "list" {
+		if err := writeCircuitBreakers(w, listCircuitBreakers(breakers, s, time.Now()), viper.GetBool("json")); err != nil {
+			return err
+		}
+		return errExitOK
+	}
+
+	serviceName := viper.GetString("service")
+	nodes := viper.GetStringSlice("node")
+	if len(nodes) == 0 {
+		nodes = []string{""}
+	}
+	for _, node := range nodes {
+		if err := database.ResetNodeCircuitBreakers(ctx, serviceName, node); err != nil {
+			return fmt.Errorf("could not reset circuit breakers: %w", err)
+		}
+	}
+	var resetAny bool
+	for _, b := range breakers {
+		if (serviceName == "" || b.Service() == serviceName) && (nodes[0] == "" || slices.Contains(nodes, b.Node())) {
+			fmt.Fprintf(w, "Reset circuit breaker for service %s, node %s\n", b.Service(), b.Node())
+			resetAny = true
+		}
+	}
+	if !resetAny {
+		fmt.Fprintln(w, "No circuit breakers to reset")
+	}
+	return errExitOK
+}
+
+// listCircuitBreakers returns the listing of each circuit breaker in breakers at the time now
+func listCircuitBreakers(breakers []db.NodeCircuitBreaker, s circuitBreakerSettings, now time.Time) []circuitBreakerListing {
+	listings := make([]circuitBreakerListing, 0, len(breakers))
+	for _, b := range breakers {
+		l := circuitBreakerListing{
+			Service:             b.Service(),
+			Node:                b.Node(),
+			State:               s.state(b, now),
+			ConsecutiveFailures: b.ConsecutiveFailures(),
+		}
+		if !b.Opened().IsZero() {
+			opened, until := b.Opened(), b.Opened().Add(s.cooldown)
+			l.Opened, l.Until = &opened, &until
+		}
+		listings = append(listings, l)
+	}
+	return listings
+}
+
+// writeCircuitBreakers writes listings to w, one circuit breaker per line, or as JSON if asJSON is true
+func writeCircuitBreakers(w io.Writer, listings []circuitBreakerListing, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listings)
+	}
+	for _, l := range listings {
+		line := fmt.Sprintf("%s\t%s\tstate=%s\tconsecutiveFailures=%d", l.Service, l.Node, l.State, l.ConsecutiveFailures)
+		if l.Opened != nil {
+			line += fmt.Sprintf("\topened=%s\tuntil=%s", l.Opened.Format(time.RFC3339), l.Until.Format(time.RFC3339))
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
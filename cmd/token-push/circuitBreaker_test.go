@@ -0,0 +1,236 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/db"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+func TestGetCircuitBreakerSettings(t *testing.T) {
+	type testCase struct {
+		description string
+		config      map[string]any
+		expected    circuitBreakerSettings
+		expectErr   bool
+	}
+	testCases := []testCase{
+		{
+			"Not configured",
+			nil,
+			circuitBreakerSettings{cooldown: defaultCircuitBreakerCooldown},
+			false,
+		},
+		{
+			"Threshold and cooldown configured",
+			map[string]any{"circuitBreaker.failureThreshold": 5, "circuitBreaker.cooldown": "12h"},
+			circuitBreakerSettings{failureThreshold: 5, cooldown: 12 * time.Hour},
+			false,
+		},
+		{
+			"Negative threshold",
+			map[string]any{"circuitBreaker.failureThreshold": -1},
+			circuitBreakerSettings{},
+			true,
+		},
+		{
+			"Cooldown can't be parsed",
+			map[string]any{"circuitBreaker.failureThreshold": 5, "circuitBreaker.cooldown": "forever"},
+			circuitBreakerSettings{},
+			true,
+		},
+		{
+			"Cooldown isn't positive",
+			map[string]any{"circuitBreaker.failureThreshold": 5, "circuitBreaker.cooldown": "0s"},
+			circuitBreakerSettings{},
+			true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.description, func(t *testing.T) {
+			viper.Reset()
+			t.Cleanup(func() { viper.Reset() })
+			for key, value := range test.config {
+				viper.Set(key, value)
+			}
+			s, err := getCircuitBreakerSettings()
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, s)
+			assert.Equal(t, test.expected.failureThreshold > 0, s.enabled())
+		})
+	}
+}
+
+func TestCircuitBreakerState(t *testing.T) {
+	s := circuitBreakerSettings{failureThreshold: 3, cooldown: time.Hour}
+	now := time.Unix(100000, 0)
+	assert.Equal(t, circuitClosed, s.state(&nodeCircuitBreakerState{consecutiveFailures: 2}, now))
+	assert.Equal(t, circuitOpen, s.state(&nodeCircuitBreakerState{consecutiveFailures: 3, opened: now.Add(-59 * time.Minute)}, now))
+	assert.Equal(t, circuitHalfOpen, s.state(&nodeCircuitBreakerState{consecutiveFailures: 3, opened: now.Add(-time.Hour)}, now))
+}
+
+// TestSkipNodesWithOpenCircuits checks that only the nodes whose circuit breakers are open for their own service are skipped, and that
+// we only get a notice for the circuit breakers that we haven't sent one for yet
+func TestSkipNodesWithOpenCircuits(t *testing.T) {
+	s := circuitBreakerSettings{failureThreshold: 3, cooldown: time.Hour}
+	now := time.Unix(100000, 0)
+	nodes := []string{"node1", "node2", "node3", "node4"}
+	serviceConfigs := map[string]*worker.Config{
+		"expt1_role1": {Nodes: nodes},
+		"expt2_role1": {Nodes: []string{"node1", "node2"}},
+	}
+	breakers := []db.NodeCircuitBreaker{
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node1", consecutiveFailures: 3, opened: now.Add(-time.Minute)},
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node2", consecutiveFailures: 4, opened: now.Add(-time.Minute), notified: true},
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node3", consecutiveFailures: 2},
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node4", consecutiveFailures: 3, opened: now.Add(-2 * time.Hour), notified: true},
+	}
+
+	notices, notified := skipNodesWithOpenCircuits(serviceConfigs, breakers, s, now)
+	assert.Equal(t, []string{"node3", "node4"}, serviceConfigs["expt1_role1"].Nodes)
+	assert.Equal(t, []string{"node1", "node2"}, serviceConfigs["expt2_role1"].Nodes)
+	assert.Equal(t, []string{"node1", "node2", "node3", "node4"}, nodes)
+	if assert.Len(t, notices, 1) {
+		assert.Equal(t, "expt1_role1", notices[0].service)
+		assert.Equal(t, "node1", notices[0].node)
+		assert.Contains(t, notices[0].message, "Circuit open for node node1")
+	}
+	assert.Equal(t,
+		[]db.NodeCircuitBreaker{
+			&nodeCircuitBreakerState{service: "expt1_role1", node: "node1", consecutiveFailures: 3, opened: now.Add(-time.Minute), notified: true},
+		},
+		notified,
+	)
+}
+
+func TestNextNodeCircuitBreakers(t *testing.T) {
+	s := circuitBreakerSettings{failureThreshold: 3, cooldown: time.Hour}
+	now := time.Unix(100000, 0)
+	opened := now.Add(-2 * time.Hour)
+	breakers := []db.NodeCircuitBreaker{
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node1", consecutiveFailures: 1},
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node2", consecutiveFailures: 2},
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node3", consecutiveFailures: 3, opened: opened, notified: true},
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node4", consecutiveFailures: 5, opened: opened, notified: true},
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node7", consecutiveFailures: 2},
+	}
+	nodeResults := []db.NodePushResult{
+		&nodePushOutcome{service: "expt1_role1", node: "node1", success: true},
+		&nodePushOutcome{service: "expt1_role1", node: "node2", success: false},
+		&nodePushOutcome{service: "expt1_role1", node: "node3", success: false},
+		&nodePushOutcome{service: "expt1_role1", node: "node4", success: true},
+		&nodePushOutcome{service: "expt1_role1", node: "node5", success: true},
+		&nodePushOutcome{service: "expt1_role1", node: "node6", success: false},
+		// Canceled pushes, like those of an interrupted run, don't count against the node
+		&nodePushOutcome{service: "expt1_role1", node: "node7", success: false, errorClass: worker.ErrorClassCanceled},
+		&nodePushOutcome{service: "expt1_role1", node: "node8", success: false, errorClass: worker.ErrorClassCanceled},
+	}
+
+	updated, reset := nextNodeCircuitBreakers(breakers, nodeResults, s, now)
+	assert.Equal(t,
+		[]db.NodeCircuitBreaker{
+			// Reached the threshold, so the circuit breaker opens
+			&nodeCircuitBreakerState{service: "expt1_role1", node: "node2", consecutiveFailures: 3, opened: now},
+			// Half-open probe failed, so the circuit breaker opens again without another notice
+			&nodeCircuitBreakerState{service: "expt1_role1", node: "node3", consecutiveFailures: 4, opened: now, notified: true},
+			// First failure
+			&nodeCircuitBreakerState{service: "expt1_role1", node: "node6", consecutiveFailures: 1},
+		},
+		updated,
+	)
+	assert.Equal(t, []db.NodeCircuitBreaker{breakers[0], breakers[3]}, reset)
+}
+
+// TestRunCircuitBreakersSubcommand checks that the circuit-breakers subcommand lists the circuit breakers recorded in the database, and
+// resets the ones selected by the service and node flags
+func TestRunCircuitBreakersSubcommand(t *testing.T) {
+	ctx := context.Background()
+	viper.Reset()
+	t.Cleanup(func() { viper.Reset() })
+	oldConfigModel := configModel
+	configModel = nil
+	t.Cleanup(func() { configModel = oldConfigModel })
+
+	dbLocation := path.Join(t.TempDir(), "managed-tokens.db")
+	viper.Set("dbLocation", dbLocation)
+	viper.Set("circuitBreaker.failureThreshold", 3)
+	viper.Set("circuitBreaker.cooldown", "1h")
+
+	var b bytes.Buffer
+	assert.Error(t, runCircuitBreakersSubcommand(ctx, &b, []string{"list"}), "Database does not exist")
+
+	database, err := db.OpenOrCreateDatabase(dbLocation)
+	if err != nil {
+		t.Fatalf("Could not create new database, %s", err)
+	}
+	assert.NoError(t, database.UpdateServices(ctx, []string{"expt1_role1", "expt2_role1"}))
+	assert.NoError(t, database.UpdateNodes(ctx, []string{"node1", "node2"}))
+	opened := time.Now().Add(-time.Minute).Truncate(time.Second)
+	assert.NoError(t, database.UpdateNodeCircuitBreakersTable(ctx, []db.NodeCircuitBreaker{
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node1", consecutiveFailures: 3, opened: opened},
+		&nodeCircuitBreakerState{service: "expt1_role1", node: "node2", consecutiveFailures: 1},
+		&nodeCircuitBreakerState{service: "expt2_role1", node: "node1", consecutiveFailures: 2},
+	}))
+	database.Close()
+
+	assert.Error(t, runCircuitBreakersSubcommand(ctx, &b, nil))
+	assert.Error(t, runCircuitBreakersSubcommand(ctx, &b, []string{"open"}))
+
+	assert.ErrorIs(t, runCircuitBreakersSubcommand(ctx, &b, []string{"list"}), errExitOK)
+	assert.Equal(t,
+		"expt1_role1\tnode1\tstate=open\tconsecutiveFailures=3\topened="+opened.Format(time.RFC3339)+"\tuntil="+opened.Add(time.Hour).Format(time.RFC3339)+"\n"+
+			"expt1_role1\tnode2\tstate=closed\tconsecutiveFailures=1\n"+
+			"expt2_role1\tnode1\tstate=closed\tconsecutiveFailures=2\n",
+		b.String(),
+	)
+
+	b.Reset()
+	viper.Set("json", true)
+	assert.ErrorIs(t, runCircuitBreakersSubcommand(ctx, &b, []string{"list"}), errExitOK)
+	assert.Contains(t, b.String(), `"state": "open"`)
+	viper.Set("json", false)
+
+	b.Reset()
+	viper.Set("node", []string{"node1"})
+	assert.ErrorIs(t, runCircuitBreakersSubcommand(ctx, &b, []string{"reset"}), errExitOK)
+	assert.Equal(t,
+		"Reset circuit breaker for service expt1_role1, node node1\nReset circuit breaker for service expt2_role1, node node1\n",
+		b.String(),
+	)
+
+	b.Reset()
+	viper.Set("service", "expt2_role1")
+	viper.Set("node", []string{})
+	assert.ErrorIs(t, runCircuitBreakersSubcommand(ctx, &b, []string{"reset"}), errExitOK)
+	assert.Equal(t, "No circuit breakers to reset\n", b.String())
+
+	b.Reset()
+	assert.ErrorIs(t, runCircuitBreakersSubcommand(ctx, &b, []string{"list"}), errExitOK)
+	assert.Equal(t, "expt1_role1\tnode2\tstate=closed\tconsecutiveFailures=1\n", b.String())
+}
@@ -22,6 +22,8 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"maps"
+	"math"
 	"os"
 	"os/exec"
 	"path"
@@ -50,6 +52,7 @@ var (
 
 func init() {
 	globalScheddCache.cache = make(map[string]*scheddCacheEntry)
+	globalScheddCache.createdAt = make(map[string]time.Time)
 	globalScheddCache.mu = &sync.Mutex{}
 }
 
@@ -57,16 +60,18 @@ func init() {
 
 // getUserPrincipalFromConfiguration gets the configured kerberos principal
 func getUserPrincipalFromConfiguration(configPath string) string {
-	if userPrincipalOverrideConfigPath, ok := getConfigOverridePath(configPath, "userPrincipal"); ok {
-		return viper.GetString(userPrincipalOverrideConfigPath)
+	cfg := getConfigModel()
+	overrides := cfg.overridesAt(configPath)
+	if overrides.UserPrincipalOverride != nil {
+		return *overrides.UserPrincipalOverride
 	} else {
-		kerberosPrincipalPattern, _ := getConfigOverridePath(configPath, "kerberosPrincipalPattern")
-		userPrincipalTemplate, err := template.New("userPrincipal").Parse(viper.GetString(kerberosPrincipalPattern))
+		kerberosPrincipalPattern := overrideOr(overrides.KerberosPrincipalPatternOverride, cfg.KerberosPrincipalPattern)
+		userPrincipalTemplate, err := template.New("userPrincipal").Parse(kerberosPrincipalPattern)
 		if err != nil {
 			log.Errorf("Error parsing Kerberos Principal Template, %s", err)
 			return ""
 		}
-		account := viper.GetString(configPath + ".account")
+		account := cfg.roleAt(configPath).Account
 		templateArgs := struct{ Account string }{Account: account}
 
 		var b strings.Builder
@@ -134,28 +139,24 @@ func resolveHtgettokenOptsFromConfig(credKey string) string {
 	return htgettokenOpts
 }
 
-// getTokenLifetimeStringFromConfiguration checks the configuration for the "minTokenLifetime" key.  If it is set, the value is returned.  Otherwise,
-// a default is returned.
+// getTokenLifetimeStringFromConfiguration returns the configured minTokenLifetime, or its default if it is not configured
 func getTokenLifetimeStringFromConfiguration() string {
-	defaultLifetimeString := "10s"
-	if viper.IsSet("minTokenLifetime") {
-		return viper.GetString("minTokenLifetime")
-	}
-	return defaultLifetimeString
+	return getConfigModel().MinTokenLifetime
 }
 
 // getKeytabFromConfiguration checks the configuration at the configPath for an override for the path to the kerberos keytab.
 // If the override does not exist, it uses the configuration to calculate the default path to the keytab
 func getKeytabFromConfiguration(configPath string) string {
-	if keytabConfigPath, ok := getConfigOverridePath(configPath, "keytabPath"); ok {
-		return viper.GetString(keytabConfigPath)
+	cfg := getConfigModel()
+	if keytabPathOverride := cfg.overridesAt(configPath).KeytabPathOverride; keytabPathOverride != nil {
+		return *keytabPathOverride
 	} else {
 		// Default keytab location
 		return path.Join(
-			viper.GetString(keytabConfigPath),
+			cfg.KeytabPath,
 			fmt.Sprintf(
 				"%s.keytab",
-				viper.GetString(configPath+".account"),
+				cfg.roleAt(configPath).Account,
 			),
 		)
 	}
@@ -210,6 +211,7 @@ func getScheddsAndCollectorHostFromConfiguration(ctx context.Context, configPath
 				nil,
 			}
 			globalScheddCache.cache[collectorHostEntry] = cacheEntry
+			globalScheddCache.createdAt[collectorHostEntry] = time.Now()
 		}
 
 		// Now that we have our *scheddCacheEntry (either new or preexisting), if its *sync.Once has not been run, do so now to populate the entry.
@@ -263,16 +265,16 @@ func getScheddsAndCollectorHostFromConfiguration(ctx context.Context, configPath
 // It is preferred to use getScheddsAndCollectorHostFromConfiguration to get the collector host, as it will also populate the schedd cache
 // and handle failovers
 func getCondorCollectorHostFromConfiguration(configPath string) string {
-	condorCollectorHostPath, _ := getConfigOverridePath(configPath, "condorCollectorHost")
-	return viper.GetString(condorCollectorHostPath)
+	cfg := getConfigModel()
+	return overrideOr(cfg.overridesAt(configPath).CondorCollectorHostOverride, cfg.CondorCollectorHost)
 }
 
 // checkScheddsOverride checks the global and service-level configurations for the condorCreddHost key.  If that key exists, the value
 // is returned, along with a bool indicating that the key was found in the configuration.
 func checkScheddsOverride(configPath string) (schedds []string, found bool) {
-	creddOverrideVar, _ := getConfigOverridePath(configPath, "condorCreddHost")
-	if viper.IsSet(creddOverrideVar) {
-		schedds = append(schedds, viper.GetString(creddOverrideVar))
+	cfg := getConfigModel()
+	if creddHost := overrideOr(cfg.overridesAt(configPath).CondorCreddHostOverride, cfg.CondorCreddHost); creddHost != "" {
+		schedds = append(schedds, creddHost)
 		log.WithFields(log.Fields{
 			"configPath": configPath,
 			"schedds":    schedds,
@@ -285,10 +287,9 @@ func checkScheddsOverride(configPath string) (schedds []string, found bool) {
 // getConstraintFromConfiguration checks the configuration at the configPath for an override for the path to a condor constraint
 // If the override does not exist, it returns the globally-configured condor constraint.
 func getConstraintFromConfiguration(configPath string) string {
-	var constraint string
-	constraintKey, _ := getConfigOverridePath(configPath, "condorScheddConstraint")
-	if viper.IsSet(constraintKey) {
-		constraint = viper.GetString(constraintKey)
+	cfg := getConfigModel()
+	constraint := overrideOr(cfg.overridesAt(configPath).CondorScheddConstraintOverride, cfg.CondorScheddConstraint)
+	if constraint != "" {
 		log.WithField("constraint", constraint).Debug("Found constraint for condor collector query (condor_status)")
 	}
 	return constraint
@@ -307,8 +308,9 @@ func getVaultServer(configPath string) (string, error) {
 	}
 
 	// Check config
-	if vaultServerConfigKey, _ := getConfigOverridePath(configPath, "vaultServer"); viper.IsSet(vaultServerConfigKey) {
-		return viper.GetString(vaultServerConfigKey), nil
+	cfg := getConfigModel()
+	if vaultServer := overrideOr(cfg.overridesAt(configPath).VaultServerOverride, cfg.VaultServer); vaultServer != "" {
+		return vaultServer, nil
 	}
 
 	// Then check condor
@@ -340,15 +342,22 @@ func getSecCredentialGettokenOptsFromCondor() (string, error) {
 // where the condorVaultStorer worker should look for and store service/credd-specific vault tokens.  If the override does not exist,
 // it uses the configuration to calculate the default path to the relevant directory
 func getServiceCreddVaultTokenPathRoot(configPath string) string {
-	serviceCreddVaultTokenPathRootPath, _ := getConfigOverridePath(configPath, "serviceCreddVaultTokenPathRoot")
-	return viper.GetString(serviceCreddVaultTokenPathRootPath)
+	cfg := getConfigModel()
+	return overrideOr(cfg.overridesAt(configPath).ServiceCreddVaultTokenPathRootOverride, cfg.ServiceCreddVaultTokenPathRoot)
+}
+
+// getServiceTagsFromConfiguration returns the sorted, de-duplicated tags configured for the service at serviceConfigPath
+func getServiceTagsFromConfiguration(serviceConfigPath string) []string {
+	tags := slices.Clone(getConfigModel().roleAt(serviceConfigPath).Tags)
+	slices.Sort(tags)
+	return slices.Compact(tags)
 }
 
 // getFileCopierOptionsFromConfig gets the fileCopierOptions from the configuration.  If fileCopierOptions
 // is overridden at the service configuration level, then the global configuration value is ignored.
 func getFileCopierOptionsFromConfig(configPath string) []string {
-	fileCopierOptsPath, _ := getConfigOverridePath(configPath, "fileCopierOptions")
-	fileCopierOptsString := viper.GetString(fileCopierOptsPath)
+	cfg := getConfigModel()
+	fileCopierOptsString := overrideOr(cfg.overridesAt(configPath).FileCopierOptionsOverride, cfg.FileCopierOptions)
 	fileCopierOpts, _ := shlex.Split(fileCopierOptsString)
 	return fileCopierOpts
 }
@@ -357,8 +366,8 @@ func getFileCopierOptionsFromConfig(configPath string) []string {
 // extra args to pass to the ping worker.  If the override does not exist,
 // it uses the configuration to calculate the default path to the relevant directory
 func getPingOptsFromConfig(configPath string) []string {
-	pingOptsPath, _ := getConfigOverridePath(configPath, "pingOptions")
-	pingOptsString := viper.GetString(pingOptsPath)
+	cfg := getConfigModel()
+	pingOptsString := overrideOr(cfg.overridesAt(configPath).PingOptionsOverride, cfg.PingOptions)
 	pingOpts, _ := shlex.Split(pingOptsString)
 	return pingOpts
 }
@@ -367,32 +376,69 @@ func getPingOptsFromConfig(configPath string) []string {
 // extra args to pass to the fileCopier worker.  If the override does not exist,
 // it uses the configuration to calculate the default path to the relevant directory
 func getSSHOptsFromConfig(configPath string) []string {
-	sshOptsPath, _ := getConfigOverridePath(configPath, "sshOptions")
-	sshOptsString := viper.GetString(sshOptsPath)
+	cfg := getConfigModel()
+	sshOptsString := overrideOr(cfg.overridesAt(configPath).SSHOptionsOverride, cfg.SSHOptions)
 	sshOpts, _ := shlex.Split(sshOptsString)
 	return sshOpts
 }
 
+// getNodeOptionsFromConfiguration returns the settings of each destination node of the service at serviceConfigPath that has settings
+// of its own, keyed by node
+func getNodeOptionsFromConfiguration(serviceConfigPath string) map[string]worker.NodeOptions {
+	nodeOptions := make(map[string]worker.NodeOptions)
+	for _, d := range getConfigModel().roleAt(serviceConfigPath).DestinationNodes {
+		if !d.hasNodeOptions() {
+			continue
+		}
+		sshOpts, _ := shlex.Split(d.SSHOptions)
+		fileCopierOpts, _ := shlex.Split(d.FileCopierOptions)
+		pingOpts, _ := shlex.Split(d.PingOptions)
+		nodeOptions[d.Node] = worker.NodeOptions{
+			Account:           d.Account,
+			Port:              d.Port,
+			JumpHost:          d.JumpHost,
+			SSHOptions:        sshOpts,
+			FileCopierOptions: fileCopierOpts,
+			PingOptions:       pingOpts,
+		}
+	}
+	return nodeOptions
+}
+
 // getDefaultRoleFileDestinationTemplate gets the template that the pushTokenWorker should use when
 // deriving the default role file path on the destination node.
 func getDefaultRoleFileDestinationTemplate(configPath string) string {
-	defaultRoleFileDestinationTmplPath, _ := getConfigOverridePath(configPath, "defaultRoleFileDestinationTemplate")
-	if !viper.IsSet(defaultRoleFileDestinationTmplPath) {
-		return "/tmp/default_role_{{.Experiment}}_{{.DesiredUID}}" // Default role file destination template
+	cfg := getConfigModel()
+	return overrideOr(cfg.overridesAt(configPath).DefaultRoleFileDestinationTemplateOverride, cfg.DefaultRoleFileDestinationTemplate)
+}
+
+// getTokenDestinationsFromConfig gets the destinations on each destination node that the vault token for the service at configPath
+// should be pushed to.  If tokenDestinations is overridden for the role or its experiment, the global tokenDestinations are ignored.
+// If no destinations are configured, the worker package's defaults are used.
+func getTokenDestinationsFromConfig(configPath string) []worker.TokenDestination {
+	cfg := getConfigModel()
+	configured := overrideOr(cfg.overridesAt(configPath).TokenDestinationsOverride, cfg.TokenDestinations)
+	if len(configured) == 0 {
+		return worker.DefaultTokenDestinations()
+	}
+	tokenDestinations := make([]worker.TokenDestination, 0, len(configured))
+	for _, d := range configured {
+		tokenDestinations = append(tokenDestinations, worker.TokenDestination{Template: d.Path, Optional: d.Optional})
 	}
-	return viper.GetString(defaultRoleFileDestinationTmplPath)
+	return tokenDestinations
 }
 
 // getTokenGetterOverrideFromConfiguration checks the configuration for an overridden tokenGetter worker.WorkerType.
-// If the override key "<configPath>.tokenGetterOverride" exists, the function validates the value, and returns
+// If tokenGetterOverride is set for the role at configPath or its experiment, the function validates the value, and returns
 // the corresponding WorkerType. If validation fails, or the override key is not set in the configuration,
 // the default of worker.StoreAndGetToken is returned.
 func getTokenGetterOverrideFromConfiguration(configPath string) worker.WorkerType {
 	_default := worker.StoreAndGetToken // If validation fails or if we did not override the TokenGetter in the configuration, use worker.StoreAndGetToken
 
-	if tokenGetterOverridePath, overridden := getConfigOverridePath(configPath, "tokenGetter"); overridden {
+	if tokenGetterOverride := getConfigModel().overridesAt(configPath).TokenGetterOverride; tokenGetterOverride != nil {
+		tokenGetterOverridePath, _ := getConfigOverridePath(configPath, "tokenGetter")
 		// Check the configuration value against the possible valid worker type configuration strings
-		overrideValue := viper.GetString(tokenGetterOverridePath)
+		overrideValue := *tokenGetterOverride
 		overrideWorkerType, ok := workerTypeFromConfig(overrideValue)
 		if !ok {
 			log.Errorf("Invalid tokenGetter override value %s found in configuration at %s. Using default", overrideValue, tokenGetterOverridePath)
@@ -417,14 +463,14 @@ func getTokenGetterOverrideFromConfiguration(configPath string) worker.WorkerTyp
 // and a slice of strings containing the names of services for which notifications should be disabled.
 func resolveDisableNotifications(services []service.Service) (bool, []string) {
 	serviceNotificationsToDisable := make([]string, 0, len(services))
-	globalDisableNotifications := viper.GetBool("disableNotifications")
+	cfg := getConfigModel()
+	globalDisableNotifications := cfg.DisableNotifications
 	finalDisableAdminNotifications := globalDisableNotifications
 
 	// Check each service's override
 	for _, s := range services {
 		serviceConfigPath := "experiments." + s.Experiment() + ".roles." + s.Role()
-		disableNotificationsPath, _ := getConfigOverridePath(serviceConfigPath, "disableNotifications")
-		serviceDisableNotifications := viper.GetBool(disableNotificationsPath)
+		serviceDisableNotifications := overrideOr(cfg.overridesAt(serviceConfigPath).DisableNotificationsOverride, globalDisableNotifications)
 
 		// If global setting is to disable notifications (true), but any one of the experiments wants to have notifications sent (false),
 		// we need to send admin notifications for that service too, so override the global setting
@@ -443,18 +489,33 @@ func resolveDisableNotifications(services []service.Service) (bool, []string) {
 
 // Utility functions
 
-// getConfigOverridePath checks to see if key + "Override" is defined at the checkConfigPath in the configuration.
-// If so, the full configuration path is returned, and the overridden bool is set to true.
+// getConfigOverridePath checks to see if key + "Override" is defined at the checkConfigPath in the configuration.  If checkConfigPath is
+// the path of a role, the role's experiment is checked as well.  If either is set, the full configuration path of the most specific one
+// is returned, and the overridden bool is set to true.
 // If not, the original key is returned, and the overridden bool is set to false
 func getConfigOverridePath(checkConfigPath, key string) (configPath string, overridden bool) {
 	configPath = key
-	overrideConfigPath := checkConfigPath + "." + key + "Override"
-	if viper.IsSet(overrideConfigPath) {
-		return overrideConfigPath, true
+	checkConfigPaths := []string{checkConfigPath}
+	if experiment, _, ok := parseServiceConfigPath(checkConfigPath); ok {
+		checkConfigPaths = append(checkConfigPaths, "experiments."+experiment)
+	}
+	for _, p := range checkConfigPaths {
+		overrideConfigPath := p + "." + key + "Override"
+		if viper.IsSet(overrideConfigPath) {
+			return overrideConfigPath, true
+		}
 	}
 	return
 }
 
+// overrideOr returns the value of a role- or experiment-level override if it is set in the configuration, and value otherwise
+func overrideOr[T any](override *T, value T) T {
+	if override != nil {
+		return *override
+	}
+	return value
+}
+
 // parseVaultServerFromEnvSetting takes an environment setting meant for htgettoken to parse (for example "-a vaultserver.domain"),
 // and returns the vaultServer from that setting (in the above example, "vaultserver.domain", nil would be returned)
 func parseVaultServerFromEnvSetting(envSetting string) (string, error) {
@@ -481,44 +542,88 @@ func parseVaultServerFromEnvSetting(envSetting string) (string, error) {
 	return *vaultServerPtr, nil
 }
 
-// createWorkerRetryMap creates a map of worker.WorkerTypes to their retry configuration.
-// It validates each set of retry count/sleep duration values against the total
-// configured timeout for that WorkerType before adding them to the map.
-func createWorkerRetryMap(timeoutsMap map[timeoutKey]time.Duration) (map[worker.WorkerType]workerRetryConfig, error) {
+// createWorkerRetryMap creates a map of worker.WorkerTypes to their retry configuration for the service at serviceConfigPath, or the
+// global retry configuration if serviceConfigPath is empty.  It validates each set of retry count/sleep duration values against the
+// timeout in timeoutsMap that the retries of that WorkerType have to fit within before adding them to the map.
+func createWorkerRetryMap(serviceConfigPath string, timeoutsMap map[timeoutKey]time.Duration) (map[worker.WorkerType]workerRetryConfig, error) {
 	workerRetryMap := make(map[worker.WorkerType]workerRetryConfig)
 
-	_retryArgs := []struct {
-		worker.WorkerType
+	for _, wt := range validWorkerTypes {
 		// The timeout that we should be validating before using it
-		checkTimeout time.Duration
-	}{
-		{worker.GetKerberosTickets, timeoutsMap[timeoutKerberos]},
-		{worker.GetToken, timeoutsMap[timeoutVaultStorer]},
-		{worker.StoreAndGetToken, timeoutsMap[timeoutVaultStorer]},
-		{worker.PingAggregator, timeoutsMap[timeoutPing]},
-		{worker.PushTokens, timeoutsMap[timeoutPush]},
-	}
-	for _, retryArg := range _retryArgs {
-		numRetries, retrySleep, err := getAndCheckRetryInfoFromConfig(retryArg.WorkerType, retryArg.checkTimeout)
+		key := retryTimeoutKeyForWorkerType(wt)
+		numRetries, retrySleep, err := getAndCheckRetryInfoFromConfig(serviceConfigPath, wt, timeoutsMap[key])
 		if err != nil {
-			msg := fmt.Sprintf("invalid timeout %s: %s", workerTypeToConfigString(retryArg.WorkerType), err.Error())
+			msg := fmt.Sprintf("invalid timeout %s: %s", workerTypeToConfigString(wt), err.Error())
 			return nil, errors.New(msg)
 		}
-		workerRetryMap[retryArg.WorkerType] = workerRetryConfig{
+		// getAndCheckRetryInfoFromConfig has already checked the backoff settings
+		backoff, _ := getRetryBackoffFromConfig(serviceConfigPath, wt)
+		workerRetryMap[wt] = workerRetryConfig{
 			numRetries: uint(numRetries),
 			retrySleep: retrySleep,
+			backoff:    backoff,
 		}
 	}
 	return workerRetryMap, nil
 }
 
-func checkRetryTimeout(numRetries int, retrySleepDuration time.Duration, timeout time.Duration) error {
-	if timeout < time.Duration(numRetries)*retrySleepDuration {
-		return fmt.Errorf("timeout (%s) is less than numRetries*retrySleepDuration (%s)", timeout, time.Duration(numRetries)*retrySleepDuration)
+// getConcurrencyLimitsFromConfiguration reads the limits on how many operations the workers can run at once from the workerType
+// section of the configuration.  workerType.maxChildProcesses limits the number of operations across all workers,
+// workerType.maxConcurrencyPerNode limits the number of operations against any single destination node, and
+// workerType.<workerType>.maxConcurrency limits the number of operations for that worker type.  Unset limits mean no limit.
+func getConcurrencyLimitsFromConfiguration() worker.ConcurrencyLimits {
+	workerTypeConfig := getConfigModel().WorkerType
+	limits := worker.ConcurrencyLimits{
+		Global:        workerTypeConfig.MaxChildProcesses,
+		PerNode:       workerTypeConfig.MaxConcurrencyPerNode,
+		PerWorkerType: make(map[worker.WorkerType]int),
+	}
+	for _, wt := range validWorkerTypes {
+		if limit := workerTypeConfig.forWorkerType(wt).MaxConcurrency; limit != 0 {
+			limits.PerWorkerType[wt] = limit
+		}
+	}
+	return limits
+}
+
+// retryTimeoutKeyForWorkerType returns the key of the timeout that all of the retries of the worker type wt have to fit within.  The
+// kerberos and vault token workers give each attempt the whole timeout of their step, so their retries only have to fit within the
+// global timeout.
+func retryTimeoutKeyForWorkerType(wt worker.WorkerType) timeoutKey {
+	switch wt {
+	case worker.GetKerberosTickets, worker.GetToken, worker.StoreAndGetToken:
+		return timeoutGlobal
+	default:
+		key, _ := timeoutKeyForWorkerType(wt)
+		return key
+	}
+}
+
+// checkRetryTimeout checks that timeout is at least the longest total time that numRetries retries could sleep, given the sleep
+// before the first retry, retrySleepDuration, and the backoff settings
+func checkRetryTimeout(numRetries int, retrySleepDuration time.Duration, backoff retryBackoffConfig, timeout time.Duration) error {
+	if maxSleep := backoff.maxTotalSleep(numRetries, retrySleepDuration); timeout < maxSleep {
+		return fmt.Errorf("timeout (%s) is less than the longest time the retries could sleep (%s)", timeout, maxSleep)
 	}
 	return nil
 }
 
+// maxTotalSleep returns the longest total time that numRetries retries could sleep if the first one sleeps for retrySleep, and each
+// one after it sleeps b.multiplier times as long as the one before it, before the jitter is applied.  It is capped at b.maxElapsedTime
+// if that is set.
+func (b retryBackoffConfig) maxTotalSleep(numRetries int, retrySleep time.Duration) time.Duration {
+	var total float64
+	sleep := float64(retrySleep) * (1 + b.jitter)
+	for range numRetries {
+		total += sleep
+		sleep *= max(b.multiplier, 1)
+	}
+	if b.maxElapsedTime > 0 {
+		total = min(total, float64(b.maxElapsedTime))
+	}
+	return time.Duration(min(total, float64(math.MaxInt64)))
+}
+
 func setDefaultWorkerRetryMap() map[worker.WorkerType]workerRetryConfig {
 	m := make(map[worker.WorkerType]workerRetryConfig)
 	validRetryWorkerTypes := slices.Collect(worker.ValidRetryWorkerTypes())
@@ -535,15 +640,150 @@ func setDefaultWorkerRetryMap() map[worker.WorkerType]workerRetryConfig {
 	return m
 }
 
-// getAndCheckRetryInfoFromConfig gets the number of retries and the sleep time between retries from the configuration
-// for a particular worker type key in the configuration.  It then checks that the retry timeout is less than the
-// given duration.
-func getAndCheckRetryInfoFromConfig(wt worker.WorkerType, checkTimeout time.Duration) (numRetries int, retrySleep time.Duration, err error) {
-	numRetries = getWorkerConfigInteger[int](wt, "numRetries")
-	retrySleep = getWorkerConfigTimeDuration(wt, "retrySleep")
-	if err := checkRetryTimeout(numRetries, retrySleep, checkTimeout); err != nil {
+// getAndCheckRetryInfoFromConfig gets the number of retries and the sleep time before the first retry from the configuration
+// for a particular worker type key in the configuration.  If serviceConfigPath is not empty, any workerTypeOverride set for that role
+// or its experiment takes precedence.  It then checks that the longest time the retries could sleep, given the backoff settings, is
+// less than the given duration.
+func getAndCheckRetryInfoFromConfig(serviceConfigPath string, wt worker.WorkerType, checkTimeout time.Duration) (numRetries int, retrySleep time.Duration, err error) {
+	settings := getConfigModel().WorkerType.forWorkerType(wt)
+	numRetries = settings.NumRetries
+	if retrySleep, err = parseOptionalDuration(settings.RetrySleep); err != nil {
+		return 0, 0, fmt.Errorf("could not parse retrySleep: %w", err)
+	}
+	if override, ok := getWorkerRetryOverrides(serviceConfigPath, wt); ok {
+		if override.NumRetries != nil {
+			numRetries = *override.NumRetries
+		}
+		if override.RetrySleep != nil {
+			if retrySleep, err = time.ParseDuration(*override.RetrySleep); err != nil {
+				return 0, 0, fmt.Errorf("could not parse retrySleep override: %w", err)
+			}
+		}
+	}
+	if numRetries < 0 {
+		return 0, 0, errors.New("numRetries cannot be negative")
+	}
+	backoff, err := getRetryBackoffFromConfig(serviceConfigPath, wt)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := checkRetryTimeout(numRetries, retrySleep, backoff, checkTimeout); err != nil {
 		msg := "timeout is less than the time it would take to retry all attempts.  Will stop now"
 		return 0, 0, errors.New(msg)
 	}
 	return numRetries, retrySleep, nil
 }
+
+// getRetryBackoffFromConfig gets the backoff settings for the retries of a particular worker type from the configuration.  If
+// serviceConfigPath is not empty, any workerTypeOverride set for that role or its experiment takes precedence.  Unset settings are
+// left as zero, which means a fixed sleep between retries with no limit on the total time other than the timeout.
+func getRetryBackoffFromConfig(serviceConfigPath string, wt worker.WorkerType) (retryBackoffConfig, error) {
+	settings := getConfigModel().WorkerType.forWorkerType(wt)
+	maxElapsedTime, err := parseOptionalDuration(settings.MaxElapsedTime)
+	if err != nil {
+		return retryBackoffConfig{}, fmt.Errorf("could not parse maxElapsedTime: %w", err)
+	}
+	backoff := retryBackoffConfig{
+		multiplier:     settings.BackoffMultiplier,
+		jitter:         settings.Jitter,
+		maxElapsedTime: maxElapsedTime,
+	}
+	if override, ok := getWorkerRetryOverrides(serviceConfigPath, wt); ok {
+		backoff.multiplier = overrideOr(override.BackoffMultiplier, backoff.multiplier)
+		backoff.jitter = overrideOr(override.Jitter, backoff.jitter)
+		if override.MaxElapsedTime != nil {
+			if backoff.maxElapsedTime, err = time.ParseDuration(*override.MaxElapsedTime); err != nil {
+				return retryBackoffConfig{}, fmt.Errorf("could not parse maxElapsedTime override: %w", err)
+			}
+		}
+	}
+	if backoff.multiplier != 0 && backoff.multiplier < 1 {
+		return retryBackoffConfig{}, errors.New("backoffMultiplier cannot be less than 1")
+	}
+	if backoff.jitter < 0 || backoff.jitter > 1 {
+		return retryBackoffConfig{}, errors.New("jitter must be between 0 and 1")
+	}
+	if backoff.maxElapsedTime < 0 {
+		return retryBackoffConfig{}, errors.New("maxElapsedTime cannot be negative")
+	}
+	return backoff, nil
+}
+
+// getWorkerRetryOverrides returns the workerTypeOverride settings for the worker type wt that apply to the role at serviceConfigPath.
+// viper lower-cases the keys it reads in, so the worker types are matched case-insensitively.
+func getWorkerRetryOverrides(serviceConfigPath string, wt worker.WorkerType) (workerRetryOverrides, bool) {
+	if serviceConfigPath == "" {
+		return workerRetryOverrides{}, false
+	}
+	for key, override := range getConfigModel().overridesAt(serviceConfigPath).WorkerTypeOverride {
+		if strings.EqualFold(key, workerTypeToConfigString(wt)) {
+			return override, true
+		}
+	}
+	return workerRetryOverrides{}, false
+}
+
+// getServiceTimeouts returns the timeouts for the service at serviceConfigPath:  globalTimeouts, with any timeoutsOverride set for the
+// role or its experiment applied on top of them.  If an override can't be used, or the service's component timeouts add up to more than
+// its global timeout, an error is returned along with globalTimeouts.
+func getServiceTimeouts(serviceConfigPath string, globalTimeouts map[timeoutKey]time.Duration) (map[timeoutKey]time.Duration, error) {
+	serviceTimeouts, err := applyTimeoutSettings(globalTimeouts, getConfigModel().overridesAt(serviceConfigPath).TimeoutsOverride)
+	if err == nil {
+		err = checkComponentTimeouts(serviceTimeouts)
+	}
+	if err != nil {
+		return maps.Clone(globalTimeouts), err
+	}
+	return serviceTimeouts, nil
+}
+
+// defaultTimeouts returns the default timeouts of the configuration model
+func defaultTimeouts() map[timeoutKey]time.Duration {
+	// The defaults are all supported timeouts that can be parsed, which TestDefaultTimeouts checks
+	t, _ := applyTimeoutSettings(make(map[timeoutKey]time.Duration), newDefaultConfigModel().Timeouts.settings())
+	return t
+}
+
+// parseOptionalDuration parses the duration string s.  An empty s means no duration, and is returned as 0.
+func parseOptionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// applyTimeoutSettings returns a copy of base with the timeouts in settings, which are keyed like the timeouts section of the
+// configuration, applied.  Settings that are not supported timeouts or can't be parsed are left out, and returned as errors.
+func applyTimeoutSettings(base map[timeoutKey]time.Duration, settings map[string]string) (map[timeoutKey]time.Duration, error) {
+	applied := maps.Clone(base)
+	errs := make([]error, 0)
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		tKey, ok := getTimeoutKeyFromString(strings.TrimSuffix(strings.ToLower(key), "timeout"))
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s is not a supported timeout", key))
+			continue
+		}
+		timeout, err := time.ParseDuration(settings[key])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not parse %s: %w", key, err))
+			continue
+		}
+		applied[tKey] = timeout
+	}
+	return applied, errors.Join(errs...)
+}
+
+// checkComponentTimeouts checks that the timeouts in timeoutsMap other than the global timeout don't add up to more than the global
+// timeout
+func checkComponentTimeouts(timeoutsMap map[timeoutKey]time.Duration) error {
+	var componentTotal time.Duration
+	for key, timeout := range timeoutsMap {
+		if key != timeoutGlobal {
+			componentTotal += timeout
+		}
+	}
+	if componentTotal > timeoutsMap[timeoutGlobal] {
+		return fmt.Errorf("component timeouts (%s in total) exceed the global timeout (%s)", componentTotal, timeoutsMap[timeoutGlobal])
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// configChanges.go records a snapshot of the configuration of every configured service in the ManagedTokensDatabase, and reports
+// what changed since the snapshot that an earlier run recorded.  When pushes start failing, this tells the admins what changed.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+
+	"github.com/fermitools/managed-tokens/internal/db"
+	"github.com/fermitools/managed-tokens/internal/tracing"
+)
+
+// serviceConfigSnapshot holds the parts of a service's effective configuration that we track between runs
+type serviceConfigSnapshot struct {
+	Account            string   `json:"account"`
+	DestinationNodes   []string `json:"destinationNodes"`
+	DesiredUIDOverride *uint32  `json:"desiredUIDOverride,omitempty"`
+	KeytabPath         string   `json:"keytabPath"`
+	ScheddsOverride    []string `json:"scheddsOverride,omitempty"`
+}
+
+// configSnapshot is a snapshot of the configuration of all configured services, keyed by service name
+type configSnapshot map[string]serviceConfigSnapshot
+
+// serviceConfigChange is a single change to a service's configuration
+type serviceConfigChange struct {
+	service string
+	message string
+}
+
+// trackConfigChanges compares the current configuration of all configured services, not just the ones selected for this run, with
+// the latest snapshot recorded in database, and logs and returns the changes.  If record is true and the configuration changed, the
+// current snapshot is recorded in database for the next run to compare against.
+func trackConfigChanges(ctx context.Context, database *db.ManagedTokensDatabase, record bool) ([]serviceConfigChange, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("token-push").Start(ctx, "trackConfigChanges")
+	defer span.End()
+
+	current := getConfigSnapshot()
+	currentBytes, err := json.Marshal(current)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, exeLogger, "Could not serialize configuration snapshot")
+		return nil, err
+	}
+
+	var changes []serviceConfigChange
+	previous, err := database.GetLatestConfigSnapshot(ctx)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		exeLogger.Info("No configuration snapshot from an earlier run.  Will not report configuration changes")
+	case err != nil:
+		tracing.LogErrorWithTrace(span, exeLogger, "Could not get configuration snapshot from earlier run")
+		return nil, err
+	default:
+		if previous.Snapshot() == string(currentBytes) {
+			exeLogger.Debug("Configuration has not changed since the last recorded snapshot")
+			return nil, nil
+		}
+		var previousSnapshot configSnapshot
+		if err := json.Unmarshal([]byte(previous.Snapshot()), &previousSnapshot); err != nil {
+			tracing.LogErrorWithTrace(span, exeLogger, "Could not parse configuration snapshot from earlier run.  Will replace it")
+		} else {
+			changes = diffConfigSnapshots(previousSnapshot, current)
+			for _, c := range changes {
+				exeLogger.WithFields(log.Fields{
+					"service":          c.service,
+					"snapshotRecorded": previous.Recorded().Format(time.RFC3339),
+				}).Infof("Configuration changed: %s", c.message)
+			}
+		}
+	}
+
+	if record {
+		if err := database.InsertConfigSnapshot(ctx, time.Now(), string(currentBytes)); err != nil {
+			tracing.LogErrorWithTrace(span, exeLogger, "Could not record configuration snapshot")
+			return changes, err
+		}
+	}
+	tracing.LogSuccessWithTrace(span, exeLogger, "Checked configuration for changes since the last recorded snapshot")
+	return changes, nil
+}
+
+// getConfigSnapshot returns a snapshot of the configuration of every configured service.  Only UIDs that are overridden in the
+// configuration are part of the snapshot, since the others come from FERRY.
+func getConfigSnapshot() configSnapshot {
+	cfg := getConfigModel()
+	snapshot := make(configSnapshot)
+	for experiment, experimentConfig := range cfg.Experiments {
+		for role := range experimentConfig.Roles {
+			serviceConfigPath := "experiments." + experiment + ".roles." + role
+			s := serviceConfigSnapshot{
+				Account:            cfg.roleAt(serviceConfigPath).Account,
+				DestinationNodes:   slices.Sorted(slices.Values(cfg.roleAt(serviceConfigPath).destinationNodeNames())),
+				DesiredUIDOverride: cfg.overridesAt(serviceConfigPath).DesiredUIDOverride,
+				KeytabPath:         getKeytabFromConfiguration(serviceConfigPath),
+			}
+			if schedds, found := checkScheddsOverride(serviceConfigPath); found {
+				s.ScheddsOverride = schedds
+			}
+			snapshot[experiment+"_"+role] = s
+		}
+	}
+	return snapshot
+}
+
+// diffConfigSnapshots returns the changes between the previous and current configuration snapshots, sorted by service
+func diffConfigSnapshots(previous, current configSnapshot) []serviceConfigChange {
+	changes := make([]serviceConfigChange, 0)
+	for _, service := range slices.Sorted(maps.Keys(previous)) {
+		if _, ok := current[service]; !ok {
+			changes = append(changes, serviceConfigChange{service, "service removed"})
+		}
+	}
+	for _, service := range slices.Sorted(maps.Keys(current)) {
+		p, ok := previous[service]
+		if !ok {
+			changes = append(changes, serviceConfigChange{service, "service added"})
+			continue
+		}
+		c := current[service]
+		if added, removed := diffStringSets(p.DestinationNodes, c.DestinationNodes); len(added) > 0 || len(removed) > 0 {
+			parts := make([]string, 0, 2)
+			if len(added) > 0 {
+				parts = append(parts, "added "+strings.Join(added, ", "))
+			}
+			if len(removed) > 0 {
+				parts = append(parts, "removed "+strings.Join(removed, ", "))
+			}
+			changes = append(changes, serviceConfigChange{service, "destinationNodes changed: " + strings.Join(parts, "; ")})
+		}
+		if p.Account != c.Account {
+			changes = append(changes, serviceConfigChange{service, fmt.Sprintf("account changed from %q to %q", p.Account, c.Account)})
+		}
+		if uidString(p.DesiredUIDOverride) != uidString(c.DesiredUIDOverride) {
+			changes = append(changes, serviceConfigChange{service, fmt.Sprintf("desiredUID override changed from %s to %s", uidString(p.DesiredUIDOverride), uidString(c.DesiredUIDOverride))})
+		}
+		if p.KeytabPath != c.KeytabPath {
+			changes = append(changes, serviceConfigChange{service, fmt.Sprintf("keytabPath changed from %q to %q", p.KeytabPath, c.KeytabPath)})
+		}
+		if !slices.Equal(p.ScheddsOverride, c.ScheddsOverride) {
+			changes = append(changes, serviceConfigChange{service, fmt.Sprintf("schedds override changed from %v to %v", p.ScheddsOverride, c.ScheddsOverride)})
+		}
+	}
+	return changes
+}
+
+// diffStringSets returns the elements of current that are not in previous, and the elements of previous that are not in current
+func diffStringSets(previous, current []string) (added, removed []string) {
+	for _, s := range current {
+		if !slices.Contains(previous, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range previous {
+		if !slices.Contains(current, s) {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+// uidString returns the string form of a UID override for a configuration change message
+func uidString(uid *uint32) string {
+	if uid == nil {
+		return "none"
+	}
+	return fmt.Sprint(*uid)
+}
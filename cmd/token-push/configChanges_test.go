@@ -0,0 +1,100 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/db"
+)
+
+func TestDiffConfigSnapshots(t *testing.T) {
+	uid := uint32(12345)
+	previous := configSnapshot{
+		"expt1_role1": {Account: "acct1", DestinationNodes: []string{"node1", "node2"}, KeytabPath: "/keytabs/acct1.keytab"},
+		"expt2_role1": {Account: "acct2", DestinationNodes: []string{"node1"}, KeytabPath: "/keytabs/acct2.keytab"},
+	}
+	current := configSnapshot{
+		"expt1_role1": {
+			Account:            "acct1a",
+			DestinationNodes:   []string{"node2", "node3"},
+			DesiredUIDOverride: &uid,
+			KeytabPath:         "/keytabs/acct1a.keytab",
+			ScheddsOverride:    []string{"schedd1"},
+		},
+		"expt3_role1": {Account: "acct3", DestinationNodes: []string{"node1"}, KeytabPath: "/keytabs/acct3.keytab"},
+	}
+
+	assert.Empty(t, diffConfigSnapshots(previous, previous))
+	assert.Equal(t,
+		[]serviceConfigChange{
+			{"expt2_role1", "service removed"},
+			{"expt1_role1", "destinationNodes changed: added node3; removed node1"},
+			{"expt1_role1", `account changed from "acct1" to "acct1a"`},
+			{"expt1_role1", "desiredUID override changed from none to 12345"},
+			{"expt1_role1", `keytabPath changed from "/keytabs/acct1.keytab" to "/keytabs/acct1a.keytab"`},
+			{"expt1_role1", "schedds override changed from [] to [schedd1]"},
+			{"expt3_role1", "service added"},
+		},
+		diffConfigSnapshots(previous, current),
+	)
+}
+
+// TestTrackConfigChanges checks that the configuration changes since the last recorded snapshot are reported, and that a snapshot
+// is only recorded when we ask for it to be
+func TestTrackConfigChanges(t *testing.T) {
+	ctx := context.Background()
+	viper.Reset()
+	t.Cleanup(func() { viper.Reset() })
+	oldConfigModel := configModel
+	configModel = nil
+	t.Cleanup(func() { configModel = oldConfigModel })
+
+	database, err := db.OpenOrCreateDatabase(path.Join(t.TempDir(), "managed-tokens.db"))
+	if err != nil {
+		t.Fatalf("Could not create new database, %s", err)
+	}
+	defer database.Close()
+
+	viper.Set("keytabPath", "/keytabs")
+	viper.Set("experiments.expt1.roles.role1.account", "acct1")
+	viper.Set("experiments.expt1.roles.role1.destinationNodes", []string{"node1"})
+
+	// No earlier snapshot, so nothing to report
+	changes, err := trackConfigChanges(ctx, database, true)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// A change that isn't recorded is reported again on the next run
+	viper.Set("experiments.expt1.roles.role1.destinationNodes", []string{"node1", "node2"})
+	expected := []serviceConfigChange{{"expt1_role1", "destinationNodes changed: added node2"}}
+	changes, err = trackConfigChanges(ctx, database, false)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, changes)
+	changes, err = trackConfigChanges(ctx, database, true)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, changes)
+
+	// Once it's recorded, it's not reported anymore
+	changes, err = trackConfigChanges(ctx, database, true)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
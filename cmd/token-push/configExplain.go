@@ -0,0 +1,218 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// configExplain.go implements token-push config explain, which shows where the effective value of a setting for a service comes from
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+const configExplainSubcommand = "explain"
+
+// configLevel is the level of the configuration that the effective value of a setting comes from
+type configLevel string
+
+const (
+	configLevelRole       configLevel = "role"
+	configLevelExperiment configLevel = "experiment"
+	configLevelGlobal     configLevel = "global"
+	configLevelDefault    configLevel = "default"
+)
+
+// roleExplainKeys and experimentExplainKeys are the settings that can only be set at the role and experiment levels, respectively
+var (
+	roleExplainKeys       = []string{"account", "destinationNodes", "tags"}
+	experimentExplainKeys = []string{"emails", "experimentOverride"}
+)
+
+// explainDefaultNotes describe how token-push gets a value for the overridable settings whose default is not a configuration value.  The
+// notes for timeouts and workerType are made from the defaults of the configuration model.
+var explainDefaultNotes = map[string]string{
+	"desiredUID":        "looked up in the managed tokens database by the service's account",
+	"userPrincipal":     "computed from kerberosPrincipalPattern and the service's account",
+	"tokenDestinations": "/tmp/vt_u{{.DesiredUID}} and /tmp/vt_u{{.DesiredUID}}-{{.Service}}, both required",
+	"timeouts":          defaultTimeoutsNote(newDefaultConfigModel().Timeouts),
+	"workerType":        defaultWorkerTypeNote(newDefaultConfigModel().WorkerType),
+}
+
+// defaultTimeoutsNote describes the default timeouts t
+func defaultTimeoutsNote(t timeoutsConfig) string {
+	settings := t.settings()
+	notes := make([]string, 0, len(settings))
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		notes = append(notes, key+" "+settings[key])
+	}
+	return strings.Join(notes, ", ")
+}
+
+// defaultWorkerTypeNote describes the default retry settings of the worker types in w
+func defaultWorkerTypeNote(w workerTypeConfig) string {
+	notes := make([]string, 0)
+	for _, wt := range validWorkerTypes {
+		if settings := w.forWorkerType(wt); settings.NumRetries > 0 {
+			notes = append(notes, fmt.Sprintf("%s %d retries, %s apart", workerTypeToConfigString(wt), settings.NumRetries, settings.RetrySleep))
+		}
+	}
+	if len(notes) == 0 {
+		return "no retries"
+	}
+	return strings.Join(notes, ", ")
+}
+
+// configExplanation describes the effective value of a setting for a service, and where it comes from
+type configExplanation struct {
+	Service    string      `json:"service"`
+	Key        string      `json:"key"`
+	Value      any         `json:"value"`
+	Level      configLevel `json:"level"`
+	ConfigPath string      `json:"configPath,omitempty"`
+	File       string      `json:"file,omitempty"`
+	Note       string      `json:"note,omitempty"`
+}
+
+// runConfigExplain writes the explanation of the setting given in args for the service given by the service flag to w
+func runConfigExplain(w io.Writer, args []string) error {
+	serviceName := viper.GetString("service")
+	if serviceName == "" || len(args) != 1 {
+		return errors.New("usage: token-push config explain -s <service> <key>")
+	}
+	e, err := explainConfigSetting(serviceName, args[0])
+	if err != nil {
+		return err
+	}
+	if err := writeConfigExplanation(w, e, viper.GetBool("json")); err != nil {
+		return err
+	}
+	return errExitOK
+}
+
+// explainConfigSetting returns the effective value of the setting key for the service serviceName, and the level and file of the
+// configuration it comes from.  key can be given with or without its Override suffix.
+func explainConfigSetting(serviceName, key string) (configExplanation, error) {
+	s := service.NewService(serviceName)
+	serviceConfigPath := "experiments." + s.Experiment() + ".roles." + s.Role()
+	if !viper.IsSet(serviceConfigPath) {
+		return configExplanation{}, fmt.Errorf("service %s is not configured", serviceName)
+	}
+	experimentConfigPath := "experiments." + s.Experiment()
+
+	e := configExplanation{Service: serviceName}
+	equalsKey := func(k string) bool { return strings.EqualFold(k, key) }
+	if baseKey, ok := strings.CutSuffix(key, "Override"); ok && slices.ContainsFunc(configOverrideKeys, func(k string) bool { return strings.EqualFold(k, baseKey) }) {
+		key = baseKey
+	}
+	switch {
+	case slices.ContainsFunc(configOverrideKeys, equalsKey):
+		e.Key = configOverrideKeys[slices.IndexFunc(configOverrideKeys, equalsKey)]
+		configPath, overridden := getConfigOverridePath(serviceConfigPath, e.Key)
+		switch {
+		case overridden && strings.HasPrefix(configPath, serviceConfigPath+"."):
+			e.setFromConfig(configLevelRole, configPath)
+		case overridden:
+			e.setFromConfig(configLevelExperiment, configPath)
+		case viper.IsSet(configPath):
+			e.setFromConfig(configLevelGlobal, configPath)
+		default:
+			e.Level = configLevelDefault
+			e.Value = defaultConfigValue(e.Key)
+			e.Note = explainDefaultNotes[e.Key]
+		}
+	case slices.ContainsFunc(roleExplainKeys, equalsKey):
+		e.Key = roleExplainKeys[slices.IndexFunc(roleExplainKeys, equalsKey)]
+		e.setFromConfigIfSet(configLevelRole, serviceConfigPath+"."+e.Key)
+	case slices.ContainsFunc(experimentExplainKeys, equalsKey):
+		e.Key = experimentExplainKeys[slices.IndexFunc(experimentExplainKeys, equalsKey)]
+		e.setFromConfigIfSet(configLevelExperiment, experimentConfigPath+"."+e.Key)
+	default:
+		return configExplanation{}, fmt.Errorf("%s is not a setting that can be explained.  Supported settings: %s", key,
+			strings.Join(slices.Concat(roleExplainKeys, experimentExplainKeys, configOverrideKeys), ", "))
+	}
+	return e, nil
+}
+
+// setFromConfig sets the explanation's value to the one at configPath, which is at the given level of the configuration
+func (e *configExplanation) setFromConfig(level configLevel, configPath string) {
+	e.Level = level
+	e.ConfigPath = configPath
+	e.Value = displayConfigValue(configPath, viper.Get(configPath))
+	e.File = getConfigSource(configPath).String()
+}
+
+// setFromConfigIfSet calls setFromConfig if configPath is set in the configuration.  Otherwise, the setting has no value.
+func (e *configExplanation) setFromConfigIfSet(level configLevel, configPath string) {
+	if viper.IsSet(configPath) {
+		e.setFromConfig(level, configPath)
+		return
+	}
+	e.Level = configLevelDefault
+}
+
+// defaultConfigValue returns the default value of the global setting key, or nil if it has none
+func defaultConfigValue(key string) any {
+	defaults := reflect.ValueOf(*newDefaultConfigModel())
+	for i := range defaults.NumField() {
+		if jsonFieldName(defaults.Type().Field(i)) == key && !defaults.Field(i).IsZero() {
+			return defaults.Field(i).Interface()
+		}
+	}
+	if key == "tokenGetter" {
+		return workerTypeToConfigString(worker.StoreAndGetToken)
+	}
+	return nil
+}
+
+// writeConfigExplanation writes e to w, either as JSON or as human-readable lines
+func writeConfigExplanation(w io.Writer, e configExplanation, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(e)
+	}
+
+	value := "<not set>"
+	if e.Value != nil {
+		v, err := json.Marshal(e.Value)
+		if err != nil {
+			return fmt.Errorf("could not format value of %s: %w", e.Key, err)
+		}
+		value = string(v)
+	}
+	fmt.Fprintf(w, "%s for %s: %s\n", e.Key, e.Service, value)
+	fmt.Fprintf(w, "  level: %s\n", e.Level)
+	if e.ConfigPath != "" {
+		fmt.Fprintf(w, "  key:   %s\n", e.ConfigPath)
+	}
+	if e.File != "" {
+		fmt.Fprintf(w, "  file:  %s\n", e.File)
+	}
+	if e.Note != "" {
+		fmt.Fprintf(w, "  note:  %s\n", e.Note)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainConfigSetting(t *testing.T) {
+	defer viper.Reset()
+	configFile := filepath.Join(t.TempDir(), "managedTokens.yml")
+	configData := `
+vaultServer: globalvault
+sshOptions: -o global
+pingOptions: -c 1
+experiments:
+  myexpt:
+    emails: [email@example.com]
+    vaultServerOverride: experimentvault
+    sshOptionsOverride: -o experiment
+    roles:
+      myrole:
+        account: myaccount
+        destinationNodes: [node1]
+        sshOptionsOverride: -o role
+      otherrole:
+        account: otheraccount
+        destinationNodes: [node2]
+`
+	if err := os.WriteFile(configFile, []byte(configData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		description string
+		service     string
+		key         string
+		expected    configExplanation
+	}
+	testCases := []testCase{
+		{
+			"Role-level override",
+			"myexpt_myrole",
+			"sshOptions",
+			configExplanation{Service: "myexpt_myrole", Key: "sshOptions", Value: "-o role", Level: configLevelRole,
+				ConfigPath: "experiments.myexpt.roles.myrole.sshOptionsOverride", File: configFile},
+		},
+		{
+			"Experiment-level override, given with Override suffix",
+			"myexpt_myrole",
+			"vaultServerOverride",
+			configExplanation{Service: "myexpt_myrole", Key: "vaultServer", Value: "experimentvault", Level: configLevelExperiment,
+				ConfigPath: "experiments.myexpt.vaultServerOverride", File: configFile},
+		},
+		{
+			"Global value",
+			"myexpt_otherrole",
+			"pingOptions",
+			configExplanation{Service: "myexpt_otherrole", Key: "pingOptions", Value: "-c 1", Level: configLevelGlobal, ConfigPath: "pingOptions",
+				File: configFile},
+		},
+		{
+			"Experiment-level override for another role",
+			"myexpt_otherrole",
+			"sshoptions",
+			configExplanation{Service: "myexpt_otherrole", Key: "sshOptions", Value: "-o experiment", Level: configLevelExperiment,
+				ConfigPath: "experiments.myexpt.sshOptionsOverride", File: configFile},
+		},
+		{
+			"Default",
+			"myexpt_myrole",
+			"defaultRoleFileDestinationTemplate",
+			configExplanation{Service: "myexpt_myrole", Key: "defaultRoleFileDestinationTemplate", Level: configLevelDefault,
+				Value: newDefaultConfigModel().DefaultRoleFileDestinationTemplate},
+		},
+		{
+			"Default without a configuration value",
+			"myexpt_myrole",
+			"desiredUID",
+			configExplanation{Service: "myexpt_myrole", Key: "desiredUID", Level: configLevelDefault, Note: explainDefaultNotes["desiredUID"]},
+		},
+		{
+			"Role-level setting",
+			"myexpt_myrole",
+			"account",
+			configExplanation{Service: "myexpt_myrole", Key: "account", Value: "myaccount", Level: configLevelRole,
+				ConfigPath: "experiments.myexpt.roles.myrole.account", File: configFile},
+		},
+		{
+			"Experiment-level setting that isn't set",
+			"myexpt_myrole",
+			"experimentOverride",
+			configExplanation{Service: "myexpt_myrole", Key: "experimentOverride", Level: configLevelDefault},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.description, func(t *testing.T) {
+			e, err := explainConfigSetting(test.service, test.key)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, e)
+		})
+	}
+
+	_, err := explainConfigSetting("myexpt_myrole", "notakey")
+	assert.ErrorContains(t, err, "notakey is not a setting that can be explained")
+	_, err = explainConfigSetting("myexpt_notarole", "vaultServer")
+	assert.ErrorContains(t, err, "service myexpt_notarole is not configured")
+}
+
+func TestRunConfigExplain(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("experiments.myexpt.roles.myrole.account", "myaccount")
+	viper.Set("experiments.myexpt.keytabPathOverride", "/path/to/keytab")
+
+	var b bytes.Buffer
+	assert.Error(t, runConfigSubcommand(&b, []string{"explain", "keytabPath"}), "service is required")
+
+	viper.Set("service", "myexpt_myrole")
+	assert.ErrorIs(t, runConfigSubcommand(&b, []string{"explain", "keytabPath"}), errExitOK)
+	assert.Equal(t, `keytabPath for myexpt_myrole: "/path/to/keytab"
+  level: experiment
+  key:   experiments.myexpt.keytabPathOverride
+`, b.String())
+
+	b.Reset()
+	viper.Set("json", true)
+	assert.ErrorIs(t, runConfigSubcommand(&b, []string{"explain", "keytabPath"}), errExitOK)
+	var e configExplanation
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &e))
+	assert.Equal(t, configLevelExperiment, e.Level)
+}
+
+// TestDefaultNotes checks that the notes for the timeouts and workerType defaults describe the given defaults
+func TestDefaultNotes(t *testing.T) {
+	assert.Equal(t, "globalTimeout 300s, kerberosTimeout 20s, pingTimeout 10s, pushTimeout 30s, vaultStorerTimeout 60s",
+		defaultTimeoutsNote(newDefaultConfigModel().Timeouts))
+	assert.Equal(t, "kerberosTimeout 5s", defaultTimeoutsNote(timeoutsConfig{KerberosTimeout: "5s", FerryRequestTimeout: "30s"}))
+
+	assert.Equal(t, "no retries", defaultWorkerTypeNote(workerTypeConfig{}))
+	assert.Equal(t, "pushTokens 3 retries, 10s apart",
+		defaultWorkerTypeNote(workerTypeConfig{PushTokens: workerSettingsConfig{NumRetries: 3, RetrySleep: "10s"}}))
+}
@@ -0,0 +1,689 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// configModel.go provides the typed model of the token-push configuration.  The model is decoded from viper and validated once in setup,
+// and the configuration getters read from it instead of looking up hand-built key paths in viper.  The same model is used to generate
+// the JSON Schema of the configuration.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+// tokenPushConfig holds the global settings of token-push, and the settings of each configured experiment.  The sections of the
+// configuration that only the other executables read, like ferry, are modeled too, so that the JSON Schema covers the whole configuration.
+type tokenPushConfig struct {
+	KeytabPath                         string `json:"keytabPath,omitempty" description:"Directory that holds the kerberos keytabs, named <account>.keytab"`
+	KerberosPrincipalPattern           string `json:"kerberosPrincipalPattern,omitempty" description:"Template for the kerberos principal of a service.  {{.Account}} is replaced by the service's account"`
+	MinTokenLifetime                   string `json:"minTokenLifetime,omitempty" description:"Minimum lifetime of the vault tokens that are pushed, given to htgettoken"`
+	CondorCollectorHost                string `json:"condorCollectorHost,omitempty" description:"HTCondor collector to query for the credd schedds"`
+	CondorCreddHost                    string `json:"condorCreddHost,omitempty" description:"Schedd to store vault tokens on, instead of the schedds found by querying the collector"`
+	CondorScheddConstraint             string `json:"condorScheddConstraint,omitempty" description:"Constraint to use when querying the collector for schedds"`
+	VaultServer                        string `json:"vaultServer,omitempty" description:"Vault server to get vault tokens from"`
+	ServiceCreddVaultTokenPathRoot     string `json:"serviceCreddVaultTokenPathRoot,omitempty" description:"Directory that holds the stored service/credd-specific vault tokens"`
+	DefaultRoleFileDestinationTemplate string `json:"defaultRoleFileDestinationTemplate,omitempty" description:"Template for the path of the default role file on the destination nodes.  Any field of worker.Config can be used"`
+	PingOptions                        string `json:"pingOptions,omitempty" description:"Extra options to give to ping"`
+	FileCopierOptions                  string `json:"fileCopierOptions,omitempty" description:"Extra options to give to the file copier, usually rsync"`
+	SSHOptions                         string `json:"sshOptions,omitempty" description:"Options to give to ssh when copying files"`
+	DisableNotifications               bool   `json:"disableNotifications,omitempty" description:"Do not send any notifications"`
+	ErrorCountToSendMessage            int    `json:"errorCountToSendMessage,omitempty" description:"Number of consecutive errors for a service or node before a notification is sent"`
+	DaemonInterval                     string `json:"daemonInterval,omitempty" description:"How often to push tokens for each service in daemon mode"`
+	ScheddCacheLifetime                string `json:"scheddCacheLifetime,omitempty" description:"How long schedds queried from a collector are cached"`
+	DBLocation                         string `json:"dbLocation,omitempty" description:"Location of the managed tokens database"`
+	ConfigDir                          string `json:"configDir,omitempty" description:"Directory of YAML and JSON files that define more experiments.  Relative to the directory of the main configuration file"`
+	DevEnvironmentLabel                string `json:"devEnvironmentLabel,omitempty" description:"Label that sets the metrics, logs, and traces of a development instance apart from production.  Can also be set with MANAGED_TOKENS_DEV_ENVIRONMENT_LABEL"`
+	SecretsKeyFile                     string `json:"secretsKeyFile,omitempty" description:"File with the base64-encoded key to decrypt encrypted-file secret references with"`
+
+	// TokenDestinations has no default here, since decoding a configured list into a non-empty default list would keep the extra
+	// default entries.  getTokenDestinationsFromConfig uses worker.DefaultTokenDestinations if it is empty.
+	TokenDestinations []tokenDestinationConfig `json:"tokenDestinations,omitempty" description:"Paths on the destination nodes to push the vault tokens to.  Defaults to /tmp/vt_u{{.DesiredUID}} and /tmp/vt_u{{.DesiredUID}}-{{.Service}}"`
+
+	Timeouts   timeoutsConfig        `json:"timeouts,omitempty" description:"Time limits for the run and for each of its steps"`
+	WorkerType workerTypeConfig      `json:"workerType,omitempty" description:"Retry and concurrency settings of the workers"`
+	Logs       map[string]logsConfig `json:"logs,omitempty" description:"Log files, by executable name"`
+	Prometheus prometheusConfig      `json:"prometheus,omitempty" description:"Settings for pushing metrics to a prometheus pushgateway"`
+	Loki       lokiConfig            `json:"loki,omitempty" description:"Settings for sending logs to loki"`
+	Tracing    tracingConfig         `json:"tracing,omitempty" description:"Settings for sending traces"`
+
+	CircuitBreaker circuitBreakerConfig `json:"circuitBreaker,omitempty" description:"Settings of the circuit breakers for pushing each service's tokens to each node"`
+	RunReport      runReportConfig      `json:"runReport,omitempty" description:"Settings for writing a report of each run"`
+	RunLock        runLockConfig        `json:"runLock,omitempty" description:"Settings of the lock that keeps more than one instance of each executable from running at once"`
+	Ferry          ferryConfig          `json:"ferry,omitempty" description:"Settings for getting UIDs from FERRY.  Only used by refresh-uids-from-ferry"`
+
+	Email         emailConfig         `json:"email,omitempty" description:"Settings for sending notification emails"`
+	Notifications notificationsConfig `json:"notifications,omitempty" description:"Where to send the admin notifications"`
+	// The configuration key doesn't match the field name case-insensitively, so it needs a mapstructure tag
+	NotificationsTest notificationsConfig         `json:"notifications_test,omitempty" mapstructure:"notifications_test" description:"Where to send the admin notifications in test runs"`
+	Experiments       map[string]experimentConfig `json:"experiments" jsonschema:"required" description:"Experiments to push tokens for, by experiment name"`
+}
+
+// timeoutsConfig holds the time limits for a run and for each of its steps
+type timeoutsConfig struct {
+	GlobalTimeout       string `json:"globalTimeout,omitempty" description:"Time limit for the whole run"`
+	KerberosTimeout     string `json:"kerberosTimeout,omitempty" description:"Time limit for getting the kerberos tickets of a service"`
+	VaultStorerTimeout  string `json:"vaultStorerTimeout,omitempty" description:"Time limit for storing and getting the vault tokens of a service"`
+	PingTimeout         string `json:"pingTimeout,omitempty" description:"Time limit for pinging the destination nodes of a service"`
+	PushTimeout         string `json:"pushTimeout,omitempty" description:"Time limit for pushing the vault tokens of a service to its destination nodes"`
+	FerryRequestTimeout string `json:"ferryRequestTimeout,omitempty" description:"Time limit for each request to FERRY.  Only used by refresh-uids-from-ferry"`
+}
+
+// settings returns the timeouts that token-push uses, keyed like the timeouts section of the configuration.  Timeouts that are not set
+// are left out.
+func (t timeoutsConfig) settings() map[string]string {
+	settings := make(map[string]string)
+	for key, value := range map[string]string{
+		"globalTimeout":      t.GlobalTimeout,
+		"kerberosTimeout":    t.KerberosTimeout,
+		"vaultStorerTimeout": t.VaultStorerTimeout,
+		"pingTimeout":        t.PingTimeout,
+		"pushTimeout":        t.PushTimeout,
+	} {
+		if value != "" {
+			settings[key] = value
+		}
+	}
+	return settings
+}
+
+// workerTypeConfig holds the settings of the workers.  Each worker type's settings are under its configuration string, as given by
+// workerTypeToConfigString.
+type workerTypeConfig struct {
+	MaxChildProcesses     int `json:"maxChildProcesses,omitempty" description:"Number of operations, like kinit, ping, and rsync, that can run at once across all worker types.  0 means no limit"`
+	MaxConcurrencyPerNode int `json:"maxConcurrencyPerNode,omitempty" description:"Number of operations that can run at once against any single destination node.  0 means no limit"`
+
+	GetKerberosTickets workerSettingsConfig `json:"getKerberosTickets,omitempty"`
+	GetToken           workerSettingsConfig `json:"getToken,omitempty"`
+	StoreAndGetToken   workerSettingsConfig `json:"storeAndGetToken,omitempty"`
+	PingAggregator     workerSettingsConfig `json:"pingAggregator,omitempty"`
+	PushTokens         workerSettingsConfig `json:"pushTokens,omitempty"`
+}
+
+// forWorkerType returns the settings of the worker type wt
+func (w workerTypeConfig) forWorkerType(wt worker.WorkerType) workerSettingsConfig {
+	v := reflect.ValueOf(w)
+	for i := range v.NumField() {
+		if settings, ok := v.Field(i).Interface().(workerSettingsConfig); ok && jsonFieldName(v.Type().Field(i)) == workerTypeToConfigString(wt) {
+			return settings
+		}
+	}
+	return workerSettingsConfig{}
+}
+
+// workerSettingsConfig holds the retry and concurrency settings of a single worker type
+type workerSettingsConfig struct {
+	NumRetries        int     `json:"numRetries,omitempty" description:"Number of times to retry the worker type's operations"`
+	RetrySleep        string  `json:"retrySleep,omitempty" description:"Time to wait before the first retry of the worker type's operations"`
+	BackoffMultiplier float64 `json:"backoffMultiplier,omitempty" description:"Factor by which the time to wait grows after each retry.  0 or 1 means a fixed time"`
+	Jitter            float64 `json:"jitter,omitempty" description:"Fraction, between 0 and 1, by which each time to wait is randomly varied"`
+	MaxElapsedTime    string  `json:"maxElapsedTime,omitempty" description:"Limit on the total time of all of the attempts and the waits between them.  Unset means no limit"`
+	MaxConcurrency    int     `json:"maxConcurrency,omitempty" description:"Number of the worker type's operations that can run at once.  0 means no limit"`
+}
+
+// circuitBreakerConfig holds the settings of the circuit breakers for pushing each service's tokens to each node
+type circuitBreakerConfig struct {
+	FailureThreshold int    `json:"failureThreshold,omitempty" description:"Number of consecutive runs that failed to push a service's tokens to a node before the node is skipped for the service.  0 disables the circuit breakers"`
+	Cooldown         string `json:"cooldown,omitempty" description:"How long to skip a node for a service before trying it again"`
+}
+
+// settings returns the circuitBreakerSettings that c configures, or an error if c is not valid
+func (c circuitBreakerConfig) settings() (circuitBreakerSettings, error) {
+	if c.FailureThreshold < 0 {
+		return circuitBreakerSettings{}, fmt.Errorf("circuitBreaker.failureThreshold must not be negative, got %d", c.FailureThreshold)
+	}
+	cooldown, err := time.ParseDuration(c.Cooldown)
+	if err != nil {
+		return circuitBreakerSettings{}, fmt.Errorf("could not parse circuitBreaker.cooldown: %w", err)
+	}
+	if cooldown <= 0 {
+		return circuitBreakerSettings{}, fmt.Errorf("circuitBreaker.cooldown must be positive, got %s", cooldown)
+	}
+	return circuitBreakerSettings{failureThreshold: c.FailureThreshold, cooldown: cooldown}, nil
+}
+
+// runReportConfig holds the settings for writing a report of each run
+type runReportConfig struct {
+	Directory string `json:"directory,omitempty" description:"Directory to write a JSON report of each run to.  Reports are not written if this is not set"`
+	JUnit     bool   `json:"junit,omitempty" description:"Also write each report as JUnit XML"`
+}
+
+// runLockConfig holds the settings of the run lock
+type runLockConfig struct {
+	Path        string `json:"path,omitempty" description:"Lock file to use.  Defaults to <executable>.lock in the directory of dbLocation.  If set, all executables share this lock"`
+	WaitTimeout string `json:"waitTimeout,omitempty" description:"How long to wait for a running instance to finish before giving up"`
+}
+
+// ferryConfig holds the settings for getting UIDs from FERRY
+type ferryConfig struct {
+	Host                     string `json:"host,omitempty" description:"Host name of the FERRY server"`
+	Port                     int    `json:"port,omitempty" description:"Port of the FERRY server"`
+	CAPath                   string `json:"caPath,omitempty" description:"Directory of the CA certificates to verify the FERRY server with"`
+	HostCert                 string `json:"hostCert,omitempty" description:"Certificate to authenticate to FERRY with"`
+	HostKey                  string `json:"hostKey,omitempty" description:"Key of hostCert"`
+	ServiceExperiment        string `json:"serviceExperiment,omitempty" description:"Experiment of the service whose vault token is used to authenticate to FERRY"`
+	ServiceRole              string `json:"serviceRole,omitempty" description:"Role of the service whose vault token is used to authenticate to FERRY"`
+	ServiceKerberosPrincipal string `json:"serviceKerberosPrincipal,omitempty" description:"Kerberos principal of the service whose vault token is used to authenticate to FERRY"`
+	ServiceKeytabPath        string `json:"serviceKeytabPath,omitempty" description:"Keytab of the service whose vault token is used to authenticate to FERRY"`
+	VaultServer              string `json:"vaultServer,omitempty" description:"Vault server to get the service's vault token from"`
+}
+
+// logsConfig holds the log files of an executable
+type logsConfig struct {
+	LogFile   string `json:"logfile,omitempty" description:"File that info and more severe messages are logged to"`
+	DebugFile string `json:"debugfile,omitempty" description:"File that every message, including debug messages, is logged to"`
+}
+
+// prometheusConfig holds the settings for pushing metrics to a prometheus pushgateway
+type prometheusConfig struct {
+	Host    string `json:"host,omitempty" description:"URL of the prometheus pushgateway"`
+	JobName string `json:"jobname,omitempty" description:"Job name to push the metrics under.  Unless devEnvironmentLabel is production, it is appended to the job name"`
+}
+
+// lokiConfig holds the settings for sending logs to loki
+type lokiConfig struct {
+	Host string `json:"host,omitempty" description:"URL of the loki server.  Logs are not sent to loki if this is not set"`
+	// The configuration key doesn't match the field name case-insensitively, so it needs a mapstructure tag
+	ResponseHeaderTimeout string `json:"response_header_timeout,omitempty" mapstructure:"response_header_timeout" description:"Time to wait for the response headers of each request to loki"`
+}
+
+// tracingConfig holds the settings for sending traces
+type tracingConfig struct {
+	URL string `json:"url,omitempty" description:"URL of the OTLP HTTP endpoint to send traces to.  Traces are not sent if this is not set"`
+}
+
+// emailConfig holds the settings for sending notification emails
+type emailConfig struct {
+	From     string `json:"from,omitempty" description:"Address that notification emails are sent from"`
+	SMTPHost string `json:"smtpHost,omitempty" description:"SMTP server to send notification emails through"`
+	SMTPPort int    `json:"smtpPort,omitempty" description:"Port of the SMTP server"`
+}
+
+// notificationsConfig holds where to send the admin notifications
+type notificationsConfig struct {
+	// The configuration keys don't match the field names case-insensitively, so they need mapstructure tags
+	AdminEmail     stringList `json:"admin_email,omitempty" mapstructure:"admin_email" description:"Addresses to send the admin notifications to"`
+	SlackAlertsURL string     `json:"SLACK_ALERTS_URL,omitempty" mapstructure:"slack_alerts_url" description:"Slack webhook URL to send the admin notifications to"`
+}
+
+// stringList is a list of strings that can also be given as a single string of comma-separated values
+type stringList []string
+
+// jsonSchema returns the JSON Schema of a stringList:  either a string or an array of strings
+func (stringList) jsonSchema() map[string]any {
+	return map[string]any{
+		"anyOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+}
+
+// tokenDestinationConfig holds a single destination on the destination nodes that a service's vault token is pushed to
+type tokenDestinationConfig struct {
+	Path     string `json:"path" jsonschema:"required" description:"Template for the path of the vault token on the destination nodes.  {{.DesiredUID}}, {{.Account}}, {{.Service}}, {{.Experiment}}, and {{.Role}} can be used"`
+	Optional bool   `json:"optional,omitempty" description:"Do not mark the node as failed if the vault token cannot be pushed to this destination"`
+}
+
+// experimentConfig holds the settings for a single experiment.  Overrides set here apply to every role of the experiment, unless the
+// role overrides the same setting itself.
+type experimentConfig struct {
+	Emails             []string              `json:"emails" jsonschema:"required" description:"Addresses to send the experiment's notifications to"`
+	ExperimentOverride string                `json:"experimentOverride,omitempty" description:"Name of the experiment according to the token issuer, if it is different from the configuration key"`
+	Roles              map[string]roleConfig `json:"roles" jsonschema:"required" description:"Roles of the experiment, by role name"`
+
+	settingOverrides `mapstructure:",squash"`
+}
+
+// roleConfig holds the settings for a single role of an experiment, i.e. a service
+type roleConfig struct {
+	Account          string                  `json:"account" jsonschema:"required" description:"Account that the service's tokens are for"`
+	DestinationNodes []destinationNodeConfig `json:"destinationNodes" jsonschema:"required" description:"Nodes to push the service's tokens to.  Each node is either its host name, or an object with the host name and the node's own settings"`
+	Tags             []string                `json:"tags,omitempty" description:"Tags used to select services with --tag and --exclude-tag"`
+
+	settingOverrides `mapstructure:",squash"`
+}
+
+// destinationNodeConfig holds a single destination node of a role, and the settings of that node that differ from the role's.  In the
+// configuration, a node that has no settings of its own can be given as just its host name.
+type destinationNodeConfig struct {
+	Node              string `json:"node" jsonschema:"required" description:"Host name of the node"`
+	Account           string `json:"account,omitempty" description:"Account to connect to the node as, instead of the service's account"`
+	Port              int    `json:"port,omitempty" description:"Port of the node's ssh server"`
+	JumpHost          string `json:"jumpHost,omitempty" description:"Jump host (bastion) to connect to the node through, as [user@]host[:port].  The jump host is pinged instead of the node"`
+	SSHOptions        string `json:"sshOptions,omitempty" description:"Options to give to ssh when copying files to this node, in addition to the service's sshOptions"`
+	FileCopierOptions string `json:"fileCopierOptions,omitempty" description:"Extra options to give to the file copier for this node, in addition to the service's fileCopierOptions"`
+	PingOptions       string `json:"pingOptions,omitempty" description:"Extra options to give to ping for this node, in addition to the service's pingOptions"`
+}
+
+// shorthandField returns the field that is set when a destinationNodeConfig is given as a string
+func (destinationNodeConfig) shorthandField() string { return "node" }
+
+// hasNodeOptions returns whether the node has any settings of its own
+func (d destinationNodeConfig) hasNodeOptions() bool {
+	return d != destinationNodeConfig{Node: d.Node}
+}
+
+// destinationNodeNames returns the host names of the role's destination nodes
+func (r roleConfig) destinationNodeNames() []string {
+	nodes := make([]string, 0, len(r.DestinationNodes))
+	for _, d := range r.DestinationNodes {
+		nodes = append(nodes, d.Node)
+	}
+	return nodes
+}
+
+// configShorthand is implemented by the configuration model types that can also be given as a single string, which sets the field
+// named by shorthandField
+type configShorthand interface {
+	shorthandField() string
+}
+
+var configShorthandType = reflect.TypeFor[configShorthand]()
+
+// configShorthandDecodeHook is a mapstructure.DecodeHookFuncType that decodes a string into a configShorthand type by setting its
+// shorthand field
+func configShorthandDecodeHook(from, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to.Kind() != reflect.Struct || !to.Implements(configShorthandType) {
+		return data, nil
+	}
+	return map[string]any{reflect.Zero(to).Interface().(configShorthand).shorthandField(): data}, nil
+}
+
+// configSchemaProvider is implemented by the configuration model types whose JSON Schema can't be derived from their Go type
+type configSchemaProvider interface {
+	jsonSchema() map[string]any
+}
+
+var configSchemaProviderType = reflect.TypeFor[configSchemaProvider]()
+
+// settingOverrides holds the <key>Override settings that can be set for an experiment or a role.  Each of them is nil unless it is set in
+// the configuration.  A service uses its role's override if it is set, then its experiment's override, and then the global <key>
+// setting.
+type settingOverrides struct {
+	KeytabPathOverride                         *string                   `json:"keytabPathOverride,omitempty" description:"Path of the service's keytab"`
+	UserPrincipalOverride                      *string                   `json:"userPrincipalOverride,omitempty" description:"Kerberos principal of the service"`
+	DesiredUIDOverride                         *uint32                   `json:"desiredUIDOverride,omitempty" description:"UID to push the service's tokens for, instead of looking it up in the database"`
+	CondorCollectorHostOverride                *string                   `json:"condorCollectorHostOverride,omitempty"`
+	CondorCreddHostOverride                    *string                   `json:"condorCreddHostOverride,omitempty"`
+	CondorScheddConstraintOverride             *string                   `json:"condorScheddConstraintOverride,omitempty"`
+	VaultServerOverride                        *string                   `json:"vaultServerOverride,omitempty"`
+	ServiceCreddVaultTokenPathRootOverride     *string                   `json:"serviceCreddVaultTokenPathRootOverride,omitempty"`
+	KerberosPrincipalPatternOverride           *string                   `json:"kerberosPrincipalPatternOverride,omitempty"`
+	DefaultRoleFileDestinationTemplateOverride *string                   `json:"defaultRoleFileDestinationTemplateOverride,omitempty"`
+	PingOptionsOverride                        *string                   `json:"pingOptionsOverride,omitempty"`
+	FileCopierOptionsOverride                  *string                   `json:"fileCopierOptionsOverride,omitempty"`
+	SSHOptionsOverride                         *string                   `json:"sshOptionsOverride,omitempty"`
+	DisableNotificationsOverride               *bool                     `json:"disableNotificationsOverride,omitempty"`
+	TokenGetterOverride                        *string                   `json:"tokenGetterOverride,omitempty" description:"Worker type to get the service's vault token with:  getToken or storeAndGetToken"`
+	DaemonIntervalOverride                     *string                   `json:"daemonIntervalOverride,omitempty"`
+	TokenDestinationsOverride                  *[]tokenDestinationConfig `json:"tokenDestinationsOverride,omitempty" description:"Paths on the destination nodes to push the service's vault tokens to"`
+
+	// The map overrides are merged key by key, so that a role only needs to set the timeouts and worker types it changes
+	TimeoutsOverride   map[string]string               `json:"timeoutsOverride,omitempty" description:"Timeouts for the service, keyed like the timeouts section, e.g. vaultStorerTimeout.  Timeouts that are not overridden use the timeouts section"`
+	WorkerTypeOverride map[string]workerRetryOverrides `json:"workerTypeOverride,omitempty" description:"Retry settings for the service, by worker type.  Settings that are not overridden use the workerType section"`
+}
+
+// workerRetryOverrides holds the retry settings of a worker type that can be overridden for an experiment or a role
+type workerRetryOverrides struct {
+	NumRetries        *int     `json:"numRetries,omitempty" description:"Number of times to retry the worker type's operations for the service"`
+	RetrySleep        *string  `json:"retrySleep,omitempty" description:"Time to wait before the first retry of the worker type's operations for the service"`
+	BackoffMultiplier *float64 `json:"backoffMultiplier,omitempty" description:"Factor by which the time to wait grows after each retry for the service"`
+	Jitter            *float64 `json:"jitter,omitempty" description:"Fraction, between 0 and 1, by which each time to wait is randomly varied for the service"`
+	MaxElapsedTime    *string  `json:"maxElapsedTime,omitempty" description:"Limit on the total time of all of the service's attempts and the waits between them"`
+}
+
+// mergedWith returns o, with every override that is set in more replacing the corresponding override in o.  Map overrides are merged
+// key by key instead, and so are the fields of the struct values in them.
+func (o settingOverrides) mergedWith(more settingOverrides) settingOverrides {
+	merged := o
+	mergedValue, moreValue := reflect.ValueOf(&merged).Elem(), reflect.ValueOf(more)
+	for i := range moreValue.NumField() {
+		if !moreValue.Field(i).IsNil() {
+			mergedValue.Field(i).Set(mergeOverrideValues(mergedValue.Field(i), moreValue.Field(i)))
+		}
+	}
+	return merged
+}
+
+// mergeOverrideValues returns more if it replaces base, or a new map with the entries of both if they are maps.  In that case, if both
+// have an entry for the same key and it is a struct of overrides, the fields of more's entry that are set replace those of base's entry.
+func mergeOverrideValues(base, more reflect.Value) reflect.Value {
+	if more.Kind() != reflect.Map || base.IsNil() {
+		return more
+	}
+	merged := reflect.MakeMapWithSize(more.Type(), base.Len()+more.Len())
+	iter := base.MapRange()
+	for iter.Next() {
+		merged.SetMapIndex(iter.Key(), iter.Value())
+	}
+	iter = more.MapRange()
+	for iter.Next() {
+		value := iter.Value()
+		if baseValue := base.MapIndex(iter.Key()); baseValue.IsValid() && value.Kind() == reflect.Struct {
+			mergedStruct := reflect.New(value.Type()).Elem()
+			mergedStruct.Set(baseValue)
+			for i := range value.NumField() {
+				if !value.Field(i).IsNil() {
+					mergedStruct.Field(i).Set(value.Field(i))
+				}
+			}
+			value = mergedStruct
+		}
+		merged.SetMapIndex(iter.Key(), value)
+	}
+	return merged
+}
+
+// newDefaultConfigModel returns a *tokenPushConfig that holds the defaults for every setting that has one
+func newDefaultConfigModel() *tokenPushConfig {
+	return &tokenPushConfig{
+		MinTokenLifetime:                   "10s",
+		DefaultRoleFileDestinationTemplate: "/tmp/default_role_{{.Experiment}}_{{.DesiredUID}}",
+		DaemonInterval:                     daemonIntervalDefault.String(),
+		ScheddCacheLifetime:                scheddCacheLifetimeDefault.String(),
+		DBLocation:                         "/var/lib/managed-tokens/uid.db",
+		DevEnvironmentLabel:                devEnvironmentLabelDefault,
+		Timeouts: timeoutsConfig{
+			GlobalTimeout:      "300s",
+			KerberosTimeout:    "20s",
+			VaultStorerTimeout: "60s",
+			PingTimeout:        "10s",
+			PushTimeout:        "30s",
+		},
+		WorkerType: workerTypeConfig{
+			StoreAndGetToken: workerSettingsConfig{MaxConcurrency: 10},
+		},
+		Prometheus:     prometheusConfig{JobName: "managed_tokens"},
+		Loki:           lokiConfig{ResponseHeaderTimeout: "1s"},
+		CircuitBreaker: circuitBreakerConfig{Cooldown: defaultCircuitBreakerCooldown.String()},
+		RunLock:        runLockConfig{WaitTimeout: "0s"},
+		Notifications:  notificationsConfig{AdminEmail: stringList{"fife-group@fnal.gov"}},
+		Experiments:    make(map[string]experimentConfig),
+	}
+}
+
+// configModel is the configuration model that was loaded in setup
+var configModel *tokenPushConfig
+
+// loadConfigModel decodes the configuration model from viper and validates it.  If it succeeds, the getters read from this model
+// from then on.
+func loadConfigModel() error {
+	c, err := decodeConfigModel()
+	if err != nil {
+		return fmt.Errorf("could not decode configuration: %w", err)
+	}
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	configModel = c
+	return nil
+}
+
+// getConfigModel returns the configuration model that was loaded in setup.  If it hasn't been loaded, for example when token-push is
+// still setting up, the model is decoded from the current viper configuration instead.
+func getConfigModel() *tokenPushConfig {
+	if configModel != nil {
+		return configModel
+	}
+	c, err := decodeConfigModel()
+	if err != nil {
+		log.Errorf("Could not decode configuration: %s", err)
+	}
+	return c
+}
+
+// decodeConfigModel decodes the viper configuration into a *tokenPushConfig, on top of the defaults.  viper matches the configuration keys
+// to the model's fields case-insensitively, so we only need mapstructure tags for the keys that don't match a field name.  Besides viper's default decode hooks, the configShorthand
+// types are decoded from strings.
+func decodeConfigModel() (*tokenPushConfig, error) {
+	c := newDefaultConfigModel()
+	err := viper.Unmarshal(c, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(), // viper's default decode hooks
+		mapstructure.StringToSliceHookFunc(","),
+		configShorthandDecodeHook,
+	)))
+	return c, err
+}
+
+// adminNotifications returns where to send the admin notifications:  the notifications_test section in test runs, and the notifications
+// section otherwise
+func (c *tokenPushConfig) adminNotifications(test bool) notificationsConfig {
+	if test {
+		return c.NotificationsTest
+	}
+	return c.Notifications
+}
+
+// experiment returns the configuration of the given experiment.  viper lower-cases the keys it reads in, so experiment names are
+// matched case-insensitively.
+func (c *tokenPushConfig) experiment(name string) experimentConfig {
+	return c.Experiments[strings.ToLower(name)]
+}
+
+// roleAt returns the configuration of the role at serviceConfigPath, which has the form experiments.<experiment>.roles.<role>.
+// If there is no such role, an empty roleConfig is returned.
+func (c *tokenPushConfig) roleAt(serviceConfigPath string) roleConfig {
+	experiment, role, ok := parseServiceConfigPath(serviceConfigPath)
+	if !ok {
+		return roleConfig{}
+	}
+	return c.experiment(experiment).Roles[strings.ToLower(role)]
+}
+
+// overridesAt returns the overrides that apply to the role at serviceConfigPath:  the role's own overrides, and any overrides set for
+// its experiment that the role doesn't override itself
+func (c *tokenPushConfig) overridesAt(serviceConfigPath string) settingOverrides {
+	experiment, role, ok := parseServiceConfigPath(serviceConfigPath)
+	if !ok {
+		return settingOverrides{}
+	}
+	e := c.experiment(experiment)
+	return e.settingOverrides.mergedWith(e.Roles[strings.ToLower(role)].settingOverrides)
+}
+
+// parseServiceConfigPath splits a service configuration path of the form experiments.<experiment>.roles.<role> into the experiment and
+// the role.  ok is false if serviceConfigPath doesn't have that form.
+func parseServiceConfigPath(serviceConfigPath string) (experiment, role string, ok bool) {
+	parts := strings.Split(serviceConfigPath, ".")
+	if len(parts) != 4 || parts[0] != "experiments" || parts[2] != "roles" {
+		return "", "", false
+	}
+	return parts[1], parts[3], true
+}
+
+// validate makes sure that every setting that the JSON Schema marks as required is set
+func (c *tokenPushConfig) validate() error {
+	return checkRequiredFields(reflect.ValueOf(*c), "")
+}
+
+// checkRequiredFields walks v, and returns an error for each field tagged with jsonschema:"required" that has its zero value.  The error
+// messages use the configuration key path, which starts with prefix.
+func checkRequiredFields(v reflect.Value, prefix string) error {
+	var errs []error
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if isSquashedField(field) {
+				errs = append(errs, checkRequiredFields(v.Field(i), prefix))
+				continue
+			}
+			key := prefix + jsonFieldName(field)
+			if isRequiredField(field) && isEmptyValue(v.Field(i)) {
+				errs = append(errs, fmt.Errorf("%s is required", key))
+				continue
+			}
+			errs = append(errs, checkRequiredFields(v.Field(i), key+"."))
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		for _, k := range keys {
+			errs = append(errs, checkRequiredFields(v.MapIndex(k), prefix+k.String()+"."))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// jsonFieldName returns the name of a configuration model field, as given by its json tag
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
+
+// isEmptyValue returns whether v is its zero value, or an empty slice or map
+func isEmptyValue(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// isSquashedField returns whether the fields of a configuration model field are set at the same level as the field itself
+func isSquashedField(field reflect.StructField) bool {
+	_, options, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+	return options == "squash"
+}
+
+func isRequiredField(field reflect.StructField) bool {
+	return field.Tag.Get("jsonschema") == "required"
+}
+
+// configSchema returns the JSON Schema of the configuration that token-push reads
+func configSchema() map[string]any {
+	schema := schemaForType(reflect.TypeOf(tokenPushConfig{}), reflect.ValueOf(*newDefaultConfigModel()))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "token-push configuration"
+	return schema
+}
+
+// schemaForType returns the JSON Schema for a configuration model type.  defaults holds the default values of the fields of a struct
+// type, and is ignored for other types.  Structs don't allow properties that aren't part of the model, so that typos in the configuration
+// are caught.
+func schemaForType(t reflect.Type, defaults reflect.Value) map[string]any {
+	if t.Implements(configSchemaProviderType) {
+		return reflect.Zero(t).Interface().(configSchemaProvider).jsonSchema()
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaForType(t.Elem(), reflect.Value{})
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaForType(t.Elem(), reflect.Value{})}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaForType(t.Elem(), reflect.Value{})}
+	case reflect.Struct:
+		if t.Implements(configShorthandType) {
+			return map[string]any{"anyOf": []any{map[string]any{"type": "string"}, structSchema(t, defaults)}}
+		}
+		return structSchema(t, defaults)
+	}
+	return map[string]any{}
+}
+
+// structSchema returns the JSON Schema of the configuration model struct type t.  defaults, if valid, holds the default values of its fields.
+func structSchema(t reflect.Type, defaults reflect.Value) map[string]any {
+	properties := make(map[string]any, t.NumField())
+	required := make([]string, 0)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		var fieldDefault reflect.Value
+		if defaults.IsValid() {
+			fieldDefault = defaults.Field(i)
+		}
+		if isSquashedField(field) {
+			maps.Copy(properties, schemaForType(field.Type, fieldDefault)["properties"].(map[string]any))
+			continue
+		}
+		fieldSchema := schemaForType(field.Type, fieldDefault)
+		if description := field.Tag.Get("description"); description != "" {
+			fieldSchema["description"] = description
+		}
+		if fieldDefault.IsValid() && !fieldDefault.IsZero() && fieldDefault.Kind() != reflect.Map {
+			fieldSchema["default"] = fieldDefault.Interface()
+		}
+		properties[jsonFieldName(field)] = fieldSchema
+		if isRequiredField(field) {
+			required = append(required, jsonFieldName(field))
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// configSubcommand is the positional argument that runs the config subcommands, like config schema
+const configSubcommand = "config"
+
+// runConfigSubcommand runs the config subcommand given by args, and writes its output to w.  It returns errExitOK if the subcommand
+// succeeded.
+func runConfigSubcommand(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("no config subcommand given.  Supported subcommands: schema, explain, render, encrypt-secret")
+	}
+	switch args[0] {
+	case "schema":
+		if err := writeConfigSchema(w); err != nil {
+			return err
+		}
+		return errExitOK
+	case configExplainSubcommand:
+		return runConfigExplain(w, args[1:])
+	case configRenderSubcommand:
+		return runConfigRender(w)
+	case configEncryptSecretSubcommand:
+		return runConfigEncryptSecret(os.Stdin, w)
+	default:
+		return fmt.Errorf("unknown config subcommand %s.  Supported subcommands: schema, explain, render, encrypt-secret", args[0])
+	}
+}
+
+// configSubcommandReadsConfig returns whether the config subcommand name needs the configuration file to be read in first
+func configSubcommandReadsConfig(name string) bool {
+	return name == configExplainSubcommand || name == configRenderSubcommand || name == configEncryptSecretSubcommand
+}
+
+// writeConfigSchema writes the JSON Schema of the configuration to w
+func writeConfigSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(configSchema())
+}
@@ -0,0 +1,346 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+func TestDecodeConfigModel(t *testing.T) {
+	defer viper.Reset()
+
+	// Defaults
+	c, err := decodeConfigModel()
+	assert.NoError(t, err)
+	assert.Equal(t, newDefaultConfigModel(), c)
+
+	viper.Set("keytabPath", "/path/to/keytabs")
+	viper.Set("minTokenLifetime", "30s")
+	viper.Set("email.smtpport", 25)
+	viper.Set("experiments.myexpt.emails", []string{"email@example.com"})
+	viper.Set("experiments.myexpt.experimentOverride", "realexpt")
+	viper.Set("experiments.myexpt.roles.myrole.account", "myaccount")
+	viper.Set("experiments.myexpt.roles.myrole.destinationNodes", []any{"node1", map[string]any{"node": "node2", "port": 2222, "jumpHost": "bastion"}})
+	viper.Set("experiments.myexpt.roles.myrole.desiredUIDOverride", 12345)
+	viper.Set("experiments.myexpt.roles.myrole.sshOptionsOverride", "-o Arg=val")
+
+	c, err = decodeConfigModel()
+	assert.NoError(t, err)
+	assert.Equal(t, "/path/to/keytabs", c.KeytabPath)
+	assert.Equal(t, "30s", c.MinTokenLifetime)
+	assert.Equal(t, newDefaultConfigModel().DBLocation, c.DBLocation)
+	assert.Equal(t, 25, c.Email.SMTPPort)
+	assert.Equal(t, "realexpt", c.experiment("myexpt").ExperimentOverride)
+	assert.Equal(t, []string{"email@example.com"}, c.experiment("MyExpt").Emails)
+
+	role := c.roleAt("experiments.myexpt.roles.myrole")
+	assert.Equal(t, "myaccount", role.Account)
+	assert.Equal(t, []destinationNodeConfig{{Node: "node1"}, {Node: "node2", Port: 2222, JumpHost: "bastion"}}, role.DestinationNodes)
+	assert.Equal(t, []string{"node1", "node2"}, role.destinationNodeNames())
+	if assert.NotNil(t, role.DesiredUIDOverride) {
+		assert.Equal(t, uint32(12345), *role.DesiredUIDOverride)
+	}
+	if assert.NotNil(t, role.SSHOptionsOverride) {
+		assert.Equal(t, "-o Arg=val", *role.SSHOptionsOverride)
+	}
+	assert.Nil(t, role.KeytabPathOverride)
+
+	assert.Equal(t, roleConfig{}, c.roleAt("experiments.myexpt.roles.otherrole"))
+	assert.Equal(t, roleConfig{}, c.roleAt("myexpt.myrole"))
+
+	// A value of the wrong type is a decoding error
+	viper.Set("experiments.myexpt.roles.myrole.desiredUIDOverride", "notanumber")
+	_, err = decodeConfigModel()
+	assert.Error(t, err)
+}
+
+// TestDecodeConfigModelSections checks that the timeouts, workerType, and observability sections are decoded on top of their defaults
+func TestDecodeConfigModelSections(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set("timeouts.kerberosTimeout", "15s")
+	viper.Set("timeouts.ferryRequestTimeout", "30s")
+	viper.Set("workerType.maxChildProcesses", 50)
+	viper.Set("workerType.pushTokens.numRetries", 3.0) // JSON stores every number as a float
+	viper.Set("workerType.pushTokens.retrySleep", "10s")
+	viper.Set("workerType.PushTokens.backoffMultiplier", 2)
+	viper.Set("logs.token-push.logfile", "/path/to/log")
+	viper.Set("loki.response_header_timeout", "5s")
+	viper.Set("devEnvironmentLabel", "development")
+	viper.Set("runReport.directory", "/path/to/reports")
+	viper.Set("runReport.junit", true)
+	viper.Set("runLock.waitTimeout", "5m")
+	viper.Set("notifications.SLACK_ALERTS_URL", "https://hooks.example.com/services/test")
+	viper.Set("notifications_test.admin_email", "admin1@example.com,admin2@example.com")
+	viper.Set("ferry.port", 8445)
+
+	c, err := decodeConfigModel()
+	assert.NoError(t, err)
+
+	expectedTimeouts := newDefaultConfigModel().Timeouts
+	expectedTimeouts.KerberosTimeout = "15s"
+	expectedTimeouts.FerryRequestTimeout = "30s"
+	assert.Equal(t, expectedTimeouts, c.Timeouts)
+	assert.NotContains(t, c.Timeouts.settings(), "ferryRequestTimeout")
+	assert.Equal(t, "15s", c.Timeouts.settings()["kerberosTimeout"])
+
+	assert.Equal(t, 50, c.WorkerType.MaxChildProcesses)
+	assert.Equal(t, workerSettingsConfig{NumRetries: 3, RetrySleep: "10s", BackoffMultiplier: 2}, c.WorkerType.forWorkerType(worker.PushTokens))
+	assert.Equal(t, workerSettingsConfig{}, c.WorkerType.forWorkerType(worker.GetKerberosTickets))
+
+	assert.Equal(t, logsConfig{LogFile: "/path/to/log"}, c.Logs["token-push"])
+	assert.Equal(t, lokiConfig{ResponseHeaderTimeout: "5s"}, c.Loki)
+	assert.Equal(t, newDefaultConfigModel().Prometheus, c.Prometheus)
+	assert.Equal(t, "development", c.DevEnvironmentLabel)
+	assert.Equal(t, runReportConfig{Directory: "/path/to/reports", JUnit: true}, c.RunReport)
+	assert.Equal(t, runLockConfig{WaitTimeout: "5m"}, c.RunLock)
+	assert.Equal(t, 8445, c.Ferry.Port)
+
+	// The notifications section keeps its default admin email, and notifications_test has none
+	assert.Equal(t, notificationsConfig{AdminEmail: stringList{"fife-group@fnal.gov"}, SlackAlertsURL: "https://hooks.example.com/services/test"},
+		c.adminNotifications(false))
+	assert.Equal(t, notificationsConfig{AdminEmail: stringList{"admin1@example.com", "admin2@example.com"}}, c.adminNotifications(true))
+}
+
+// TestWorkerTypeConfigMatchesWorkerTypes checks that the workerType section of the model has settings for every worker type, so that
+// forWorkerType can't silently return empty settings for one of them
+func TestWorkerTypeConfigMatchesWorkerTypes(t *testing.T) {
+	modelWorkerTypes := make([]string, 0)
+	workerTypeConfigType := reflect.TypeOf(workerTypeConfig{})
+	for i := range workerTypeConfigType.NumField() {
+		if workerTypeConfigType.Field(i).Type == reflect.TypeOf(workerSettingsConfig{}) {
+			modelWorkerTypes = append(modelWorkerTypes, jsonFieldName(workerTypeConfigType.Field(i)))
+		}
+	}
+	configWorkerTypes := make([]string, 0, len(validWorkerTypes))
+	for _, wt := range validWorkerTypes {
+		configWorkerTypes = append(configWorkerTypes, workerTypeToConfigString(wt))
+	}
+	assert.ElementsMatch(t, configWorkerTypes, modelWorkerTypes)
+}
+
+func TestConfigModelValidate(t *testing.T) {
+	c := newDefaultConfigModel()
+	assert.EqualError(t, c.validate(), "experiments is required")
+
+	c.Experiments["expt1"] = experimentConfig{
+		Emails: []string{"email@example.com"},
+		Roles: map[string]roleConfig{
+			"role1": {Account: "account1", DestinationNodes: []destinationNodeConfig{{Node: "node1"}}},
+			"role2": {DestinationNodes: []destinationNodeConfig{}},
+		},
+	}
+	c.Experiments["expt2"] = experimentConfig{}
+	err := c.validate()
+	assert.EqualError(t, err, "experiments.expt1.roles.role2.account is required\n"+
+		"experiments.expt1.roles.role2.destinationNodes is required\n"+
+		"experiments.expt2.emails is required\n"+
+		"experiments.expt2.roles is required")
+}
+
+func TestLoadConfigModel(t *testing.T) {
+	defer viper.Reset()
+	defer func() { configModel = nil }()
+
+	// The example configuration should always be valid
+	viper.SetConfigFile("../../managedTokens.yml")
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Could not read example configuration: %s", err)
+	}
+	assert.NoError(t, loadConfigModel())
+	assert.Same(t, configModel, getConfigModel())
+	assert.Equal(t, "dunepro", getConfigModel().roleAt("experiments.dune.roles.production").Account)
+
+	// Once loaded, the model does not change with the viper configuration
+	viper.Set("experiments.dune.roles.production.account", "otheraccount")
+	assert.Equal(t, "dunepro", getConfigModel().roleAt("experiments.dune.roles.production").Account)
+
+	configModel = nil
+	viper.Set("experiments.dune.roles.production.account", "")
+	assert.Error(t, loadConfigModel())
+	assert.Nil(t, configModel)
+}
+
+func TestConfigSchema(t *testing.T) {
+	var b bytes.Buffer
+	assert.ErrorIs(t, runConfigSubcommand(&b, []string{"schema"}), errExitOK)
+
+	var schema map[string]any
+	if err := json.Unmarshal(b.Bytes(), &schema); err != nil {
+		t.Fatalf("Schema is not valid JSON: %s", err)
+	}
+	assert.Equal(t, false, schema["additionalProperties"])
+	assert.Equal(t, []any{"experiments"}, schema["required"])
+
+	properties := schema["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string", "default": "10s", "description": "Minimum lifetime of the vault tokens that are pushed, given to htgettoken"},
+		properties["minTokenLifetime"])
+	circuitBreaker := properties["circuitBreaker"].(map[string]any)
+	assert.Equal(t, false, circuitBreaker["additionalProperties"])
+	assert.Equal(t, "6h0m0s", circuitBreaker["properties"].(map[string]any)["cooldown"].(map[string]any)["default"])
+	adminEmail := properties["notifications"].(map[string]any)["properties"].(map[string]any)["admin_email"].(map[string]any)
+	assert.Len(t, adminEmail["anyOf"], 2)
+	assert.Equal(t, []any{"fife-group@fnal.gov"}, adminEmail["default"])
+
+	experiment := properties["experiments"].(map[string]any)["additionalProperties"].(map[string]any)
+	assert.Equal(t, false, experiment["additionalProperties"])
+	role := experiment["properties"].(map[string]any)["roles"].(map[string]any)["additionalProperties"].(map[string]any)
+	assert.Equal(t, false, role["additionalProperties"])
+	assert.Equal(t, []any{"account", "destinationNodes"}, role["required"])
+	roleProperties := role["properties"].(map[string]any)
+	destinationNodes := roleProperties["destinationNodes"].(map[string]any)
+	assert.Equal(t, "array", destinationNodes["type"])
+	nodeSchemas := destinationNodes["items"].(map[string]any)["anyOf"].([]any)
+	if assert.Len(t, nodeSchemas, 2) {
+		assert.Equal(t, map[string]any{"type": "string"}, nodeSchemas[0])
+		assert.Equal(t, []any{"node"}, nodeSchemas[1].(map[string]any)["required"])
+		assert.Contains(t, nodeSchemas[1].(map[string]any)["properties"], "jumpHost")
+	}
+	assert.Equal(t, "integer", roleProperties["desiredUIDOverride"].(map[string]any)["type"])
+	assert.Contains(t, experiment["properties"], "keytabPathOverride")
+}
+
+// TestExampleConfigMatchesSchema checks that every key of the example configuration is a property in the JSON Schema, since the schema
+// doesn't allow any others
+func TestExampleConfigMatchesSchema(t *testing.T) {
+	b, err := os.ReadFile("../../managedTokens.json")
+	if err != nil {
+		t.Fatalf("Could not read example configuration: %s", err)
+	}
+	var config map[string]any
+	if err := json.Unmarshal(b, &config); err != nil {
+		t.Fatalf("Example configuration is not valid JSON: %s", err)
+	}
+	for _, key := range unknownConfigKeys(config, configSchema(), "") {
+		t.Errorf("Example configuration key %s is not in the schema", key)
+	}
+}
+
+// unknownConfigKeys returns the key paths in value, which start with prefix, that schema doesn't allow
+func unknownConfigKeys(value any, schema map[string]any, prefix string) []string {
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		for _, s := range anyOf {
+			if s.(map[string]any)["type"] == "object" {
+				schema = s.(map[string]any)
+			}
+		}
+	}
+	unknown := make([]string, 0)
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		for key, fieldValue := range v {
+			if fieldSchema, ok := properties[key].(map[string]any); ok {
+				unknown = append(unknown, unknownConfigKeys(fieldValue, fieldSchema, prefix+key+".")...)
+			} else if fieldSchema, ok := schema["additionalProperties"].(map[string]any); ok {
+				unknown = append(unknown, unknownConfigKeys(fieldValue, fieldSchema, prefix+key+".")...)
+			} else {
+				unknown = append(unknown, prefix+key)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for _, item := range v {
+				unknown = append(unknown, unknownConfigKeys(item, items, prefix)...)
+			}
+		}
+	}
+	return unknown
+}
+
+func TestOverridesAt(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("experiments.myexpt.keytabPathOverride", "/experiment/keytab")
+	viper.Set("experiments.myexpt.vaultServerOverride", "experimentvault")
+	viper.Set("experiments.myexpt.roles.myrole.vaultServerOverride", "rolevault")
+	viper.Set("experiments.myexpt.roles.otherrole.account", "otheraccount")
+
+	c, err := decodeConfigModel()
+	assert.NoError(t, err)
+
+	// The role's override takes precedence over the experiment's
+	overrides := c.overridesAt("experiments.myexpt.roles.myrole")
+	if assert.NotNil(t, overrides.VaultServerOverride) {
+		assert.Equal(t, "rolevault", *overrides.VaultServerOverride)
+	}
+	if assert.NotNil(t, overrides.KeytabPathOverride) {
+		assert.Equal(t, "/experiment/keytab", *overrides.KeytabPathOverride)
+	}
+	assert.Nil(t, overrides.SSHOptionsOverride)
+
+	overrides = c.overridesAt("experiments.myexpt.roles.otherrole")
+	if assert.NotNil(t, overrides.VaultServerOverride) {
+		assert.Equal(t, "experimentvault", *overrides.VaultServerOverride)
+	}
+
+	// Merging doesn't change the experiment's overrides
+	assert.Equal(t, "experimentvault", *c.experiment("myexpt").VaultServerOverride)
+	assert.Equal(t, settingOverrides{}, c.overridesAt("myexpt.myrole"))
+}
+
+func TestOverridesAtMergesMaps(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("experiments.myexpt.timeoutsOverride", map[string]any{"vaultstorerTimeout": "2m", "pushTimeout": "45s"})
+	viper.Set("experiments.myexpt.workerTypeOverride", map[string]any{"pushTokens": map[string]any{"numRetries": 3, "retrySleep": "5s"}})
+	viper.Set("experiments.myexpt.roles.myrole.timeoutsOverride", map[string]any{"vaultstorerTimeout": "3m"})
+	viper.Set("experiments.myexpt.roles.myrole.workerTypeOverride", map[string]any{"pushTokens": map[string]any{"numRetries": 1}})
+
+	c, err := decodeConfigModel()
+	assert.NoError(t, err)
+
+	// The role's entries take precedence, and the experiment's other entries still apply
+	overrides := c.overridesAt("experiments.myexpt.roles.myrole")
+	assert.Equal(t, map[string]string{"vaultstorertimeout": "3m", "pushtimeout": "45s"}, overrides.TimeoutsOverride)
+	if assert.Contains(t, overrides.WorkerTypeOverride, "pushtokens") {
+		pushOverrides := overrides.WorkerTypeOverride["pushtokens"]
+		assert.Equal(t, 1, *pushOverrides.NumRetries)
+		assert.Equal(t, "5s", *pushOverrides.RetrySleep)
+	}
+
+	// Merging doesn't change the experiment's overrides
+	assert.Equal(t, "2m", c.experiment("myexpt").TimeoutsOverride["vaultstorertimeout"])
+	assert.Equal(t, 3, *c.experiment("myexpt").WorkerTypeOverride["pushtokens"].NumRetries)
+}
+
+// TestConfigOverrideKeysMatchModel makes sure that every override that token-push looks for is part of the configuration model
+func TestConfigOverrideKeysMatchModel(t *testing.T) {
+	modelOverrides := make([]string, 0)
+	overridesType := reflect.TypeOf(settingOverrides{})
+	for i := range overridesType.NumField() {
+		modelOverrides = append(modelOverrides, strings.TrimSuffix(jsonFieldName(overridesType.Field(i)), "Override"))
+	}
+	assert.ElementsMatch(t, configOverrideKeys, modelOverrides)
+}
+
+func TestRunConfigSubcommandErrors(t *testing.T) {
+	var b bytes.Buffer
+	err := runConfigSubcommand(&b, nil)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, errExitOK))
+	assert.Error(t, runConfigSubcommand(&b, []string{"notasubcommand"}))
+	assert.Empty(t, b.String())
+}
@@ -0,0 +1,68 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/fermitools/managed-tokens/internal/configLoader"
+	"github.com/fermitools/managed-tokens/internal/secrets"
+)
+
+// configEncryptSecretSubcommand is the config subcommand that encrypts a secret for an encrypted-file reference
+const configEncryptSecretSubcommand = "encrypt-secret"
+
+// configSecretReferences holds the secret reference that each resolved configuration key was set to, by the key, lower-cased like viper
+// does.  These are shown in place of the secrets.
+var configSecretReferences = make(map[string]string)
+
+// displayConfigValue returns the value to show for the configuration key configPath, which has the value value.  If configPath was set
+// to a secret reference, the reference is returned instead of the secret.
+func displayConfigValue(configPath string, value any) any {
+	if reference, ok := configSecretReferences[strings.ToLower(configPath)]; ok {
+		return reference
+	}
+	return value
+}
+
+// runConfigEncryptSecret encrypts the secret read from r with the key in the secretsKeyFile, and writes the result to w.  Writing the
+// result to a file makes a file that an encrypted-file:<path> reference can refer to.
+func runConfigEncryptSecret(r io.Reader, w io.Writer) error {
+	keyFile := viper.GetString(configLoader.SecretsKeyFileKey)
+	if keyFile == "" {
+		return fmt.Errorf("config %s needs %s to be configured", configEncryptSecretSubcommand, configLoader.SecretsKeyFileKey)
+	}
+	key, err := secrets.ReadKey(keyFile)
+	if err != nil {
+		return err
+	}
+	secret, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("could not read secret: %w", err)
+	}
+	encrypted, err := secrets.Encrypt(key, strings.TrimRight(string(secret), "\r\n"))
+	if err != nil {
+		return fmt.Errorf("could not encrypt secret: %w", err)
+	}
+	if _, err := fmt.Fprintln(w, encrypted); err != nil {
+		return err
+	}
+	return errExitOK
+}
@@ -0,0 +1,80 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/configLoader"
+	"github.com/fermitools/managed-tokens/internal/secrets"
+)
+
+// TestDisplayConfigValue reads in a configuration that refers to secrets, and checks that the references are shown instead of the secrets
+func TestDisplayConfigValue(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	configSecretReferences = make(map[string]string)
+	defer func() { configSecretReferences = make(map[string]string) }()
+
+	tempDir := t.TempDir()
+	slackFile := filepath.Join(tempDir, "slack-url")
+	os.WriteFile(slackFile, []byte("https://hooks.example.com/services/fromfile\n"), 0o600)
+	configFile := filepath.Join(tempDir, "managedTokens.yml")
+	os.WriteFile(configFile, []byte("notifications:\n  SLACK_ALERTS_URL: file:"+slackFile+"\nemail:\n  from: admin@example.com\n"), 0o644)
+
+	viper.Set("configfile", configFile)
+	assert.NoError(t, initConfig())
+	assert.Equal(t, "https://hooks.example.com/services/fromfile", viper.GetString("notifications.slack_alerts_url"))
+	assert.Equal(t, "file:"+slackFile, displayConfigValue("notifications.SLACK_ALERTS_URL", viper.Get("notifications.slack_alerts_url")))
+	assert.Equal(t, "admin@example.com", displayConfigValue("email.from", viper.Get("email.from")))
+	assert.Equal(t, secrets.Redacted, secrets.Redact("https://hooks.example.com/services/fromfile"))
+}
+
+func TestRunConfigEncryptSecret(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	configSecretReferences = make(map[string]string)
+	defer func() { configSecretReferences = make(map[string]string) }()
+
+	tempDir := t.TempDir()
+	var b bytes.Buffer
+	assert.ErrorContains(t, runConfigEncryptSecret(strings.NewReader("mysecret"), &b), "needs secretsKeyFile to be configured")
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	keyFile := filepath.Join(tempDir, "secrets.key")
+	os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)), 0o600)
+	viper.Set("secretsKeyFile", keyFile)
+
+	assert.ErrorIs(t, runConfigEncryptSecret(strings.NewReader("mysecret\n"), &b), errExitOK)
+	encryptedFile := filepath.Join(tempDir, "secret.enc")
+	os.WriteFile(encryptedFile, b.Bytes(), 0o600)
+
+	// The encrypted file can be used as a reference
+	viper.Set("email.smtphost", "encrypted-file:"+encryptedFile)
+	_, err := configLoader.ResolveSecrets(viper.GetViper())
+	assert.NoError(t, err)
+	assert.Equal(t, "mysecret", viper.GetString("email.smtphost"))
+}
@@ -0,0 +1,49 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// configSources.go keeps track of the file that each experiment and role was defined in
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/fermitools/managed-tokens/internal/configDir"
+)
+
+// configSources holds the location that each experiment and role was defined at, by lower-cased configuration path
+var configSources map[string]configDir.Location
+
+// getConfigSource returns the location that the configuration path configPath was defined at.  Settings of an experiment or a role are
+// attributed to the file the experiment or role is defined in, and all other settings to the main configuration file.
+func getConfigSource(configPath string) configDir.Location {
+	parts := strings.Split(strings.ToLower(configPath), ".")
+	for i := min(len(parts), 4); i >= 2; i-- {
+		if l, ok := configSources[strings.Join(parts[:i], ".")]; ok {
+			return l
+		}
+	}
+	return configDir.Location{File: viper.ConfigFileUsed()}
+}
+
+// getServiceSource returns the location that the role at serviceConfigPath was defined at, or an empty string if it is not known
+func getServiceSource(serviceConfigPath string) string {
+	if l, ok := configSources[strings.ToLower(serviceConfigPath)]; ok {
+		return l.String()
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/configDir"
+)
+
+// TestConfigSources reads in a configuration with a configuration directory, and checks the locations that are reported for its settings
+func TestConfigSources(t *testing.T) {
+	defer viper.Reset()
+	defer func() { configSources = nil }()
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "managedTokens.yml")
+	files := map[string]string{
+		configFile: `keytabPath: /path/to/keytabs
+configDir: conf.d
+experiments:
+  dune:
+    emails: [email1@example.com]
+    roles:
+      production:
+        account: dunepro
+`,
+		filepath.Join(dir, "conf.d", "mu2e.yml"): `experiments:
+  mu2e:
+    emails: [email2@example.com]
+    roles:
+      production:
+        account: mu2epro
+`,
+		filepath.Join(dir, "conf.d", "nova.json"): `{"experiments": {"nova": {"emails": ["email3@example.com"], "roles": {"production": {"account": "novapro"}}}}}`,
+	}
+	if err := os.Mkdir(filepath.Join(dir, "conf.d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	viper.Set("configfile", configFile)
+	assert.NoError(t, initConfig())
+	assert.Equal(t, "mu2epro", viper.GetString("experiments.mu2e.roles.production.account"))
+
+	assert.Equal(t, configFile+":7", getServiceSource("experiments.dune.roles.production"))
+	assert.Equal(t, filepath.Join(dir, "conf.d", "mu2e.yml")+":5", getServiceSource("experiments.mu2e.roles.production"))
+	assert.Equal(t, filepath.Join(dir, "conf.d", "nova.json")+":1", getServiceSource("experiments.nova.roles.production"))
+	assert.Empty(t, getServiceSource("experiments.nova.roles.analysis"))
+
+	assert.Equal(t, configDir.Location{File: filepath.Join(dir, "conf.d", "mu2e.yml"), Line: 5},
+		getConfigSource("experiments.mu2e.roles.production.keytabPathOverride"))
+	assert.Equal(t, configDir.Location{File: filepath.Join(dir, "conf.d", "mu2e.yml"), Line: 2}, getConfigSource("experiments.mu2e.emails"))
+	assert.Equal(t, configDir.Location{File: configFile}, getConfigSource("keytabPath"))
+
+	// validate-config reports the file that each service and problem is in
+	result := validateConfiguration()
+	assert.Equal(t, map[string]string{
+		"dune_production": configFile + ":7",
+		"mu2e_production": filepath.Join(dir, "conf.d", "mu2e.yml") + ":5",
+		"nova_production": filepath.Join(dir, "conf.d", "nova.json") + ":1",
+	}, result.ServiceSources)
+	for _, p := range result.Problems {
+		if p.Key == "experiments.mu2e.roles.production.destinationNodes" {
+			assert.Equal(t, filepath.Join(dir, "conf.d", "mu2e.yml")+":5", p.File)
+		}
+	}
+
+	// An experiment defined in both the main configuration file and the configuration directory is an error
+	if err := os.WriteFile(filepath.Join(dir, "conf.d", "dune.yml"), []byte("experiments:\n  dune:\n    emails: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	viper.Set("configfile", configFile)
+	assert.EqualError(t, initConfig(),
+		"experiment dune is defined more than once: at "+configFile+":4 and at "+filepath.Join(dir, "conf.d", "dune.yml")+":2")
+}
+
+func TestConfigSourcesNoConfigDir(t *testing.T) {
+	defer viper.Reset()
+	defer func() { configSources = nil }()
+
+	viper.Set("configfile", "../../managedTokens.yml")
+	assert.NoError(t, initConfig())
+	assert.Regexp(t, `^\.\./\.\./managedTokens\.yml:\d+$`, getServiceSource("experiments.dune.roles.production"))
+}
@@ -40,6 +40,11 @@ var serviceConfigPath string = "experiments.myexperiment.roles.myrole"
 
 func serviceOverrideKey(key string) string { return serviceConfigPath + "." + key + "Override" }
 
+func experimentOverrideKey(key string) string {
+	experiment, _, _ := parseServiceConfigPath(serviceConfigPath)
+	return "experiments." + experiment + "." + key + "Override"
+}
+
 func skipForCI(t *testing.T) {
 	if val, ok := os.LookupEnv("CI"); ok && val != "" {
 		t.Skipf("Skipping test in CI environment.  CI=%s", val)
@@ -97,6 +102,28 @@ func TestGetConfigOverridePath(t *testing.T) {
 			false,
 			checkOverriddenAndGetKey,
 		},
+		{
+			"Valid experiment-level override",
+			func() string {
+				returnKey := randomKey()
+				viper.Set(returnKey, "foo")
+				viper.Set(experimentOverrideKey(returnKey), "bar")
+				return returnKey
+			},
+			true,
+			func(_ bool, key string) string { return experimentOverrideKey(key) },
+		},
+		{
+			"Service-level override takes precedence over experiment-level override",
+			func() string {
+				returnKey := randomKey()
+				viper.Set(experimentOverrideKey(returnKey), "foo")
+				viper.Set(serviceOverrideKey(returnKey), "bar")
+				return returnKey
+			},
+			true,
+			checkOverriddenAndGetKey,
+		},
 	}
 
 	for _, test := range testCases {
@@ -720,19 +747,19 @@ func TestGetConstraintFromConfiguration(t *testing.T) {
 		{
 			"No constraint in configuration",
 			func() {},
-			"myexpt",
+			"experiments.myexpt.roles.myrole",
 			"",
 		},
 		{
 			"Constraint at global level for config",
 			func() { viper.Set("condorScheddConstraint", "foobar") },
-			"myexpt",
+			"experiments.myexpt.roles.myrole",
 			"foobar",
 		},
 		{
 			"Constraint set at override level",
-			func() { viper.Set("myexpt.condorScheddConstraintOverride", "baz") },
-			"myexpt",
+			func() { viper.Set("experiments.myexpt.roles.myrole.condorScheddConstraintOverride", "baz") },
+			"experiments.myexpt.roles.myrole",
 			"baz",
 		},
 	}
@@ -884,7 +911,7 @@ func TestGetDefaultRoleFileDestinationTemplate(t *testing.T) {
 		{
 			"No template in configuration",
 			func() {},
-			"myexpt",
+			"experiments.myexpt.roles.myrole",
 			"/tmp/default_role_{{.Experiment}}_{{.DesiredUID}}",
 		},
 		{
@@ -892,15 +919,15 @@ func TestGetDefaultRoleFileDestinationTemplate(t *testing.T) {
 			func() {
 				viper.Set("defaultRoleFileDestinationTemplate", "/custom/path/{{.Experiment}}_{{.DesiredUID}}")
 			},
-			"myexpt",
+			"experiments.myexpt.roles.myrole",
 			"/custom/path/{{.Experiment}}_{{.DesiredUID}}",
 		},
 		{
 			"Template set at override level",
 			func() {
-				viper.Set("myexpt.defaultRoleFileDestinationTemplateOverride", "/override/path/{{.Experiment}}_{{.DesiredUID}}")
+				viper.Set("experiments.myexpt.roles.myrole.defaultRoleFileDestinationTemplateOverride", "/override/path/{{.Experiment}}_{{.DesiredUID}}")
 			},
-			"myexpt",
+			"experiments.myexpt.roles.myrole",
 			"/override/path/{{.Experiment}}_{{.DesiredUID}}",
 		},
 	}
@@ -1167,11 +1194,39 @@ func TestResolveDisableNotifications(t *testing.T) {
 	}
 }
 
+func TestGetConcurrencyLimitsFromConfiguration(t *testing.T) {
+	defer viper.Reset()
+	// Only the vault token storers are limited by default
+	assert.Equal(t,
+		worker.ConcurrencyLimits{PerWorkerType: map[worker.WorkerType]int{worker.StoreAndGetToken: 10}},
+		getConcurrencyLimitsFromConfiguration(),
+	)
+
+	viper.Set("workerType.maxChildProcesses", 50)
+	viper.Set("workerType.maxConcurrencyPerNode", 5)
+	viper.Set("workerType.pushTokens.maxConcurrency", 20)
+	viper.Set("workerType.pingAggregator.maxConcurrency", float64(10)) // Like we'd get from a JSON config
+	viper.Set("workerType.storeAndGetToken.maxConcurrency", 3)
+	assert.Equal(t,
+		worker.ConcurrencyLimits{
+			Global:        50,
+			PerNode:       5,
+			PerWorkerType: map[worker.WorkerType]int{worker.PushTokens: 20, worker.PingAggregator: 10, worker.StoreAndGetToken: 3},
+		},
+		getConcurrencyLimitsFromConfiguration(),
+	)
+
+	// Setting the vault token storers' limit to 0 removes it
+	viper.Set("workerType.storeAndGetToken.maxConcurrency", 0)
+	assert.NotContains(t, getConcurrencyLimitsFromConfiguration().PerWorkerType, worker.StoreAndGetToken)
+}
+
 func TestCheckRetryTimeout(t *testing.T) {
 	type testCase struct {
 		description        string
 		numRetries         int
 		retrySleepDuration time.Duration
+		backoff            retryBackoffConfig
 		timeout            time.Duration
 		expectedError      bool
 	}
@@ -1198,11 +1253,35 @@ func TestCheckRetryTimeout(t *testing.T) {
 			timeout:            20 * time.Second,
 			expectedError:      true,
 		},
+		{
+			description:        "Timeout is less than the growing sleeps",
+			numRetries:         3,
+			retrySleepDuration: 10 * time.Second,
+			backoff:            retryBackoffConfig{multiplier: 2},
+			timeout:            40 * time.Second,
+			expectedError:      true,
+		},
+		{
+			description:        "Timeout is less than the sleeps with jitter",
+			numRetries:         3,
+			retrySleepDuration: 10 * time.Second,
+			backoff:            retryBackoffConfig{jitter: 0.5},
+			timeout:            40 * time.Second,
+			expectedError:      true,
+		},
+		{
+			description:        "Max elapsed time caps the growing sleeps",
+			numRetries:         3,
+			retrySleepDuration: 10 * time.Second,
+			backoff:            retryBackoffConfig{multiplier: 2, jitter: 0.5, maxElapsedTime: 40 * time.Second},
+			timeout:            40 * time.Second,
+			expectedError:      false,
+		},
 	}
 
 	for _, test := range testCases {
 		t.Run(test.description, func(t *testing.T) {
-			err := checkRetryTimeout(test.numRetries, test.retrySleepDuration, test.timeout)
+			err := checkRetryTimeout(test.numRetries, test.retrySleepDuration, test.backoff, test.timeout)
 			if test.expectedError {
 				assert.Error(t, err)
 			} else {
@@ -1302,7 +1381,7 @@ func TestCreateWorkerRetryMap(t *testing.T) {
 			viper.Reset()
 			defer viper.Reset()
 			test.testConfigSetup()
-			workerRetryMap, err := createWorkerRetryMap(test.timeoutsMap)
+			workerRetryMap, err := createWorkerRetryMap("", test.timeoutsMap)
 			assert.Equal(t, test.expected, workerRetryMap)
 			test.expectedErrFunc(t, err)
 		})
@@ -1356,7 +1435,7 @@ func TestGetAndCheckRetryInfoFromConfig(t *testing.T) {
 			viper.Set("workerType."+workerTypeToConfigString(tt.workerType)+".numRetries", tt.numRetries)
 			viper.Set("workerType."+workerTypeToConfigString(tt.workerType)+".retrySleep", tt.retrySleep.String())
 
-			numRetries, retrySleep, err := getAndCheckRetryInfoFromConfig(tt.workerType, tt.checkTimeout)
+			numRetries, retrySleep, err := getAndCheckRetryInfoFromConfig("", tt.workerType, tt.checkTimeout)
 			if tt.expectedError != nil {
 				assert.EqualError(t, err, tt.expectedError.Error())
 				assert.Equal(t, 0, numRetries)
@@ -1371,7 +1450,7 @@ func TestGetAndCheckRetryInfoFromConfig(t *testing.T) {
 	}
 }
 func TestGetTokenGetterOverrideFromConfiguration(t *testing.T) {
-	configPath := "configroot"
+	configPath := "experiments.myexpt.roles.myrole"
 
 	type testCase struct {
 		description      string
@@ -1436,3 +1515,316 @@ func TestGetTokenGetterOverrideFromConfiguration(t *testing.T) {
 		})
 	}
 }
+
+func TestGetTokenDestinationsFromConfig(t *testing.T) {
+	type testCase struct {
+		description       string
+		configSetupFunc   func()
+		serviceConfigPath string
+		expectedResult    []worker.TokenDestination
+	}
+
+	testCases := []testCase{
+		{
+			"No destinations in configuration",
+			func() {},
+			"experiments.myexpt.roles.myrole",
+			worker.DefaultTokenDestinations(),
+		},
+		{
+			"Destinations at global level",
+			func() {
+				viper.Set("tokenDestinations", []map[string]any{{"path": "/tmp/vt_{{.Account}}"}, {"path": "/tmp/vt_{{.Service}}", "optional": true}})
+			},
+			"experiments.myexpt.roles.myrole",
+			[]worker.TokenDestination{{Template: "/tmp/vt_{{.Account}}"}, {Template: "/tmp/vt_{{.Service}}", Optional: true}},
+		},
+		{
+			"Destinations overridden at experiment level",
+			func() {
+				viper.Set("tokenDestinations", []map[string]any{{"path": "/tmp/vt_{{.Account}}"}, {"path": "/tmp/vt_{{.Service}}"}})
+				viper.Set("experiments.myexpt.tokenDestinationsOverride", []map[string]any{{"path": "/expt/{{.Role}}", "optional": true}})
+			},
+			"experiments.myexpt.roles.myrole",
+			[]worker.TokenDestination{{Template: "/expt/{{.Role}}", Optional: true}},
+		},
+		{
+			"Destinations overridden at role level",
+			func() {
+				viper.Set("experiments.myexpt.tokenDestinationsOverride", []map[string]any{{"path": "/expt/{{.Role}}"}})
+				viper.Set("experiments.myexpt.roles.myrole.tokenDestinationsOverride", []map[string]any{{"path": "/role/{{.DesiredUID}}"}})
+			},
+			"experiments.myexpt.roles.myrole",
+			[]worker.TokenDestination{{Template: "/role/{{.DesiredUID}}"}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(
+			test.description,
+			func(t *testing.T) {
+				reset()
+				test.configSetupFunc()
+				assert.Equal(t, test.expectedResult, getTokenDestinationsFromConfig(test.serviceConfigPath))
+			},
+		)
+	}
+}
+
+func TestGetNodeOptionsFromConfiguration(t *testing.T) {
+	reset()
+	defer reset()
+	viper.Set("experiments.myexpt.roles.myrole.destinationNodes", []any{
+		"node1",
+		map[string]any{"node": "node2"},
+		map[string]any{
+			"node":              "node3",
+			"account":           "node3account",
+			"port":              2222,
+			"jumpHost":          "user@bastion",
+			"sshOptions":        "-o Arg1=val1",
+			"fileCopierOptions": "--chmod=u=r,go=",
+			"pingOptions":       "-W 2",
+		},
+	})
+
+	assert.Equal(t,
+		map[string]worker.NodeOptions{
+			"node3": {
+				Account:           "node3account",
+				Port:              2222,
+				JumpHost:          "user@bastion",
+				SSHOptions:        []string{"-o", "Arg1=val1"},
+				FileCopierOptions: []string{"--chmod=u=r,go="},
+				PingOptions:       []string{"-W", "2"},
+			},
+		},
+		getNodeOptionsFromConfiguration("experiments.myexpt.roles.myrole"),
+	)
+	assert.Empty(t, getNodeOptionsFromConfiguration("experiments.myexpt.roles.otherrole"))
+}
+
+func TestGetServiceTimeouts(t *testing.T) {
+	globalTimeouts := map[timeoutKey]time.Duration{
+		timeoutGlobal:      300 * time.Second,
+		timeoutKerberos:    20 * time.Second,
+		timeoutVaultStorer: 60 * time.Second,
+		timeoutPing:        10 * time.Second,
+		timeoutPush:        30 * time.Second,
+	}
+	serviceConfigPath := "experiments.myexpt.roles.myrole"
+
+	type testCase struct {
+		description      string
+		timeoutsOverride map[string]any
+		expected         map[timeoutKey]time.Duration
+		errContains      string
+	}
+
+	testCases := []testCase{
+		{
+			description: "No overrides",
+			expected:    globalTimeouts,
+		},
+		{
+			description:      "Valid overrides",
+			timeoutsOverride: map[string]any{"vaultstorerTimeout": "2m", "globalTimeout": "400s"},
+			expected: map[timeoutKey]time.Duration{
+				timeoutGlobal:      400 * time.Second,
+				timeoutKerberos:    20 * time.Second,
+				timeoutVaultStorer: 2 * time.Minute,
+				timeoutPing:        10 * time.Second,
+				timeoutPush:        30 * time.Second,
+			},
+		},
+		{
+			description:      "Unsupported timeout",
+			timeoutsOverride: map[string]any{"fooTimeout": "2m"},
+			expected:         globalTimeouts,
+			errContains:      "footimeout is not a supported timeout",
+		},
+		{
+			description:      "Unparseable timeout",
+			timeoutsOverride: map[string]any{"pushTimeout": "forever"},
+			expected:         globalTimeouts,
+			errContains:      "could not parse pushtimeout",
+		},
+		{
+			description:      "Component timeouts exceed global timeout",
+			timeoutsOverride: map[string]any{"vaultstorerTimeout": "5m"},
+			expected:         globalTimeouts,
+			errContains:      "exceed the global timeout",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			viper.Set(serviceConfigPath+".account", "myaccount")
+			if tc.timeoutsOverride != nil {
+				viper.Set(serviceConfigPath+".timeoutsOverride", tc.timeoutsOverride)
+			}
+
+			serviceTimeouts, err := getServiceTimeouts(serviceConfigPath, globalTimeouts)
+			assert.Equal(t, tc.expected, serviceTimeouts)
+			if tc.errContains != "" {
+				assert.ErrorContains(t, err, tc.errContains)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRetryBackoffMaxTotalSleep(t *testing.T) {
+	assert.Equal(t, 30*time.Second, retryBackoffConfig{}.maxTotalSleep(3, 10*time.Second))
+	assert.Equal(t, 70*time.Second, retryBackoffConfig{multiplier: 2}.maxTotalSleep(3, 10*time.Second))
+	assert.Equal(t, 105*time.Second, retryBackoffConfig{multiplier: 2, jitter: 0.5}.maxTotalSleep(3, 10*time.Second))
+	assert.Equal(t, time.Minute, retryBackoffConfig{multiplier: 2, maxElapsedTime: time.Minute}.maxTotalSleep(3, 10*time.Second))
+	assert.Equal(t, time.Duration(0), retryBackoffConfig{multiplier: 2}.maxTotalSleep(0, 10*time.Second))
+}
+
+func TestGetRetryBackoffFromConfig(t *testing.T) {
+	serviceConfigPath := "experiments.myexpt.roles.myrole"
+
+	type testCase struct {
+		description string
+		setupFunc   func()
+		expected    retryBackoffConfig
+		errContains string
+	}
+
+	testCases := []testCase{
+		{
+			description: "Nothing set",
+			setupFunc:   func() {},
+			expected:    retryBackoffConfig{},
+		},
+		{
+			description: "Global settings",
+			setupFunc: func() {
+				viper.Set("workerType.pushTokens.backoffMultiplier", 2)
+				viper.Set("workerType.pushTokens.jitter", 0.2)
+				viper.Set("workerType.pushTokens.maxElapsedTime", "1m")
+			},
+			expected: retryBackoffConfig{multiplier: 2, jitter: 0.2, maxElapsedTime: time.Minute},
+		},
+		{
+			description: "Overrides take precedence",
+			setupFunc: func() {
+				viper.Set("workerType.pushTokens.backoffMultiplier", 2)
+				viper.Set("workerType.pushTokens.jitter", 0.2)
+				viper.Set("experiments.myexpt.workerTypeOverride.pushTokens.backoffMultiplier", 3)
+				viper.Set(serviceConfigPath+".workerTypeOverride.pushTokens.maxElapsedTime", "30s")
+			},
+			expected: retryBackoffConfig{multiplier: 3, jitter: 0.2, maxElapsedTime: 30 * time.Second},
+		},
+		{
+			description: "Multiplier less than 1",
+			setupFunc:   func() { viper.Set("workerType.pushTokens.backoffMultiplier", 0.5) },
+			errContains: "backoffMultiplier cannot be less than 1",
+		},
+		{
+			description: "Jitter more than 1",
+			setupFunc:   func() { viper.Set(serviceConfigPath+".workerTypeOverride.pushTokens.jitter", 1.5) },
+			errContains: "jitter must be between 0 and 1",
+		},
+		{
+			description: "Unparseable maxElapsedTime override",
+			setupFunc:   func() { viper.Set(serviceConfigPath+".workerTypeOverride.pushTokens.maxElapsedTime", "soon") },
+			errContains: "could not parse maxElapsedTime override",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			viper.Set(serviceConfigPath+".account", "myaccount")
+			tc.setupFunc()
+			backoff, err := getRetryBackoffFromConfig(serviceConfigPath, worker.PushTokens)
+			if tc.errContains != "" {
+				assert.ErrorContains(t, err, tc.errContains)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, backoff)
+		})
+	}
+}
+
+func TestCreateWorkerRetryMapServiceOverrides(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	serviceConfigPath := "experiments.myexpt.roles.myrole"
+	timeoutsMap := map[timeoutKey]time.Duration{
+		timeoutGlobal:      300 * time.Second,
+		timeoutKerberos:    20 * time.Second,
+		timeoutVaultStorer: 60 * time.Second,
+		timeoutPing:        10 * time.Second,
+		timeoutPush:        30 * time.Second,
+	}
+	viper.Set("workerType.pushTokens.numRetries", 2)
+	viper.Set("workerType.pushTokens.retrySleep", "5s")
+	viper.Set(serviceConfigPath+".account", "myaccount")
+	viper.Set("experiments.myexpt.workerTypeOverride.pushTokens.numRetries", 4)
+
+	// The global retry settings ignore the overrides
+	workerRetryMap, err := createWorkerRetryMap("", timeoutsMap)
+	assert.NoError(t, err)
+	assert.Equal(t, workerRetryConfig{numRetries: 2, retrySleep: 5 * time.Second}, workerRetryMap[worker.PushTokens])
+
+	// The experiment's override applies to the role, and unset settings come from the workerType section
+	workerRetryMap, err = createWorkerRetryMap(serviceConfigPath, timeoutsMap)
+	assert.NoError(t, err)
+	assert.Equal(t, workerRetryConfig{numRetries: 4, retrySleep: 5 * time.Second}, workerRetryMap[worker.PushTokens])
+
+	// The retries still have to fit in the service's timeout
+	viper.Set(serviceConfigPath+".workerTypeOverride.pushTokens.retrySleep", "10s")
+	_, err = createWorkerRetryMap(serviceConfigPath, timeoutsMap)
+	assert.ErrorContains(t, err, "invalid timeout pushTokens")
+
+	viper.Set(serviceConfigPath+".workerTypeOverride.pushTokens.retrySleep", "soon")
+	_, err = createWorkerRetryMap(serviceConfigPath, timeoutsMap)
+	assert.ErrorContains(t, err, "could not parse retrySleep override")
+
+	// The backoff settings are carried along, and the growing sleeps have to fit in the timeout too
+	viper.Set(serviceConfigPath+".workerTypeOverride.pushTokens.retrySleep", "2s")
+	viper.Set(serviceConfigPath+".workerTypeOverride.pushTokens.backoffMultiplier", 1.5)
+	workerRetryMap, err = createWorkerRetryMap(serviceConfigPath, timeoutsMap)
+	assert.NoError(t, err)
+	assert.Equal(t, workerRetryConfig{numRetries: 4, retrySleep: 2 * time.Second, backoff: retryBackoffConfig{multiplier: 1.5}}, workerRetryMap[worker.PushTokens])
+
+	viper.Set(serviceConfigPath+".workerTypeOverride.pushTokens.backoffMultiplier", 3)
+	_, err = createWorkerRetryMap(serviceConfigPath, timeoutsMap)
+	assert.ErrorContains(t, err, "invalid timeout pushTokens")
+	viper.Set(serviceConfigPath+".workerTypeOverride.pushTokens.backoffMultiplier", 1)
+
+	// Each kerberos attempt gets the whole kerberos timeout, so its retries only have to fit in the global timeout
+	viper.Set("workerType.getKerberosTickets.numRetries", 2)
+	viper.Set("workerType.getKerberosTickets.retrySleep", "60s")
+	workerRetryMap, err = createWorkerRetryMap(serviceConfigPath, timeoutsMap)
+	assert.NoError(t, err)
+	assert.Equal(t, workerRetryConfig{numRetries: 2, retrySleep: 60 * time.Second}, workerRetryMap[worker.GetKerberosTickets])
+
+	viper.Set("workerType.getKerberosTickets.retrySleep", "200s")
+	_, err = createWorkerRetryMap(serviceConfigPath, timeoutsMap)
+	assert.ErrorContains(t, err, "invalid timeout getKerberosTickets")
+}
+
+// TestDefaultTimeouts checks that every supported timeout has a default in the configuration model that can be parsed
+func TestDefaultTimeouts(t *testing.T) {
+	_, err := applyTimeoutSettings(make(map[timeoutKey]time.Duration), newDefaultConfigModel().Timeouts.settings())
+	assert.NoError(t, err)
+	assert.Equal(t,
+		map[timeoutKey]time.Duration{
+			timeoutGlobal:      300 * time.Second,
+			timeoutKerberos:    20 * time.Second,
+			timeoutVaultStorer: 60 * time.Second,
+			timeoutPing:        10 * time.Second,
+			timeoutPush:        30 * time.Second,
+		},
+		defaultTimeouts(),
+	)
+}
@@ -0,0 +1,197 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// daemon.go provides the scheduler that token-push uses when it is run with the --daemon flag.  Rather than exiting after a single
+// pass, token-push keeps running and periodically calls run() on the services that are due, according to the global daemonInterval
+// and any per-service daemonIntervalOverride settings.  State that is expensive to rebuild (the configuration, the schedd cache,
+// the database handle, and the metrics registry) is carried over from one cycle to the next.
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/fermitools/managed-tokens/internal/db"
+	"github.com/fermitools/managed-tokens/internal/service"
+)
+
+const (
+	daemonIntervalDefault      = time.Hour
+	scheddCacheLifetimeDefault = 6 * time.Hour
+)
+
+// daemonDatabase is the database handle that is kept open across daemon cycles.  It is nil unless token-push is running in daemon mode.
+var daemonDatabase *db.ManagedTokensDatabase
+
+// daemonScheduler keeps track of when each service was last run, and when each service is next due to be run
+type daemonScheduler struct {
+	// services holds all of the services the daemon is responsible for, in the order they were configured
+	services []service.Service
+	// intervals maps each service name to the interval at which that service should be run
+	intervals map[string]time.Duration
+	// lastRun maps each service name to the time it was last run.  Services that have never been run are absent
+	lastRun map[string]time.Time
+}
+
+// newDaemonScheduler returns a *daemonScheduler for the given services.  Each service's interval is read from the
+// configuration, either from the service's daemonIntervalOverride key, or from the global daemonInterval key.
+func newDaemonScheduler(services []service.Service) *daemonScheduler {
+	d := &daemonScheduler{
+		services:  services,
+		intervals: make(map[string]time.Duration, len(services)),
+		lastRun:   make(map[string]time.Time, len(services)),
+	}
+	for _, s := range services {
+		serviceConfigPath := "experiments." + s.Experiment() + ".roles." + s.Role()
+		d.intervals[getServiceName(s)] = getDaemonIntervalFromConfiguration(serviceConfigPath)
+	}
+	return d
+}
+
+// dueServices returns the services that should be run at time now
+func (d *daemonScheduler) dueServices(now time.Time) []service.Service {
+	due := make([]service.Service, 0, len(d.services))
+	for _, s := range d.services {
+		last, ok := d.lastRun[getServiceName(s)]
+		if !ok || !now.Before(last.Add(d.intervals[getServiceName(s)])) {
+			due = append(due, s)
+		}
+	}
+	return due
+}
+
+// markRun records that the given services were run at time t
+func (d *daemonScheduler) markRun(services []service.Service, t time.Time) {
+	for _, s := range services {
+		d.lastRun[getServiceName(s)] = t
+	}
+}
+
+// nextRun returns the earliest time at which any service is due to be run
+func (d *daemonScheduler) nextRun() time.Time {
+	var next time.Time
+	for _, s := range d.services {
+		last, ok := d.lastRun[getServiceName(s)]
+		if !ok {
+			return time.Now()
+		}
+		due := last.Add(d.intervals[getServiceName(s)])
+		if next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+	return next
+}
+
+// runDaemon runs the token-push operations in a loop until ctx is canceled.  Each cycle only operates on the services that are due
+// to be run, and each cycle is subject to the global timeout.
+func runDaemon(ctx context.Context) error {
+	if len(services) == 0 {
+		return errors.New("no services configured for daemon to operate on")
+	}
+
+	allServices := services
+	defer func() { services = allServices }()
+
+	scheduler := newDaemonScheduler(allServices)
+	scheddCacheLifetime := getScheddCacheLifetimeFromConfiguration()
+
+	defer func() {
+		if daemonDatabase != nil {
+			daemonDatabase.Close()
+			daemonDatabase = nil
+		}
+	}()
+
+	exeLogger.Info("Starting token-push in daemon mode")
+	for {
+		if due := scheduler.dueServices(time.Now()); len(due) > 0 {
+			runDaemonCycle(ctx, due)
+			scheduler.markRun(due, time.Now())
+			globalScheddCache.expireEntries(scheddCacheLifetime)
+		}
+
+		next := scheduler.nextRun()
+		exeLogger.WithField("nextRun", next.Format(time.RFC3339)).Debug("Waiting for next daemon cycle")
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			exeLogger.Info("Stopping token-push daemon")
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// runDaemonCycle runs the token-push operations once on the given services, and resets the state that should not persist
+// from one cycle to the next
+func runDaemonCycle(ctx context.Context, due []service.Service) {
+	startSetup = time.Now()
+	services = due
+	defer resetNotificationsManagerState()
+
+	ctx, cancel := context.WithTimeout(ctx, timeouts[timeoutGlobal])
+	defer cancel()
+
+	serviceNames := make([]string, 0, len(due))
+	for _, s := range due {
+		serviceNames = append(serviceNames, getServiceName(s))
+	}
+	cycleLogger := exeLogger.WithField("services", serviceNames)
+	cycleLogger.Info("Starting daemon cycle")
+	if err := run(ctx); err != nil {
+		cycleLogger.Error("Error running operations to push vault tokens during daemon cycle")
+		return
+	}
+	cycleLogger.Info("Finished daemon cycle")
+}
+
+// getDaemonIntervalFromConfiguration returns the interval at which the service with the given configPath should be run in
+// daemon mode.  If the configured interval cannot be parsed or is not positive, the default interval is returned.
+func getDaemonIntervalFromConfiguration(configPath string) time.Duration {
+	cfg := getConfigModel()
+	interval, err := time.ParseDuration(overrideOr(cfg.overridesAt(configPath).DaemonIntervalOverride, cfg.DaemonInterval))
+	if err != nil || interval <= 0 {
+		log.WithField("configPath", configPath).Warnf("Could not parse configured daemon interval.  Using default of %s", daemonIntervalDefault)
+		return daemonIntervalDefault
+	}
+	return interval
+}
+
+// getScheddCacheLifetimeFromConfiguration returns how long schedds queried from a collector should be cached before they are queried again
+func getScheddCacheLifetimeFromConfiguration() time.Duration {
+	lifetime, err := time.ParseDuration(getConfigModel().ScheddCacheLifetime)
+	if err != nil || lifetime < 0 {
+		log.Warnf("Could not parse configured scheddCacheLifetime.  Using default of %s", scheddCacheLifetimeDefault)
+		return scheddCacheLifetimeDefault
+	}
+	return lifetime
+}
+
+func checkDaemonFlags() error {
+	if !viper.GetBool("daemon") {
+		return nil
+	}
+	if viper.GetBool("run-onboarding") {
+		return errors.New("daemon flag cannot be used with the run-onboarding flag")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/service"
+)
+
+func TestGetDaemonIntervalFromConfiguration(t *testing.T) {
+	configPath := "experiments.myexpt.roles.myrole"
+	type testCase struct {
+		description      string
+		setupFunc        func()
+		expectedInterval time.Duration
+	}
+
+	testCases := []testCase{
+		{
+			"Nothing set - use default",
+			func() {},
+			daemonIntervalDefault,
+		},
+		{
+			"Global interval set",
+			func() { viper.Set("daemonInterval", "30m") },
+			30 * time.Minute,
+		},
+		{
+			"Global and service-level interval set",
+			func() {
+				viper.Set("daemonInterval", "30m")
+				viper.Set(configPath+".daemonIntervalOverride", "10m")
+			},
+			10 * time.Minute,
+		},
+		{
+			"Unparseable interval - use default",
+			func() { viper.Set("daemonInterval", "notaduration") },
+			daemonIntervalDefault,
+		},
+		{
+			"Negative interval - use default",
+			func() { viper.Set("daemonInterval", "-10m") },
+			daemonIntervalDefault,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(
+			test.description,
+			func(t *testing.T) {
+				test.setupFunc()
+				defer viper.Reset()
+				assert.Equal(t, test.expectedInterval, getDaemonIntervalFromConfiguration(configPath))
+			},
+		)
+	}
+}
+
+func TestDaemonScheduler(t *testing.T) {
+	viper.Set("daemonInterval", "1h")
+	viper.Set("experiments.expt1.roles.role1.daemonIntervalOverride", "10m")
+	defer viper.Reset()
+
+	s1 := service.NewService("expt1_role1")
+	s2 := service.NewService("expt2_role1")
+	d := newDaemonScheduler([]service.Service{s1, s2})
+
+	start := time.Now()
+
+	// Nothing has run yet, so everything should be due
+	assert.ElementsMatch(t, []service.Service{s1, s2}, d.dueServices(start))
+	assert.False(t, d.nextRun().After(time.Now()))
+
+	d.markRun([]service.Service{s1, s2}, start)
+	assert.Empty(t, d.dueServices(start.Add(5*time.Minute)))
+	assert.Equal(t, start.Add(10*time.Minute), d.nextRun())
+
+	// Only the service with the shorter interval should be due
+	assert.Equal(t, []service.Service{s1}, d.dueServices(start.Add(10*time.Minute)))
+	d.markRun([]service.Service{s1}, start.Add(10*time.Minute))
+	assert.Equal(t, start.Add(20*time.Minute), d.nextRun())
+
+	// Both services should be due
+	assert.ElementsMatch(t, []service.Service{s1, s2}, d.dueServices(start.Add(time.Hour)))
+}
+
+func TestScheddCacheExpireEntries(t *testing.T) {
+	c := scheddCache{
+		cache:     make(map[string]*scheddCacheEntry),
+		createdAt: make(map[string]time.Time),
+		mu:        &sync.Mutex{},
+	}
+	c.cache["fresh"] = &scheddCacheEntry{newScheddCollection(), &sync.Once{}, nil}
+	c.createdAt["fresh"] = time.Now()
+	c.cache["old"] = &scheddCacheEntry{newScheddCollection(), &sync.Once{}, nil}
+	c.createdAt["old"] = time.Now().Add(-2 * time.Hour)
+	c.cache["errored"] = &scheddCacheEntry{newScheddCollection(), &sync.Once{}, errors.New("this failed")}
+	c.createdAt["errored"] = time.Now()
+
+	c.expireEntries(time.Hour)
+	assert.Contains(t, c.cache, "fresh")
+	assert.NotContains(t, c.cache, "old")
+	assert.NotContains(t, c.cache, "errored")
+	assert.NotContains(t, c.createdAt, "old")
+}
+
+func TestCheckDaemonFlags(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set("daemon", false)
+	viper.Set("run-onboarding", true)
+	assert.NoError(t, checkDaemonFlags())
+
+	viper.Set("daemon", true)
+	assert.Error(t, checkDaemonFlags())
+
+	viper.Set("run-onboarding", false)
+	assert.NoError(t, checkDaemonFlags())
+}
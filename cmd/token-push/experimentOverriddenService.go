@@ -16,8 +16,6 @@
 package main
 
 import (
-	"github.com/spf13/viper"
-
 	"github.com/fermitools/managed-tokens/internal/service"
 )
 
@@ -89,7 +87,7 @@ func getServiceName(s service.Service) string {
 // CheckExperimentOverride checks the configuration for a given experiment to see if it has an "experimentOverride" key defined.
 // If it does, it will return that override value.  Else, it will return the passed in experiment string
 func checkExperimentOverride(experiment string) string {
-	if override := viper.GetString("experiments." + experiment + ".experimentOverride"); override != "" {
+	if override := getConfigModel().experiment(experiment).ExperimentOverride; override != "" {
 		return override
 	}
 	return experiment
@@ -0,0 +1,39 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// jsonnetConfig.go implements token-push config render, which prints the evaluated .jsonnet configuration
+
+import (
+	"errors"
+	"io"
+)
+
+const configRenderSubcommand = "render"
+
+// renderedConfig holds the JSON that a .jsonnet configuration file evaluated to, if token-push was given one
+var renderedConfig []byte
+
+// runConfigRender writes the JSON that the .jsonnet configuration file evaluated to, to w
+func runConfigRender(w io.Writer) error {
+	if renderedConfig == nil {
+		return errors.New("config render needs a .jsonnet configuration file, given with -c/--configfile")
+	}
+	if _, err := w.Write(renderedConfig); err != nil {
+		return err
+	}
+	return errExitOK
+}
@@ -0,0 +1,52 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRunConfigRender reads in a jsonnet configuration file that reads an external variable, and then renders it
+func TestRunConfigRender(t *testing.T) {
+	defer viper.Reset()
+	defer func() { renderedConfig = nil }()
+
+	var b bytes.Buffer
+	err := runConfigSubcommand(&b, []string{"render"})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, errExitOK))
+
+	viper.Set("ext-str", []string{"lifetime=1h"})
+	configFile := filepath.Join(t.TempDir(), "managedTokens.jsonnet")
+	if err := os.WriteFile(configFile, []byte(`{minTokenLifetime: std.extVar("lifetime"), experiments: {myexpt: {emails: ["email@example.com"]}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("configfile", configFile)
+	assert.NoError(t, initConfig())
+	assert.Equal(t, "1h", viper.GetString("minTokenLifetime"))
+	assert.Equal(t, []string{"email@example.com"}, viper.GetStringSlice("experiments.myexpt.emails"))
+	assert.Equal(t, configFile, viper.ConfigFileUsed())
+
+	assert.ErrorIs(t, runConfigSubcommand(&b, []string{"render"}), errExitOK)
+	assert.JSONEq(t, `{"minTokenLifetime": "1h", "experiments": {"myexpt": {"emails": ["email@example.com"]}}}`, b.String())
+}
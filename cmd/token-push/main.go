@@ -19,10 +19,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime/debug"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -38,11 +41,14 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
 
+	"github.com/fermitools/managed-tokens/internal/configLoader"
 	"github.com/fermitools/managed-tokens/internal/contextStore"
 	"github.com/fermitools/managed-tokens/internal/db"
 	"github.com/fermitools/managed-tokens/internal/environment"
 	"github.com/fermitools/managed-tokens/internal/metrics"
 	"github.com/fermitools/managed-tokens/internal/notifications"
+	"github.com/fermitools/managed-tokens/internal/runLock"
+	"github.com/fermitools/managed-tokens/internal/secrets"
 	"github.com/fermitools/managed-tokens/internal/service"
 	"github.com/fermitools/managed-tokens/internal/tracing"
 	"github.com/fermitools/managed-tokens/internal/utils"
@@ -62,14 +68,11 @@ var devEnvironmentLabel string
 
 const devEnvironmentLabelDefault string = "production"
 
-// Supported timeouts and their default values
-var timeouts = map[timeoutKey]time.Duration{
-	timeoutGlobal:      time.Duration(300 * time.Second),
-	timeoutKerberos:    time.Duration(20 * time.Second),
-	timeoutVaultStorer: time.Duration(60 * time.Second),
-	timeoutPing:        time.Duration(10 * time.Second),
-	timeoutPush:        time.Duration(30 * time.Second),
-}
+// Supported timeouts.  These start at the defaults of the configuration model, and initTimeouts applies the configured timeouts.
+var timeouts = defaultTimeouts()
+
+// cleanupGracePeriod is how long after the global timeout we allow for sending notifications and other cleanup
+const cleanupGracePeriod = 30 * time.Second
 
 // Metrics-related variables
 var (
@@ -95,6 +98,28 @@ var (
 		Name:      "failed_services_push_count",
 		Help:      "The number of services for which pushing tokens failed in the last round",
 	})
+	stageTargetCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "managed_tokens",
+		Name:      "stage_target_count",
+		Help:      "The number of targets of a stage, like schedds or nodes, for each service that succeeded or failed in the last round, by error class",
+	},
+		[]string{
+			"service",
+			"stage",
+			"outcome",
+			"error_class",
+		},
+	)
+	serviceTagInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "managed_tokens",
+		Name:      "service_tag_info",
+		Help:      "Set to 1 for each tag configured for a service",
+	},
+		[]string{
+			"service",
+			"tag",
+		},
+	)
 )
 
 var (
@@ -108,9 +133,36 @@ func main() {
 		if errors.Is(err, errExitOK) {
 			os.Exit(0)
 		}
+		// validate-config has already reported the problems with the configuration
+		if errors.Is(err, errConfigInvalid) {
+			os.Exit(1)
+		}
 		log.Fatal("Error running setup actions.  Exiting")
 	}
 
+	if viper.GetBool("daemon") {
+		// SIGINT or SIGTERM stops the daemon once the current cycle has cleaned up
+		ctx, stop := utils.ContextWithInterruptHandling(context.Background())
+		defer stop()
+		shutdownTracing := func(context.Context) {}
+		if tracingShutdown, err := initTracing(ctx); err == nil {
+			shutdownTracing = tracingShutdown
+		}
+		defer func() { shutdownTracing(ctx) }()
+		lock := acquireRunLockOrExit(ctx)
+		defer lock.Release()
+		if err := runDaemon(ctx); err != nil {
+			exeLogger.Error("Error running token-push daemon.  Exiting")
+			// os.Exit doesn't run the deferred calls, so release the lock and flush the traces before exiting
+			lock.Release()
+			shutdownTracing(ctx)
+			stop()
+			os.Exit(1)
+		}
+		exeLogger.Debug("Finished running daemon")
+		return
+	}
+
 	// Global context
 	var globalTimeout time.Duration
 	var ok bool
@@ -120,13 +172,44 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), globalTimeout)
 	defer cancel()
 
+	// If we get SIGINT or SIGTERM, cancel the run so that the workers can unwind and we can still clean up
+	ctx, stop := utils.ContextWithInterruptHandling(ctx)
+	defer stop()
+
 	// Tracing has to be initialized here and not in setup because we need our global context to pass to child spans
 	if tracingShutdown, err := initTracing(ctx); err == nil {
 		defer tracingShutdown(ctx)
 	}
 
+	// If we only need to print the plan, do that and stop
+	if viper.GetBool("plan") {
+		if err := runPlan(ctx, secrets.NewRedactingWriter(os.Stdout)); err != nil {
+			exeLogger.Fatal("Error printing execution plan.  Exiting")
+		}
+		return
+	}
+
+	// Make sure we're the only token-push running
+	lock := acquireRunLockOrExit(ctx)
+	defer lock.Release()
+
+	// Only select the services to retry once we hold the lock, so that the results of the previous run can't change underneath us
+	if viper.GetBool("retry-failed") {
+		retryServices, err := selectRetryFailedServices(ctx, services)
+		if errors.Is(err, errNoFailedServices) {
+			exeLogger.Info("No services failed in the previous run.  Nothing to retry")
+			return
+		}
+		if err != nil {
+			lock.Release() // exeLogger.Fatal exits without running the deferred calls
+			exeLogger.Fatal("Could not select the services that failed in the previous run.  Exiting")
+		}
+		services = retryServices
+	}
+
 	// Run our actual operation
 	if err := run(ctx); err != nil {
+		lock.Release() // exeLogger.Fatal exits without running the deferred calls
 		exeLogger.Fatal("Error running operations to push vault tokens.  Exiting")
 	}
 	exeLogger.Debug("Finished run")
@@ -136,6 +219,10 @@ func main() {
 func setup() error {
 	startSetup = time.Now()
 
+	// Keep the secrets that are resolved from the configuration out of the logs.  This has to be the first hook, so that it runs before
+	// the hooks that write log entries out
+	log.AddHook(secrets.RedactHook{})
+
 	// Configuration defaults that are not flag/config file specific
 	viper.SetDefault("disableNotifications", false)
 
@@ -173,6 +260,11 @@ func setup() error {
 	}
 	setupLogger.Info(versionMessage)
 
+	// The configuration schema doesn't depend on the configuration file, so we can print it before reading that in
+	if pflag.Arg(0) == configSubcommand && !configSubcommandReadsConfig(pflag.Arg(1)) {
+		return runConfigSubcommand(os.Stdout, pflag.Args()[1:])
+	}
+
 	if err := initConfig(); err != nil {
 		fmt.Println("Fatal error setting up configuration.  Exiting now")
 		return err
@@ -184,16 +276,28 @@ func setup() error {
 	disableNotifyFlagWorkaround()
 	// END TODO
 
+	// config explain and config render need the configuration
+	if pflag.Arg(0) == configSubcommand {
+		return runConfigSubcommand(secrets.NewRedactingWriter(os.Stdout), pflag.Args()[1:])
+	}
+
+	// If user wants to validate the configuration, do that and exit
+	if pflag.Arg(0) == validateConfigSubcommand {
+		return runValidateConfig(secrets.NewRedactingWriter(os.Stdout))
+	}
+
+	// If user wants to list or reset the node circuit breakers, do that and exit
+	if pflag.Arg(0) == circuitBreakersSubcommand {
+		err := runCircuitBreakersSubcommand(context.Background(), os.Stdout, pflag.Args()[1:])
+		if err != nil && !errors.Is(err, errExitOK) {
+			setupLogger.Error(err)
+		}
+		return err
+	}
+
 	// If user wants to list all services, do that and exit
 	if viper.GetBool("list-services") {
-		allServices := make([]string, 0)
-		for experiment := range viper.GetStringMap("experiments") {
-			roleMap := viper.GetStringMap("experiments." + experiment + ".roles")
-			for role := range roleMap {
-				allServices = append(allServices, fmt.Sprintf("%s_%s", experiment, role))
-			}
-		}
-		fmt.Println(strings.Join(allServices, "\n"))
+		listServices(os.Stdout)
 		return errExitOK
 	}
 
@@ -202,6 +306,26 @@ func setup() error {
 		return err
 	}
 
+	if err := checkDaemonFlags(); err != nil {
+		setupLogger.Error(err)
+		return err
+	}
+
+	if err := checkPlanFlags(); err != nil {
+		setupLogger.Error(err)
+		return err
+	}
+
+	if err := checkPushOnlyFlags(); err != nil {
+		setupLogger.Error(err)
+		return err
+	}
+
+	if err := checkRetryFailedFlags(); err != nil {
+		setupLogger.Error(err)
+		return err
+	}
+
 	devEnvironmentLabel = getDevEnvironmentLabel()
 
 	initLogs()
@@ -213,7 +337,26 @@ func setup() error {
 		notificationsDisabledBy = DISABLED_BY_FLAG
 	}
 
+	// Decode and validate the configuration once, now that the flags that change it have been applied
+	if err := loadConfigModel(); err != nil {
+		setupLogger.Error(err)
+		return err
+	}
+
 	initServices()
+	if len(services) == 0 && serviceSelectionFlagsSet() {
+		err := errors.New("no services match the given tag, exclude-tag, and exclude-service flags")
+		setupLogger.Error(err)
+		return err
+	}
+
+	if viper.GetBool("push-only") {
+		var err error
+		if services, err = selectPushOnlyServices(services); err != nil {
+			setupLogger.Error(err)
+			return err
+		}
+	}
 
 	if err := initTimeouts(); err != nil {
 		setupLogger.Error("Fatal error setting up timeouts")
@@ -225,7 +368,7 @@ func setup() error {
 	return nil
 }
 
-func run(ctx context.Context) error {
+func run(ctx context.Context) (retErr error) {
 	// Order of operations:
 	// 0. Setup (admin notifications, kerberos cache dir, generate worker.Configs, set up notification listeners)
 	// 1. Get kerberos tickets
@@ -239,9 +382,16 @@ func run(ctx context.Context) error {
 	defer span.End()
 
 	successfulServices := make(map[string]bool) // Initialize Map of services for which all steps were successful
+	report := newRunReport(currentExecutable, startSetup, services)
+	currentRunReport = report
 
 	database, databaseErr := openDatabaseAndLoadServices(ctx)
 
+	// The notification managers need to keep running if the run is interrupted, so that we can still send notifications and save
+	// error counts to the database
+	notificationsCtx, notificationsCancel := utils.ContextWithoutInterrupt(ctx, cleanupGracePeriod)
+	defer notificationsCancel()
+
 	// Determine what notifications should be sent
 	var blockAdminNotifications bool
 	blockServiceNotificationsSlice := make([]string, 0, len(services))
@@ -275,27 +425,68 @@ func run(ctx context.Context) error {
 	var aReceiveChan chan<- notifications.SourceNotification
 	var adminNotifications []notifications.SendMessager
 	if !blockAdminNotifications {
-		admNotMgr, aReceiveChan, adminNotifications = setupAdminNotifications(ctx, database)
+		admNotMgr, aReceiveChan, adminNotifications = setupAdminNotifications(notificationsCtx, database)
 		if databaseErr != nil {
 			msg := "Could not open or create ManagedTokensDatabase"
 			span.SetStatus(codes.Error, msg)
 			aReceiveChan <- notifications.SourceNotification{
 				Notification: notifications.NewSetupError(msg, currentExecutable),
 			}
-		} else {
+		} else if daemonDatabase == nil {
 			defer database.Close()
 		}
 	}
 
 	// Worker-specific config that is service-independent to be passed to the worker.Config constructor
-	workerRetryMap, err := createWorkerRetryMap(timeouts)
+	workerRetryMap, err := createWorkerRetryMap("", timeouts)
 	if err != nil {
 		exeLogger.Errorf("Could not create worker retry map: %s. Will run without retries", err)
 		workerRetryMap = setDefaultWorkerRetryMap()
 	}
 
+	if err := worker.SetConcurrencyLimits(getConcurrencyLimitsFromConfiguration()); err != nil {
+		exeLogger.Errorf("Could not set concurrency limits for workers: %s. Will run without concurrency limits", err)
+		worker.SetConcurrencyLimits(worker.ConcurrencyLimits{})
+	}
+
+	// If we're in test mode, or if we're onboarding a service but not pushing their tokens, we don't push tokens to the nodes
+	pushTokens := !viper.GetBool("test") && !(viper.GetBool("run-onboarding") && !viper.GetBool("push-tokens"))
+
+	// Circuit breakers only change when we push tokens, since the other runs don't tell us whether pushing to the nodes works
+	circuitBreakers, err := getCircuitBreakerSettings()
+	if err != nil {
+		exeLogger.Errorf("Could not use circuit breaker settings: %s.  Will run without circuit breakers", err)
+	}
+	useCircuitBreakers := pushTokens && databaseErr == nil && circuitBreakers.enabled()
+
+	// Report what changed in the configuration since an earlier run recorded it, so that new failures can be traced back to
+	// configuration changes.  As with the run results, we only record the configuration if we push tokens.
+	if databaseErr == nil {
+		configChanges, err := trackConfigChanges(ctx, database, pushTokens)
+		if err != nil {
+			exeLogger.Errorf("Could not check the configuration for changes since the last run: %s", err)
+		}
+		if !blockAdminNotifications {
+			for _, c := range configChanges {
+				aReceiveChan <- notifications.SourceNotification{Notification: notifications.NewConfigChange(c.message, c.service)}
+			}
+		}
+	}
+
 	// All the cleanup actions that should run any time run() returns
 	defer func() {
+		// If we were interrupted, let the admins know, and make sure the run is reported as aborted
+		if sig, ok := utils.GetInterruptSignal(ctx); ok {
+			msg := fmt.Sprintf("Run interrupted by signal %s.  Not all services may have been processed", sig)
+			exeLogger.Error(msg)
+			if !blockAdminNotifications {
+				aReceiveChan <- notifications.SourceNotification{Notification: notifications.NewSetupError(msg, currentExecutable)}
+			}
+			if retErr == nil {
+				retErr = errors.New(msg)
+			}
+		}
+
 		// Run cleanup actions
 		// Cleanup
 		if err := reportSuccessesAndFailures(successfulServices); err != nil {
@@ -303,7 +494,7 @@ func run(ctx context.Context) error {
 		}
 		// Push metrics to prometheus pushgateway
 		if prometheusUp {
-			if err := metrics.PushToPrometheus(viper.GetString("prometheus.host"), getPrometheusJobName()); err != nil {
+			if err := metrics.PushToPrometheus(getConfigModel().Prometheus.Host, getPrometheusJobName()); err != nil {
 				exeLogger.Error("Could not push metrics to prometheus pushgateway")
 			} else {
 				exeLogger.Info("Finished pushing metrics to prometheus pushgateway")
@@ -311,10 +502,23 @@ func run(ctx context.Context) error {
 		}
 		if blockAdminNotifications {
 			exeLogger.Debugf("Admin notifications disabled by %s. Not sending admin notifications", notificationsDisabledBy.String())
+			// Still make sure that the workers' notifications have all been thrown away before returning
+			handleNotificationsFinalization()
 		} else {
 			close(aReceiveChan)
 			// We don't check the error here, because we don't want to halt execution if the admin message can't be sent.  Just log it and move on
-			sendAdminNotifications(ctx, admNotMgr, &adminNotifications)
+			sendAdminNotifications(notificationsCtx, admNotMgr, &adminNotifications)
+		}
+		// Write the run report last, so that it includes any notifications sent by the workers
+		writeRunReport(report, successfulServices, retErr)
+		// Save the results of this run from the finalized report so that a later run can retry what failed.  If we didn't try to push
+		// tokens, these results would hide the failures of the last run that did.
+		if pushTokens {
+			saveRunResults(notificationsCtx, database, report)
+		}
+		// An interrupted run's failed pushes say nothing about the nodes, so they shouldn't count towards opening their circuit breakers
+		if _, interrupted := utils.GetInterruptSignal(ctx); useCircuitBreakers && !interrupted {
+			updateNodeCircuitBreakers(notificationsCtx, database, report, circuitBreakers)
 		}
 	}()
 
@@ -362,21 +566,34 @@ func run(ctx context.Context) error {
 			span.SetAttributes(attribute.KeyValue{Key: "service", Value: attribute.StringValue(s.Name())})
 			defer span.End()
 
+			serviceConfigPath := "experiments." + s.Experiment() + ".roles." + s.Role()
+			tags := getServiceTagsFromConfiguration(serviceConfigPath)
+			span.SetAttributes(attribute.StringSlice("tags", tags))
+			if prometheusUp {
+				for _, tag := range tags {
+					serviceTagInfo.WithLabelValues(s.Name(), tag).Set(1)
+				}
+			}
+
 			// Add every service to our successfulServices map.  The value will be set to true later if we
 			// successfully complete all the operations for that service
 			_successfulServicesMux.Lock()
 			successfulServices[getServiceName(s)] = false
 			_successfulServicesMux.Unlock()
 
-			// Create kerberos cache for this service
-			krb5ccCache, err := os.CreateTemp(kerbCacheDir, fmt.Sprintf("managed-tokens-krb5ccCache-%s", s.Name()))
-			if err != nil {
-				tracing.LogErrorWithTrace(span, funcLogger, "Cannot create kerberos cache. Subsequent operations will fail. Skipping service.")
-				return
+			// Create kerberos cache for this service.  In push-only mode, we don't get kerberos tickets for the service, so we leave
+			// KRB5CCNAME alone, and ssh and rsync use the kerberos credentials of the user running token-push
+			setKrb5ccname := func(*environment.CommandEnvironment) {}
+			if !viper.GetBool("push-only") {
+				krb5ccCache, err := os.CreateTemp(kerbCacheDir, fmt.Sprintf("managed-tokens-krb5ccCache-%s", s.Name()))
+				if err != nil {
+					tracing.LogErrorWithTrace(span, funcLogger, "Cannot create kerberos cache. Subsequent operations will fail. Skipping service.")
+					return
+				}
+				setKrb5ccname = func(e *environment.CommandEnvironment) { e.SetKrb5ccname(krb5ccCache.Name(), environment.FILE) }
 			}
 
 			// All required service-level configuration items
-			serviceConfigPath := "experiments." + s.Experiment() + ".roles." + s.Role()
 			uid, err := getDesiredUIDByOverrideOrLookup(ctx, serviceConfigPath, database)
 			if err != nil {
 				tracing.LogErrorWithTrace(span, funcLogger, "Error obtaining UID for service. Skipping service.")
@@ -431,11 +648,23 @@ func run(ctx context.Context) error {
 			fileCopierOptions := getFileCopierOptionsFromConfig(serviceConfigPath)
 			extraPingOpts := getPingOptsFromConfig(serviceConfigPath)
 			sshOpts := getSSHOptsFromConfig(serviceConfigPath)
+			tokenDestinations := getTokenDestinationsFromConfig(serviceConfigPath)
+
+			// Timeouts and retry settings can be overridden for the service.  If the overrides can't be used, fall back to the global ones
+			serviceTimeouts, err := getServiceTimeouts(serviceConfigPath, timeouts)
+			if err != nil {
+				funcLogger.Errorf("Could not use timeouts configured for service: %s.  Using global timeouts", err)
+			}
+			serviceRetryMap, err := createWorkerRetryMap(serviceConfigPath, serviceTimeouts)
+			if err != nil {
+				funcLogger.Errorf("Could not use retry settings configured for service: %s.  Using global retry settings", err)
+				serviceRetryMap = workerRetryMap
+			}
 
 			c, err := worker.NewConfig(
 				s,
 				worker.SetCommandEnvironment(
-					func(e *environment.CommandEnvironment) { e.SetKrb5ccname(krb5ccCache.Name(), environment.FILE) },
+					setKrb5ccname,
 					func(e *environment.CommandEnvironment) { e.SetCondorCollectorHost(collectorHost) },
 					func(e *environment.CommandEnvironment) { e.SetHtgettokenOpts(htgettokenopts) },
 				),
@@ -445,13 +674,16 @@ func run(ctx context.Context) error {
 				worker.SetUserPrincipal(userPrincipal),
 				worker.SetKeytabPath(keytabPath),
 				worker.SetDesiredUID(uid),
-				worker.SetNodes(viper.GetStringSlice(serviceConfigPath+".destinationNodes")),
-				worker.SetAccount(viper.GetString(serviceConfigPath+".account")),
-				setAllWorkerRetryValues(workerRetryMap),
+				worker.SetNodes(getRetryFailedNodes(getServiceName(s), getDestinationNodesFromConfiguration(serviceConfigPath))),
+				worker.SetNodeOptions(getNodeOptionsFromConfiguration(serviceConfigPath)),
+				worker.SetAccount(getConfigModel().roleAt(serviceConfigPath).Account),
+				setAllWorkerRetryValues(serviceRetryMap),
+				setAllWorkerTimeouts(serviceTimeouts),
 				worker.SetSupportedExtrasKeyValue(worker.DefaultRoleFileDestinationTemplate, defaultRoleFileDestinationTemplate),
 				worker.SetSupportedExtrasKeyValue(worker.FileCopierOptions, fileCopierOptions),
 				worker.SetSupportedExtrasKeyValue(worker.PingOptions, extraPingOpts),
 				worker.SetSupportedExtrasKeyValue(worker.SSHOptions, sshOpts),
+				worker.SetSupportedExtrasKeyValue(worker.TokenDestinations, tokenDestinations),
 				tokenGetterInteractiveSelector,
 			)
 			if err != nil {
@@ -465,10 +697,10 @@ func run(ctx context.Context) error {
 
 			// If notifications are not disabled for this service, register the service for notifications
 			if _, ok := noServiceNotifications[getServiceName(s)]; !ok && (admNotMgr != nil) {
-				registerServiceNotificationsChan(ctx, s, admNotMgr)
+				registerServiceNotificationsChan(notificationsCtx, s, admNotMgr)
 			} else {
 				// If notifications are disabled for this service, register a dummy channel so that notifications get thrown away
-				registerDummyServiceNotificationsChan(ctx, s)
+				registerDummyServiceNotificationsChan(notificationsCtx, s)
 			}
 
 			span.SetStatus(codes.Ok, "Service config setup")
@@ -476,6 +708,30 @@ func run(ctx context.Context) error {
 	}
 	serviceConfigSetupWg.Wait()
 
+	// In push-only mode, we can only push vault tokens that a previous run stored.  If there isn't one for a service, that's an error
+	servicesWithoutStoredTokens := make([]string, 0)
+	if viper.GetBool("push-only") {
+		for _, serviceName := range slices.Sorted(maps.Keys(serviceConfigs)) {
+			tokenPath, err := worker.FindStoredVaultToken(serviceConfigs[serviceName])
+			if err != nil {
+				msg := fmt.Sprintf("No stored vault token found for service %s.  Cannot push tokens for this service in push-only mode", serviceName)
+				tracing.LogErrorWithTrace(span, exeLogger.WithField("service", serviceName), msg)
+				if !blockAdminNotifications {
+					aReceiveChan <- notifications.SourceNotification{Notification: notifications.NewSetupError(msg, currentExecutable)}
+				}
+				servicesWithoutStoredTokens = append(servicesWithoutStoredTokens, serviceName)
+				delete(serviceConfigs, serviceName)
+				continue
+			}
+			exeLogger.WithFields(log.Fields{"service": serviceName, "tokenPath": tokenPath}).Info("Will push stored vault token")
+		}
+	}
+
+	for _, s := range services {
+		_, ok := serviceConfigs[getServiceName(s)]
+		report.recordStage(getServiceName(s), stageSetup, ok, startSetup, time.Now())
+	}
+
 	if len(serviceConfigs) == 0 {
 		msg := "no serviceConfigs to operate on"
 		tracing.LogErrorWithTrace(span, exeLogger, msg)
@@ -493,6 +749,19 @@ func run(ctx context.Context) error {
 		exeLogger.Error("Could not update database with currently-configured nodes.  Future database-based operations may fail")
 	}
 
+	// Skip the nodes whose circuit breakers are open.  The admins get a single notice for each node when we first skip it.
+	if useCircuitBreakers {
+		notices, err := applyNodeCircuitBreakers(ctx, database, serviceConfigs, circuitBreakers)
+		if err != nil {
+			exeLogger.Errorf("Could not apply node circuit breakers: %s", err)
+		}
+		if !blockAdminNotifications {
+			for _, n := range notices {
+				aReceiveChan <- notifications.SourceNotification{Notification: notifications.NewSetupError(n.message, n.service)}
+			}
+		}
+	}
+
 	// Setup done.  Push prometheus metrics
 	msg := "Setup complete"
 	span.AddEvent(msg)
@@ -508,165 +777,106 @@ func run(ctx context.Context) error {
 		ctx = contextStore.WithVerbose(ctx)
 	}
 
-	// 1. Get kerberos tickets
-	// Get channels and start worker for getting kerberos ticekts
-	startKerberos := time.Now()
-	span.AddEvent("Starting get kerberos tickets")
-	kerberosChannels := startServiceConfigWorkerForProcessing(ctx, worker.GetKerberosTickets, serviceConfigs, timeoutKerberos)
-
-	// If we couldn't get a kerberos ticket for a service, we don't want to try to get vault
-	// tokens for that service
-	failedKerberosConfigs := removeFailedServiceConfigs(kerberosChannels, serviceConfigs)
-	for _, failure := range failedKerberosConfigs {
-		exeLogger.WithField("service", failure.Service.Name()).Error("Failed to obtain kerberos ticket.  Will not try to obtain or push vault token to service nodes")
-	}
-	if len(serviceConfigs) == 0 {
-		exeLogger.Info("No more serviceConfigs to operate on.  Cleaning up now")
-		return nil
+	// 1-4. Get kerberos tickets, get and store vault tokens, ping nodes, and push vault tokens to nodes.  Each service moves on to its
+	// next stage as soon as it is done with its current one, so a slow service does not hold up the others.  If a service fails
+	// a stage, it will not go through any of the later stages, with the exception of pinging nodes:  if we can't ping some nodes,
+	// we still try to push tokens to all of the configured nodes.
+	//
+	// If we're in test mode, or if we're onboarding a service but not pushing their tokens, we stop after getting the vault tokens
+	//
+	// In push-only mode, we only ping nodes and push the vault tokens that are already stored
+	stages := getPipelineStages(onlyGetTokenServices, pushTokens)
+	if viper.GetBool("push-only") {
+		stages = getPushOnlyPipelineStages()
 	}
-	if prometheusUp {
-		promDuration.WithLabelValues(currentExecutable, "getKerberosTickets").Set(time.Since(startKerberos).Seconds())
+	span.AddEvent("Start pipeline")
+	results, err := startServiceConfigPipeline(ctx, stages, serviceConfigs)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, exeLogger, "Could not start pipeline")
+		return err
 	}
-	span.AddEvent("End get kerberos tickets")
 
-	// 2. Get and store vault tokens
-	// We're enclosing this in a func() so that the garbage collector can try to clean up the extra maps we'll have to make here
-	func() {
-		_serviceConfigsGetToken := make(map[string]*worker.Config)
-		_serviceConfigsStoreAndGetToken := make(map[string]*worker.Config)
-
-		// Pick which serviceConfigs are going to use a worker.GetTokenWorker vs worker.StoreAndGetTokenWorker
-		for serviceName := range serviceConfigs {
-			if _, ok := onlyGetTokenServices[serviceName]; ok {
-				_serviceConfigsGetToken[serviceName] = serviceConfigs[serviceName]
-				continue
+	timeSpans := make(stageTimeSpans)
+	servicesWithVaultTokens := make([]string, 0, len(serviceConfigs))
+	for result := range results {
+		serviceName := getServiceName(result.GetService())
+		resultLogger := exeLogger.WithField("service", serviceName)
+		timeSpans.observe(result)
+		report.recordStageResult(result)
+
+		switch result.WorkerType {
+		case worker.GetKerberosTickets:
+			if !result.GetSuccess() {
+				resultLogger.Error("Failed to obtain kerberos ticket.  Will not try to obtain or push vault token to service nodes")
+			}
+		case worker.GetToken, worker.StoreAndGetToken:
+			if !result.GetSuccess() {
+				resultLogger.Error("Failed to obtain vault token.  Will not try to push vault token to service nodes")
+				break
+			}
+			servicesWithVaultTokens = append(servicesWithVaultTokens, serviceName)
+		case worker.PingAggregator:
+			if !result.GetSuccess() {
+				resultLogger.Error("Could not ping all nodes for service.  We'll still try to push tokens to all configured nodes, but there may be failures.  See logs for details")
 			}
-			_serviceConfigsStoreAndGetToken[serviceName] = serviceConfigs[serviceName]
-		}
-
-		// 2a.  Handle serviceConfigs that only need to get tokens
-		startGetTokens := time.Now()
-		span.AddEvent("Start get tokens for services that only need to get tokens")
-		getTokenChans := startServiceConfigWorkerForProcessing(ctx, worker.GetToken, _serviceConfigsGetToken, timeoutVaultStorer)
-
-		// Wait until all workers are done, remove any service configs that we couldn't get tokens for from serviceConfigs.
-		failedGetTokenConfigs := removeFailedServiceConfigs(getTokenChans, serviceConfigs)
-		for _, failure := range failedGetTokenConfigs {
-			exeLogger.WithField("service", failure.Service.Name()).Error("Failed to obtain vault token.  Will not try to push vault token to service nodes")
-		}
-
-		if prometheusUp {
-			promDuration.WithLabelValues(currentExecutable, "getTokens").Set(time.Since(startGetTokens).Seconds())
-		}
-		span.AddEvent("End get tokens for services that only need to get tokens")
-
-		// 2b. Get channels and start worker for getting and storing short-lived vault token (condor_vault_storer)
-		startCondorVault := time.Now()
-		span.AddEvent("Start obtain and store vault tokens")
-
-		// Get channels and start worker for getting and storing vault tokens
-		condorVaultChans := startServiceConfigWorkerForProcessing(ctx, worker.StoreAndGetToken, _serviceConfigsStoreAndGetToken, timeoutVaultStorer)
-
-		// Wait until all workers are done, remove any service configs that we couldn't get tokens for from serviceConfigs
-		failedVaultConfigs := removeFailedServiceConfigs(condorVaultChans, serviceConfigs)
-		for _, failure := range failedVaultConfigs {
-			exeLogger.WithField("service", failure.Service.Name()).Error("Failed to obtain vault token.  Will not try to push vault token to service nodes")
-		}
-
-		// For any successful services, make sure we remove all the vault tokens when we're done
-		for serviceName := range serviceConfigs {
-			defer func(serviceName string) {
-				if err := vaultToken.RemoveServiceVaultTokens(serviceName); err != nil {
-					exeLogger.WithField("service", serviceName).Error("Could not remove vault tokens for service")
-				}
-			}(serviceName)
-		}
-
-		if prometheusUp {
-			promDuration.WithLabelValues(currentExecutable, "storeAndGetTokens").Set(time.Since(startCondorVault).Seconds())
 		}
-		span.AddEvent("End obtain and store vault tokens")
-	}()
 
-	// If we're in test mode, stop here
-	if viper.GetBool("test") {
-		exeLogger.Info("Test mode.  Cleaning up now")
-		for service := range serviceConfigs {
-			successfulServices[service] = true
+		// A service is successful once it has made it through all of its stages
+		if result.Final && result.GetSuccess() {
+			successfulServices[serviceName] = true
 		}
-		return nil
 	}
+	span.AddEvent("End pipeline")
 
-	// If we're onboarding a service but not pushing their tokens, stop here
-	if viper.GetBool("run-onboarding") && !viper.GetBool("push-tokens") {
-		exeLogger.Info("Onboarding mode.  Cleaning up now")
-		for service := range serviceConfigs {
-			successfulServices[service] = true
-		}
-		return nil
-	}
-
-	if len(serviceConfigs) == 0 {
-		exeLogger.Info("No more serviceConfigs to operate on.  Cleaning up now")
-		return nil
-	}
-
-	// 3. Ping nodes to check their status
-	// Get channels and start worker for pinging service nodes
-	startPing := time.Now()
-	span.AddEvent("Start ping nodes")
-	pingChans := startServiceConfigWorkerForProcessing(ctx, worker.PingAggregator, serviceConfigs, timeoutPing)
-
-	for pingSuccess := range pingChans.GetSuccessChan() {
-		if !pingSuccess.GetSuccess() {
-			msg := "Could not ping all nodes for service.  We'll still try to push tokens to all configured nodes, but there may be failures.  See logs for details"
-			exeLogger.WithField("service", getServiceName(pingSuccess.GetService())).Error(msg)
+	// Make sure we remove all the vault tokens we got now that we're done
+	for _, serviceName := range servicesWithVaultTokens {
+		if err := vaultToken.RemoveServiceVaultTokens(serviceName); err != nil {
+			exeLogger.WithField("service", serviceName).Error("Could not remove vault tokens for service")
 		}
 	}
 
 	if prometheusUp {
-		promDuration.WithLabelValues(currentExecutable, "pingNodes").Set(time.Since(startPing).Seconds())
-	}
-	span.AddEvent("End ping nodes")
-
-	// 4. Push vault tokens to nodes
-	// Get channels and start worker for pushing tokens to service nodes
-	startPush := time.Now()
-	span.AddEvent("Start push tokens")
-	pushChans := startServiceConfigWorkerForProcessing(ctx, worker.PushTokens, serviceConfigs, timeoutPush)
-
-	// Aggregate the successes
-	for pushSuccess := range pushChans.GetSuccessChan() {
-		if pushSuccess.GetSuccess() {
-			successfulServices[getServiceName(pushSuccess.GetService())] = true
+		for wt, timeSpan := range timeSpans {
+			promDuration.WithLabelValues(currentExecutable, stageMetricLabels[wt]).Set(timeSpan.end.Sub(timeSpan.start).Seconds())
 		}
+		report.setStageTargetMetrics()
 	}
 
-	if prometheusUp {
-		promDuration.WithLabelValues(currentExecutable, "pushTokens").Set(time.Since(startPush).Seconds())
+	if !pushTokens {
+		exeLogger.Info("Not pushing tokens in test or onboarding mode.  Cleaning up now")
 	}
-	span.AddEvent("End push tokens")
 
+	if len(servicesWithoutStoredTokens) > 0 {
+		return fmt.Errorf("no stored vault tokens found for services: %s", strings.Join(servicesWithoutStoredTokens, ", "))
+	}
 	return nil
 }
 
 // Setup helper functions
 
 func initFlags() {
-	// Defaults
-	viper.SetDefault("notifications.admin_email", "fife-group@fnal.gov")
-
 	// Flags
 	pflag.String("admin", "", "Override the config file admin email")
 	pflag.StringP("configfile", "c", "", "Specify alternate config file")
+	pflag.Bool("daemon", false, "Keep running, and push tokens for each service at its configured daemonInterval")
 	pflag.Bool("disable-notifications", false, "Turn off all notifications for this run")
 	pflag.Bool("dont-notify", false, "Same as --disable-notifications")
+	pflag.StringSlice("exclude-service", []string{}, "Do not push tokens for this service.  Can be given more than once")
+	pflag.StringSlice("exclude-tag", []string{}, "Do not push tokens for services that have this tag.  Can be given more than once")
 	pflag.StringP("experiment", "e", "", "Name of single experiment to push tokens")
+	pflag.StringArray("ext-str", []string{}, "Set a jsonnet external variable, as key=value, if the config file is a .jsonnet file.  Can be given more than once")
+	pflag.StringSlice("jpath", []string{}, "Also search this directory for jsonnet imports, if the config file is a .jsonnet file.  Can be given more than once")
+	pflag.Bool("json", false, "Print the results of validate-config, config explain, and circuit-breakers list as JSON")
 	pflag.Bool("list-services", false, "List all configured services in config file")
 	pflag.Bool("no-loki", false, "Disable sending logs to Loki (should only be used in testing or temporary debugging)")
+	pflag.StringSlice("node", []string{}, "Only push tokens to this node.  Can be given more than once.  Must be used with --push-only, or with circuit-breakers reset to only reset the circuit breakers for this node")
+	pflag.Bool("plan", false, "Print the fully-resolved configuration for each service as JSON, without obtaining or pushing any tokens")
+	pflag.Bool("push-only", false, "Push the vault tokens stored by a previous run to the nodes, without getting kerberos tickets or new vault tokens")
 	pflag.BoolP("push-tokens", "p", false, "Push tokens to nodes after onboarding a service. If -r/--run-onboarding is set, this flag must be set to push tokens.  Otherwise, it is ignored")
+	pflag.Bool("retry-failed", false, "Only push tokens for the services, and the nodes, that failed in the previous run")
 	pflag.BoolP("run-onboarding", "r", false, "Run onboarding for a given service.  Must be used with -s/--service, optionally can be used with -p/--push-tokens")
-	pflag.StringP("service", "s", "", "Service to obtain and push vault tokens for.  Must be of the form experiment_role, e.g. dune_production")
+	pflag.StringP("service", "s", "", "Service to obtain and push vault tokens for, or with circuit-breakers reset, to reset the circuit breakers for.  Must be of the form experiment_role, e.g. dune_production")
+	pflag.StringSlice("tag", []string{}, "Only push tokens for services that have this tag.  Can be given more than once")
 	pflag.BoolP("test", "t", false, "Test mode.  Obtain vault tokens but don't push them to nodes")
 	pflag.BoolP("verbose", "v", false, "Turn on verbose mode")
 	pflag.Bool("version", false, "Version of Managed Tokens library")
@@ -681,25 +891,17 @@ func initFlags() {
 	// Instead, we have to work around this after we read in the config file (see setup())
 }
 
+// initConfig reads in the configuration, and keeps what was learned about it while it was read in
 func initConfig() error {
-	// Get config file
-	configFileName := "managedTokens"
-	// Check for override
-	if config := viper.GetString("configfile"); config != "" {
-		viper.SetConfigFile(config)
-	} else {
-		viper.SetConfigName(configFileName)
-	}
-
-	viper.AddConfigPath("/etc/managed-tokens/")
-	viper.AddConfigPath("$HOME/.managed-tokens/")
-	viper.AddConfigPath(".")
-
-	err := viper.ReadInConfig()
+	c, err := configLoader.Load(context.Background(), viper.GetViper(), viper.GetString("configfile"), viper.GetStringSlice("jpath"),
+		viper.GetStringSlice("ext-str"))
 	if err != nil {
-		log.WithField("executable", currentExecutable).Errorf("Error reading in config file: %v", err)
+		log.WithField("executable", currentExecutable).Errorf("Error reading in configuration: %v", err)
 		return err
 	}
+	renderedConfig = c.Rendered
+	configSources = c.Sources
+	configSecretReferences = c.SecretReferences
 	return nil
 }
 
@@ -723,41 +925,44 @@ func checkRunOnboardingFlags() error {
 // in-code overrides.  This only sets the initial state of the given viper keys.
 func initEnvironment() {
 	viper.BindEnv("collectorHost", environment.CondorCollectorHost.EnvVarKey())
+	// For devs, this variable can be set to differentiate between dev and prod for metrics, for example
+	viper.BindEnv("devEnvironmentLabel", "MANAGED_TOKENS_DEV_ENVIRONMENT_LABEL")
 }
 
 // Set up logs
 func initLogs() {
 	log.SetLevel(log.DebugLevel)
-	debugLogConfigLookup := "logs.token-push.debugfile"
-	logConfigLookup := "logs.token-push.logfile"
+	cfg := getConfigModel()
+	logFiles := cfg.Logs["token-push"]
 	// Debug log
 	log.AddHook(lfshook.NewHook(lfshook.PathMap{
-		log.DebugLevel: viper.GetString(debugLogConfigLookup),
-		log.InfoLevel:  viper.GetString(debugLogConfigLookup),
-		log.WarnLevel:  viper.GetString(debugLogConfigLookup),
-		log.ErrorLevel: viper.GetString(debugLogConfigLookup),
-		log.FatalLevel: viper.GetString(debugLogConfigLookup),
-		log.PanicLevel: viper.GetString(debugLogConfigLookup),
+		log.DebugLevel: logFiles.DebugFile,
+		log.InfoLevel:  logFiles.DebugFile,
+		log.WarnLevel:  logFiles.DebugFile,
+		log.ErrorLevel: logFiles.DebugFile,
+		log.FatalLevel: logFiles.DebugFile,
+		log.PanicLevel: logFiles.DebugFile,
 	}, &log.TextFormatter{FullTimestamp: true}))
 
 	// Info log file
 	log.AddHook(lfshook.NewHook(lfshook.PathMap{
-		log.InfoLevel:  viper.GetString(logConfigLookup),
-		log.WarnLevel:  viper.GetString(logConfigLookup),
-		log.ErrorLevel: viper.GetString(logConfigLookup),
-		log.FatalLevel: viper.GetString(logConfigLookup),
-		log.PanicLevel: viper.GetString(logConfigLookup),
+		log.InfoLevel:  logFiles.LogFile,
+		log.WarnLevel:  logFiles.LogFile,
+		log.ErrorLevel: logFiles.LogFile,
+		log.FatalLevel: logFiles.LogFile,
+		log.PanicLevel: logFiles.LogFile,
 	}, &log.TextFormatter{FullTimestamp: true}))
 
 	// Loki.  Example here taken from README: https://github.com/YuKitsune/lokirus/blob/main/README.md
-	if viper.GetBool("no-loki") || viper.GetString("loki.host") == "" {
+	if viper.GetBool("no-loki") || cfg.Loki.Host == "" {
 		log.Info("Loki logging disabled by flag")
 	} else {
 		lokiClient := http.DefaultClient
 
-		var lokiClientTimeout = 1 * time.Second
-		if _timeout, err := time.ParseDuration(viper.GetString("loki.response_header_timeout")); err == nil {
-			lokiClientTimeout = _timeout
+		lokiClientTimeout, err := time.ParseDuration(cfg.Loki.ResponseHeaderTimeout)
+		if err != nil {
+			lokiClientTimeout, _ = time.ParseDuration(newDefaultConfigModel().Loki.ResponseHeaderTimeout)
+			log.Warnf("Could not parse loki.response_header_timeout.  Using the default of %s", lokiClientTimeout)
 		}
 
 		var useTransport *http.Transport
@@ -783,7 +988,7 @@ func initLogs() {
 			}).
 			WithHttpClient(lokiClient)
 		lokiHook := lokirus.NewLokiHookWithOpts(
-			viper.GetString("loki.host"),
+			cfg.Loki.Host,
 			lokiOpts,
 			log.InfoLevel,
 			log.WarnLevel,
@@ -803,33 +1008,17 @@ func initLogs() {
 
 // Setup of timeouts, if they're set
 func initTimeouts() error {
-	// Save supported timeouts into timeouts map
-	for key, timeoutString := range viper.GetStringMapString("timeouts") {
-		tKey := strings.TrimSuffix(key, "timeout")
-		// Only save the timeout if it's supported, otherwise ignore it
-		if validKey, ok := getTimeoutKeyFromString(tKey); ok {
-			timeout, err := time.ParseDuration(timeoutString)
-			if err != nil {
-				exeLogger.WithField("timeoutKey", validKey.String()).Warn("Could not parse configured timeout.  Using default")
-				continue
-			}
-			timeouts[validKey] = timeout
-			exeLogger.WithField(validKey.String(), timeoutString).Debug("Configured timeout")
-		}
+	// Save configured timeouts into timeouts map.  Timeouts that can't be parsed keep their defaults
+	var err error
+	if timeouts, err = applyTimeoutSettings(timeouts, getConfigModel().Timeouts.settings()); err != nil {
+		exeLogger.Warnf("Could not use some configured timeouts.  Using their defaults instead: %s", err)
 	}
-
-	// Verify that individual timeouts don't add to more than total timeout
-	now := time.Now()
-	timeForComponentCheck := now
-
-	for timeoutKey, timeout := range timeouts {
-		if timeoutKey != timeoutGlobal {
-			timeForComponentCheck = timeForComponentCheck.Add(timeout)
-		}
+	for key, timeout := range timeouts {
+		exeLogger.WithField(key.String(), timeout).Debug("Configured timeout")
 	}
 
-	timeForGlobalCheck := now.Add(timeouts[timeoutGlobal])
-	if timeForComponentCheck.After(timeForGlobalCheck) {
+	// Verify that individual timeouts don't add to more than total timeout
+	if err := checkComponentTimeouts(timeouts); err != nil {
 		msg := "configured component timeouts exceed the total configured global timeout.  Please check all configured timeouts"
 		exeLogger.Error(msg)
 		return errors.New(msg)
@@ -840,16 +1029,19 @@ func initTimeouts() error {
 // Set up prometheus metrics
 func initMetrics() error {
 	// Set up prometheus metrics
-	if _, err := http.Get(viper.GetString("prometheus.host")); err != nil {
+	prometheusHost := getConfigModel().Prometheus.Host
+	if _, err := http.Get(prometheusHost); err != nil {
 		exeLogger.Errorf("Error contacting prometheus pushgateway %s: %s.  The rest of prometheus operations will fail. "+
 			"To limit error noise, "+
 			"these failures at the experiment level will be registered as warnings in the log, "+
-			"and not be sent in any notifications.", viper.GetString("prometheus.host"), err.Error())
+			"and not be sent in any notifications.", prometheusHost, err.Error())
 		prometheusUp = false
 		return err
 	}
 	metrics.MetricsRegistry.MustRegister(promDuration)
 	metrics.MetricsRegistry.MustRegister(servicePushFailureCount)
+	metrics.MetricsRegistry.MustRegister(serviceTagInfo)
+	metrics.MetricsRegistry.MustRegister(stageTargetCount)
 	return nil
 }
 
@@ -861,9 +1053,8 @@ func initServices() {
 	switch {
 	case viper.GetString("experiment") != "":
 		// Running on a single experiment and all its roles
-		experimentConfigPath := "experiments." + viper.GetString("experiment")
 		experiment := checkExperimentOverride(viper.GetString("experiment"))
-		for role := range viper.GetStringMap(experimentConfigPath + ".roles") {
+		for role := range getConfigModel().experiment(viper.GetString("experiment")).Roles {
 			services = addServiceToServicesSlice(services, viper.GetString("experiment"), experiment, role)
 		}
 	case viper.GetString("service") != "":
@@ -873,20 +1064,20 @@ func initServices() {
 		services = addServiceToServicesSlice(services, serviceExperiment, experiment, role)
 	default:
 		// Running on every configured experiment and role
-		for configExperiment := range viper.GetStringMap("experiments") {
-			experimentConfigPath := "experiments." + configExperiment
+		for configExperiment, experimentConfig := range getConfigModel().Experiments {
 			experiment := checkExperimentOverride(configExperiment)
-			for role := range viper.GetStringMap(experimentConfigPath + ".roles") {
+			for role := range experimentConfig.Roles {
 				services = addServiceToServicesSlice(services, configExperiment, experiment, role)
 			}
 		}
 	}
+	services = filterServicesBySelectionFlags(services)
 }
 
 // initTracing initializes the tracing configuration and returns a function to shutdown the
 // initialized TracerProvider and an error, if any.
 func initTracing(ctx context.Context) (func(context.Context), error) {
-	url := viper.GetString("tracing.url")
+	url := getConfigModel().Tracing.URL
 	if url == "" {
 		msg := "no tracing url configured.  Continuing without tracing"
 		exeLogger.Error(msg)
@@ -943,17 +1134,21 @@ func openDatabaseAndLoadServices(ctx context.Context) (*db.ManagedTokensDatabase
 	defer span.End()
 
 	// Open connection to the SQLite database where notification info will be stored
-	if viper.IsSet("dbLocation") {
-		dbLocation = viper.GetString("dbLocation")
-	} else {
-		dbLocation = "/var/lib/managed-tokens/uid.db"
-	}
+	dbLocation = getDBLocation()
 	exeLogger.Debugf("Using db file at %s", dbLocation)
 
-	database, err := db.OpenOrCreateDatabase(dbLocation)
-	if err != nil {
-		tracing.LogErrorWithTrace(span, exeLogger, "Could not open or create ManagedTokensDatabase")
-		return nil, err
+	// In daemon mode, reuse the database handle from the previous cycle if we have one
+	database := daemonDatabase
+	if database == nil {
+		var err error
+		database, err = db.OpenOrCreateDatabase(dbLocation)
+		if err != nil {
+			tracing.LogErrorWithTrace(span, exeLogger, "Could not open or create ManagedTokensDatabase")
+			return nil, err
+		}
+		if viper.GetBool("daemon") {
+			daemonDatabase = database
+		}
 	}
 
 	servicesToAddToDatabase := make([]string, 0, len(services))
@@ -969,6 +1164,49 @@ func openDatabaseAndLoadServices(ctx context.Context) (*db.ManagedTokensDatabase
 	return database, nil
 }
 
+// getDBLocation returns the configured location of the ManagedTokensDatabase, or the default location if none is configured
+func getDBLocation() string {
+	return getConfigModel().DBLocation
+}
+
+// acquireRunLockOrExit acquires the run lock, waiting up to runLock.waitTimeout for another instance of token-push to finish.  If
+// another instance is still running after that, it notifies the admins and exits with runLock.ExitCodeLockHeld.
+func acquireRunLockOrExit(ctx context.Context) *runLock.Lock {
+	path := runLock.Path(getConfigModel().RunLock.Path, filepath.Dir(getDBLocation()), currentExecutable)
+	return runLock.AcquireOrExit(ctx, path, currentExecutable, getRunLockWaitTimeout(), getRunLockNotifier())
+}
+
+// getRunLockWaitTimeout returns how long to wait for another instance of token-push to finish.  If runLock.waitTimeout can't be parsed,
+// we don't wait at all.
+func getRunLockWaitTimeout() time.Duration {
+	waitTimeout, err := time.ParseDuration(getConfigModel().RunLock.WaitTimeout)
+	if err != nil {
+		log.WithField("executable", currentExecutable).Warn("Could not parse configured runLock.waitTimeout.  Not waiting for a running instance to finish")
+		return 0
+	}
+	return waitTimeout
+}
+
+// getRunLockNotifier returns the runLock.Notifier that sends the run lock notification directly to the admin email and slack
+// channel, or nil if notifications are disabled
+func getRunLockNotifier() runLock.Notifier {
+	cfg := getConfigModel()
+	if cfg.DisableNotifications {
+		return nil
+	}
+	adminNotificationsCfg := cfg.adminNotifications(viper.GetBool("test"))
+	return runLock.NewNotifier(
+		notifications.NewEmail(
+			cfg.Email.From,
+			adminNotificationsCfg.AdminEmail,
+			"Managed Tokens: "+currentExecutable+" already running "+time.Now().Format(time.RFC822),
+			cfg.Email.SMTPHost,
+			cfg.Email.SMTPPort,
+		),
+		notifications.NewSlackMessage(adminNotificationsCfg.SlackAlertsURL),
+	)
+}
+
 // addServiceToServicesSlice checks to see if, for an experiment and its entry in the configuration, a normal service.Service can be added
 // to the services slice, or if an ExperimentOverriddenService should be added.  It then adds the resultant type that implements
 // service.Service to the services slice
@@ -985,22 +1223,15 @@ func addServiceToServicesSlice(services []service.Service, configExperiment, rea
 }
 
 // getDevEnvironment first checks the environment variable MANAGED_TOKENS_DEV_ENVIRONMENT for the devEnvironment, then the configuration file.
-// If it finds neither are set, it returns the default global setting.  This logic is handled by the underlying logic in the
-// viper library
+// If it finds neither are set, it returns the default from the configuration model.  initEnvironment binds the environment variable, so
+// this logic is handled by the underlying logic in the viper library
 func getDevEnvironmentLabel() string {
-	// For devs, this variable can be set to differentiate between dev and prod for metrics, for example
-	viper.SetDefault("devEnvironmentLabel", devEnvironmentLabelDefault)
-	viper.BindEnv("devEnvironmentLabel", "MANAGED_TOKENS_DEV_ENVIRONMENT_LABEL")
-	return viper.GetString("devEnvironmentLabel")
+	return getConfigModel().DevEnvironmentLabel
 }
 
 // getPrometheusJobName gets the job name by parsing the configuration and the devEnvironment
 func getPrometheusJobName() string {
-	defaultJobName := "managed_tokens"
-	jobName := viper.GetString("prometheus.jobname")
-	if jobName == "" {
-		jobName = defaultJobName
-	}
+	jobName := getConfigModel().Prometheus.JobName
 	if devEnvironmentLabel == devEnvironmentLabelDefault {
 		return jobName
 	}
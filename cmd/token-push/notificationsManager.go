@@ -21,7 +21,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/spf13/viper"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 
@@ -42,7 +41,8 @@ import (
 // When all operations are done, handleNotificationsFinalization should be called.  This function:
 // 1.  Waits for all the workers to finish sending notifications to their listeners (controlled by workerNotificationWg)
 // 2.  Closes the notificationsFromWorkersChan to signal the internal routing functions to expect no more notifications to come through
-// 3.  (2) closes all the registered ServiceEmailManager notifications channels in the serviceNotificationChanMap.  This triggers those
+// 3.  (2) closes all the registered ServiceEmailManager notifications channels in the serviceNotificationChanMap.  If no worker ever started
+// directNotificationsToManagers, handleNotificationsFinalization closes them itself.  This triggers those
 // ServiceEmailManagers to compile their data and send emails to service stakeholders if needed
 // 4.  Waits for all registered ServiceEmailManagers to finish their work (controlled by serviceEmailManagersWg)
 
@@ -64,7 +64,8 @@ func registerServiceNotificationsChan(ctx context.Context, s service.Service, a
 	serviceName := getServiceName(s)
 	span.SetAttributes(attribute.KeyValue{Key: "service", Value: attribute.StringValue(serviceName)})
 
-	toEmails := viper.GetStringSlice("experiments." + s.Experiment() + ".emails")
+	cfg := getConfigModel()
+	toEmails := cfg.experiment(s.Experiment()).Emails
 	if len(toEmails) == 0 {
 		exeLogger.WithField("service", serviceName).Warn("No emails found.  No notifications will be sent for this service")
 		return
@@ -72,18 +73,18 @@ func registerServiceNotificationsChan(ctx context.Context, s service.Service, a
 
 	timestamp := time.Now().Format(time.RFC822)
 	e := notifications.NewEmail(
-		viper.GetString("email.from"),
+		cfg.Email.From,
 		toEmails,
 		fmt.Sprintf("Managed Tokens Push Errors for %s - %s", serviceName, timestamp),
-		viper.GetString("email.smtphost"),
-		viper.GetInt("email.smtpport"),
+		cfg.Email.SMTPHost,
+		cfg.Email.SMTPPort,
 	)
 	serviceEmailManagersWg.Add(1)
 
 	// Functional options for ServiceEmailManager
 	funcOpts := make([]notifications.ServiceEmailManagerOption, 0)
 	setNotificationMinimum := func(em *notifications.ServiceEmailManager) error {
-		em.NotificationMinimum = viper.GetInt("errorCountToSendMessage")
+		em.NotificationMinimum = cfg.ErrorCountToSendMessage
 		return nil
 	}
 	funcOpts = append(funcOpts, setNotificationMinimum)
@@ -172,7 +173,18 @@ func startListenerOnWorkerNotificationChans(ctx context.Context, nChan <-chan no
 func handleNotificationsFinalization() {
 	workerNotificationWg.Wait()         // First let all workers finish sending notifications through their various Notifications channels
 	close(notificationsFromWorkersChan) // Close the aggregation channel for all worker notifications
-	serviceEmailManagersWg.Wait()       // Wait for all notifications.ServiceEmailManager instances to finish their work
+	// If no workers were started, for example because no service had a stored vault token in push-only mode, directNotificationsToManagers
+	// never ran, and nothing else will close the registered service notifications channels.  Otherwise, this waits for it to finish.
+	notificationSorterOnce.Do(closeRegisteredNotificationsChans)
+	serviceEmailManagersWg.Wait() // Wait for all notifications.ServiceEmailManager instances to finish their work
+}
+
+// resetNotificationsManagerState resets the package-level notifications routing state so that a new set of services and workers can
+// be registered.  It should only be called after handleNotificationsFinalization has returned, for example between daemon cycles.
+func resetNotificationsManagerState() {
+	serviceNotificationChanMap.Clear()
+	notificationSorterOnce = sync.Once{}
+	notificationsFromWorkersChan = make(chan notifications.Notification)
 }
 
 // Internal routing funcs
@@ -193,6 +205,7 @@ func directNotificationsToManagers(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		default:
+			currentRunReport.recordNotification(n)
 			// Direct received notifications to appropriate registered notifications channel, if it exists
 			if receiveChan, ok := serviceNotificationChanMap.Load(n.GetService()); ok {
 				if receiveChanVal, ok := receiveChan.(chan notifications.Notification); ok {
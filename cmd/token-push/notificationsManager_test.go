@@ -18,6 +18,7 @@ package main
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -72,3 +73,23 @@ func TestNotificationsManagerSendsMessage(t *testing.T) {
 	logOutput := buf.String()
 	assert.Contains(t, logOutput, "Error sending email")
 }
+
+// If no worker ever starts routing notifications, for example because no service had a stored vault token in push-only mode,
+// handleNotificationsFinalization should still close the registered notifications channels and return
+func TestHandleNotificationsFinalizationWithoutWorkers(t *testing.T) {
+	resetNotificationsManagerState()
+	t.Cleanup(resetNotificationsManagerState)
+
+	registerDummyServiceNotificationsChan(t.Context(), service.NewService("fakeexperiment_fakerole"))
+
+	done := make(chan struct{})
+	go func() {
+		handleNotificationsFinalization()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("handleNotificationsFinalization did not return")
+	}
+}
@@ -0,0 +1,306 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// plan.go provides the --plan mode of token-push, which resolves every service's configuration the same way run() does, but
+// instead of running kinit, condor_vault_storer, htgettoken, ping, or rsync, prints what would have been used and where each
+// value came from.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+
+	"github.com/fermitools/managed-tokens/internal/db"
+	"github.com/fermitools/managed-tokens/internal/environment"
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/tracing"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+// Sources for values in a servicePlan that were not read directly from the configuration file
+const (
+	planSourceDefault           = "default"
+	planSourceDatabase          = "database"
+	planSourceComputed          = "computed"
+	planSourceCondorConfigVal   = "condor_config_val"
+	planSourceConfigPrefix      = "config:"
+	planSourceEnvironmentPrefix = "environment:"
+	planSourceCollectorPrefix   = "collector:"
+)
+
+// planValue is a single resolved value in a servicePlan, along with where that value came from
+type planValue struct {
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+	Error  string `json:"error,omitempty"`
+}
+
+// servicePlan holds all of the resolved values that token-push would use for a service
+type servicePlan struct {
+	Service    string               `json:"service"`
+	Experiment string               `json:"experiment"`
+	Role       string               `json:"role"`
+	ConfigPath string               `json:"configPath"`
+	Tags       []string             `json:"tags,omitempty"`
+	Values     map[string]planValue `json:"values"`
+}
+
+// runPlan resolves the configuration for each service in services, and writes one JSON document per service to w.  It does not
+// obtain or push any tokens, and does not write to the database.
+func runPlan(ctx context.Context, w io.Writer) error {
+	ctx, span := otel.GetTracerProvider().Tracer("token-push").Start(ctx, "runPlan")
+	defer span.End()
+
+	// Only read from an existing database.  We don't want to create or migrate one just to print a plan
+	var database *db.ManagedTokensDatabase
+	dbLocation := getDBLocation()
+	if _, err := os.Stat(dbLocation); err == nil {
+		database, err = db.OpenDatabaseReadOnly(dbLocation)
+		if err != nil {
+			exeLogger.WithField("dbLocation", dbLocation).Error("Could not open database.  UIDs that are not overridden in the configuration will not be resolved")
+		} else {
+			defer database.Close()
+		}
+	} else {
+		exeLogger.WithField("dbLocation", dbLocation).Warn("Database does not exist.  UIDs that are not overridden in the configuration will not be resolved")
+	}
+
+	plans := make([]servicePlan, 0, len(services))
+	for _, s := range services {
+		plans = append(plans, getServicePlan(ctx, s, database))
+	}
+	slices.SortFunc(plans, func(a, b servicePlan) int {
+		switch {
+		case a.Service < b.Service:
+			return -1
+		case a.Service > b.Service:
+			return 1
+		}
+		return 0
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	for _, p := range plans {
+		if err := encoder.Encode(p); err != nil {
+			tracing.LogErrorWithTrace(span, exeLogger, "Could not write execution plan")
+			return err
+		}
+	}
+	tracing.LogSuccessWithTrace(span, exeLogger, "Wrote execution plan")
+	return nil
+}
+
+// getServicePlan resolves all of the configuration values that token-push would use for the service s
+func getServicePlan(ctx context.Context, s service.Service, database *db.ManagedTokensDatabase) servicePlan {
+	serviceConfigPath := "experiments." + s.Experiment() + ".roles." + s.Role()
+	p := servicePlan{
+		Service:    getServiceName(s),
+		Experiment: s.Experiment(),
+		Role:       s.Role(),
+		ConfigPath: serviceConfigPath,
+		Tags:       getServiceTagsFromConfiguration(serviceConfigPath),
+		Values:     make(map[string]planValue),
+	}
+	setErr := func(key string, err error) {
+		v := p.Values[key]
+		v.Error = err.Error()
+		p.Values[key] = v
+	}
+
+	// Resolve the role from the configuration model, like the run does
+	role := getConfigModel().roleAt(serviceConfigPath)
+	p.Values["account"] = planValue{Value: role.Account, Source: planSourceConfigPrefix + serviceConfigPath + ".account"}
+	nodes := role.destinationNodeNames()
+	p.Values["destinationNodes"] = planValue{Value: nodes, Source: planSourceConfigPrefix + serviceConfigPath + ".destinationNodes"}
+	nodeOptions := getNodeOptionsFromConfiguration(serviceConfigPath)
+	p.Values["nodeOptions"] = planValue{Value: nodeOptions, Source: planSourceConfigPrefix + serviceConfigPath + ".destinationNodes"}
+
+	uidSource := planSourceDatabase
+	if desiredUIDPath, overridden := getConfigOverridePath(serviceConfigPath, "desiredUID"); overridden {
+		uidSource = planSourceConfigPrefix + desiredUIDPath
+	}
+	uid, err := getDesiredUIDByOverrideOrLookup(ctx, serviceConfigPath, database)
+	p.Values["desiredUID"] = planValue{Value: uid, Source: uidSource}
+	if err != nil {
+		setErr("desiredUID", err)
+	}
+
+	userPrincipal, htgettokenOpts := getUserPrincipalAndHtgettokenoptsFromConfiguration(serviceConfigPath)
+	userPrincipalSource := configValueSource(serviceConfigPath, "userPrincipal")
+	if _, overridden := getConfigOverridePath(serviceConfigPath, "userPrincipal"); !overridden {
+		userPrincipalSource = configValueSource(serviceConfigPath, "kerberosPrincipalPattern")
+	}
+	p.Values["userPrincipal"] = planValue{Value: userPrincipal, Source: userPrincipalSource}
+	if userPrincipal == "" {
+		setErr("userPrincipal", errors.New("blank userPrincipal"))
+	}
+	htgettokenOptsSource := planSourceComputed
+	if viper.IsSet("ORIG_HTGETTOKENOPTS") {
+		htgettokenOptsSource = planSourceEnvironmentPrefix + "HTGETTOKENOPTS"
+	}
+	p.Values["htgettokenOpts"] = planValue{Value: htgettokenOpts, Source: htgettokenOptsSource}
+
+	vaultServer, err := getVaultServer(serviceConfigPath)
+	p.Values["vaultServer"] = planValue{Value: vaultServer, Source: getVaultServerSource(serviceConfigPath)}
+	if err != nil {
+		setErr("vaultServer", err)
+	}
+
+	tokenGetterWT := getTokenGetterOverrideFromConfiguration(serviceConfigPath)
+	p.Values["tokenGetter"] = planValue{Value: workerTypeToConfigString(tokenGetterWT), Source: configValueSource(serviceConfigPath, "tokenGetter")}
+
+	var schedds []string
+	if tokenGetterWT == worker.StoreAndGetToken {
+		var collectorHost string
+		collectorHost, schedds, err = getScheddsAndCollectorHostFromConfiguration(ctx, serviceConfigPath)
+		p.Values["condorCollectorHost"] = planValue{Value: collectorHost, Source: configValueSource(serviceConfigPath, "condorCollectorHost")}
+		scheddsSource := planSourceCollectorPrefix + collectorHost
+		if _, found := checkScheddsOverride(serviceConfigPath); found {
+			scheddsSource = configValueSource(serviceConfigPath, "condorCreddHost")
+		}
+		p.Values["schedds"] = planValue{Value: schedds, Source: scheddsSource}
+		if err != nil {
+			setErr("schedds", err)
+		}
+	}
+
+	keytabPath := getKeytabFromConfiguration(serviceConfigPath)
+	keytabSource := configValueSource(serviceConfigPath, "keytabPath")
+	if _, overridden := getConfigOverridePath(serviceConfigPath, "keytabPath"); !overridden {
+		keytabSource = planSourceComputed
+	}
+	p.Values["keytabPath"] = planValue{Value: keytabPath, Source: keytabSource}
+
+	defaultRoleFileDestinationTemplate := getDefaultRoleFileDestinationTemplate(serviceConfigPath)
+	p.Values["defaultRoleFileDestinationTemplate"] = planValue{Value: defaultRoleFileDestinationTemplate, Source: configValueSource(serviceConfigPath, "defaultRoleFileDestinationTemplate")}
+	serviceCreddVaultTokenPathRoot := getServiceCreddVaultTokenPathRoot(serviceConfigPath)
+	p.Values["serviceCreddVaultTokenPathRoot"] = planValue{Value: serviceCreddVaultTokenPathRoot, Source: configValueSource(serviceConfigPath, "serviceCreddVaultTokenPathRoot")}
+	p.Values["fileCopierOptions"] = planValue{Value: getFileCopierOptionsFromConfig(serviceConfigPath), Source: configValueSource(serviceConfigPath, "fileCopierOptions")}
+	p.Values["pingOptions"] = planValue{Value: getPingOptsFromConfig(serviceConfigPath), Source: configValueSource(serviceConfigPath, "pingOptions")}
+	p.Values["sshOptions"] = planValue{Value: getSSHOptsFromConfig(serviceConfigPath), Source: configValueSource(serviceConfigPath, "sshOptions")}
+	tokenDestinations := getTokenDestinationsFromConfig(serviceConfigPath)
+	p.Values["tokenDestinations"] = planValue{Value: tokenDestinations, Source: configValueSource(serviceConfigPath, "tokenDestinations")}
+
+	disableNotificationsPath, _ := getConfigOverridePath(serviceConfigPath, "disableNotifications")
+	p.Values["disableNotifications"] = planValue{Value: viper.GetBool(disableNotificationsPath), Source: configValueSource(serviceConfigPath, "disableNotifications")}
+
+	serviceTimeouts, err := getServiceTimeouts(serviceConfigPath, timeouts)
+	timeoutStrings := make(map[string]string, len(serviceTimeouts))
+	for key, timeout := range serviceTimeouts {
+		timeoutStrings[key.String()] = timeout.String()
+	}
+	p.Values["timeouts"] = planValue{Value: timeoutStrings, Source: configValueSource(serviceConfigPath, "timeouts")}
+	if err != nil {
+		setErr("timeouts", err)
+	}
+
+	pushTokensConfigKey := "workerType." + workerTypeToConfigString(worker.PushTokens)
+	numRetriesSource, retrySleepSource := keySource(pushTokensConfigKey+".numRetries"), keySource(pushTokensConfigKey+".retrySleep")
+	if override, ok := getWorkerRetryOverrides(serviceConfigPath, worker.PushTokens); ok {
+		workerTypeOverridePath, _ := getConfigOverridePath(serviceConfigPath, "workerType")
+		if override.NumRetries != nil {
+			numRetriesSource = planSourceConfigPrefix + workerTypeOverridePath
+		}
+		if override.RetrySleep != nil {
+			retrySleepSource = planSourceConfigPrefix + workerTypeOverridePath
+		}
+	}
+	numRetries, retrySleep, retryErr := getAndCheckRetryInfoFromConfig(serviceConfigPath, worker.PushTokens, serviceTimeouts[timeoutPush])
+	if retryErr != nil {
+		// token-push falls back to the global retry settings
+		numRetries, retrySleep, _ = getAndCheckRetryInfoFromConfig("", worker.PushTokens, timeouts[timeoutPush])
+		numRetriesSource, retrySleepSource = keySource(pushTokensConfigKey+".numRetries"), keySource(pushTokensConfigKey+".retrySleep")
+	}
+	p.Values["pushNumRetries"] = planValue{Value: numRetries, Source: numRetriesSource}
+	p.Values["pushRetrySleep"] = planValue{Value: retrySleep.String(), Source: retrySleepSource}
+	if retryErr != nil {
+		setErr("pushNumRetries", retryErr)
+	}
+
+	// Build the worker.Config that would be passed to the workers so that we can get the destination paths from the worker package
+	c, err := worker.NewConfig(
+		s,
+		worker.SetCommandEnvironment(func(e *environment.CommandEnvironment) { e.SetHtgettokenOpts(htgettokenOpts) }),
+		worker.SetSchedds(schedds),
+		worker.SetVaultServer(vaultServer),
+		worker.SetServiceCreddVaultTokenPathRoot(serviceCreddVaultTokenPathRoot),
+		worker.SetUserPrincipal(userPrincipal),
+		worker.SetKeytabPath(keytabPath),
+		worker.SetDesiredUID(uid),
+		worker.SetNodes(nodes),
+		worker.SetNodeOptions(nodeOptions),
+		worker.SetAccount(role.Account),
+		worker.SetSupportedExtrasKeyValue(worker.DefaultRoleFileDestinationTemplate, defaultRoleFileDestinationTemplate),
+		worker.SetSupportedExtrasKeyValue(worker.TokenDestinations, tokenDestinations),
+	)
+	if err != nil {
+		p.Values["pushDestinations"] = planValue{Source: planSourceComputed, Error: fmt.Sprintf("could not create config for service: %s", err)}
+		return p
+	}
+	destinations, err := worker.GetPushDestinations(c)
+	p.Values["pushDestinations"] = planValue{Value: destinations, Source: planSourceComputed}
+	if err != nil {
+		setErr("pushDestinations", err)
+	}
+
+	return p
+}
+
+// configValueSource returns the source that the value for key would be read from for the service at configPath
+func configValueSource(configPath, key string) string {
+	if overridePath, overridden := getConfigOverridePath(configPath, key); overridden {
+		return planSourceConfigPrefix + overridePath
+	}
+	return keySource(key)
+}
+
+// keySource returns the source for a global configuration key
+func keySource(key string) string {
+	if viper.IsSet(key) {
+		return planSourceConfigPrefix + key
+	}
+	return planSourceDefault
+}
+
+// getVaultServerSource returns the source getVaultServer would use to get the vault server for the service at configPath
+func getVaultServerSource(configPath string) string {
+	if os.Getenv(environment.CondorSecCredentialGettokenOpts.EnvVarKey()) != "" {
+		return planSourceEnvironmentPrefix + environment.CondorSecCredentialGettokenOpts.EnvVarKey()
+	}
+	if vaultServerConfigKey, _ := getConfigOverridePath(configPath, "vaultServer"); viper.IsSet(vaultServerConfigKey) {
+		return planSourceConfigPrefix + vaultServerConfigKey
+	}
+	return planSourceCondorConfigVal
+}
+
+func checkPlanFlags() error {
+	if !viper.GetBool("plan") {
+		return nil
+	}
+	if viper.GetBool("daemon") || viper.GetBool("run-onboarding") {
+		return errors.New("plan flag cannot be used with the daemon or run-onboarding flags")
+	}
+	return nil
+}
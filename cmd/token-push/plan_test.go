@@ -0,0 +1,153 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/environment"
+	"github.com/fermitools/managed-tokens/internal/service"
+)
+
+func TestConfigValueSource(t *testing.T) {
+	configPath := "experiments.myexpt.roles.myrole"
+	defer viper.Reset()
+
+	assert.Equal(t, planSourceDefault, configValueSource(configPath, "keytabPath"))
+
+	viper.Set("keytabPath", "/path/to/keytabs")
+	assert.Equal(t, "config:keytabPath", configValueSource(configPath, "keytabPath"))
+
+	viper.Set(configPath+".keytabPathOverride", "/path/to/my/keytab")
+	assert.Equal(t, "config:"+configPath+".keytabPathOverride", configValueSource(configPath, "keytabPath"))
+}
+
+func TestGetVaultServerSource(t *testing.T) {
+	configPath := "experiments.myexpt.roles.myrole"
+	defer viper.Reset()
+
+	t.Setenv(environment.CondorSecCredentialGettokenOpts.EnvVarKey(), "")
+	assert.Equal(t, planSourceCondorConfigVal, getVaultServerSource(configPath))
+
+	viper.Set("vaultServer", "vaultserver.domain")
+	assert.Equal(t, "config:vaultServer", getVaultServerSource(configPath))
+
+	t.Setenv(environment.CondorSecCredentialGettokenOpts.EnvVarKey(), "-a vaultserver2.domain")
+	assert.Equal(t, "environment:"+environment.CondorSecCredentialGettokenOpts.EnvVarKey(), getVaultServerSource(configPath))
+}
+
+func TestGetServicePlan(t *testing.T) {
+	configPath := "experiments.myexpt.roles.myrole"
+	t.Setenv(environment.CondorSecCredentialGettokenOpts.EnvVarKey(), "")
+	viper.Set("vaultServer", "vaultserver.domain")
+	viper.Set("keytabPath", "/path/to/keytabs")
+	viper.Set("kerberosPrincipalPattern", "{{.Account}}/cron/host@REALM")
+	viper.Set(configPath+".account", "myaccount")
+	viper.Set(configPath+".destinationNodes", []string{"node1", "node2"})
+	viper.Set(configPath+".desiredUIDOverride", 12345)
+	viper.Set("condorCollectorHost", "mycollector")
+	viper.Set(configPath+".condorCreddHostOverride", "mycredd")
+	defer viper.Reset()
+
+	p := getServicePlan(context.Background(), service.NewService("myexpt_myrole"), nil)
+
+	assert.Equal(t, "myexpt_myrole", p.Service)
+	assert.Equal(t, configPath, p.ConfigPath)
+	assert.Equal(t, planValue{Value: "myaccount", Source: "config:" + configPath + ".account"}, p.Values["account"])
+	assert.Equal(t, planValue{Value: uint32(12345), Source: "config:" + configPath + ".desiredUIDOverride"}, p.Values["desiredUID"])
+	assert.Equal(t, planValue{Value: "myaccount/cron/host@REALM", Source: "config:kerberosPrincipalPattern"}, p.Values["userPrincipal"])
+	assert.Equal(t, planValue{Value: "vaultserver.domain", Source: "config:vaultServer"}, p.Values["vaultServer"])
+	assert.Equal(t, planValue{Value: []string{"mycredd"}, Source: "config:" + configPath + ".condorCreddHostOverride"}, p.Values["schedds"])
+	assert.Equal(t, planValue{Value: "/path/to/keytabs/myaccount.keytab", Source: planSourceComputed}, p.Values["keytabPath"])
+	assert.Equal(t, planSourceDefault, p.Values["defaultRoleFileDestinationTemplate"].Source)
+	assert.Equal(t,
+		planValue{
+			Value:  []string{"/tmp/vt_u12345", "/tmp/vt_u12345-myexpt_myrole", "/tmp/default_role_myexpt_12345"},
+			Source: planSourceComputed,
+		},
+		p.Values["pushDestinations"],
+	)
+}
+
+// The plan should show the account from the loaded configuration model, which is what the run uses, even if the raw configuration
+// has changed since
+func TestGetServicePlanAccountFromConfigModel(t *testing.T) {
+	configPath := "experiments.myexpt.roles.myrole"
+	viper.Set("experiments.myexpt.emails", []string{"me@example.com"})
+	viper.Set(configPath+".account", "myaccount")
+	viper.Set(configPath+".destinationNodes", []string{"node1"})
+	defer viper.Reset()
+	if err := loadConfigModel(); err != nil {
+		t.Fatalf("Could not load configuration model: %s", err)
+	}
+	defer func() { configModel = nil }()
+
+	viper.Set(configPath+".account", "otheraccount")
+	p := getServicePlan(context.Background(), service.NewService("myexpt_myrole"), nil)
+	assert.Equal(t, "myaccount", p.Values["account"].Value)
+}
+
+func TestGetServicePlanNoDatabase(t *testing.T) {
+	configPath := "experiments.myexpt.roles.myrole"
+	viper.Set(configPath+".account", "myaccount")
+	viper.Set(configPath+".tokenGetterOverride", "getToken")
+	defer viper.Reset()
+
+	p := getServicePlan(context.Background(), service.NewService("myexpt_myrole"), nil)
+	assert.Equal(t, planSourceDatabase, p.Values["desiredUID"].Source)
+	assert.NotEmpty(t, p.Values["desiredUID"].Error)
+	assert.Equal(t, "getToken", p.Values["tokenGetter"].Value)
+	assert.NotContains(t, p.Values, "schedds")
+}
+
+func TestRunPlan(t *testing.T) {
+	viper.Set("dbLocation", path.Join(t.TempDir(), "doesnotexist.db"))
+	viper.Set("experiments.myexpt.roles.myrole.account", "myaccount")
+	viper.Set("experiments.myexpt.roles.myrole.tokenGetterOverride", "getToken")
+	viper.Set("experiments.myexpt2.roles.myrole.account", "myaccount2")
+	viper.Set("experiments.myexpt2.roles.myrole.tokenGetterOverride", "getToken")
+	defer viper.Reset()
+
+	oldServices := services
+	services = []service.Service{service.NewService("myexpt2_myrole"), service.NewService("myexpt_myrole")}
+	defer func() { services = oldServices }()
+
+	var b bytes.Buffer
+	if err := runPlan(context.Background(), &b); err != nil {
+		t.Fatalf("Could not run plan: %s", err)
+	}
+
+	// The plan should be sorted by service, and should not have created a database
+	decoder := json.NewDecoder(&b)
+	for _, expected := range []string{"myexpt2_myrole", "myexpt_myrole"} {
+		var p servicePlan
+		if err := decoder.Decode(&p); err != nil {
+			t.Fatalf("Could not decode plan: %s", err)
+		}
+		assert.Equal(t, expected, p.Service)
+	}
+	assert.False(t, decoder.More())
+	_, err := os.Stat(viper.GetString("dbLocation"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
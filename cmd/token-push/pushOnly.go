@@ -0,0 +1,106 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// pushOnly.go provides the --push-only mode of token-push, which pushes the vault tokens that were already stored by a previous run
+// to the destination nodes, without getting kerberos tickets or getting and storing new vault tokens.
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+// checkPushOnlyFlags makes sure that the push-only and node flags are not combined with flags that they can't be used with
+func checkPushOnlyFlags() error {
+	if !viper.GetBool("push-only") {
+		if len(viper.GetStringSlice("node")) > 0 {
+			return errors.New("node flag can only be used with the push-only flag")
+		}
+		return nil
+	}
+	for _, flag := range []string{"daemon", "plan", "run-onboarding", "test"} {
+		if viper.GetBool(flag) {
+			return errors.New("push-only flag cannot be used with the " + flag + " flag")
+		}
+	}
+	return nil
+}
+
+// getDestinationNodesFromConfiguration returns the destination nodes for the service at serviceConfigPath.  In push-only mode, if
+// any nodes were given with the node flag, only those nodes are returned.
+func getDestinationNodesFromConfiguration(serviceConfigPath string) []string {
+	nodes := getConfigModel().roleAt(serviceConfigPath).destinationNodeNames()
+	selectedNodes := viper.GetStringSlice("node")
+	if !viper.GetBool("push-only") || len(selectedNodes) == 0 {
+		return nodes
+	}
+	return slices.DeleteFunc(nodes, func(node string) bool { return !slices.Contains(selectedNodes, node) })
+}
+
+// selectPushOnlyServices returns the services that push-only mode should push tokens for:  if nodes were given with the node flag,
+// these are the services that have at least one of those nodes as a destination node.  It returns an error if there are no such
+// services.
+func selectPushOnlyServices(services []service.Service) ([]service.Service, error) {
+	selectedNodes := viper.GetStringSlice("node")
+	if len(selectedNodes) == 0 {
+		return services, nil
+	}
+
+	selectedServices := make([]service.Service, 0, len(services))
+	foundNodes := make(map[string]struct{})
+	for _, s := range services {
+		nodes := getDestinationNodesFromConfiguration("experiments." + s.Experiment() + ".roles." + s.Role())
+		if len(nodes) == 0 {
+			continue
+		}
+		selectedServices = append(selectedServices, s)
+		for _, node := range nodes {
+			foundNodes[node] = struct{}{}
+		}
+	}
+
+	unknownNodes := make([]string, 0)
+	for _, node := range selectedNodes {
+		if _, ok := foundNodes[node]; !ok {
+			unknownNodes = append(unknownNodes, node)
+		}
+	}
+	if len(unknownNodes) > 0 {
+		exeLogger.WithField("nodes", strings.Join(unknownNodes, ", ")).Warn("Nodes are not destination nodes of any of the selected services.  Will not push tokens to them")
+	}
+
+	if len(selectedServices) == 0 {
+		return nil, errors.New("none of the selected services have any of the given nodes as destination nodes")
+	}
+	return selectedServices, nil
+}
+
+// getPushOnlyPipelineStages returns the worker.PipelineStages that each service's *worker.Config should go through in push-only mode
+func getPushOnlyPipelineStages() []worker.PipelineStage {
+	stages := []worker.PipelineStage{
+		// If we can't ping some nodes, we still try to push to all of them
+		{WorkerType: worker.PingAggregator, ContinueOnFailure: true},
+		{WorkerType: worker.PushTokens},
+	}
+	setPipelineStageTimeouts(stages)
+	return stages
+}
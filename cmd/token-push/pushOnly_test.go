@@ -0,0 +1,84 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+func TestCheckPushOnlyFlags(t *testing.T) {
+	defer viper.Reset()
+
+	assert.NoError(t, checkPushOnlyFlags())
+
+	viper.Set("node", []string{"node1"})
+	assert.Error(t, checkPushOnlyFlags())
+
+	viper.Set("push-only", true)
+	assert.NoError(t, checkPushOnlyFlags())
+
+	for _, flag := range []string{"daemon", "plan", "run-onboarding", "test"} {
+		viper.Set(flag, true)
+		assert.Error(t, checkPushOnlyFlags(), flag)
+		viper.Set(flag, false)
+	}
+}
+
+func TestSelectPushOnlyServices(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set("experiments.expt1.roles.role1.destinationNodes", []string{"node1", "node2"})
+	viper.Set("experiments.expt2.roles.role1.destinationNodes", []string{"node3"})
+	services := []service.Service{service.NewService("expt1_role1"), service.NewService("expt2_role1")}
+
+	// Without the node flag, every service is selected, with all of its nodes
+	viper.Set("push-only", true)
+	selected, err := selectPushOnlyServices(services)
+	assert.NoError(t, err)
+	assert.Equal(t, services, selected)
+	assert.Equal(t, []string{"node1", "node2"}, getDestinationNodesFromConfiguration("experiments.expt1.roles.role1"))
+
+	viper.Set("node", []string{"node2", "node4"})
+	selected, err = selectPushOnlyServices(services)
+	assert.NoError(t, err)
+	assert.Equal(t, services[:1], selected)
+	assert.Equal(t, []string{"node2"}, getDestinationNodesFromConfiguration("experiments.expt1.roles.role1"))
+
+	viper.Set("node", []string{"node4"})
+	_, err = selectPushOnlyServices(services)
+	assert.Error(t, err)
+
+	// The node flag is only used in push-only mode
+	viper.Set("push-only", false)
+	assert.Equal(t, []string{"node1", "node2"}, getDestinationNodesFromConfiguration("experiments.expt1.roles.role1"))
+}
+
+func TestGetPushOnlyPipelineStages(t *testing.T) {
+	stages := getPushOnlyPipelineStages()
+	if assert.Len(t, stages, 2) {
+		assert.Equal(t, worker.PingAggregator, stages[0].WorkerType)
+		assert.True(t, stages[0].ContinueOnFailure)
+		assert.Equal(t, timeouts[timeoutPing], stages[0].Timeout)
+		assert.Equal(t, worker.PushTokens, stages[1].WorkerType)
+		assert.Equal(t, timeouts[timeoutPush], stages[1].Timeout)
+	}
+}
@@ -0,0 +1,216 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// retryFailed.go provides the --retry-failed mode of token-push, which only runs the services that failed in the previous run, and
+// for services that only failed to push their tokens to some nodes, only pushes to those nodes.  It also provides the recording of
+// each run's results in the ManagedTokensDatabase that this mode relies on.
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+
+	"github.com/fermitools/managed-tokens/internal/db"
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/tracing"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+// retryFailedNodes holds, for each service that only failed to push its tokens to some of its nodes in the previous run, those nodes.
+// It is only populated in retry-failed mode.
+var retryFailedNodes map[string][]string
+
+// errNoFailedServices is returned by selectRetryFailedServices if none of the selected services failed in the previous run
+var errNoFailedServices = errors.New("no services failed in the previous run")
+
+// checkRetryFailedFlags makes sure that the retry-failed flag is not combined with flags that it can't be used with
+func checkRetryFailedFlags() error {
+	if !viper.GetBool("retry-failed") {
+		return nil
+	}
+	for _, flag := range []string{"daemon", "plan", "run-onboarding", "test"} {
+		if viper.GetBool(flag) {
+			return errors.New("retry-failed flag cannot be used with the " + flag + " flag")
+		}
+	}
+	return nil
+}
+
+// selectRetryFailedServices reads the results of the previous run from the ManagedTokensDatabase, and returns the services in services
+// that failed in that run.  It also populates retryFailedNodes.  If none of the services failed, it returns errNoFailedServices.
+func selectRetryFailedServices(ctx context.Context, services []service.Service) ([]service.Service, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("token-push").Start(ctx, "selectRetryFailedServices")
+	defer span.End()
+
+	// We need the results of a previous run, so don't create a new database here.  We also only read from the database, so don't migrate it
+	dbLocation := getDBLocation()
+	funcLogger := exeLogger.WithField("dbLocation", dbLocation)
+	if _, err := os.Stat(dbLocation); err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Database does not exist.  Cannot determine which services failed in the previous run")
+		return nil, err
+	}
+	database, err := db.OpenDatabaseReadOnly(dbLocation)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not open database.  Cannot determine which services failed in the previous run")
+		return nil, err
+	}
+	defer database.Close()
+
+	serviceResults, err := database.GetServiceRunResults(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			tracing.LogErrorWithTrace(span, funcLogger, "No results of a previous run were found in the database")
+			return nil, errors.New("no results of a previous run were found in the database")
+		}
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not get the results of the previous run from the database")
+		return nil, err
+	}
+	nodeResults, err := database.GetNodePushResults(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not get the node push results of the previous run from the database")
+		return nil, err
+	}
+
+	var selected []service.Service
+	selected, retryFailedNodes = filterRetryFailedServices(services, serviceResults, nodeResults)
+	if len(selected) == 0 {
+		return nil, errNoFailedServices
+	}
+	tracing.LogSuccessWithTrace(span, funcLogger, "Selected services that failed in the previous run")
+	return selected, nil
+}
+
+// filterRetryFailedServices returns the services in services that failed according to serviceResults.  Services that have no recorded
+// result are not selected.  For each selected service that failed to push its tokens, it also returns the nodes that the push failed
+// for according to nodeResults.  If there are no failed nodes recorded for such a service, we push to all of its nodes again.
+func filterRetryFailedServices(services []service.Service, serviceResults []db.ServiceRunResult, nodeResults []db.NodePushResult) ([]service.Service, map[string][]string) {
+	failedServices := make(map[string]string, len(serviceResults))
+	for _, r := range serviceResults {
+		if !r.Success() {
+			failedServices[r.Service()] = r.FailedStage()
+		}
+	}
+
+	failedNodes := make(map[string][]string)
+	for _, r := range nodeResults {
+		if failedStage, ok := failedServices[r.Service()]; ok && failedStage == workerTypeToConfigString(worker.PushTokens) && !r.Success() {
+			failedNodes[r.Service()] = append(failedNodes[r.Service()], r.Node())
+		}
+	}
+
+	selected := make([]service.Service, 0, len(services))
+	for _, s := range services {
+		if _, ok := failedServices[getServiceName(s)]; ok {
+			selected = append(selected, s)
+		}
+	}
+	return selected, failedNodes
+}
+
+// getRetryFailedNodes returns the nodes in nodes that the service should push its tokens to.  In retry-failed mode, if the service only
+// failed to push its tokens to some nodes in the previous run, only those nodes are returned.  Otherwise, nodes is returned unchanged.
+func getRetryFailedNodes(serviceName string, nodes []string) []string {
+	failedNodes, ok := retryFailedNodes[serviceName]
+	if !ok {
+		return nodes
+	}
+	// viper can give us the slice that it stores, so don't modify it in place
+	return slices.DeleteFunc(slices.Clone(nodes), func(node string) bool { return !slices.Contains(failedNodes, node) })
+}
+
+// serviceRunOutcome implements db.ServiceRunResult
+type serviceRunOutcome struct {
+	service     string
+	success     bool
+	failedStage string
+}
+
+func (s *serviceRunOutcome) Service() string     { return s.service }
+func (s *serviceRunOutcome) Success() bool       { return s.success }
+func (s *serviceRunOutcome) FailedStage() string { return s.failedStage }
+
+// nodePushOutcome implements db.NodePushResult.  errorClass is the class of the error that the push failed with, if it did.
+type nodePushOutcome struct {
+	service    string
+	node       string
+	success    bool
+	errorClass worker.ErrorClass
+}
+
+func (n *nodePushOutcome) Service() string { return n.service }
+func (n *nodePushOutcome) Node() string    { return n.node }
+func (n *nodePushOutcome) Success() bool   { return n.success }
+
+// getRunResultsFromReport returns the result of the run for each service in the finalized runReport r, along with the result of
+// pushing each service's tokens to each of its nodes.  A service's failed stage is the first stage that failed for it, not counting
+// pinging nodes, since we push tokens to nodes even if we can't ping them.
+func getRunResultsFromReport(r *runReport) ([]db.ServiceRunResult, []db.NodePushResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	serviceResults := make([]db.ServiceRunResult, 0, len(r.Services))
+	nodeResults := make([]db.NodePushResult, 0)
+	for _, serviceName := range slices.Sorted(maps.Keys(r.Services)) {
+		sr := r.Services[serviceName]
+		result := &serviceRunOutcome{service: serviceName, success: sr.Outcome == outcomeSuccess}
+		for _, st := range sr.Stages {
+			if st.Stage == workerTypeToConfigString(worker.PushTokens) {
+				for _, t := range st.Targets {
+					nodeResults = append(nodeResults, &nodePushOutcome{
+						service:    serviceName,
+						node:       t.Target,
+						success:    t.Outcome == outcomeSuccess,
+						errorClass: worker.ErrorClass(t.ErrorClass),
+					})
+				}
+			}
+			if !result.success && result.failedStage == "" && st.Outcome == outcomeFailure && st.Stage != workerTypeToConfigString(worker.PingAggregator) {
+				result.failedStage = st.Stage
+			}
+		}
+		serviceResults = append(serviceResults, result)
+	}
+	return serviceResults, nodeResults
+}
+
+// saveRunResults records the results of the run in the finalized runReport r in the ManagedTokensDatabase, so that a later run can
+// retry the services and nodes that failed
+func saveRunResults(ctx context.Context, database *db.ManagedTokensDatabase, r *runReport) {
+	if database == nil || r == nil {
+		return
+	}
+	ctx, span := otel.GetTracerProvider().Tracer("token-push").Start(ctx, "saveRunResults")
+	defer span.End()
+
+	serviceResults, nodeResults := getRunResultsFromReport(r)
+	// The service results have to be saved first, since the node push results are only valid for the run recorded for each service
+	if err := database.UpdateServiceRunResultsTable(ctx, r.StartTime, serviceResults); err != nil {
+		tracing.LogErrorWithTrace(span, exeLogger, "Could not save service run results to database.  --retry-failed will not be able to use the results of this run")
+		return
+	}
+	if err := database.UpdateNodePushResultsTable(ctx, r.StartTime, nodeResults); err != nil {
+		tracing.LogErrorWithTrace(span, exeLogger, "Could not save node push results to database.  --retry-failed will not be able to use the results of this run")
+		return
+	}
+	tracing.LogSuccessWithTrace(span, exeLogger, "Saved run results to database")
+}
@@ -0,0 +1,151 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/db"
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+func TestCheckRetryFailedFlags(t *testing.T) {
+	defer viper.Reset()
+
+	assert.NoError(t, checkRetryFailedFlags())
+	viper.Set("retry-failed", true)
+	assert.NoError(t, checkRetryFailedFlags())
+
+	// retry-failed can be combined with push-only
+	viper.Set("push-only", true)
+	assert.NoError(t, checkRetryFailedFlags())
+
+	for _, flag := range []string{"daemon", "plan", "run-onboarding", "test"} {
+		viper.Set(flag, true)
+		assert.Error(t, checkRetryFailedFlags(), flag)
+		viper.Set(flag, false)
+	}
+}
+
+func TestFilterRetryFailedServices(t *testing.T) {
+	pushStage := workerTypeToConfigString(worker.PushTokens)
+	services := []service.Service{
+		service.NewService("expt1_role1"),
+		service.NewService("expt1_role2"),
+		service.NewService("expt2_role1"),
+		service.NewService("expt3_role1"),
+	}
+	serviceResults := []db.ServiceRunResult{
+		&serviceRunOutcome{service: "expt1_role1", success: true},
+		&serviceRunOutcome{service: "expt1_role2", success: false, failedStage: pushStage},
+		&serviceRunOutcome{service: "expt2_role1", success: false, failedStage: workerTypeToConfigString(worker.GetKerberosTickets)},
+		&serviceRunOutcome{service: "otherexpt_role1", success: false, failedStage: stageSetup},
+	}
+	nodeResults := []db.NodePushResult{
+		&nodePushOutcome{service: "expt1_role1", node: "node1", success: true},
+		&nodePushOutcome{service: "expt1_role2", node: "node1", success: true},
+		&nodePushOutcome{service: "expt1_role2", node: "node2", success: false},
+	}
+
+	// expt3_role1 has no recorded result, and otherexpt_role1 is not one of our services
+	selected, failedNodes := filterRetryFailedServices(services, serviceResults, nodeResults)
+	assert.Equal(t, services[1:3], selected)
+	assert.Equal(t, map[string][]string{"expt1_role2": {"node2"}}, failedNodes)
+}
+
+func TestGetRetryFailedNodes(t *testing.T) {
+	defer func() { retryFailedNodes = nil }()
+	nodes := []string{"node1", "node2", "node3"}
+
+	assert.Equal(t, nodes, getRetryFailedNodes("expt_role", nodes))
+
+	retryFailedNodes = map[string][]string{"expt_role": {"node3", "node1"}}
+	assert.Equal(t, []string{"node1", "node3"}, getRetryFailedNodes("expt_role", nodes))
+	assert.Equal(t, nodes, getRetryFailedNodes("expt_role2", nodes))
+	assert.Equal(t, []string{"node1", "node2", "node3"}, nodes)
+}
+
+func TestGetRunResultsFromReport(t *testing.T) {
+	services := []service.Service{
+		service.NewService("expt_success"),
+		service.NewService("expt_pushfailure"),
+		service.NewService("expt_tokenfailure"),
+		service.NewService("expt_notrun"),
+	}
+	start := time.Now()
+	r := newRunReport("token-push", start, services)
+	for _, s := range services[:3] {
+		r.recordStage(s.Name(), stageSetup, true, start, start)
+	}
+
+	pushResult := func(s service.Service, nodes ...worker.NodePushResult) worker.StageResult {
+		details := &worker.PushTokensResult{Service: s, Nodes: nodes}
+		return worker.StageResult{
+			WorkerType: worker.PushTokens,
+			Config:     &worker.Config{Service: s},
+			Success:    details.GetSuccess(),
+			Start:      start,
+			Final:      true,
+			Details:    details,
+		}
+	}
+	failedFile := worker.FilePushResult{OperationResult: worker.OperationResult{Target: "node2", Err: errors.New("exit status 23")}, Required: true}
+	canceledFile := worker.FilePushResult{
+		OperationResult: worker.OperationResult{Target: "node3", Err: context.Canceled, ErrorClass: worker.ErrorClassCanceled},
+		Required:        true,
+	}
+
+	r.recordStage("expt_success", workerTypeToConfigString(worker.PingAggregator), false, start, start)
+	r.recordStageResult(pushResult(services[0], worker.NodePushResult{Node: "node1"}))
+
+	r.recordStage("expt_pushfailure", workerTypeToConfigString(worker.PingAggregator), false, start, start)
+	r.recordStageResult(pushResult(services[1],
+		worker.NodePushResult{Node: "node1"},
+		worker.NodePushResult{Node: "node2", Files: []worker.FilePushResult{failedFile}},
+		worker.NodePushResult{Node: "node3", Files: []worker.FilePushResult{canceledFile}},
+	))
+
+	r.recordStage("expt_tokenfailure", workerTypeToConfigString(worker.GetToken), false, start, start)
+
+	r.finalize(map[string]bool{"expt_success": true}, nil)
+
+	serviceResults, nodeResults := getRunResultsFromReport(r)
+	assert.Equal(t,
+		[]db.ServiceRunResult{
+			&serviceRunOutcome{service: "expt_notrun", success: false, failedStage: ""},
+			&serviceRunOutcome{service: "expt_pushfailure", success: false, failedStage: workerTypeToConfigString(worker.PushTokens)},
+			&serviceRunOutcome{service: "expt_success", success: true},
+			&serviceRunOutcome{service: "expt_tokenfailure", success: false, failedStage: workerTypeToConfigString(worker.GetToken)},
+		},
+		serviceResults,
+	)
+	assert.Equal(t,
+		[]db.NodePushResult{
+			&nodePushOutcome{service: "expt_pushfailure", node: "node1", success: true},
+			&nodePushOutcome{service: "expt_pushfailure", node: "node2", success: false},
+			&nodePushOutcome{service: "expt_pushfailure", node: "node3", success: false, errorClass: worker.ErrorClassCanceled},
+			&nodePushOutcome{service: "expt_success", node: "node1", success: true},
+		},
+		nodeResults,
+	)
+}
@@ -0,0 +1,517 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// runReport.go provides a machine-readable report of a token-push run.  The report records the outcome of each stage for each
+// service, along with any per-node results and error messages, and is written as JSON (and optionally JUnit XML) to the directory
+// configured at runReport.directory.
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fermitools/managed-tokens/internal/notifications"
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+// currentRunReport is the runReport for the run that is currently in progress.  It is replaced at the beginning of every call to run()
+var currentRunReport *runReport
+
+// Possible stage and run outcomes
+const (
+	outcomeSuccess        = "success"
+	outcomeFailure        = "failure"
+	outcomeSkipped        = "skipped"
+	outcomeRunning        = "running"
+	outcomePartialFailure = "partial_failure"
+	outcomeAborted        = "aborted"
+)
+
+// Stage name for the service configuration setup that happens before any workers are run
+const stageSetup = "setup"
+
+// runReport is the report for a single token-push run
+type runReport struct {
+	Executable      string                    `json:"executable"`
+	StartTime       time.Time                 `json:"startTime"`
+	EndTime         time.Time                 `json:"endTime"`
+	DurationSeconds float64                   `json:"durationSeconds"`
+	Outcome         string                    `json:"outcome"`
+	Error           string                    `json:"error,omitempty"`
+	Services        map[string]*serviceReport `json:"services"`
+
+	// stageOrder is the order in which stages are run for every service
+	stageOrder []string
+	mu         sync.Mutex
+}
+
+// serviceReport holds the stage results for a single service
+type serviceReport struct {
+	Outcome string         `json:"outcome"`
+	Stages  []*stageReport `json:"stages"`
+}
+
+// stageReport holds the result of a single stage for a single service
+type stageReport struct {
+	Stage           string          `json:"stage"`
+	Outcome         string          `json:"outcome"`
+	StartTime       time.Time       `json:"startTime,omitzero"`
+	DurationSeconds float64         `json:"durationSeconds"`
+	Errors          []string        `json:"errors,omitempty"`
+	Targets         []*targetReport `json:"targets,omitempty"`
+}
+
+// targetReport holds the result of a stage for a single target within that stage, for example a node or a schedd
+type targetReport struct {
+	Target          string        `json:"target"`
+	Outcome         string        `json:"outcome"`
+	ErrorClass      string        `json:"errorClass,omitempty"`
+	Attempts        uint          `json:"attempts,omitempty"`
+	DurationSeconds float64       `json:"durationSeconds,omitempty"`
+	Errors          []string      `json:"errors,omitempty"`
+	Files           []*fileReport `json:"files,omitempty"`
+}
+
+// fileReport holds the result of pushing a single file to a node
+type fileReport struct {
+	Destination     string  `json:"destination"`
+	Required        bool    `json:"required"`
+	Outcome         string  `json:"outcome"`
+	ErrorClass      string  `json:"errorClass,omitempty"`
+	Attempts        uint    `json:"attempts"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// newRunReport returns a *runReport for the given services, where every stage for every service is marked as skipped
+func newRunReport(executable string, startTime time.Time, services []service.Service) *runReport {
+	r := &runReport{
+		Executable: executable,
+		StartTime:  startTime,
+		Services:   make(map[string]*serviceReport, len(services)),
+		stageOrder: []string{
+			stageSetup,
+			workerTypeToConfigString(worker.GetKerberosTickets),
+			workerTypeToConfigString(worker.GetToken),
+			workerTypeToConfigString(worker.StoreAndGetToken),
+			workerTypeToConfigString(worker.PingAggregator),
+			workerTypeToConfigString(worker.PushTokens),
+		},
+	}
+	for _, s := range services {
+		sr := &serviceReport{Outcome: outcomeSkipped}
+		for _, stage := range r.stageOrder {
+			sr.Stages = append(sr.Stages, &stageReport{Stage: stage, Outcome: outcomeSkipped})
+		}
+		r.Services[getServiceName(s)] = sr
+	}
+	return r
+}
+
+// getStage returns the *stageReport for the given service and stage, or nil if there is none.  The caller must hold r.mu
+func (r *runReport) getStage(serviceName, stage string) *stageReport {
+	sr, ok := r.Services[serviceName]
+	if !ok {
+		return nil
+	}
+	for _, st := range sr.Stages {
+		if st.Stage == stage {
+			return st
+		}
+	}
+	return nil
+}
+
+// startStage marks a stage for a service as running, so that notifications sent during the stage are attached to it
+func (r *runReport) startStage(serviceName, stage string, start time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if st := r.getStage(serviceName, stage); st != nil {
+		st.Outcome = outcomeRunning
+		st.StartTime = start
+	}
+}
+
+// recordStage records the outcome of a stage for a service that was started at start and finished at end
+func (r *runReport) recordStage(serviceName, stage string, success bool, start, end time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.getStage(serviceName, stage)
+	if st == nil {
+		return
+	}
+	st.Outcome = outcomeFailure
+	if success {
+		st.Outcome = outcomeSuccess
+	}
+	st.StartTime = start
+	st.DurationSeconds = end.Sub(start).Seconds()
+}
+
+// recordStageResult records the outcome of a stage reported by a worker.Pipeline.  The stage's duration is the one the worker.Pipeline
+// measured, so it doesn't include the time the result waited to be recorded.  If the stage's worker reported per-target results, like
+// the result for each node, those are recorded as the stage's targets.
+func (r *runReport) recordStageResult(result worker.StageResult) {
+	if r == nil {
+		return
+	}
+	serviceName := getServiceName(result.GetService())
+	stage := workerTypeToConfigString(result.WorkerType)
+	r.recordStage(serviceName, stage, result.GetSuccess(), result.Start, result.End)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.getStage(serviceName, stage)
+	if st == nil {
+		return
+	}
+	switch details := result.Details.(type) {
+	case *worker.StoreAndGetTokenResult:
+		for _, o := range details.Schedds {
+			st.Targets = append(st.Targets, newTargetReportFromOperation(o))
+		}
+	case *worker.PingResult:
+		for _, o := range details.Nodes {
+			st.Targets = append(st.Targets, newTargetReportFromOperation(o))
+		}
+	case *worker.PushTokensResult:
+		if details.Err != nil {
+			st.Errors = append(st.Errors, details.Err.Error())
+		}
+		for _, n := range details.Nodes {
+			st.Targets = append(st.Targets, newTargetReportFromNodePush(n))
+		}
+	}
+}
+
+// newTargetReportFromOperation returns the *targetReport for a single worker.OperationResult
+func newTargetReportFromOperation(o worker.OperationResult) *targetReport {
+	t := &targetReport{
+		Target:          o.Target,
+		Outcome:         outcomeSuccess,
+		Attempts:        o.Attempts,
+		DurationSeconds: o.Duration().Seconds(),
+	}
+	if !o.Success() {
+		t.Outcome = outcomeFailure
+		t.ErrorClass = string(o.ErrorClass)
+		t.Errors = []string{o.Err.Error()}
+	}
+	return t
+}
+
+// newTargetReportFromNodePush returns the *targetReport for the files pushed to a single node.  The node's errors and error class come
+// from the required files that could not be pushed.  The duration is the time from the first push to the node starting to the last one
+// ending.
+func newTargetReportFromNodePush(n worker.NodePushResult) *targetReport {
+	t := &targetReport{Target: n.Node, Outcome: outcomeSuccess}
+	if f := n.FirstFailure(); f != nil {
+		t.Outcome = outcomeFailure
+		t.ErrorClass = string(f.ErrorClass)
+	}
+
+	var start, end time.Time
+	for _, f := range n.Files {
+		fr := &fileReport{
+			Destination:     f.Destination,
+			Required:        f.Required,
+			Outcome:         outcomeSuccess,
+			Attempts:        f.Attempts,
+			DurationSeconds: f.Duration().Seconds(),
+		}
+		if !f.Success() {
+			fr.Outcome = outcomeFailure
+			fr.ErrorClass = string(f.ErrorClass)
+			fr.Error = f.Err.Error()
+			if f.Required {
+				t.Errors = append(t.Errors, fmt.Sprintf("%s: %s", f.Destination, fr.Error))
+			}
+		}
+		t.Files = append(t.Files, fr)
+
+		if start.IsZero() || f.Start.Before(start) {
+			start = f.Start
+		}
+		if f.End.After(end) {
+			end = f.End
+		}
+	}
+	if !start.IsZero() {
+		t.DurationSeconds = end.Sub(start).Seconds()
+	}
+	return t
+}
+
+// recordNotification attaches the message of a notifications.Notification sent by a worker to the stage that is running, or was run
+// last, for the service.  Push errors are not recorded, since the PushTokens worker's results already hold the error for each node.
+func (r *runReport) recordNotification(n notifications.Notification) {
+	if r == nil {
+		return
+	}
+	if _, ok := n.(interface{ GetNode() string }); ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sr, ok := r.Services[n.GetService()]
+	if !ok {
+		return
+	}
+
+	// Attach the message to the running stage, or the last stage that was run
+	for i := len(sr.Stages) - 1; i >= 0; i-- {
+		if sr.Stages[i].Outcome != outcomeSkipped {
+			sr.Stages[i].Errors = append(sr.Stages[i].Errors, n.GetMessage())
+			return
+		}
+	}
+	sr.Stages[0].Errors = append(sr.Stages[0].Errors, n.GetMessage())
+}
+
+// setStageTargetMetrics sets the stage target count metric from the targets recorded for each service and stage.  Successful targets
+// have the error class "none".
+func (r *runReport) setStageTargetMetrics() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type metricKey struct{ service, stage, outcome, errorClass string }
+	counts := make(map[metricKey]int)
+	for serviceName, sr := range r.Services {
+		for _, st := range sr.Stages {
+			for _, t := range st.Targets {
+				errorClass := t.ErrorClass
+				if errorClass == "" {
+					errorClass = "none"
+				}
+				counts[metricKey{serviceName, st.Stage, t.Outcome, errorClass}]++
+			}
+		}
+	}
+
+	// Clear out the counts from any earlier run, like an earlier daemon cycle
+	stageTargetCount.Reset()
+	for k, count := range counts {
+		stageTargetCount.WithLabelValues(k.service, k.stage, k.outcome, k.errorClass).Set(float64(count))
+	}
+}
+
+// finalize sets the end time of the run, and classifies each service and the overall run.  runErr is the error returned by run(), if any.
+// A service is successful if the last stage it needed succeeded, and none of its stages failed.
+func (r *runReport) finalize(successfulServices map[string]bool, runErr error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.EndTime = time.Now()
+	r.DurationSeconds = r.EndTime.Sub(r.StartTime).Seconds()
+
+	var successCount int
+	for serviceName, sr := range r.Services {
+		// Any stage that never reported a result did not finish
+		for _, st := range sr.Stages {
+			if st.Outcome == outcomeRunning {
+				st.Outcome = outcomeFailure
+				st.DurationSeconds = r.EndTime.Sub(st.StartTime).Seconds()
+			}
+		}
+		sr.Outcome = outcomeFailure
+		if successfulServices[serviceName] {
+			sr.Outcome = outcomeSuccess
+			successCount++
+		}
+	}
+
+	switch {
+	case runErr != nil:
+		r.Outcome = outcomeAborted
+		r.Error = runErr.Error()
+	case successCount == len(r.Services):
+		r.Outcome = outcomeSuccess
+	case successCount == 0:
+		r.Outcome = outcomeFailure
+	default:
+		r.Outcome = outcomePartialFailure
+	}
+}
+
+// write writes the runReport as JSON to dir, and if writeJUnit is true, as JUnit XML as well.  The report is written to a timestamped
+// file, and a copy is kept at a stable "latest" location so that monitoring tools can always find the most recent report.
+func (r *runReport) write(dir string, writeJUnit bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("could not create run report directory: %w", err)
+	}
+	timestamp := r.StartTime.Format("20060102T150405")
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal run report to JSON: %w", err)
+	}
+	if err := writeReportFiles(dir, r.Executable, timestamp, "json", data); err != nil {
+		return err
+	}
+
+	if !writeJUnit {
+		return nil
+	}
+	data, err = xml.MarshalIndent(r.toJUnit(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal run report to JUnit XML: %w", err)
+	}
+	return writeReportFiles(dir, r.Executable, timestamp, "xml", append([]byte(xml.Header), data...))
+}
+
+// writeReportFiles writes data to both the timestamped report file and the latest report file in dir
+func writeReportFiles(dir, executable, timestamp, extension string, data []byte) error {
+	for _, name := range []string{
+		fmt.Sprintf("%s-report-%s.%s", executable, timestamp, extension),
+		fmt.Sprintf("%s-report-latest.%s", executable, extension),
+	} {
+		// Write to a temporary file and rename it so readers never see a partially-written report
+		tmp, err := os.CreateTemp(dir, "."+name)
+		if err != nil {
+			return fmt.Errorf("could not create temporary run report file: %w", err)
+		}
+		_, writeErr := tmp.Write(data)
+		closeErr := tmp.Close()
+		if writeErr != nil || closeErr != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("could not write run report file %s", name)
+		}
+		if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("could not set permissions on run report file %s: %w", name, err)
+		}
+		if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("could not move run report file into place: %w", err)
+		}
+	}
+	return nil
+}
+
+// JUnit XML types.  Each service is a testsuite, and each stage for that service is a testcase
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// toJUnit converts the runReport to JUnit XML types.  The caller must hold r.mu
+func (r *runReport) toJUnit() junitTestSuites {
+	j := junitTestSuites{Name: r.Executable, Time: r.DurationSeconds}
+
+	serviceNames := make([]string, 0, len(r.Services))
+	for serviceName := range r.Services {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	slices.Sort(serviceNames)
+
+	for _, serviceName := range serviceNames {
+		suite := junitTestSuite{Name: serviceName, Timestamp: r.StartTime.Format(time.RFC3339)}
+		for _, st := range r.Services[serviceName].Stages {
+			tc := junitTestCase{Name: st.Stage, ClassName: serviceName, Time: st.DurationSeconds}
+			switch st.Outcome {
+			case outcomeSkipped:
+				tc.Skipped = &struct{}{}
+				suite.Skipped++
+			case outcomeFailure:
+				messages := slices.Clone(st.Errors)
+				for _, t := range st.Targets {
+					if t.Outcome == outcomeFailure {
+						messages = append(messages, fmt.Sprintf("%s: %v", t.Target, t.Errors))
+					}
+				}
+				tc.Failure = &junitFailure{Message: fmt.Sprintf("%s failed for %s", st.Stage, serviceName), Text: fmt.Sprint(messages)}
+				suite.Failures++
+			}
+			suite.Tests++
+			suite.Time += st.DurationSeconds
+			suite.Cases = append(suite.Cases, tc)
+		}
+		j.Tests += suite.Tests
+		j.Failures += suite.Failures
+		j.Skipped += suite.Skipped
+		j.Suites = append(j.Suites, suite)
+	}
+	return j
+}
+
+// writeRunReport finalizes and writes the report for the current run, if a report directory is configured
+func writeRunReport(r *runReport, successfulServices map[string]bool, runErr error) {
+	if r == nil {
+		return
+	}
+	r.finalize(successfulServices, runErr)
+	cfg := getConfigModel().RunReport
+	dir := cfg.Directory
+	if dir == "" {
+		exeLogger.Debug("No run report directory configured.  Not writing run report")
+		return
+	}
+	if err := r.write(dir, cfg.JUnit); err != nil {
+		exeLogger.WithField("directory", dir).Errorf("Could not write run report: %s", err)
+		return
+	}
+	exeLogger.WithField("directory", dir).Info("Wrote run report")
+}
@@ -0,0 +1,269 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/notifications"
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+func TestRunReportRecording(t *testing.T) {
+	services := []service.Service{service.NewService("expt1_role1"), service.NewService("expt2_role1")}
+	r := newRunReport("token-push", time.Now(), services)
+	kerberosStage := workerTypeToConfigString(worker.GetKerberosTickets)
+	pushStage := workerTypeToConfigString(worker.PushTokens)
+
+	// Everything starts out skipped
+	for _, sr := range r.Services {
+		for _, st := range sr.Stages {
+			assert.Equal(t, outcomeSkipped, st.Outcome)
+		}
+	}
+
+	start := time.Now()
+	r.recordStage("expt1_role1", stageSetup, true, start, start)
+	r.startStage("expt1_role1", kerberosStage, start)
+	r.recordNotification(notifications.NewSetupError("kinit failed", "expt1_role1"))
+	r.recordStage("expt1_role1", kerberosStage, false, start, start)
+
+	assert.Equal(t, outcomeSuccess, r.getStage("expt1_role1", stageSetup).Outcome)
+	st := r.getStage("expt1_role1", kerberosStage)
+	assert.Equal(t, outcomeFailure, st.Outcome)
+	assert.Equal(t, []string{"kinit failed"}, st.Errors)
+
+	// Push errors are left to the PushTokens worker's results
+	r.recordStage("expt2_role1", pushStage, false, start, start)
+	r.recordNotification(notifications.NewPushError("push failed", "expt2_role1", "node1"))
+	st = r.getStage("expt2_role1", pushStage)
+	assert.Empty(t, st.Errors)
+	assert.Empty(t, st.Targets)
+
+	// Notifications and records for unknown services are ignored
+	r.recordNotification(notifications.NewSetupError("unknown", "expt3_role1"))
+	r.recordStage("expt3_role1", stageSetup, true, start, start)
+	assert.NotContains(t, r.Services, "expt3_role1")
+}
+
+func TestRunReportRecordStageResult(t *testing.T) {
+	s := service.NewService("expt1_role1")
+	r := newRunReport("token-push", time.Now(), []service.Service{s})
+	start := time.Now()
+	errTimeout := fmt.Errorf("could not store token: %w", context.DeadlineExceeded)
+	errPush := errors.New("exit status 23")
+	stageResult := func(wt worker.WorkerType, details worker.SuccessReporter) worker.StageResult {
+		return worker.StageResult{WorkerType: wt, Config: &worker.Config{Service: s}, Success: details.GetSuccess(), Start: start, End: start.Add(4 * time.Second), Details: details}
+	}
+
+	r.recordStageResult(stageResult(worker.StoreAndGetToken, &worker.StoreAndGetTokenResult{
+		Service: s,
+		Schedds: []worker.OperationResult{
+			{Target: "schedd1", Attempts: 1, Start: start, End: start.Add(time.Second)},
+			{Target: "schedd2", Err: errTimeout, ErrorClass: worker.ErrorClassTimeout, Attempts: 3, Start: start, End: start.Add(2 * time.Second)},
+		},
+	}))
+	st := r.getStage("expt1_role1", workerTypeToConfigString(worker.StoreAndGetToken))
+	assert.Equal(t, outcomeFailure, st.Outcome)
+	assert.Equal(t, float64(4), st.DurationSeconds, "Stage duration should be the one the worker.Pipeline measured")
+	assert.Equal(t,
+		[]*targetReport{
+			{Target: "schedd1", Outcome: outcomeSuccess, Attempts: 1, DurationSeconds: 1},
+			{Target: "schedd2", Outcome: outcomeFailure, ErrorClass: "timeout", Attempts: 3, DurationSeconds: 2, Errors: []string{errTimeout.Error()}},
+		},
+		st.Targets,
+	)
+
+	r.recordStageResult(stageResult(worker.PingAggregator, &worker.PingResult{
+		Service: s,
+		Nodes:   []worker.OperationResult{{Target: "node1", Attempts: 1, Start: start, End: start}},
+	}))
+	st = r.getStage("expt1_role1", workerTypeToConfigString(worker.PingAggregator))
+	assert.Equal(t, outcomeSuccess, st.Outcome)
+	assert.Equal(t, []*targetReport{{Target: "node1", Outcome: outcomeSuccess, Attempts: 1}}, st.Targets)
+
+	// Failures to push optional files are listed with the node's files, but are not the node's errors
+	r.recordStageResult(stageResult(worker.PushTokens, &worker.PushTokensResult{
+		Service: s,
+		Nodes: []worker.NodePushResult{
+			{
+				Node: "node1",
+				Files: []worker.FilePushResult{
+					{
+						OperationResult: worker.OperationResult{Target: "node1", Attempts: 1, Start: start, End: start.Add(time.Second)},
+						Destination:     "/tmp/file1",
+						Required:        true,
+					},
+					{
+						OperationResult: worker.OperationResult{Target: "node1", Err: errPush, ErrorClass: worker.ErrorClassOther, Attempts: 2, Start: start.Add(time.Second), End: start.Add(3 * time.Second)},
+						Destination:     "/tmp/file2",
+						Required:        false,
+					},
+				},
+			},
+			{
+				Node: "node2",
+				Files: []worker.FilePushResult{
+					{
+						OperationResult: worker.OperationResult{Target: "node2", Err: errPush, ErrorClass: worker.ErrorClassOther, Attempts: 2, Start: start, End: start.Add(time.Second)},
+						Destination:     "/tmp/file1",
+						Required:        true,
+					},
+				},
+			},
+		},
+	}))
+	st = r.getStage("expt1_role1", workerTypeToConfigString(worker.PushTokens))
+	assert.Equal(t, outcomeFailure, st.Outcome)
+	assert.Equal(t,
+		[]*targetReport{
+			{
+				Target:          "node1",
+				Outcome:         outcomeSuccess,
+				DurationSeconds: 3,
+				Files: []*fileReport{
+					{Destination: "/tmp/file1", Required: true, Outcome: outcomeSuccess, Attempts: 1, DurationSeconds: 1},
+					{Destination: "/tmp/file2", Required: false, Outcome: outcomeFailure, ErrorClass: "other", Attempts: 2, DurationSeconds: 2, Error: "exit status 23"},
+				},
+			},
+			{
+				Target:          "node2",
+				Outcome:         outcomeFailure,
+				ErrorClass:      "other",
+				DurationSeconds: 1,
+				Errors:          []string{"/tmp/file1: exit status 23"},
+				Files: []*fileReport{
+					{Destination: "/tmp/file1", Required: true, Outcome: outcomeFailure, ErrorClass: "other", Attempts: 2, DurationSeconds: 1, Error: "exit status 23"},
+				},
+			},
+		},
+		st.Targets,
+	)
+
+	// If the push could not start, the error is attached to the stage
+	r = newRunReport("token-push", time.Now(), []service.Service{s})
+	r.recordStageResult(stageResult(worker.PushTokens, &worker.PushTokensResult{Service: s, Err: errors.New("could not find suitable vault token to push")}))
+	st = r.getStage("expt1_role1", workerTypeToConfigString(worker.PushTokens))
+	assert.Equal(t, outcomeFailure, st.Outcome)
+	assert.Equal(t, []string{"could not find suitable vault token to push"}, st.Errors)
+	assert.Empty(t, st.Targets)
+}
+
+func TestRunReportFinalize(t *testing.T) {
+	services := []service.Service{service.NewService("expt1_role1"), service.NewService("expt2_role1")}
+	type testCase struct {
+		description        string
+		successfulServices map[string]bool
+		runErr             error
+		expectedOutcome    string
+	}
+
+	testCases := []testCase{
+		{
+			"All services succeeded",
+			map[string]bool{"expt1_role1": true, "expt2_role1": true},
+			nil,
+			outcomeSuccess,
+		},
+		{
+			"One service failed",
+			map[string]bool{"expt1_role1": true, "expt2_role1": false},
+			nil,
+			outcomePartialFailure,
+		},
+		{
+			"All services failed",
+			map[string]bool{"expt1_role1": false},
+			nil,
+			outcomeFailure,
+		},
+		{
+			"Run returned an error",
+			map[string]bool{"expt1_role1": true, "expt2_role1": true},
+			errors.New("this failed"),
+			outcomeAborted,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(
+			test.description,
+			func(t *testing.T) {
+				r := newRunReport("token-push", time.Now(), services)
+				r.startStage("expt1_role1", stageSetup, time.Now())
+				r.finalize(test.successfulServices, test.runErr)
+				assert.Equal(t, test.expectedOutcome, r.Outcome)
+				// Stages that were still running are failures
+				assert.Equal(t, outcomeFailure, r.getStage("expt1_role1", stageSetup).Outcome)
+				for serviceName, sr := range r.Services {
+					if test.successfulServices[serviceName] {
+						assert.Equal(t, outcomeSuccess, sr.Outcome)
+					} else {
+						assert.Equal(t, outcomeFailure, sr.Outcome)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestRunReportWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "reports")
+	r := newRunReport("token-push", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), []service.Service{service.NewService("expt1_role1")})
+	r.recordStage("expt1_role1", stageSetup, true, time.Now(), time.Now())
+	r.recordStage("expt1_role1", workerTypeToConfigString(worker.GetKerberosTickets), false, time.Now(), time.Now())
+	r.finalize(map[string]bool{}, nil)
+
+	if err := r.write(dir, true); err != nil {
+		t.Fatalf("Could not write run report: %s", err)
+	}
+
+	for _, name := range []string{"token-push-report-20240102T030405.json", "token-push-report-latest.json"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Could not read run report %s: %s", name, err)
+		}
+		var result map[string]any
+		assert.NoError(t, json.Unmarshal(data, &result))
+		assert.Equal(t, outcomeFailure, result["outcome"])
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "token-push-report-latest.xml"))
+	if err != nil {
+		t.Fatalf("Could not read JUnit run report: %s", err)
+	}
+	var suites junitTestSuites
+	assert.NoError(t, xml.Unmarshal(data, &suites))
+	assert.Equal(t, len(r.stageOrder), suites.Tests)
+	assert.Equal(t, 1, suites.Failures)
+	assert.Equal(t, len(r.stageOrder)-2, suites.Skipped)
+	assert.Equal(t, "expt1_role1", suites.Suites[0].Name)
+
+	// No temporary files should be left behind
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 4)
+}
@@ -18,6 +18,7 @@ package main
 import (
 	"context"
 	"sync"
+	"time"
 
 	condor "github.com/retzkek/htcondor-go"
 	log "github.com/sirupsen/logrus"
@@ -29,8 +30,24 @@ import (
 // scheddCache is a cache where the schedds corresponding to each collector are stored.  It is a container for a map[string]*scheddCacheEntry,
 // where the key is the collector host, and a mutex to control access to this map
 type scheddCache struct {
-	cache map[string]*scheddCacheEntry
-	mu    *sync.Mutex
+	cache     map[string]*scheddCacheEntry
+	createdAt map[string]time.Time // Time at which each cache entry was created, keyed by collector host
+	mu        *sync.Mutex
+}
+
+// expireEntries removes any entries from the scheddCache that are older than maxAge, or that could not be populated.  This allows
+// long-running callers to query the collectors again for those entries
+func (s *scheddCache) expireEntries(maxAge time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for collectorHost, entry := range s.cache {
+		createdAt, ok := s.createdAt[collectorHost]
+		if entry.err != nil || (ok && time.Since(createdAt) > maxAge) {
+			delete(s.cache, collectorHost)
+			delete(s.createdAt, collectorHost)
+			log.WithField("collectorHost", collectorHost).Debug("Expired schedd cache entry")
+		}
+	}
 }
 
 // scheddCacheEntry is an entry that contains a *scheddCollection and a *sync.Once to ensure that it is populated exactly once
@@ -17,96 +17,128 @@ package main
 
 import (
 	"context"
+	"maps"
 	"slices"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 
-	"github.com/fermitools/managed-tokens/internal/contextStore"
 	"github.com/fermitools/managed-tokens/internal/worker"
 )
 
-// chansForWorkers is an interface that defines methods for obtaining channels
-// used by worker.Workers. It includes methods to get channels for service
-// configurations and success reporting.
-type chansForWorkers interface {
-	GetServiceConfigChan() chan<- *worker.Config
-	GetSuccessChan() <-chan worker.SuccessReporter
+// timeoutKeyForWorkerType returns the timeoutKey whose timeout should be used for the worker.WorkerType
+func timeoutKeyForWorkerType(wt worker.WorkerType) (timeoutKey, bool) {
+	switch wt {
+	case worker.GetKerberosTickets:
+		return timeoutKerberos, true
+	case worker.GetToken, worker.StoreAndGetToken:
+		return timeoutVaultStorer, true
+	case worker.PingAggregator:
+		return timeoutPing, true
+	case worker.PushTokens:
+		return timeoutPush, true
+	default:
+		return invalidTimeoutKey, false
+	}
 }
 
-// startServiceConfigWorkerForProcessing starts up the corresponding worker for the provided worker.WorkerType, gives it a set of channels to
-// receive *worker.Configs and send notification.Notifications on, and sends *worker.Configs to the worker
-func startServiceConfigWorkerForProcessing(ctx context.Context, wt worker.WorkerType,
-	serviceConfigs map[string]*worker.Config, timeoutCheckKey timeoutKey) chansForWorkers {
-	ctx, span := otel.GetTracerProvider().Tracer("token-push").Start(ctx, "startServiceConfigWorkerForProcessing")
-	span.SetAttributes(
-		attribute.KeyValue{
-			Key:   "WorkerType",
-			Value: attribute.StringValue(wt.String()),
-		},
-	)
-	defer span.End()
-
-	funcLogger := exeLogger.WithField("workerType", wt.String())
-
-	// If we don't have any serviceConfigs to process, don't start the worker
-	if len(serviceConfigs) == 0 || serviceConfigs == nil {
-		funcLogger.Debug("No serviceConfigs to process, not starting worker")
-		return nil
+// getPipelineStages returns the worker.PipelineStages that each service's *worker.Config should go through, in order.  Services in
+// onlyGetTokenServices go through the GetToken stage, and all others go through the StoreAndGetToken stage.  If pushTokens is false,
+// the ping and push stages are left out.
+func getPipelineStages(onlyGetTokenServices map[string]struct{}, pushTokens bool) []worker.PipelineStage {
+	onlyGetToken := func(c *worker.Config) bool {
+		_, ok := onlyGetTokenServices[getServiceName(c.Service)]
+		return ok
 	}
 
-	// Make sure we're trying to start a valid worker
-	if !slices.Contains(validWorkerTypes, wt) {
-		funcLogger.Error("invalid worker type")
-		return nil
+	stages := []worker.PipelineStage{
+		{WorkerType: worker.GetKerberosTickets},
+		{WorkerType: worker.GetToken, Selector: onlyGetToken},
+		{WorkerType: worker.StoreAndGetToken, Selector: func(c *worker.Config) bool { return !onlyGetToken(c) }},
 	}
-	w := wt.Worker()
-	if w == nil {
-		funcLogger.Error("no worker found for worker type")
-		return nil
+	if pushTokens {
+		stages = append(stages,
+			// If we can't ping some nodes, we still try to push to all of them
+			worker.PipelineStage{WorkerType: worker.PingAggregator, ContinueOnFailure: true},
+			worker.PipelineStage{WorkerType: worker.PushTokens},
+		)
 	}
 
-	// We have a valid worker type, and serviceConfigs to process, so start everything up
-	channels := worker.NewChannelsForWorkers(len(serviceConfigs))
-	startListenerOnWorkerNotificationChans(ctx, channels.GetNotificationsChan())
+	setPipelineStageTimeouts(stages)
+	return stages
+}
 
-	var useCtx context.Context
-	if timeout, ok := timeouts[timeoutCheckKey]; ok {
-		useCtx = contextStore.WithOverrideTimeout(ctx, timeout)
-	} else {
-		useCtx = ctx
+// setPipelineStageTimeouts sets the timeout of each of the stages to the configured timeout for its worker.WorkerType
+func setPipelineStageTimeouts(stages []worker.PipelineStage) {
+	for i := range stages {
+		if key, ok := timeoutKeyForWorkerType(stages[i].WorkerType); ok {
+			stages[i].Timeout = timeouts[key]
+		}
 	}
+}
+
+// startServiceConfigPipeline starts a worker.Pipeline made up of the given stages, and sends all of the serviceConfigs through it.
+// Notifications from the pipeline's workers are routed to the notification managers, and each stage is marked as started in the run
+// report when a service's *worker.Config is sent to it.  The returned channel is closed once all of the serviceConfigs are done.
+func startServiceConfigPipeline(ctx context.Context, stages []worker.PipelineStage, serviceConfigs map[string]*worker.Config) (<-chan worker.StageResult, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("token-push").Start(ctx, "startServiceConfigPipeline")
+	span.SetAttributes(attribute.Int("numStages", len(stages)))
+	defer span.End()
 
-	// Start the work!
-	go w(useCtx, channels)
+	p, err := worker.NewPipeline(
+		stages,
+		worker.WithStageStartFunc(func(wt worker.WorkerType, c *worker.Config) {
+			currentRunReport.startStage(getServiceName(c.Service), workerTypeToConfigString(wt), time.Now())
+		}),
+	)
+	if err != nil {
+		exeLogger.Error("Could not set up pipeline for service configs")
+		return nil, err
+	}
 
-	// Send our serviceConfigs to the worker
-	for _, sc := range serviceConfigs {
-		channels.GetServiceConfigChan() <- sc
+	// Sort the configs so that services are started in a predictable order
+	configs := make([]*worker.Config, 0, len(serviceConfigs))
+	for _, serviceName := range slices.Sorted(maps.Keys(serviceConfigs)) {
+		configs = append(configs, serviceConfigs[serviceName])
 	}
-	close(channels.GetServiceConfigChan())
 
-	return channels
+	results, notificationsChan := p.Run(ctx, configs)
+	// The pipeline closes notificationsChan once it's done, even if ctx is canceled.  We want to route all of the notifications until then,
+	// so that notifications about an interrupted run still go out
+	startListenerOnWorkerNotificationChans(context.WithoutCancel(ctx), notificationsChan)
+	return results, nil
 }
 
-// removeFailedServiceConfigs reads the worker.SuccessReporter chan from the passed in worker.ChannelsForWorkers object, and
-// removes any *worker.Config objects from the passed in serviceConfigs map.  It returns a slice of the *worker.Configs that
-// were removed
-func removeFailedServiceConfigs(chans chansForWorkers, serviceConfigs map[string]*worker.Config) []*worker.Config {
-	failedConfigs := make([]*worker.Config, 0, len(serviceConfigs))
-	if chans == nil {
-		exeLogger.Debug("No chans provided, nothing to remove from serviceConfigs")
-		return failedConfigs
-	}
+// stageMetricLabels are the stage labels used in the stage duration metric for each worker.WorkerType
+var stageMetricLabels = map[worker.WorkerType]string{
+	worker.GetKerberosTickets: "getKerberosTickets",
+	worker.GetToken:           "getTokens",
+	worker.StoreAndGetToken:   "storeAndGetTokens",
+	worker.PingAggregator:     "pingNodes",
+	worker.PushTokens:         "pushTokens",
+}
 
-	for workerSuccess := range chans.GetSuccessChan() {
-		if !workerSuccess.GetSuccess() {
-			exeLogger.WithField(
-				"service", getServiceName(workerSuccess.GetService()),
-			).Debug("Removing serviceConfig from list of configs to use")
-			failedConfigs = append(failedConfigs, serviceConfigs[getServiceName(workerSuccess.GetService())])
-			delete(serviceConfigs, getServiceName(workerSuccess.GetService()))
-		}
+// stageTimeSpan is the time between the first service starting a pipeline stage and the last service finishing it
+type stageTimeSpan struct {
+	start time.Time
+	end   time.Time
+}
+
+// stageTimeSpans keeps track of the stageTimeSpan for each worker.WorkerType in a pipeline
+type stageTimeSpans map[worker.WorkerType]*stageTimeSpan
+
+// observe updates the stageTimeSpan for the result's worker.WorkerType
+func (s stageTimeSpans) observe(result worker.StageResult) {
+	span, ok := s[result.WorkerType]
+	if !ok {
+		s[result.WorkerType] = &stageTimeSpan{start: result.Start, end: result.End}
+		return
+	}
+	if result.Start.Before(span.start) {
+		span.start = result.Start
+	}
+	if result.End.After(span.end) {
+		span.end = result.End
 	}
-	return failedConfigs
 }
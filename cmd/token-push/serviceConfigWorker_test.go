@@ -0,0 +1,74 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+func TestGetPipelineStages(t *testing.T) {
+	onlyGetTokenServices := map[string]struct{}{"expt1_role1": {}}
+	getTokenConfig, _ := worker.NewConfig(service.NewService("expt1_role1"))
+	storeConfig, _ := worker.NewConfig(service.NewService("expt2_role1"))
+
+	stageTypes := func(stages []worker.PipelineStage) []worker.WorkerType {
+		wts := make([]worker.WorkerType, 0, len(stages))
+		for _, stage := range stages {
+			wts = append(wts, stage.WorkerType)
+		}
+		return wts
+	}
+
+	stages := getPipelineStages(onlyGetTokenServices, false)
+	assert.Equal(t, []worker.WorkerType{worker.GetKerberosTickets, worker.GetToken, worker.StoreAndGetToken}, stageTypes(stages))
+
+	stages = getPipelineStages(onlyGetTokenServices, true)
+	assert.Equal(t,
+		[]worker.WorkerType{worker.GetKerberosTickets, worker.GetToken, worker.StoreAndGetToken, worker.PingAggregator, worker.PushTokens},
+		stageTypes(stages),
+	)
+
+	// Each service should go through exactly one of the token stages
+	assert.True(t, stages[1].Selector(getTokenConfig))
+	assert.False(t, stages[2].Selector(getTokenConfig))
+	assert.False(t, stages[1].Selector(storeConfig))
+	assert.True(t, stages[2].Selector(storeConfig))
+
+	// Only pinging should let failed services continue
+	for _, stage := range stages {
+		assert.Equal(t, stage.WorkerType == worker.PingAggregator, stage.ContinueOnFailure)
+		key, _ := timeoutKeyForWorkerType(stage.WorkerType)
+		assert.Equal(t, timeouts[key], stage.Timeout)
+	}
+}
+
+func TestStageTimeSpans(t *testing.T) {
+	start := time.Now()
+	s := make(stageTimeSpans)
+	s.observe(worker.StageResult{WorkerType: worker.PushTokens, Start: start.Add(time.Second), End: start.Add(2 * time.Second)})
+	s.observe(worker.StageResult{WorkerType: worker.PushTokens, Start: start, End: start.Add(time.Second)})
+	s.observe(worker.StageResult{WorkerType: worker.PushTokens, Start: start.Add(2 * time.Second), End: start.Add(5 * time.Second)})
+	s.observe(worker.StageResult{WorkerType: worker.PingAggregator, Start: start, End: start.Add(time.Second)})
+
+	assert.Equal(t, stageTimeSpan{start: start, end: start.Add(5 * time.Second)}, *s[worker.PushTokens])
+	assert.Equal(t, stageTimeSpan{start: start, end: start.Add(time.Second)}, *s[worker.PingAggregator])
+}
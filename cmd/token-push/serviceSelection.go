@@ -0,0 +1,101 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// serviceSelection.go provides the selection of services by their tags, using the tag, exclude-tag, and exclude-service flags
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/fermitools/managed-tokens/internal/service"
+)
+
+// isServiceSelected returns whether the service with the given name and tags is selected by the tag, exclude-tag, and
+// exclude-service flags.  If any tags are given with the tag flag, a service must have at least one of them to be selected.
+// A service that has any of the tags given with the exclude-tag flag, or that was given with the exclude-service flag, is never
+// selected.
+func isServiceSelected(serviceName string, tags []string) bool {
+	hasAnyTag := func(selectTags []string) bool {
+		return slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(selectTags, tag) })
+	}
+
+	if slices.Contains(viper.GetStringSlice("exclude-service"), serviceName) {
+		return false
+	}
+	if hasAnyTag(viper.GetStringSlice("exclude-tag")) {
+		return false
+	}
+	if includeTags := viper.GetStringSlice("tag"); len(includeTags) > 0 {
+		return hasAnyTag(includeTags)
+	}
+	return true
+}
+
+// filterServicesBySelectionFlags returns the services that are selected by the tag, exclude-tag, and exclude-service flags
+func filterServicesBySelectionFlags(services []service.Service) []service.Service {
+	selected := make([]service.Service, 0, len(services))
+	for _, s := range services {
+		tags := getServiceTagsFromConfiguration("experiments." + s.Experiment() + ".roles." + s.Role())
+		if isServiceSelected(getServiceName(s), tags) {
+			selected = append(selected, s)
+		}
+	}
+	return selected
+}
+
+// serviceSelectionFlagsSet returns whether any of the tag, exclude-tag, or exclude-service flags were given
+func serviceSelectionFlagsSet() bool {
+	for _, flag := range []string{"tag", "exclude-tag", "exclude-service"} {
+		if len(viper.GetStringSlice(flag)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// listServices writes the name of each configured service that is selected by the tag, exclude-tag, and exclude-service flags to w,
+// one per line, in sorted order.  If a service has any tags, they are written after the service name, followed by the file that the
+// service is defined in.
+func listServices(w io.Writer) {
+	lines := make([]string, 0)
+	experiments := getConfigModel().Experiments
+	for _, experiment := range slices.Sorted(maps.Keys(experiments)) {
+		for _, role := range slices.Sorted(maps.Keys(experiments[experiment].Roles)) {
+			serviceName := fmt.Sprintf("%s_%s", experiment, role)
+			serviceConfigPath := "experiments." + experiment + ".roles." + role
+			tags := getServiceTagsFromConfiguration(serviceConfigPath)
+			if !isServiceSelected(serviceName, tags) {
+				continue
+			}
+			if len(tags) > 0 {
+				serviceName += "\ttags=" + strings.Join(tags, ",")
+			}
+			if source := getServiceSource(serviceConfigPath); source != "" {
+				serviceName += "\tfile=" + source
+			}
+			lines = append(lines, serviceName)
+		}
+	}
+	if len(lines) > 0 {
+		fmt.Fprintln(w, strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,107 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/configDir"
+	"github.com/fermitools/managed-tokens/internal/service"
+)
+
+func TestIsServiceSelected(t *testing.T) {
+	type testCase struct {
+		description    string
+		flags          map[string][]string
+		serviceName    string
+		tags           []string
+		expectedResult bool
+	}
+
+	testCases := []testCase{
+		{"No flags", nil, "expt_role", []string{"tag1"}, true},
+		{"No flags, no tags", nil, "expt_role", nil, true},
+		{"Has one of the selected tags", map[string][]string{"tag": {"tag1", "tag3"}}, "expt_role", []string{"tag1", "tag2"}, true},
+		{"Has none of the selected tags", map[string][]string{"tag": {"tag3"}}, "expt_role", []string{"tag1", "tag2"}, false},
+		{"Has an excluded tag", map[string][]string{"exclude-tag": {"tag2"}}, "expt_role", []string{"tag1", "tag2"}, false},
+		{
+			"Excluded tag wins over selected tag",
+			map[string][]string{"tag": {"tag1"}, "exclude-tag": {"tag2"}},
+			"expt_role",
+			[]string{"tag1", "tag2"},
+			false,
+		},
+		{"Excluded service", map[string][]string{"exclude-service": {"expt_role"}}, "expt_role", nil, false},
+		{"Other service excluded", map[string][]string{"exclude-service": {"expt_role2"}}, "expt_role", nil, true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.description, func(t *testing.T) {
+			defer viper.Reset()
+			for flag, values := range test.flags {
+				viper.Set(flag, values)
+			}
+			assert.Equal(t, test.expectedResult, isServiceSelected(test.serviceName, test.tags))
+		})
+	}
+}
+
+func TestFilterServicesBySelectionFlags(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("experiments.expt1.roles.role1.tags", []string{"pool-a"})
+	viper.Set("experiments.expt1.roles.role2.tags", []string{"pool-a", "maintenance"})
+	viper.Set("experiments.expt2.roles.role1.tags", []string{"pool-b"})
+	services := []service.Service{
+		service.NewService("expt1_role1"),
+		service.NewService("expt1_role2"),
+		service.NewService("expt2_role1"),
+	}
+
+	assert.False(t, serviceSelectionFlagsSet())
+	assert.Equal(t, services, filterServicesBySelectionFlags(services))
+
+	viper.Set("tag", []string{"pool-a"})
+	viper.Set("exclude-tag", []string{"maintenance"})
+	assert.True(t, serviceSelectionFlagsSet())
+	assert.Equal(t, services[:1], filterServicesBySelectionFlags(services))
+}
+
+func TestListServices(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("experiments.expt1.roles.role1.tags", []string{"pool-b", "pool-a", "pool-a"})
+	viper.Set("experiments.expt1.roles.role2.account", "account")
+	viper.Set("experiments.expt2.roles.role1.tags", []string{"maintenance"})
+
+	var b bytes.Buffer
+	listServices(&b)
+	assert.Equal(t, "expt1_role1\ttags=pool-a,pool-b\nexpt1_role2\nexpt2_role1\ttags=maintenance\n", b.String())
+
+	b.Reset()
+	viper.Set("exclude-tag", []string{"maintenance"})
+	viper.Set("exclude-service", []string{"expt1_role2"})
+	listServices(&b)
+	assert.Equal(t, "expt1_role1\ttags=pool-a,pool-b\n", b.String())
+
+	b.Reset()
+	defer func() { configSources = nil }()
+	configSources = map[string]configDir.Location{"experiments.expt1.roles.role1": {File: "conf.d/expt1.yml", Line: 4}}
+	listServices(&b)
+	assert.Equal(t, "expt1_role1\ttags=pool-a,pool-b\tfile=conf.d/expt1.yml:4\n", b.String())
+}
@@ -0,0 +1,457 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// validateConfig.go provides the validate-config subcommand of token-push, which checks the configuration for every configured service
+// without running anything
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/shlex"
+	"github.com/spf13/viper"
+
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/worker"
+)
+
+// validateConfigSubcommand is the positional argument that runs the validate-config subcommand
+const validateConfigSubcommand = "validate-config"
+
+// errConfigInvalid is returned by runValidateConfig if the configuration has any errors
+var errConfigInvalid = errors.New("configuration is invalid")
+
+// configOverrideKeys are the keys that token-push looks for an override of, i.e. <key>Override at the service's configuration path or
+// at its experiment's configuration path
+var configOverrideKeys = []string{
+	"condorCollectorHost",
+	"condorCreddHost",
+	"condorScheddConstraint",
+	"daemonInterval",
+	"defaultRoleFileDestinationTemplate",
+	"desiredUID",
+	"disableNotifications",
+	"fileCopierOptions",
+	"kerberosPrincipalPattern",
+	"keytabPath",
+	"pingOptions",
+	"serviceCreddVaultTokenPathRoot",
+	"sshOptions",
+	"timeouts",
+	"tokenDestinations",
+	"tokenGetter",
+	"userPrincipal",
+	"vaultServer",
+	"workerType",
+}
+
+// libsonnetSupportedOverrides must match supportedOverrides in libsonnet/experimentConfig.libsonnet.  Overrides that are not in that
+// list are dropped from role configurations that are generated with makeRoleConfig.
+var libsonnetSupportedOverrides = []string{
+	"keytabPathOverride",
+	"userPrincipalOverride",
+	"desiredUIDOverride",
+	"condorCreddHostOverride",
+	"condorCollectorHostOverride",
+	"condorScheddConstraintOverride",
+	"defaultRoleFileDestinationTemplateOverride",
+	"disableNotificationsOverride",
+	"tokenGetterOverride",
+	"daemonIntervalOverride",
+	"tokenDestinationsOverride",
+	"timeoutsOverride",
+	"workerTypeOverride",
+}
+
+// workerTypeGlobalKeys are the keys in the workerType section of the configuration that are not worker types
+var workerTypeGlobalKeys = []string{"maxChildProcesses", "maxConcurrencyPerNode"}
+
+// Severities of configuration problems
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// configProblem is a single problem found in the configuration
+type configProblem struct {
+	Severity string `json:"severity"`
+	Service  string `json:"service,omitempty"`
+	Key      string `json:"key,omitempty"`
+	File     string `json:"file,omitempty"`
+	Message  string `json:"message"`
+}
+
+// configValidationResult holds all of the problems found in the configuration, and the file that each service is defined in
+type configValidationResult struct {
+	Valid          bool              `json:"valid"`
+	Services       int               `json:"services"`
+	Errors         int               `json:"errors"`
+	Warnings       int               `json:"warnings"`
+	Problems       []configProblem   `json:"problems"`
+	ServiceSources map[string]string `json:"serviceSources,omitempty"`
+}
+
+func (r *configValidationResult) add(severity, serviceName, key, format string, args ...any) {
+	var file string
+	if key != "" {
+		file = getConfigSource(key).String()
+	}
+	r.Problems = append(r.Problems, configProblem{Severity: severity, Service: serviceName, Key: key, File: file, Message: fmt.Sprintf(format, args...)})
+	if severity == severityError {
+		r.Errors++
+	} else {
+		r.Warnings++
+	}
+}
+
+// runValidateConfig checks the configuration, and writes the result to w, as JSON if the json flag is set.  It returns errExitOK if the
+// configuration has no errors, and errConfigInvalid otherwise.
+func runValidateConfig(w io.Writer) error {
+	result := validateConfiguration()
+	if err := writeConfigValidationResult(w, result, viper.GetBool("json")); err != nil {
+		return err
+	}
+	if !result.Valid {
+		return errConfigInvalid
+	}
+	return errExitOK
+}
+
+// validateConfiguration checks the global configuration, and the configuration of every experiment and role
+func validateConfiguration() configValidationResult {
+	result := configValidationResult{Problems: make([]configProblem, 0), ServiceSources: make(map[string]string)}
+
+	if _, err := decodeConfigModel(); err != nil {
+		result.add(severityError, "", "", "configuration does not match the configuration schema: %s", err)
+	}
+	validateGlobalConfiguration(&result)
+	globalTimeouts, _ := applyTimeoutSettings(defaultTimeouts(), getConfigModel().Timeouts.settings())
+	for _, experiment := range slices.Sorted(maps.Keys(viper.GetStringMap("experiments"))) {
+		experimentConfigPath := "experiments." + experiment
+		if len(viper.GetStringSlice(experimentConfigPath+".emails")) == 0 {
+			result.add(severityError, "", experimentConfigPath+".emails", "no notification emails are configured for the experiment")
+		}
+		checkOverrideKeys(&result, "", experimentConfigPath)
+		for _, role := range slices.Sorted(maps.Keys(viper.GetStringMap(experimentConfigPath + ".roles"))) {
+			s := service.NewService(experiment + "_" + role)
+			validateServiceConfiguration(&result, s, globalTimeouts)
+			result.Services++
+			if source := getServiceSource(experimentConfigPath + ".roles." + role); source != "" {
+				result.ServiceSources[s.Name()] = source
+			}
+		}
+	}
+
+	result.Valid = result.Errors == 0
+	return result
+}
+
+// validateGlobalConfiguration checks the global keys that services fall back to when they don't override them
+func validateGlobalConfiguration(result *configValidationResult) {
+	if viper.IsSet("kerberosPrincipalPattern") {
+		if err := checkTemplate(viper.GetString("kerberosPrincipalPattern"), struct{ Account string }{}); err != nil {
+			result.add(severityError, "", "kerberosPrincipalPattern", "invalid template: %s", err)
+		}
+	}
+	if viper.IsSet("defaultRoleFileDestinationTemplate") {
+		if err := checkDefaultRoleFileDestinationTemplate(viper.GetString("defaultRoleFileDestinationTemplate")); err != nil {
+			result.add(severityError, "", "defaultRoleFileDestinationTemplate", "invalid template: %s", err)
+		}
+	}
+	if viper.IsSet("tokenDestinations") {
+		checkTokenDestinations(result, "", "tokenDestinations", getConfigModel().TokenDestinations, sampleTokenDestinationTemplateArgs)
+	}
+	for _, key := range []string{"sshOptions", "fileCopierOptions", "pingOptions"} {
+		if _, err := shlex.Split(viper.GetString(key)); err != nil {
+			result.add(severityError, "", key, "could not split options: %s", err)
+		}
+	}
+
+	// Timeouts that can't be parsed are ignored, but the rest have to fit within the global timeout
+	globalTimeouts, err := applyTimeoutSettings(defaultTimeouts(), getConfigModel().Timeouts.settings())
+	if err != nil {
+		result.add(severityWarning, "", "timeouts", "%s.  The default will be used instead", err)
+	}
+	if err := checkComponentTimeouts(globalTimeouts); err != nil {
+		result.add(severityError, "", "timeouts", "%s", err)
+	} else if _, err := createWorkerRetryMap("", globalTimeouts); err != nil {
+		result.add(severityError, "", "workerType", "%s.  token-push will run without retries", err)
+	}
+
+	if _, err := getCircuitBreakerSettings(); err != nil {
+		result.add(severityError, "", "circuitBreaker", "%s.  token-push will run without circuit breakers", err)
+	}
+
+	// viper lower-cases the keys it reads in, so compare them case-insensitively
+	for _, key := range slices.Sorted(maps.Keys(viper.GetStringMap("workerType"))) {
+		if slices.ContainsFunc(workerTypeGlobalKeys, func(k string) bool { return strings.EqualFold(k, key) }) {
+			continue
+		}
+		if !slices.ContainsFunc(validWorkerTypes, func(wt worker.WorkerType) bool { return strings.EqualFold(workerTypeToConfigString(wt), key) }) {
+			result.add(severityError, "", "workerType."+key, "not a valid worker type.  Its configuration will be ignored")
+		}
+	}
+}
+
+// validateServiceConfiguration checks the configuration of a single service, including any global values it uses
+func validateServiceConfiguration(result *configValidationResult, s service.Service, globalTimeouts map[timeoutKey]time.Duration) {
+	serviceName := s.Name()
+	serviceConfigPath := "experiments." + s.Experiment() + ".roles." + s.Role()
+
+	role := getConfigModel().roleAt(serviceConfigPath)
+	account := role.Account
+	if account == "" {
+		result.add(severityError, serviceName, serviceConfigPath+".account", "no account is configured for the service")
+	}
+	destinationNodes := role.DestinationNodes
+	if len(destinationNodes) == 0 {
+		result.add(severityError, serviceName, serviceConfigPath+".destinationNodes", "no destination nodes are configured for the service")
+	}
+	checkDestinationNodes(result, serviceName, serviceConfigPath+".destinationNodes", destinationNodes)
+
+	// Override keys
+	for _, overrideKey := range checkOverrideKeys(result, serviceName, serviceConfigPath) {
+		if !slices.Contains(libsonnetSupportedOverrides, overrideKey) {
+			result.add(severityWarning, serviceName, serviceConfigPath+"."+overrideKey,
+				"not in supportedOverrides in libsonnet/experimentConfig.libsonnet.  Configurations generated with makeRoleConfig will drop it")
+		}
+	}
+
+	// Keytab
+	keytabConfigPath, overridden := getConfigOverridePath(serviceConfigPath, "keytabPath")
+	switch {
+	case !viper.IsSet(keytabConfigPath):
+		result.add(severityError, serviceName, keytabConfigPath, "neither keytabPath nor keytabPathOverride is configured for the service")
+	case !overridden && account == "":
+		// The default keytab file is named after the account, which we already reported as missing
+	default:
+		if err := checkKeytabFile(getKeytabFromConfiguration(serviceConfigPath)); err != nil {
+			result.add(severityError, serviceName, keytabConfigPath, "%s", err)
+		}
+	}
+
+	// Overridden values.  The global values are checked in validateGlobalConfiguration
+	if _, ok := getConfigOverridePath(serviceConfigPath, "userPrincipal"); !ok {
+		if configPath, ok := getConfigOverridePath(serviceConfigPath, "kerberosPrincipalPattern"); ok {
+			if err := checkTemplate(viper.GetString(configPath), struct{ Account string }{Account: account}); err != nil {
+				result.add(severityError, serviceName, configPath, "invalid template: %s", err)
+			}
+		}
+	}
+	if configPath, ok := getConfigOverridePath(serviceConfigPath, "defaultRoleFileDestinationTemplate"); ok {
+		if err := checkDefaultRoleFileDestinationTemplate(viper.GetString(configPath)); err != nil {
+			result.add(severityError, serviceName, configPath, "invalid template: %s", err)
+		}
+	}
+	if configPath, ok := getConfigOverridePath(serviceConfigPath, "tokenDestinations"); ok {
+		if tokenDestinations := getConfigModel().overridesAt(serviceConfigPath).TokenDestinationsOverride; tokenDestinations != nil {
+			checkTokenDestinations(result, serviceName, configPath, *tokenDestinations, worker.TokenDestinationTemplateArgs{
+				Account:    account,
+				Service:    serviceName,
+				Experiment: s.Experiment(),
+				Role:       s.Role(),
+			})
+		}
+	}
+	for _, key := range []string{"sshOptions", "fileCopierOptions", "pingOptions"} {
+		if configPath, ok := getConfigOverridePath(serviceConfigPath, key); ok {
+			if _, err := shlex.Split(viper.GetString(configPath)); err != nil {
+				result.add(severityError, serviceName, configPath, "could not split options: %s", err)
+			}
+		}
+	}
+	if configPath, ok := getConfigOverridePath(serviceConfigPath, "tokenGetter"); ok {
+		wt, ok := workerTypeFromConfig(viper.GetString(configPath))
+		if !ok || !slices.Contains(slices.Collect(worker.ValidTokenGetterWorkerTypes()), wt) {
+			result.add(severityError, serviceName, configPath, "%s is not a valid tokenGetter worker type.  The default will be used", viper.GetString(configPath))
+		}
+	}
+	checkServiceTimeoutsAndRetries(result, serviceName, serviceConfigPath, globalTimeouts)
+}
+
+// checkServiceTimeoutsAndRetries checks the timeoutsOverride and workerTypeOverride settings that apply to the service at serviceConfigPath.
+// token-push falls back to the global timeouts or retry settings for a service if its own can't be used.
+func checkServiceTimeoutsAndRetries(result *configValidationResult, serviceName, serviceConfigPath string, globalTimeouts map[timeoutKey]time.Duration) {
+	timeoutsConfigPath, timeoutsOverridden := getConfigOverridePath(serviceConfigPath, "timeouts")
+	workerTypeConfigPath, workerTypeOverridden := getConfigOverridePath(serviceConfigPath, "workerType")
+	if !timeoutsOverridden && !workerTypeOverridden {
+		return
+	}
+
+	serviceTimeouts := globalTimeouts
+	if timeoutsOverridden {
+		var err error
+		if serviceTimeouts, err = getServiceTimeouts(serviceConfigPath, globalTimeouts); err != nil {
+			result.add(severityError, serviceName, timeoutsConfigPath, "%s.  The global timeouts will be used", err)
+		} else if serviceTimeouts[timeoutGlobal] > globalTimeouts[timeoutGlobal] {
+			result.add(severityWarning, serviceName, timeoutsConfigPath, "the service's global timeout (%s) is longer than the global timeout (%s), which still applies to the whole run",
+				serviceTimeouts[timeoutGlobal], globalTimeouts[timeoutGlobal])
+		}
+	}
+
+	retryConfigPath := timeoutsConfigPath
+	if workerTypeOverridden {
+		retryConfigPath = workerTypeConfigPath
+		for _, key := range slices.Sorted(maps.Keys(getConfigModel().overridesAt(serviceConfigPath).WorkerTypeOverride)) {
+			if !slices.ContainsFunc(validWorkerTypes, func(wt worker.WorkerType) bool { return strings.EqualFold(workerTypeToConfigString(wt), key) }) {
+				result.add(severityError, serviceName, workerTypeConfigPath+"."+key, "not a valid worker type.  Its overrides will be ignored")
+			}
+		}
+	}
+	if _, err := createWorkerRetryMap(serviceConfigPath, serviceTimeouts); err != nil {
+		result.add(severityError, serviceName, retryConfigPath, "%s.  The global retry settings will be used", err)
+	}
+}
+
+// checkOverrideKeys reports an error for each <key>Override key at configPath, an experiment or a role, that token-push doesn't support.
+// It returns the supported override keys that are set there.
+func checkOverrideKeys(result *configValidationResult, serviceName, configPath string) []string {
+	overrideKeys := make([]string, 0)
+	for _, key := range slices.Sorted(maps.Keys(viper.GetStringMap(configPath))) {
+		if !strings.HasSuffix(key, "override") || strings.EqualFold(key, "experimentOverride") {
+			continue
+		}
+		i := slices.IndexFunc(configOverrideKeys, func(k string) bool { return strings.EqualFold(k+"Override", key) })
+		if i == -1 {
+			result.add(severityError, serviceName, configPath+"."+key, "not a supported override.  It will be ignored")
+			continue
+		}
+		overrideKeys = append(overrideKeys, configOverrideKeys[i]+"Override")
+	}
+	return overrideKeys
+}
+
+// checkTemplate makes sure that tmpl can be parsed and executed with data
+func checkTemplate(tmpl string, data any) error {
+	t, err := template.New("checkTemplate").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return err
+	}
+	return t.Execute(io.Discard, data)
+}
+
+// checkDefaultRoleFileDestinationTemplate makes sure that tmpl can be parsed and executed with a worker.Config, like the pushTokens worker does
+func checkDefaultRoleFileDestinationTemplate(tmpl string) error {
+	c, err := worker.NewConfig(service.NewService("experiment_role"))
+	if err != nil {
+		return err
+	}
+	return checkTemplate(tmpl, *c)
+}
+
+// checkDestinationNodes checks the destination nodes at configPath, and the settings of each node
+func checkDestinationNodes(result *configValidationResult, serviceName, configPath string, destinationNodes []destinationNodeConfig) {
+	seen := make(map[string]struct{}, len(destinationNodes))
+	for i, d := range destinationNodes {
+		nodeConfigPath := fmt.Sprintf("%s[%d]", configPath, i)
+		if d.Node == "" {
+			result.add(severityError, serviceName, nodeConfigPath+".node", "no host name is configured for the destination node")
+			continue
+		}
+		if _, ok := seen[d.Node]; ok {
+			result.add(severityError, serviceName, nodeConfigPath+".node", "%s is configured as a destination node more than once", d.Node)
+		}
+		seen[d.Node] = struct{}{}
+		if d.Port < 0 || d.Port > 65535 {
+			result.add(severityError, serviceName, nodeConfigPath+".port", "%d is not a valid port", d.Port)
+		}
+		for _, opts := range []struct{ key, value string }{
+			{"sshOptions", d.SSHOptions},
+			{"fileCopierOptions", d.FileCopierOptions},
+			{"pingOptions", d.PingOptions},
+		} {
+			if _, err := shlex.Split(opts.value); err != nil {
+				result.add(severityError, serviceName, nodeConfigPath+"."+opts.key, "could not split options: %s", err)
+			}
+		}
+	}
+}
+
+// sampleTokenDestinationTemplateArgs are used to check the global tokenDestinations, which aren't specific to a service
+var sampleTokenDestinationTemplateArgs = worker.TokenDestinationTemplateArgs{
+	Account:    "account",
+	Service:    "experiment_role",
+	Experiment: "experiment",
+	Role:       "role",
+}
+
+// checkTokenDestinations makes sure that each of the vault token destinations at configPath renders a path with args, like the pushTokens
+// worker does
+func checkTokenDestinations(result *configValidationResult, serviceName, configPath string, tokenDestinations []tokenDestinationConfig, args worker.TokenDestinationTemplateArgs) {
+	if len(tokenDestinations) == 0 {
+		result.add(severityWarning, serviceName, configPath, "no vault token destinations are configured.  The defaults will be used")
+		return
+	}
+	for i, d := range tokenDestinations {
+		if _, err := worker.ExecuteTokenDestinationTemplate(d.Path, args); err != nil {
+			result.add(severityError, serviceName, fmt.Sprintf("%s[%d].path", configPath, i), "%s", err)
+		}
+	}
+	if !slices.ContainsFunc(tokenDestinations, func(d tokenDestinationConfig) bool { return !d.Optional }) {
+		result.add(severityWarning, serviceName, configPath, "all vault token destinations are optional, so a node will never be marked as failed")
+	}
+}
+
+// checkKeytabFile makes sure that the keytab file at keytabPath exists, and cannot be read or written by anyone but its owner
+func checkKeytabFile(keytabPath string) error {
+	info, err := os.Stat(keytabPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("keytab file %s does not exist", keytabPath)
+		}
+		return fmt.Errorf("could not check keytab file %s: %w", keytabPath, err)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("keytab file %s has permissions %04o.  It should only be accessible by its owner", keytabPath, perm)
+	}
+	return nil
+}
+
+// writeConfigValidationResult writes result to w, either as JSON or in a human-readable form
+func writeConfigValidationResult(w io.Writer, result configValidationResult, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+
+	for _, p := range result.Problems {
+		var location string
+		for _, part := range []string{p.File, p.Service, p.Key} {
+			if part != "" {
+				location += part + ": "
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s%s\n", strings.ToUpper(p.Severity), location, p.Message); err != nil {
+			return err
+		}
+	}
+	status := "Configuration is valid"
+	if !result.Valid {
+		status = "Configuration is invalid"
+	}
+	_, err := fmt.Fprintf(w, "%s.  Checked %d services:  %d errors, %d warnings\n", status, result.Services, result.Errors, result.Warnings)
+	return err
+}
@@ -0,0 +1,295 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLibsonnetSupportedOverrides makes sure that libsonnetSupportedOverrides is kept in sync with libsonnet/experimentConfig.libsonnet
+func TestLibsonnetSupportedOverrides(t *testing.T) {
+	data, err := os.ReadFile("../../libsonnet/experimentConfig.libsonnet")
+	if err != nil {
+		t.Fatalf("Could not read experimentConfig.libsonnet: %s", err)
+	}
+	list := regexp.MustCompile(`(?s)local supportedOverrides = \[(.*?)\];`).FindSubmatch(data)
+	if !assert.NotNil(t, list, "could not find supportedOverrides in experimentConfig.libsonnet") {
+		return
+	}
+	overrides := make([]string, 0)
+	for _, m := range regexp.MustCompile(`"([A-Za-z]+)"`).FindAllSubmatch(list[1], -1) {
+		overrides = append(overrides, string(m[1]))
+	}
+	assert.Equal(t, overrides, libsonnetSupportedOverrides)
+}
+
+func TestCheckKeytabFile(t *testing.T) {
+	tempDir := t.TempDir()
+	goodKeytab := filepath.Join(tempDir, "good.keytab")
+	badKeytab := filepath.Join(tempDir, "bad.keytab")
+	os.WriteFile(goodKeytab, []byte("keytab"), 0600)
+	os.WriteFile(badKeytab, []byte("keytab"), 0644)
+	os.Chmod(badKeytab, 0644) // In case the umask took away the group and other bits
+
+	assert.NoError(t, checkKeytabFile(goodKeytab))
+	assert.ErrorContains(t, checkKeytabFile(badKeytab), "0644")
+	assert.ErrorContains(t, checkKeytabFile(filepath.Join(tempDir, "missing.keytab")), "does not exist")
+}
+
+func TestCheckTemplates(t *testing.T) {
+	assert.NoError(t, checkTemplate("{{.Account}}@REALM", struct{ Account string }{"account"}))
+	assert.Error(t, checkTemplate("{{.Account}@REALM", struct{ Account string }{"account"}))
+	assert.Error(t, checkTemplate("{{.Foo}}@REALM", struct{ Account string }{"account"}))
+
+	assert.NoError(t, checkDefaultRoleFileDestinationTemplate("/tmp/{{.DesiredUID}}_{{.Account}}"))
+	assert.Error(t, checkDefaultRoleFileDestinationTemplate("/tmp/{{.NotAField}}"))
+}
+
+func TestValidateConfiguration(t *testing.T) {
+	defer viper.Reset()
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "goodpro.keytab"), []byte("keytab"), 0600)
+	os.WriteFile(filepath.Join(tempDir, "badpro.keytab"), []byte("keytab"), 0644)
+	os.Chmod(filepath.Join(tempDir, "badpro.keytab"), 0644)
+
+	viper.Set("keytabPath", tempDir)
+	viper.Set("kerberosPrincipalPattern", "{{.Account}}@REALM")
+	viper.Set("sshOptions", "-o Arg1=val1")
+	viper.Set("workerType.maxChildProcesses", 10)
+	viper.Set("workerType.pushTokens.numRetries", 1)
+
+	viper.Set("experiments.good.emails", []string{"email@example.com"})
+	viper.Set("experiments.good.experimentOverride", "realgood")
+	viper.Set("experiments.good.sshOptionsOverride", "-o Arg2=val2")
+	viper.Set("experiments.good.roles.production.account", "goodpro")
+	viper.Set("experiments.good.roles.production.destinationNodes", []string{"node1"})
+	viper.Set("experiments.good.roles.production.disableNotificationsOverride", true)
+
+	result := validateConfiguration()
+	assert.True(t, result.Valid)
+	assert.Equal(t, 1, result.Services)
+	assert.Empty(t, result.Problems)
+
+	viper.Set("workerType.notAWorker.numRetries", 1)
+	viper.Set("fileCopierOptions", "--chmod='u=r")
+	viper.Set("experiments.bad.notARealOverride", "value")
+	viper.Set("experiments.bad.roles.production.account", "badpro")
+	viper.Set("experiments.bad.roles.production.kerberosPrincipalPatternOverride", "{{.Account")
+	viper.Set("experiments.bad.roles.production.notARealOverride", "value")
+	viper.Set("experiments.bad.roles.production.sshOptionsOverride", "-o 'Arg1=val1")
+	viper.Set("experiments.bad.roles.production.tokenGetterOverride", "pushTokens")
+
+	result = validateConfiguration()
+	assert.False(t, result.Valid)
+	assert.Equal(t, 2, result.Services)
+	assert.Equal(t, 10, result.Errors)
+	assert.Equal(t, 2, result.Warnings) // kerberosPrincipalPatternOverride and sshOptionsOverride are not in supportedOverrides
+
+	keys := make([]string, 0, len(result.Problems))
+	for _, p := range result.Problems {
+		keys = append(keys, p.Key)
+	}
+	assert.ElementsMatch(t,
+		[]string{
+			"fileCopierOptions",
+			"workerType.notaworker",
+			"experiments.bad.emails",
+			"experiments.bad.notarealoverride",
+			"experiments.bad.roles.production.destinationNodes",
+			"experiments.bad.roles.production.kerberosPrincipalPatternOverride",
+			"experiments.bad.roles.production.notarealoverride",
+			"experiments.bad.roles.production.sshOptionsOverride",
+			"keytabPath",
+			"experiments.bad.roles.production.kerberosPrincipalPatternOverride",
+			"experiments.bad.roles.production.sshOptionsOverride",
+			"experiments.bad.roles.production.tokenGetterOverride",
+		},
+		keys,
+	)
+}
+
+func TestValidateConfigurationTokenDestinations(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "goodpro.keytab"), []byte("keytab"), 0600)
+
+	viper.Set("keytabPath", tempDir)
+	viper.Set("tokenDestinations", []map[string]any{
+		{"path": "/tmp/vt_u{{.DesiredUID}}"},
+		{"path": "/tmp/vt_u{{.DesiredUID}}-{{.Service}}", "optional": true},
+	})
+	viper.Set("experiments.good.emails", []string{"email@example.com"})
+	viper.Set("experiments.good.roles.production.account", "goodpro")
+	viper.Set("experiments.good.roles.production.destinationNodes", []string{"node1"})
+
+	result := validateConfiguration()
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Problems)
+
+	viper.Set("experiments.good.roles.production.tokenDestinationsOverride", []map[string]any{
+		{"path": "/home/{{.Account}}/{{.Doesntexist}}"},
+		{"path": "/tmp/{{.Role}}", "optional": true},
+	})
+	viper.Set("experiments.good.tokenDestinationsOverride", []map[string]any{{"path": "/tmp/{{.Experiment}}", "optional": true}})
+	viper.Set("experiments.other.emails", []string{"email@example.com"})
+	viper.Set("experiments.other.roles.production.account", "goodpro")
+	viper.Set("experiments.other.roles.production.destinationNodes", []string{"node1"})
+	viper.Set("experiments.other.tokenDestinationsOverride", []map[string]any{{"path": "/tmp/{{.Experiment}}", "optional": true}})
+
+	result = validateConfiguration()
+	assert.False(t, result.Valid)
+	assert.Equal(t, 1, result.Errors)
+	assert.Equal(t, 1, result.Warnings)
+
+	keys := make([]string, 0, len(result.Problems))
+	for _, p := range result.Problems {
+		keys = append(keys, p.Key)
+	}
+	assert.ElementsMatch(t,
+		[]string{
+			"experiments.good.roles.production.tokenDestinationsOverride[0].path",
+			"experiments.other.tokenDestinationsOverride",
+		},
+		keys,
+	)
+}
+
+func TestValidateConfigurationDestinationNodes(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "goodpro.keytab"), []byte("keytab"), 0600)
+
+	viper.Set("keytabPath", tempDir)
+	viper.Set("experiments.good.emails", []string{"email@example.com"})
+	viper.Set("experiments.good.roles.production.account", "goodpro")
+	viper.Set("experiments.good.roles.production.destinationNodes", []any{
+		"node1",
+		map[string]any{"node": "node2", "account": "otheraccount", "port": 2222, "jumpHost": "bastion", "sshOptions": "-o Arg1=val1"},
+	})
+
+	result := validateConfiguration()
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Problems)
+
+	viper.Set("experiments.good.roles.production.destinationNodes", []any{
+		"node1",
+		map[string]any{"node": "node1"},
+		map[string]any{"account": "otheraccount"},
+		map[string]any{"node": "node2", "port": 70000, "pingOptions": "-W '2"},
+	})
+
+	result = validateConfiguration()
+	assert.False(t, result.Valid)
+	keys := make([]string, 0, len(result.Problems))
+	for _, p := range result.Problems {
+		keys = append(keys, p.Key)
+	}
+	assert.Equal(t,
+		[]string{
+			"experiments.good.roles.production.destinationNodes[1].node",
+			"experiments.good.roles.production.destinationNodes[2].node",
+			"experiments.good.roles.production.destinationNodes[3].port",
+			"experiments.good.roles.production.destinationNodes[3].pingOptions",
+		},
+		keys,
+	)
+}
+
+func TestValidateConfigurationTimeoutsAndRetries(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "goodpro.keytab"), []byte("keytab"), 0600)
+
+	viper.Set("keytabPath", tempDir)
+	viper.Set("timeouts.globalTimeout", "300s")
+	viper.Set("timeouts.vaultstorerTimeout", "60s")
+	viper.Set("workerType.pushTokens.numRetries", 2)
+	viper.Set("workerType.pushTokens.retrySleep", "5s")
+	viper.Set("experiments.good.emails", []string{"email@example.com"})
+	viper.Set("experiments.good.timeoutsOverride", map[string]any{"vaultstorerTimeout": "3m"})
+	viper.Set("experiments.good.roles.production.account", "goodpro")
+	viper.Set("experiments.good.roles.production.destinationNodes", []string{"node1"})
+	viper.Set("experiments.good.roles.production.workerTypeOverride", map[string]any{"pushTokens": map[string]any{"numRetries": 5}})
+
+	result := validateConfiguration()
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Problems)
+
+	viper.Set("experiments.good.timeoutsOverride", map[string]any{"vaultstorerTimeout": "5m"})
+	viper.Set("experiments.good.roles.production.workerTypeOverride", map[string]any{
+		"pushTokens": map[string]any{"numRetries": 10},
+		"notAWorker": map[string]any{"numRetries": 1},
+	})
+	viper.Set("experiments.other.emails", []string{"email@example.com"})
+	viper.Set("experiments.other.roles.production.account", "goodpro")
+	viper.Set("experiments.other.roles.production.destinationNodes", []string{"node1"})
+	viper.Set("experiments.other.roles.production.timeoutsOverride", map[string]any{"globalTimeout": "10m"})
+
+	result = validateConfiguration()
+	assert.False(t, result.Valid)
+	assert.Equal(t, 3, result.Errors)
+	assert.Equal(t, 1, result.Warnings)
+
+	keys := make([]string, 0, len(result.Problems))
+	for _, p := range result.Problems {
+		keys = append(keys, p.Key)
+	}
+	assert.ElementsMatch(t,
+		[]string{
+			"experiments.good.timeoutsOverride",
+			"experiments.good.roles.production.workerTypeOverride.notaworker",
+			"experiments.good.roles.production.workerTypeOverride",
+			"experiments.other.roles.production.timeoutsOverride",
+		},
+		keys,
+	)
+}
+
+func TestWriteConfigValidationResult(t *testing.T) {
+	result := configValidationResult{Services: 2}
+	result.add(severityError, "expt_role", "experiments.expt.roles.role.account", "no account is configured for the service")
+	result.add(severityWarning, "", "workerType.foo", "a warning")
+
+	var b bytes.Buffer
+	assert.NoError(t, writeConfigValidationResult(&b, result, false))
+	assert.Equal(t,
+		strings.Join([]string{
+			"ERROR: expt_role: experiments.expt.roles.role.account: no account is configured for the service",
+			"WARNING: workerType.foo: a warning",
+			"Configuration is invalid.  Checked 2 services:  1 errors, 1 warnings",
+			"",
+		}, "\n"),
+		b.String(),
+	)
+
+	b.Reset()
+	assert.NoError(t, writeConfigValidationResult(&b, result, true))
+	var decoded configValidationResult
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &decoded))
+	assert.Equal(t, result, decoded)
+}
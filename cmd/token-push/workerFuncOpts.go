@@ -22,7 +22,6 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 
@@ -42,8 +41,8 @@ func getDesiredUIDByOverrideOrLookup(ctx context.Context, serviceConfigPath stri
 	span.SetAttributes(attribute.KeyValue{Key: "serviceConfigPath", Value: attribute.StringValue(serviceConfigPath)})
 	defer span.End()
 
-	if viper.IsSet(serviceConfigPath + ".desiredUIDOverride") {
-		return viper.GetUint32(serviceConfigPath + ".desiredUIDOverride"), nil
+	if desiredUIDOverride := getConfigModel().overridesAt(serviceConfigPath).DesiredUIDOverride; desiredUIDOverride != nil {
+		return *desiredUIDOverride, nil
 	}
 	// Get UID from SQLite DB that should be kept up to date by refresh-uids-from-ferry
 	if database == nil {
@@ -51,7 +50,7 @@ func getDesiredUIDByOverrideOrLookup(ctx context.Context, serviceConfigPath stri
 		log.Error(msg)
 		return 0, errors.New(msg)
 	}
-	username := viper.GetString(serviceConfigPath + ".account")
+	username := getConfigModel().roleAt(serviceConfigPath).Account
 	uid, err := database.GetUIDByUsername(ctx, username)
 	if err != nil {
 		log.Error("Could not get UID by username")
@@ -67,6 +66,14 @@ func getDesiredUIDByOverrideOrLookup(ctx context.Context, serviceConfigPath stri
 type workerRetryConfig struct {
 	numRetries uint
 	retrySleep time.Duration
+	backoff    retryBackoffConfig
+}
+
+// retryBackoffConfig holds the settings that make the sleep between retries grow and vary.  The zero value means a fixed sleep.
+type retryBackoffConfig struct {
+	multiplier     float64
+	jitter         float64
+	maxElapsedTime time.Duration
 }
 
 func setAllWorkerRetryValues(workerRetryMap map[worker.WorkerType]workerRetryConfig) worker.ConfigOption {
@@ -74,7 +81,27 @@ func setAllWorkerRetryValues(workerRetryMap map[worker.WorkerType]workerRetryCon
 		for wt, wr := range workerRetryMap {
 			worker.SetWorkerSpecificConfigOption(wt, worker.NumRetriesOption, wr.numRetries)(c)
 			worker.SetWorkerSpecificConfigOption(wt, worker.RetrySleepOption, wr.retrySleep)(c)
+			worker.SetRetryPolicyOption(wt, worker.RetryPolicy{
+				MaxAttempts:    wr.numRetries + 1,
+				BaseDelay:      wr.retrySleep,
+				Multiplier:     wr.backoff.multiplier,
+				Jitter:         wr.backoff.jitter,
+				MaxElapsedTime: wr.backoff.maxElapsedTime,
+			})(c)
 		}
 		return nil
 	}
 }
+
+// setAllWorkerTimeouts returns a worker.ConfigOption that sets the timeout of each worker.WorkerType that supports per-Config timeouts
+// from timeoutsMap.  The global timeout in timeoutsMap is set as the worker.Config's pipeline timeout.
+func setAllWorkerTimeouts(timeoutsMap map[timeoutKey]time.Duration) worker.ConfigOption {
+	return func(c *worker.Config) error {
+		for wt := range worker.ValidTimeoutWorkerTypes() {
+			if key, ok := timeoutKeyForWorkerType(wt); ok {
+				worker.SetTimeoutOption(wt, timeoutsMap[key])(c)
+			}
+		}
+		return worker.SetPipelineTimeout(timeoutsMap[timeoutGlobal])(c)
+	}
+}
@@ -12,7 +12,7 @@ import (
 )
 
 func TestGetDesiredUIDByOverrideOrLookup(t *testing.T) {
-	serviceConfigPath = "service_path"
+	serviceConfigPath = "experiments.myexpt.roles.myrole"
 	tempDir := t.TempDir()
 
 	type testCase struct {
@@ -0,0 +1,218 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package configDir reads the experiment configurations that are split out of the main managed tokens configuration file into the
+// files of a configuration directory, and keeps track of which file, and which line, each experiment and role was defined at
+package configDir
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fragmentExtensions are the extensions of the files in a configuration directory that are read in.  Other files are ignored.
+var fragmentExtensions = []string{".yml", ".yaml", ".json"}
+
+// Location is the file, and the line in that file, that a configuration entry is defined at.  Line is 0 if it is not known.
+type Location struct {
+	File string
+	Line int
+}
+
+func (l Location) String() string {
+	if l.Line == 0 {
+		return l.File
+	}
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// Fragment is a file in a configuration directory.  Fragments may only define experiments.
+type Fragment struct {
+	File string
+	// Experiments holds the experiments section of the file, by experiment name
+	Experiments map[string]any
+	// Locations holds the locations of the experiments and roles in the file, by their lower-cased configuration paths, i.e.
+	// experiments.<experiment> and experiments.<experiment>.roles.<role>
+	Locations map[string]Location
+}
+
+// ReadDir reads every YAML and JSON file in dir as a Fragment, in lexical order of their names
+func ReadDir(dir string) ([]*Fragment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration directory: %w", err)
+	}
+	fragments := make([]*Fragment, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !slices.Contains(fragmentExtensions, filepath.Ext(entry.Name())) {
+			continue
+		}
+		f, err := ReadFragment(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		fragments = append(fragments, f)
+	}
+	return fragments, nil
+}
+
+// ReadFragment reads the configuration directory file at path.  It returns an error if the file has any top-level keys other than
+// experiments.
+func ReadFragment(path string) (*Fragment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration file: %w", err)
+	}
+	root, err := parse(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fragment{File: path, Experiments: make(map[string]any), Locations: make(map[string]Location)}
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if !strings.EqualFold(key.Value, "experiments") {
+			return nil, fmt.Errorf("%s: %s is not allowed in a configuration directory file.  Only experiments can be defined there",
+				Location{path, key.Line}, key.Value)
+		}
+		if err := value.Decode(&f.Experiments); err != nil {
+			return nil, fmt.Errorf("%s: could not decode experiments: %w", Location{path, value.Line}, err)
+		}
+		addLocations(f.Locations, path, value)
+	}
+	return f, nil
+}
+
+// MainFileLocations returns the locations of the experiments and roles defined in the main configuration file, file.  experiments
+// holds the experiments section of the configuration that was read in from file.  Line numbers are found for YAML and JSON files.  Other
+// files, like jsonnet files, are only used to attribute the experiments to the file.
+func MainFileLocations(file string, experiments map[string]any) (map[string]Location, error) {
+	if !slices.Contains(fragmentExtensions, filepath.Ext(file)) {
+		return ExperimentLocations(file, experiments), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration file: %w", err)
+	}
+	return FileLocations(file, data)
+}
+
+// FileLocations returns the locations of the experiments and roles defined in the YAML or JSON configuration data, which was read from
+// file
+func FileLocations(file string, data []byte) (map[string]Location, error) {
+	root, err := parse(file, data)
+	if err != nil {
+		return nil, err
+	}
+	locations := make(map[string]Location)
+	for i := 0; i < len(root.Content); i += 2 {
+		if strings.EqualFold(root.Content[i].Value, "experiments") {
+			addLocations(locations, file, root.Content[i+1])
+		}
+	}
+	return locations, nil
+}
+
+// ExperimentLocations returns the locations of the experiments and roles in an already-decoded experiments section of the configuration,
+// which was read from file.  The locations don't have line numbers.
+func ExperimentLocations(file string, experiments map[string]any) map[string]Location {
+	locations := make(map[string]Location)
+	for experiment, experimentConfig := range experiments {
+		experimentPath := "experiments." + strings.ToLower(experiment)
+		locations[experimentPath] = Location{File: file}
+		experimentMap, _ := experimentConfig.(map[string]any)
+		roles, _ := experimentMap["roles"].(map[string]any)
+		for role := range roles {
+			locations[experimentPath+".roles."+strings.ToLower(role)] = Location{File: file}
+		}
+	}
+	return locations
+}
+
+// Merge returns the experiments defined in fragments, and the locations of every experiment and role in base and the fragments.  Each
+// experiment may only be defined in one file.  If an experiment is defined in more than one, Merge returns an error that gives every
+// location it is defined at, and the experiment is left out of the returned experiments.
+func Merge(base map[string]Location, fragments []*Fragment) (map[string]any, map[string]Location, error) {
+	experiments := make(map[string]any)
+	locations := maps.Clone(base)
+	if locations == nil {
+		locations = make(map[string]Location)
+	}
+
+	var errs []error
+	for _, f := range fragments {
+		for _, experiment := range slices.Sorted(maps.Keys(f.Experiments)) {
+			experimentPath := "experiments." + strings.ToLower(experiment)
+			if previous, ok := locations[experimentPath]; ok {
+				errs = append(errs, fmt.Errorf("experiment %s is defined more than once: at %s and at %s", experiment, previous, f.Locations[experimentPath]))
+				continue
+			}
+			experiments[experiment] = f.Experiments[experiment]
+			for path, l := range f.Locations {
+				if path == experimentPath || strings.HasPrefix(path, experimentPath+".") {
+					locations[path] = l
+				}
+			}
+		}
+	}
+	return experiments, locations, errors.Join(errs...)
+}
+
+// parse parses YAML or JSON configuration data, and returns its top-level mapping.  An empty document is returned as an empty mapping.
+func parse(file string, data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("could not parse configuration file %s: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: configuration file must be a mapping", Location{file, root.Line})
+	}
+	return root, nil
+}
+
+// addLocations adds the locations of the experiments, and their roles, in the experiments mapping node to locations
+func addLocations(locations map[string]Location, file string, experiments *yaml.Node) {
+	if experiments.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i < len(experiments.Content); i += 2 {
+		experimentKey, experimentValue := experiments.Content[i], experiments.Content[i+1]
+		experimentPath := "experiments." + strings.ToLower(experimentKey.Value)
+		locations[experimentPath] = Location{file, experimentKey.Line}
+		if experimentValue.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j < len(experimentValue.Content); j += 2 {
+			if !strings.EqualFold(experimentValue.Content[j].Value, "roles") || experimentValue.Content[j+1].Kind != yaml.MappingNode {
+				continue
+			}
+			roles := experimentValue.Content[j+1]
+			for k := 0; k < len(roles.Content); k += 2 {
+				locations[experimentPath+".roles."+strings.ToLower(roles.Content[k].Value)] = Location{file, roles.Content[k].Line}
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configDir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLocationString(t *testing.T) {
+	assert.Equal(t, "conf.d/dune.yml:3", Location{"conf.d/dune.yml", 3}.String())
+	assert.Equal(t, "managedTokens.jsonnet", Location{File: "managedTokens.jsonnet"}.String())
+}
+
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"b_mu2e.json": `{
+	"experiments": {
+		"mu2e": {"emails": ["email2@example.com"], "roles": {"production": {"account": "mu2epro"}}}
+	}
+}`,
+		"a_dune.yml": `experiments:
+  dune:
+    emails: [email1@example.com]
+    roles:
+      production:
+        account: dunepro
+      Analysis:
+        account: duneana
+`,
+		"empty.yml": "",
+		"README":    "not a configuration file",
+	})
+	if err := os.Mkdir(filepath.Join(dir, "subdir.yml"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	fragments, err := ReadDir(dir)
+	assert.NoError(t, err)
+	if !assert.Len(t, fragments, 3) {
+		return
+	}
+	assert.Equal(t, filepath.Join(dir, "a_dune.yml"), fragments[0].File)
+	assert.Equal(t, map[string]Location{
+		"experiments.dune":                  {filepath.Join(dir, "a_dune.yml"), 2},
+		"experiments.dune.roles.production": {filepath.Join(dir, "a_dune.yml"), 5},
+		"experiments.dune.roles.analysis":   {filepath.Join(dir, "a_dune.yml"), 7},
+	}, fragments[0].Locations)
+	assert.Contains(t, fragments[0].Experiments, "dune")
+
+	assert.Equal(t, filepath.Join(dir, "b_mu2e.json"), fragments[1].File)
+	assert.Equal(t, Location{filepath.Join(dir, "b_mu2e.json"), 3}, fragments[1].Locations["experiments.mu2e.roles.production"])
+
+	assert.Empty(t, fragments[2].Experiments)
+
+	_, err = ReadDir(filepath.Join(dir, "doesnotexist"))
+	assert.Error(t, err)
+}
+
+func TestReadFragmentErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"global.yml":    "experiments: {}\nkeytabPath: /path/to/keytabs\n",
+		"duplicate.yml": "experiments:\n  dune: {}\n  dune: {}\n",
+		"list.yml":      "- dune\n",
+		"invalid.yml":   "experiments: [\n",
+	})
+	_, err := ReadFragment(filepath.Join(dir, "global.yml"))
+	assert.EqualError(t, err, filepath.Join(dir, "global.yml")+":2: keytabPath is not allowed in a configuration directory file.  Only experiments can be defined there")
+	_, err = ReadFragment(filepath.Join(dir, "duplicate.yml"))
+	assert.ErrorContains(t, err, "already defined at line 2")
+	_, err = ReadFragment(filepath.Join(dir, "list.yml"))
+	assert.ErrorContains(t, err, "configuration file must be a mapping")
+	_, err = ReadFragment(filepath.Join(dir, "invalid.yml"))
+	assert.ErrorContains(t, err, "could not parse configuration file")
+}
+
+func TestFileLocations(t *testing.T) {
+	data := []byte(`keytabPath: /path/to/keytabs
+experiments:
+  dune:
+    roles:
+      production: {}
+`)
+	locations, err := FileLocations("managedTokens.yml", data)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Location{
+		"experiments.dune":                  {"managedTokens.yml", 3},
+		"experiments.dune.roles.production": {"managedTokens.yml", 5},
+	}, locations)
+}
+
+func TestExperimentLocations(t *testing.T) {
+	experiments := map[string]any{
+		"dune": map[string]any{"roles": map[string]any{"production": map[string]any{}}},
+		"mu2e": "notamap",
+	}
+	assert.Equal(t, map[string]Location{
+		"experiments.dune":                  {File: "managedTokens.jsonnet"},
+		"experiments.dune.roles.production": {File: "managedTokens.jsonnet"},
+		"experiments.mu2e":                  {File: "managedTokens.jsonnet"},
+	}, ExperimentLocations("managedTokens.jsonnet", experiments))
+}
+
+func TestMerge(t *testing.T) {
+	base := map[string]Location{
+		"experiments.dune":                  {"managedTokens.yml", 3},
+		"experiments.dune.roles.production": {"managedTokens.yml", 5},
+	}
+	fragments := []*Fragment{
+		{
+			File:        "conf.d/a.yml",
+			Experiments: map[string]any{"mu2e": map[string]any{"emails": []any{"email@example.com"}}, "DUNE": map[string]any{}},
+			Locations: map[string]Location{
+				"experiments.mu2e":                  {"conf.d/a.yml", 2},
+				"experiments.mu2e.roles.production": {"conf.d/a.yml", 5},
+				"experiments.dune":                  {"conf.d/a.yml", 8},
+			},
+		},
+		{
+			File:        "conf.d/b.json",
+			Experiments: map[string]any{"mu2e": map[string]any{}, "nova": map[string]any{}},
+			Locations: map[string]Location{
+				"experiments.mu2e": {"conf.d/b.json", 3},
+				"experiments.nova": {"conf.d/b.json", 4},
+			},
+		},
+	}
+
+	experiments, locations, err := Merge(base, fragments)
+	assert.EqualError(t, err, "experiment DUNE is defined more than once: at managedTokens.yml:3 and at conf.d/a.yml:8\n"+
+		"experiment mu2e is defined more than once: at conf.d/a.yml:2 and at conf.d/b.json:3")
+	assert.Equal(t, map[string]any{"mu2e": map[string]any{"emails": []any{"email@example.com"}}, "nova": map[string]any{}}, experiments)
+	assert.Equal(t, map[string]Location{
+		"experiments.dune":                  {"managedTokens.yml", 3},
+		"experiments.dune.roles.production": {"managedTokens.yml", 5},
+		"experiments.mu2e":                  {"conf.d/a.yml", 2},
+		"experiments.mu2e.roles.production": {"conf.d/a.yml", 5},
+		"experiments.nova":                  {"conf.d/b.json", 4},
+	}, locations)
+
+	// The base locations are not changed
+	assert.Len(t, base, 2)
+
+	experiments, locations, err = Merge(nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, experiments)
+	assert.Empty(t, locations)
+}
+
+func TestMainFileLocations(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"managedTokens.yml": "experiments:\n  dune:\n    roles:\n      production: {}\n"})
+
+	locations, err := MainFileLocations(filepath.Join(dir, "managedTokens.yml"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Location{filepath.Join(dir, "managedTokens.yml"), 4}, locations["experiments.dune.roles.production"])
+
+	locations, err = MainFileLocations("managedTokens.jsonnet", map[string]any{"dune": map[string]any{}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Location{"experiments.dune": {File: "managedTokens.jsonnet"}}, locations)
+
+	_, err = MainFileLocations(filepath.Join(dir, "doesnotexist.yml"), nil)
+	assert.Error(t, err)
+}
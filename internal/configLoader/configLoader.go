@@ -0,0 +1,163 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package configLoader reads in the managed tokens configuration for the executables: the main configuration file, which may be a
+// .jsonnet file, the experiment configurations in the configuration directory, and the secrets that the configuration refers to
+package configLoader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/fermitools/managed-tokens/internal/configDir"
+	"github.com/fermitools/managed-tokens/internal/jsonnet"
+	"github.com/fermitools/managed-tokens/internal/secrets"
+)
+
+// configFileName is the name, without the extension, of the configuration file that is looked for in configPaths if no configuration
+// file is given
+const configFileName = "managedTokens"
+
+// configPaths are the directories that the configuration file is looked for in, in order, if no configuration file is given
+var configPaths = []string{"/etc/managed-tokens/", "$HOME/.managed-tokens/", "."}
+
+// SecretsKeyFileKey is the configuration key of the file that holds the key that encrypted-file references are decrypted with.  It has
+// to be a plain path, not a reference itself.
+const SecretsKeyFileKey = "secretsKeyFile"
+
+// Config is what was learned about the configuration while it was read in, besides the configuration itself
+type Config struct {
+	// Rendered is the JSON that a .jsonnet configuration file evaluated to.  It is nil for other configuration files.
+	Rendered []byte
+	// Sources holds the location that each experiment and role was defined at, by lower-cased configuration path
+	Sources map[string]configDir.Location
+	// SecretReferences holds the secret reference that each resolved configuration key was set to, by the key, lower-cased like viper
+	// does
+	SecretReferences map[string]string
+}
+
+// Load reads the configuration into v.  configFile is the configuration file to read.  If it is empty, the managedTokens configuration
+// file is looked for in /etc/managed-tokens/, $HOME/.managed-tokens/ and the current directory.  A .jsonnet configuration file is
+// evaluated with the jsonnet import paths importPaths and the external variable assignments (key=value) extVars.  The experiments in
+// the configuration directory are then read in, and the secret references in the whole configuration are resolved.
+func Load(ctx context.Context, v *viper.Viper, configFile string, importPaths, extVars []string) (*Config, error) {
+	c := &Config{}
+	if configFile != "" {
+		v.SetConfigFile(configFile)
+	} else {
+		v.SetConfigName(configFileName)
+		for _, p := range configPaths {
+			v.AddConfigPath(p)
+		}
+	}
+
+	if configFile != "" && jsonnet.IsJsonnetFile(configFile) {
+		rendered, err := ReadJsonnetFile(ctx, v, configFile, importPaths, extVars)
+		if err != nil {
+			return nil, err
+		}
+		c.Rendered = rendered
+	} else if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("could not read in config file: %w", err)
+	}
+
+	var err error
+	if c.Sources, err = ReadConfigDir(v); err != nil {
+		return nil, err
+	}
+	if c.SecretReferences, err = ResolveSecrets(v); err != nil {
+		return nil, fmt.Errorf("could not resolve secrets in configuration: %w", err)
+	}
+	return c, nil
+}
+
+// ReadJsonnetFile evaluates the jsonnet configuration file at path with the jsonnet import paths importPaths and the external variable
+// assignments (key=value) extVars, and reads the result into v.  It returns the JSON that the file evaluated to.
+func ReadJsonnetFile(ctx context.Context, v *viper.Viper, path string, importPaths, extVars []string) ([]byte, error) {
+	opts := []jsonnet.EvaluateOption{jsonnet.WithImportPaths(importPaths...)}
+	for _, extVar := range extVars {
+		opts = append(opts, jsonnet.WithExtVarAssignment(extVar))
+	}
+	configJSON, err := jsonnet.EvaluateFile(ctx, path, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not evaluate jsonnet config file: %w", err)
+	}
+	v.SetConfigType("json")
+	if err := v.ReadConfig(bytes.NewReader(configJSON)); err != nil {
+		return nil, fmt.Errorf("could not read in evaluated jsonnet config file: %w", err)
+	}
+	return configJSON, nil
+}
+
+// ReadConfigDir reads the experiments defined in the files of the configDir directory, if it is configured, into v, on top of the main
+// configuration file.  A relative configDir is relative to the directory of the main configuration file.  It is an error for an
+// experiment to be defined in more than one file.  ReadConfigDir returns the location that each experiment and role was defined at,
+// by lower-cased configuration path.
+func ReadConfigDir(v *viper.Viper) (map[string]configDir.Location, error) {
+	baseLocations, err := configDir.MainFileLocations(v.ConfigFileUsed(), v.GetStringMap("experiments"))
+	if err != nil {
+		return nil, fmt.Errorf("could not find experiments in config file: %w", err)
+	}
+	dir := v.GetString("configDir")
+	if dir == "" {
+		return baseLocations, nil
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(v.ConfigFileUsed()), dir)
+	}
+
+	fragments, err := configDir.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config directory %s: %w", dir, err)
+	}
+	experiments, locations, err := configDir.Merge(baseLocations, fragments)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.MergeConfigMap(map[string]any{"experiments": experiments}); err != nil {
+		return nil, fmt.Errorf("could not merge config directory %s into configuration: %w", dir, err)
+	}
+	return locations, nil
+}
+
+// ResolveSecrets replaces every string value in v that refers to a secret (see the secrets package) with the secret.  encrypted-file
+// references are decrypted with the key in the SecretsKeyFileKey file.  It returns the reference that each resolved key was set to,
+// by the key, lower-cased like viper does.  The returned error has every reference that could not be resolved, but not the secrets.
+func ResolveSecrets(v *viper.Viper) (map[string]string, error) {
+	resolver := &secrets.Resolver{KeyFile: v.GetString(SecretsKeyFileKey)}
+	references := make(map[string]string)
+	errs := make([]error, 0)
+	for _, key := range slices.Sorted(slices.Values(v.AllKeys())) {
+		reference, ok := v.Get(key).(string)
+		if !ok || !secrets.IsReference(reference) || strings.EqualFold(key, SecretsKeyFileKey) {
+			continue
+		}
+		secret, err := resolver.Resolve(reference)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not resolve secret for %s: %w", key, err))
+			continue
+		}
+		v.Set(key, secret)
+		references[key] = reference
+	}
+	return references, errors.Join(errs...)
+}
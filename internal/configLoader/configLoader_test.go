@@ -0,0 +1,190 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configLoader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/configDir"
+	"github.com/fermitools/managed-tokens/internal/secrets"
+)
+
+// writeFiles writes each file in files, by path, creating the directories they are in
+func writeFiles(t *testing.T, files map[string]string) {
+	for name, data := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "managedTokens.yml")
+	t.Setenv("MANAGED_TOKENS_TEST_SMTP_HOST", "smtp.example.com")
+	writeFiles(t, map[string]string{
+		configFile: `email:
+  smtphost: env:MANAGED_TOKENS_TEST_SMTP_HOST
+configDir: conf.d
+experiments:
+  dune:
+    emails: [email1@example.com]
+`,
+		filepath.Join(dir, "conf.d", "mu2e.yml"): "experiments:\n  mu2e:\n    emails: [email2@example.com]\n",
+	})
+
+	v := viper.New()
+	c, err := Load(context.Background(), v, configFile, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, configFile, v.ConfigFileUsed())
+	assert.Equal(t, "smtp.example.com", v.GetString("email.smtphost"))
+	assert.Equal(t, []string{"email2@example.com"}, v.GetStringSlice("experiments.mu2e.emails"))
+	assert.Nil(t, c.Rendered)
+	assert.Equal(t, configDir.Location{File: filepath.Join(dir, "conf.d", "mu2e.yml"), Line: 2}, c.Sources["experiments.mu2e"])
+	assert.Equal(t, map[string]string{"email.smtphost": "env:MANAGED_TOKENS_TEST_SMTP_HOST"}, c.SecretReferences)
+
+	// A secret that cannot be resolved is an error
+	t.Setenv("MANAGED_TOKENS_TEST_SMTP_HOST", "")
+	os.Unsetenv("MANAGED_TOKENS_TEST_SMTP_HOST")
+	_, err = Load(context.Background(), viper.New(), configFile, nil, nil)
+	assert.ErrorContains(t, err, "could not resolve secret for email.smtphost")
+
+	// A configuration file that does not exist is an error
+	_, err = Load(context.Background(), viper.New(), filepath.Join(dir, "nonexistent.yml"), nil, nil)
+	assert.ErrorContains(t, err, "could not read in config file")
+}
+
+// TestReadJsonnetFile reads in a jsonnet configuration file that reads an external variable
+func TestReadJsonnetFile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "managedTokens.jsonnet")
+	if err := os.WriteFile(configFile, []byte(`{minTokenLifetime: std.extVar("lifetime"), experiments: {myexpt: {emails: ["email@example.com"]}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	v.SetConfigFile(configFile)
+	rendered, err := ReadJsonnetFile(context.Background(), v, configFile, nil, []string{"lifetime=1h"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"minTokenLifetime": "1h", "experiments": {"myexpt": {"emails": ["email@example.com"]}}}`, string(rendered))
+	assert.Equal(t, "1h", v.GetString("minTokenLifetime"))
+	assert.Equal(t, []string{"email@example.com"}, v.GetStringSlice("experiments.myexpt.emails"))
+
+	// Load keeps the rendered configuration
+	c, err := Load(context.Background(), viper.New(), configFile, nil, []string{"lifetime=2h"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"minTokenLifetime": "2h", "experiments": {"myexpt": {"emails": ["email@example.com"]}}}`, string(c.Rendered))
+
+	_, err = ReadJsonnetFile(context.Background(), viper.New(), configFile, nil, []string{"notanassignment"})
+	assert.Error(t, err)
+}
+
+func TestReadConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "managedTokens.yml")
+	writeFiles(t, map[string]string{
+		configFile: `keytabPath: /path/to/keytabs
+configDir: conf.d
+experiments:
+  dune:
+    emails: [email1@example.com]
+    roles:
+      production:
+        account: dunepro
+`,
+		filepath.Join(dir, "conf.d", "mu2e.yml"): `experiments:
+  mu2e:
+    emails: [email2@example.com]
+    roles:
+      production:
+        account: mu2epro
+`,
+		filepath.Join(dir, "conf.d", "nova.json"): `{"experiments": {"nova": {"emails": ["email3@example.com"], "roles": {"production": {"account": "novapro"}}}}}`,
+	})
+	readConfig := func() *viper.Viper {
+		v := viper.New()
+		v.SetConfigFile(configFile)
+		if err := v.ReadInConfig(); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	v := readConfig()
+	locations, err := ReadConfigDir(v)
+	assert.NoError(t, err)
+	assert.Equal(t, "dunepro", v.GetString("experiments.dune.roles.production.account"))
+	assert.Equal(t, "mu2epro", v.GetString("experiments.mu2e.roles.production.account"))
+	assert.Equal(t, "novapro", v.GetString("experiments.nova.roles.production.account"))
+	assert.Equal(t, "/path/to/keytabs", v.GetString("keytabPath"))
+	assert.Equal(t, configDir.Location{File: configFile, Line: 7}, locations["experiments.dune.roles.production"])
+	assert.Equal(t, configDir.Location{File: filepath.Join(dir, "conf.d", "mu2e.yml"), Line: 5}, locations["experiments.mu2e.roles.production"])
+	assert.Equal(t, configDir.Location{File: filepath.Join(dir, "conf.d", "nova.json"), Line: 1}, locations["experiments.nova.roles.production"])
+
+	// An experiment defined in both the main configuration file and the configuration directory is an error
+	writeFiles(t, map[string]string{filepath.Join(dir, "conf.d", "dune.yml"): "experiments:\n  dune:\n    emails: []\n"})
+	_, err = ReadConfigDir(readConfig())
+	assert.EqualError(t, err,
+		"experiment dune is defined more than once: at "+configFile+":4 and at "+filepath.Join(dir, "conf.d", "dune.yml")+":2")
+}
+
+func TestReadConfigDirNotConfigured(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("../../managedTokens.yml")
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	locations, err := ReadConfigDir(v)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\.\./\.\./managedTokens\.yml:\d+$`, locations["experiments.dune.roles.production"].String())
+}
+
+func TestResolveSecrets(t *testing.T) {
+	tempDir := t.TempDir()
+	slackFile := filepath.Join(tempDir, "slack-url")
+	os.WriteFile(slackFile, []byte("https://hooks.example.com/services/fromfile\n"), 0o600)
+	t.Setenv("MANAGED_TOKENS_TEST_SMTP_HOST", "smtp.example.com")
+
+	v := viper.New()
+	v.Set("notifications.SLACK_ALERTS_URL", "file:"+slackFile)
+	v.Set("email.smtphost", "env:MANAGED_TOKENS_TEST_SMTP_HOST")
+	v.Set("email.from", "admin@example.com")
+
+	references, err := ResolveSecrets(v)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/services/fromfile", v.GetString("notifications.slack_alerts_url"))
+	assert.Equal(t, "smtp.example.com", v.GetString("email.smtphost"))
+	assert.Equal(t, "admin@example.com", v.GetString("email.from"))
+	assert.Equal(t, map[string]string{
+		"notifications.slack_alerts_url": "file:" + slackFile,
+		"email.smtphost":                 "env:MANAGED_TOKENS_TEST_SMTP_HOST",
+	}, references)
+	assert.Equal(t, secrets.Redacted, secrets.Redact("https://hooks.example.com/services/fromfile"))
+
+	// Errors have the references that could not be resolved
+	v.Set("email.smtphost", "env:MANAGED_TOKENS_TEST_UNSET")
+	v.Set("email.from", "encrypted-file:"+filepath.Join(tempDir, "from.enc"))
+	_, err = ResolveSecrets(v)
+	assert.ErrorContains(t, err, "could not resolve secret for email.smtphost: environment variable MANAGED_TOKENS_TEST_UNSET is not set")
+	assert.ErrorContains(t, err, "could not resolve secret for email.from: no key file")
+}
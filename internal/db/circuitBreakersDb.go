@@ -0,0 +1,241 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fermitools/managed-tokens/internal/tracing"
+	_ "github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SQL statements to be used by API
+
+// Query db actions
+var (
+	getNodeCircuitBreakersStatement = `
+	SELECT
+		services.name,
+		nodes.name,
+		node_circuit_breakers.consecutive_failures,
+		node_circuit_breakers.opened,
+		node_circuit_breakers.notified
+	FROM
+		node_circuit_breakers
+		INNER JOIN services ON services.id = node_circuit_breakers.service_id
+		INNER JOIN nodes ON nodes.id = node_circuit_breakers.node_id
+	ORDER BY
+		services.name,
+		nodes.name
+	;
+	`
+)
+
+// INSERT/UPDATE/DELETE actions
+var (
+	insertOrUpdateNodeCircuitBreakersStatement = `
+	INSERT INTO node_circuit_breakers(service_id, node_id, consecutive_failures, opened, notified)
+	SELECT
+		(SELECT services.id FROM services WHERE services.name = ?) AS service_id,
+		(SELECT nodes.id FROM nodes WHERE nodes.name = ?) AS node_id,
+		? AS consecutive_failures,
+		? AS opened,
+		? AS notified
+	ON CONFLICT(service_id, node_id) DO
+		UPDATE SET consecutive_failures = ?, opened = ?, notified = ?
+	;
+	`
+	// An empty service or node name matches every service or node
+	deleteNodeCircuitBreakersStatement = `
+	DELETE FROM node_circuit_breakers
+	WHERE
+		(? = '' OR service_id = (SELECT services.id FROM services WHERE services.name = ?))
+		AND (? = '' OR node_id = (SELECT nodes.id FROM nodes WHERE nodes.name = ?))
+	;
+	`
+)
+
+// NodeCircuitBreaker is an interface that wraps the Service, Node, ConsecutiveFailures, Opened, and Notified methods.  It is meant to be
+// used both by this package and importing packages to store and retrieve the state of the circuit breaker for pushing a service's vault
+// tokens to a node.  Opened should return the zero time.Time if the circuit breaker is closed.  The database does not interpret the
+// state - it is up to the caller to decide when to open and close circuit breakers.
+type NodeCircuitBreaker interface {
+	Service() string
+	Node() string
+	ConsecutiveFailures() int
+	Opened() time.Time
+	Notified() bool
+}
+
+// nodeCircuitBreaker is an internal-facing type that implements both NodeCircuitBreaker and insertValues
+type nodeCircuitBreaker struct {
+	service             string
+	node                string
+	consecutiveFailures int
+	opened              int
+	notified            bool
+}
+
+func (n *nodeCircuitBreaker) Service() string          { return n.service }
+func (n *nodeCircuitBreaker) Node() string             { return n.node }
+func (n *nodeCircuitBreaker) ConsecutiveFailures() int { return n.consecutiveFailures }
+func (n *nodeCircuitBreaker) Notified() bool           { return n.notified }
+func (n *nodeCircuitBreaker) Opened() time.Time {
+	if n.opened == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(n.opened), 0)
+}
+
+// The values are doubled here because of the ON CONFLICT...UPDATE clause
+func (n *nodeCircuitBreaker) insertValues() []any {
+	notified := boolToInt(n.notified)
+	return []any{n.service, n.node, n.consecutiveFailures, n.opened, notified, n.consecutiveFailures, n.opened, notified}
+}
+
+func (n *nodeCircuitBreaker) unpackDataRow(resultRow []any) (dataRowUnpacker, error) {
+	// Make sure we have the right number of values
+	if len(resultRow) != 5 {
+		msg := "node circuit breaker data has wrong structure"
+		log.Errorf("%s: %v", msg, resultRow)
+		return nil, errDatabaseDataWrongStructure
+	}
+	// Type check each element
+	serviceVal, serviceTypeOk := resultRow[0].(string)
+	nodeVal, nodeTypeOk := resultRow[1].(string)
+	failuresVal, failuresTypeOk := resultRow[2].(int64)
+	openedVal, openedTypeOk := resultRow[3].(int64)
+	notifiedVal, notifiedTypeOk := resultRow[4].(int64)
+	if !(serviceTypeOk && nodeTypeOk && failuresTypeOk && openedTypeOk && notifiedTypeOk) {
+		msg := "node circuit breakers query result has wrong type.  Expected (string, string, int64, int64, int64)"
+		log.Errorf("%s: got (%T, %T, %T, %T, %T)", msg, resultRow[0], resultRow[1], resultRow[2], resultRow[3], resultRow[4])
+		return nil, errDatabaseDataWrongType
+	}
+	log.Debugf("Got NodeCircuitBreaker row: %s, %s, %d, %d, %d", serviceVal, nodeVal, failuresVal, openedVal, notifiedVal)
+	return &nodeCircuitBreaker{
+		service:             serviceVal,
+		node:                nodeVal,
+		consecutiveFailures: int(failuresVal),
+		opened:              int(openedVal),
+		notified:            notifiedVal != 0,
+	}, nil
+}
+
+// nodeCircuitBreakerSelector selects the circuit breakers to delete.  It implements insertValues so that it can be used with
+// insertValuesTransactionRunner
+type nodeCircuitBreakerSelector struct {
+	service string
+	node    string
+}
+
+func (n *nodeCircuitBreakerSelector) insertValues() []any {
+	return []any{n.service, n.service, n.node, n.node}
+}
+
+// GetNodeCircuitBreakers queries the ManagedTokensDatabase for the circuit breakers of all services and nodes, sorted by service and node.
+// It returns the data in the form of a slice of NodeCircuitBreakers that the caller can unpack using the interface methods Service(),
+// Node(), ConsecutiveFailures(), Opened(), and Notified()
+func (m *ManagedTokensDatabase) GetNodeCircuitBreakers(ctx context.Context) ([]NodeCircuitBreaker, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "db.GetNodeCircuitBreakers")
+	span.SetAttributes(attribute.String("dbLocation", m.filename))
+	defer span.End()
+
+	funcLogger := log.WithField("dbLocation", m.filename)
+	data, err := getValuesTransactionRunner(ctx, m.db, getNodeCircuitBreakersStatement)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not get node circuit breakers from ManagedTokensDatabase")
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		funcLogger.Debug("No node circuit breakers in database")
+		return nil, sql.ErrNoRows
+	}
+
+	// Unpack data
+	unpackedData, err := unpackData[*nodeCircuitBreaker](data)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Error unpacking nodeCircuitBreaker data")
+		return nil, err
+	}
+	convertedData := make([]NodeCircuitBreaker, 0, len(unpackedData))
+	for _, datum := range unpackedData {
+		convertedData = append(convertedData, datum)
+	}
+	tracing.LogSuccessWithTrace(span, funcLogger, "Got node circuit breakers from ManagedTokensDatabase")
+	return convertedData, nil
+}
+
+// UpdateNodeCircuitBreakersTable records the given circuit breakers in the ManagedTokensDatabase, replacing the state of any circuit
+// breaker that is already recorded for the same service and node.  The services and nodes must already be in the database.
+func (m *ManagedTokensDatabase) UpdateNodeCircuitBreakersTable(ctx context.Context, breakers []NodeCircuitBreaker) error {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "db.UpdateNodeCircuitBreakersTable")
+	span.SetAttributes(attribute.String("dbLocation", m.filename))
+	defer span.End()
+
+	funcLogger := log.WithField("dbLocation", m.filename)
+
+	data := make([]insertValues, 0, len(breakers))
+	for _, datum := range breakers {
+		var opened int
+		if !datum.Opened().IsZero() {
+			opened = int(datum.Opened().Unix())
+		}
+		data = append(data,
+			&nodeCircuitBreaker{
+				service:             datum.Service(),
+				node:                datum.Node(),
+				consecutiveFailures: datum.ConsecutiveFailures(),
+				opened:              opened,
+				notified:            datum.Notified(),
+			})
+	}
+
+	if err := insertValuesTransactionRunner(ctx, m.db, insertOrUpdateNodeCircuitBreakersStatement, data); err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not update node circuit breakers in ManagedTokensDatabase")
+		return err
+	}
+	tracing.LogSuccessWithTrace(span, funcLogger, "Updated node circuit breakers in ManagedTokensDatabase")
+	return nil
+}
+
+// ResetNodeCircuitBreakers removes the circuit breakers for the given service and node from the ManagedTokensDatabase, which closes them.
+// If service is empty, the circuit breakers for node are removed for every service.  If node is empty, every circuit breaker for
+// service is removed.  If both are empty, every circuit breaker is removed.
+func (m *ManagedTokensDatabase) ResetNodeCircuitBreakers(ctx context.Context, service, node string) error {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "db.ResetNodeCircuitBreakers")
+	span.SetAttributes(
+		attribute.String("dbLocation", m.filename),
+		attribute.String("service", service),
+		attribute.String("node", node),
+	)
+	defer span.End()
+
+	funcLogger := log.WithFields(log.Fields{"dbLocation": m.filename, "service": service, "node": node})
+
+	data := []insertValues{&nodeCircuitBreakerSelector{service: service, node: node}}
+	if err := insertValuesTransactionRunner(ctx, m.db, deleteNodeCircuitBreakersStatement, data); err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not reset node circuit breakers in ManagedTokensDatabase")
+		return err
+	}
+	tracing.LogSuccessWithTrace(span, funcLogger, "Reset node circuit breakers in ManagedTokensDatabase")
+	return nil
+}
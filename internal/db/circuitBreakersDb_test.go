@@ -0,0 +1,131 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNodeCircuitBreakers checks that the circuit breakers we store with UpdateNodeCircuitBreakersTable are returned by
+// GetNodeCircuitBreakers, that storing a circuit breaker again replaces its state, and that ResetNodeCircuitBreakers removes the
+// selected circuit breakers
+func TestNodeCircuitBreakers(t *testing.T) {
+	ctx := context.Background()
+	m, err := OpenOrCreateDatabase(path.Join(t.TempDir(), fmt.Sprintf("managed-tokens-test-%d.db", rand.Intn(10000))))
+	if err != nil {
+		t.Fatalf("Could not create new database, %s", err)
+	}
+	defer m.Close()
+
+	_, err = m.GetNodeCircuitBreakers(ctx)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	if err := m.UpdateServices(ctx, []string{"foo", "bar"}); err != nil {
+		t.Fatalf("Could not insert services into database: %s", err)
+	}
+	if err := m.UpdateNodes(ctx, []string{"node1", "node2"}); err != nil {
+		t.Fatalf("Could not insert nodes into database: %s", err)
+	}
+
+	setBreakers := func() {
+		breakers := []NodeCircuitBreaker{
+			&nodeCircuitBreaker{service: "foo", node: "node1", consecutiveFailures: 1},
+			&nodeCircuitBreaker{service: "foo", node: "node2", consecutiveFailures: 3, opened: 1000, notified: true},
+			&nodeCircuitBreaker{service: "bar", node: "node1", consecutiveFailures: 3, opened: 1000},
+		}
+		if err := m.UpdateNodeCircuitBreakersTable(ctx, breakers); err != nil {
+			t.Fatalf("Could not update node circuit breakers: %s", err)
+		}
+	}
+	setBreakers()
+
+	got, err := m.GetNodeCircuitBreakers(ctx)
+	assert.NoError(t, err)
+	// Sorted by service and node
+	assert.Equal(t,
+		[]NodeCircuitBreaker{
+			&nodeCircuitBreaker{service: "bar", node: "node1", consecutiveFailures: 3, opened: 1000},
+			&nodeCircuitBreaker{service: "foo", node: "node1", consecutiveFailures: 1},
+			&nodeCircuitBreaker{service: "foo", node: "node2", consecutiveFailures: 3, opened: 1000, notified: true},
+		},
+		got,
+	)
+	assert.True(t, got[1].Opened().IsZero())
+	assert.Equal(t, time.Unix(1000, 0), got[2].Opened())
+
+	assert.NoError(t, m.UpdateNodeCircuitBreakersTable(ctx, []NodeCircuitBreaker{&nodeCircuitBreaker{service: "bar", node: "node1", consecutiveFailures: 4, opened: 2000, notified: true}}))
+	got, err = m.GetNodeCircuitBreakers(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, got, 3)
+	assert.Equal(t, &nodeCircuitBreaker{service: "bar", node: "node1", consecutiveFailures: 4, opened: 2000, notified: true}, got[0])
+
+	type testCase struct {
+		description string
+		service     string
+		node        string
+		expectedLen int
+	}
+	testCases := []testCase{
+		{"Reset one circuit breaker", "foo", "node2", 2},
+		{"Reset all circuit breakers for a service", "foo", "", 1},
+		{"Reset circuit breakers for a node for every service", "", "node1", 1},
+		{"Reset all circuit breakers", "", "", 0},
+		{"Reset circuit breaker for a node that is not in the database", "foo", "node3", 3},
+	}
+	for _, test := range testCases {
+		t.Run(test.description, func(t *testing.T) {
+			setBreakers()
+			assert.NoError(t, m.ResetNodeCircuitBreakers(ctx, test.service, test.node))
+			got, err := m.GetNodeCircuitBreakers(ctx)
+			if test.expectedLen == 0 {
+				assert.ErrorIs(t, err, sql.ErrNoRows)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, got, test.expectedLen)
+			for _, b := range got {
+				if test.service != "" && test.node != "" {
+					assert.False(t, b.Service() == test.service && b.Node() == test.node)
+				} else if test.service != "" {
+					assert.NotEqual(t, test.service, b.Service())
+				} else if test.node != "" {
+					assert.NotEqual(t, test.node, b.Node())
+				}
+			}
+		})
+	}
+}
+
+func TestUnpackNodeCircuitBreakerDataRow(t *testing.T) {
+	n := &nodeCircuitBreaker{}
+	datum, err := n.unpackDataRow([]any{"foo", "node1", int64(3), int64(1000), int64(1)})
+	assert.NoError(t, err)
+	assert.Equal(t, &nodeCircuitBreaker{service: "foo", node: "node1", consecutiveFailures: 3, opened: 1000, notified: true}, datum)
+
+	_, err = n.unpackDataRow([]any{"foo", "node1", int64(3), int64(1000)})
+	assert.True(t, errors.Is(err, errDatabaseDataWrongStructure))
+	_, err = n.unpackDataRow([]any{"foo", "node1", 3, int64(1000), int64(1)})
+	assert.True(t, errors.Is(err, errDatabaseDataWrongType))
+}
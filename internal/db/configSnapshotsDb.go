@@ -0,0 +1,140 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fermitools/managed-tokens/internal/tracing"
+	_ "github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SQL statements to be used by API
+
+// Query db actions
+var (
+	getLatestConfigSnapshotStatement = `
+	SELECT
+		snapshot,
+		recorded
+	FROM
+		config_snapshots
+	ORDER BY
+		id DESC
+	LIMIT 1
+	;
+	`
+)
+
+// INSERT/UPDATE actions
+var (
+	insertIntoConfigSnapshotsStatement = `
+	INSERT INTO config_snapshots(snapshot, recorded)
+	VALUES
+		(?, ?)
+	;
+	`
+)
+
+// ConfigSnapshot is an interface that wraps the Snapshot and Recorded methods.  It is meant to be used both by this package and
+// importing packages to store and retrieve a snapshot of the configuration of all services.  The database does not interpret the
+// snapshot - it is up to the caller to decide how to serialize the configuration.
+type ConfigSnapshot interface {
+	Snapshot() string
+	Recorded() time.Time
+}
+
+// configSnapshot is an internal-facing type that implements both ConfigSnapshot and insertValues
+type configSnapshot struct {
+	snapshot string
+	recorded int
+}
+
+func (c *configSnapshot) Snapshot() string    { return c.snapshot }
+func (c *configSnapshot) Recorded() time.Time { return time.Unix(int64(c.recorded), 0) }
+
+func (c *configSnapshot) insertValues() []any { return []any{c.snapshot, c.recorded} }
+
+func (c *configSnapshot) unpackDataRow(resultRow []any) (dataRowUnpacker, error) {
+	// Make sure we have the right number of values
+	if len(resultRow) != 2 {
+		msg := "config snapshot data has wrong structure"
+		log.Errorf("%s: %v", msg, resultRow)
+		return nil, errDatabaseDataWrongStructure
+	}
+	// Type check each element
+	snapshotVal, snapshotTypeOk := resultRow[0].(string)
+	recordedVal, recordedTypeOk := resultRow[1].(int64)
+	if !(snapshotTypeOk && recordedTypeOk) {
+		msg := "config snapshot query result has wrong type.  Expected (string, int64)"
+		log.Errorf("%s: got (%T, %T)", msg, resultRow[0], resultRow[1])
+		return nil, errDatabaseDataWrongType
+	}
+	log.Debugf("Got ConfigSnapshot row recorded at %d", recordedVal)
+	return &configSnapshot{snapshot: snapshotVal, recorded: int(recordedVal)}, nil
+}
+
+// GetLatestConfigSnapshot queries the ManagedTokensDatabase for the most recently recorded configuration snapshot.  If no snapshot
+// has been recorded yet, it returns sql.ErrNoRows
+func (m *ManagedTokensDatabase) GetLatestConfigSnapshot(ctx context.Context) (ConfigSnapshot, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "db.GetLatestConfigSnapshot")
+	span.SetAttributes(attribute.String("dbLocation", m.filename))
+	defer span.End()
+
+	funcLogger := log.WithField("dbLocation", m.filename)
+	data, err := getValuesTransactionRunner(ctx, m.db, getLatestConfigSnapshotStatement)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not get latest config snapshot from ManagedTokensDatabase")
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		funcLogger.Debug("No config snapshots in database")
+		return nil, sql.ErrNoRows
+	}
+
+	// Unpack data
+	unpackedData, err := unpackData[*configSnapshot](data)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Error unpacking configSnapshot data")
+		return nil, err
+	}
+	tracing.LogSuccessWithTrace(span, funcLogger, "Got latest config snapshot from ManagedTokensDatabase")
+	return unpackedData[0], nil
+}
+
+// InsertConfigSnapshot records a snapshot of the configuration, taken at the time recorded, in the ManagedTokensDatabase.  Earlier
+// snapshots are kept, so callers should only insert a snapshot if it differs from the one returned by GetLatestConfigSnapshot.
+func (m *ManagedTokensDatabase) InsertConfigSnapshot(ctx context.Context, recorded time.Time, snapshot string) error {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "db.InsertConfigSnapshot")
+	span.SetAttributes(attribute.String("dbLocation", m.filename))
+	defer span.End()
+
+	funcLogger := log.WithField("dbLocation", m.filename)
+
+	data := []insertValues{&configSnapshot{snapshot: snapshot, recorded: int(recorded.Unix())}}
+	if err := insertValuesTransactionRunner(ctx, m.db, insertIntoConfigSnapshotsStatement, data); err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not insert config snapshot into ManagedTokensDatabase")
+		return err
+	}
+	tracing.LogSuccessWithTrace(span, funcLogger, "Inserted config snapshot into ManagedTokensDatabase")
+	return nil
+}
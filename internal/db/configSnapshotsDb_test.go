@@ -0,0 +1,54 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConfigSnapshots checks that GetLatestConfigSnapshot returns the most recently inserted config snapshot
+func TestConfigSnapshots(t *testing.T) {
+	ctx := context.Background()
+	m, err := OpenOrCreateDatabase(path.Join(t.TempDir(), fmt.Sprintf("managed-tokens-test-%d.db", rand.Intn(10000))))
+	if err != nil {
+		t.Fatalf("Could not create new database, %s", err)
+	}
+	defer m.Close()
+
+	_, err = m.GetLatestConfigSnapshot(ctx)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	assert.NoError(t, m.InsertConfigSnapshot(ctx, time.Unix(1000, 0), `{"foo":{}}`))
+	got, err := m.GetLatestConfigSnapshot(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"foo":{}}`, got.Snapshot())
+	assert.Equal(t, time.Unix(1000, 0), got.Recorded())
+
+	// A later snapshot replaces the earlier one as the latest, even if it was recorded with an earlier time
+	assert.NoError(t, m.InsertConfigSnapshot(ctx, time.Unix(500, 0), `{"bar":{}}`))
+	got, err = m.GetLatestConfigSnapshot(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"bar":{}}`, got.Snapshot())
+	assert.Equal(t, time.Unix(500, 0), got.Recorded())
+}
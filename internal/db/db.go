@@ -40,7 +40,7 @@ const (
 	// ApplicationId is used to uniquely identify a sqlite database as belonging to an application, rather than being a simple DB
 	ApplicationId              = 0x5da82553
 	dbDefaultTimeoutStr string = "10s"
-	schemaVersion              = 1
+	schemaVersion              = 4
 )
 
 // ManagedTokensDatabase is a database in which FERRY username to uid mappings are stored.  It is the main type that external packages
@@ -88,6 +88,50 @@ func OpenOrCreateDatabase(filename string) (*ManagedTokensDatabase, error) {
 	return &m, nil
 }
 
+// OpenDatabaseReadOnly opens an existing sqlite3 ManagedTokensDatabase for reading only, and returns a *ManagedTokensDatabase object.
+// Unlike OpenOrCreateDatabase, it will neither create the database nor migrate its schema, so it is safe to use from commands that
+// must not modify the database.  If the database's schema is older than the one this library expects, queries against tables
+// added in newer schema versions will return errors.
+func OpenDatabaseReadOnly(filename string) (*ManagedTokensDatabase, error) {
+	funcLog := log.WithField("dbLocation", filename)
+
+	if _, err := os.Stat(filename); err != nil {
+		funcLog.Error("ManagedTokensDatabase file does not exist.  Cannot open it read-only")
+		return nil, &databaseOpenError{filename, err}
+	}
+
+	m := ManagedTokensDatabase{filename: filename}
+	var err error
+	m.db, err = sql.Open("sqlite3", "file:"+filename+"?mode=ro")
+	if err != nil {
+		funcLog.Errorf("Could not open the managed tokens database file read-only: %s", err)
+		return nil, &databaseOpenError{filename, err}
+	}
+
+	if err := m.checkApplicationId(); err != nil {
+		funcLog.Error("ApplicationId check failed")
+		m.db.Close()
+		return nil, err
+	}
+
+	var userVersion int
+	if err := m.db.QueryRow("PRAGMA user_version").Scan(&userVersion); err != nil {
+		msg := "Could not get user_version from ManagedTokensDatabase"
+		funcLog.Error(msg)
+		m.db.Close()
+		return nil, &databaseCheckError{msg, err}
+	}
+	if userVersion < schemaVersion {
+		funcLog.WithFields(log.Fields{
+			"userVersion":   userVersion,
+			"schemaVersion": schemaVersion,
+		}).Warn("Database schema is older than expected, and will not be migrated when opened read-only.  Some data may not be available")
+	}
+
+	funcLog.Debug("ManagedTokensDatabase read-only connection ready")
+	return &m, nil
+}
+
 func (m *ManagedTokensDatabase) create() error {
 	funcLog := log.WithField("dbLocation", m.filename)
 	if err := m.initialize(); err != nil {
@@ -57,6 +57,79 @@ func TestOpenOrCreateDatabase(t *testing.T) {
 	goodTestDb.Close()
 }
 
+// TestOpenDatabaseReadOnly checks that OpenDatabaseReadOnly neither creates nor migrates a database, and that the connection it
+// returns cannot write to the database
+func TestOpenDatabaseReadOnly(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Run("Database does not exist", func(t *testing.T) {
+		dbLocation := path.Join(tempDir, "nonexistent.db")
+		m, err := OpenDatabaseReadOnly(dbLocation)
+		if err == nil {
+			m.Close()
+			t.Error("Expected error opening nonexistent database read-only.  Got nil")
+		}
+		if _, err := os.Stat(dbLocation); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected database file not to be created.  Got stat error %v", err)
+		}
+	})
+
+	t.Run("Older schema version is not migrated", func(t *testing.T) {
+		dbLocation := path.Join(tempDir, fmt.Sprintf("managed-tokens-test-%d.db", rand.Intn(10000)))
+		m := &ManagedTokensDatabase{filename: dbLocation}
+		var err error
+		if m.db, err = sql.Open("sqlite3", dbLocation); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = m.db.Exec(fmt.Sprintf("PRAGMA application_id=%d;", ApplicationId)); err != nil {
+			t.Fatal(err)
+		}
+		if err = m.migrate(0, 1); err != nil {
+			t.Fatal(err)
+		}
+		m.Close()
+
+		roDb, err := OpenDatabaseReadOnly(dbLocation)
+		if err != nil {
+			t.Fatalf("Could not open database read-only: %s", err)
+		}
+		defer roDb.Close()
+
+		var userVersion int
+		if err := roDb.db.QueryRow("PRAGMA user_version").Scan(&userVersion); err != nil {
+			t.Fatal(err)
+		}
+		if userVersion != 1 {
+			t.Errorf("Expected database to stay at schema version 1.  Got %d", userVersion)
+		}
+
+		if _, err := roDb.db.Exec("INSERT INTO uids (username, uid) VALUES ('user', 1);"); err == nil {
+			t.Error("Expected write to read-only database to fail.  Got nil error")
+		}
+	})
+
+	t.Run("Bad application ID", func(t *testing.T) {
+		dbLocation := path.Join(tempDir, fmt.Sprintf("managed-tokens-test-bad-%d.db", rand.Intn(10000)))
+		badDb, err := sql.Open("sqlite3", dbLocation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = badDb.Exec(fmt.Sprintf("PRAGMA application_id=%d;", 42)); err != nil {
+			t.Fatal(err)
+		}
+		badDb.Close()
+
+		var e *databaseCheckError
+		m, err := OpenDatabaseReadOnly(dbLocation)
+		if err == nil {
+			m.Close()
+			t.Error("Expected application ID check to fail.  Got nil error instead")
+		} else if !errors.As(err, &e) {
+			t.Errorf("Got wrong error type.  Expected *databaseCheckError, got %T instead", err)
+		}
+	})
+}
+
 func TestCreateManagedTokensDatabase(t *testing.T) {
 	tempDir := t.TempDir()
 	goodDbLocation := path.Join(tempDir, fmt.Sprintf("managed-tokens-test-%d.db", rand.Intn(10000)))
@@ -69,6 +69,71 @@ service_id INTEGER,
 node_id INTEGER,
 count INTEGER,
 UNIQUE(service_id, node_id),
+FOREIGN KEY (service_id)
+	REFERENCES services (id)
+		ON DELETE CASCADE
+		ON UPDATE NO ACTION,
+FOREIGN KEY (node_id)
+	REFERENCES nodes (id)
+		ON DELETE CASCADE
+		ON UPDATE NO ACTION
+);`,
+	},
+	{
+		description: "version 2: results of the last run for each service and node",
+		sqlText: `
+PRAGMA user_version=2;
+
+CREATE TABLE service_run_results (
+service_id INTEGER UNIQUE,
+success INTEGER NOT NULL,
+failed_stage STRING NOT NULL,
+run_start INTEGER NOT NULL,
+FOREIGN KEY (service_id)
+	REFERENCES services (id)
+		ON DELETE CASCADE
+		ON UPDATE NO ACTION
+);
+
+CREATE TABLE node_push_results (
+service_id INTEGER,
+node_id INTEGER,
+success INTEGER NOT NULL,
+run_start INTEGER NOT NULL,
+UNIQUE(service_id, node_id),
+FOREIGN KEY (service_id)
+	REFERENCES services (id)
+		ON DELETE CASCADE
+		ON UPDATE NO ACTION,
+FOREIGN KEY (node_id)
+	REFERENCES nodes (id)
+		ON DELETE CASCADE
+		ON UPDATE NO ACTION
+);`,
+	},
+	{
+		description: "version 3: snapshots of the configuration of all services, recorded whenever it changes",
+		sqlText: `
+PRAGMA user_version=3;
+
+CREATE TABLE config_snapshots (
+id INTEGER NOT NULL PRIMARY KEY,
+snapshot STRING NOT NULL,
+recorded INTEGER NOT NULL
+);`,
+	},
+	{
+		description: "version 4: circuit breakers for pushing each service's tokens to each node",
+		sqlText: `
+PRAGMA user_version=4;
+
+CREATE TABLE node_circuit_breakers (
+service_id INTEGER,
+node_id INTEGER,
+consecutive_failures INTEGER NOT NULL,
+opened INTEGER NOT NULL,
+notified INTEGER NOT NULL,
+UNIQUE(service_id, node_id),
 FOREIGN KEY (service_id)
 	REFERENCES services (id)
 		ON DELETE CASCADE
@@ -137,6 +137,9 @@ func TestMigrationFromLowerSchemaVersion(t *testing.T) {
 	// Lower version than schemaVersion - so our test DB should match the migrations
 	lowerVersion := schemaVersion - 1
 	msg := "error running test where the database version number is lower than the schemaVersion"
+	if err := m.migrate(0, lowerVersion); err != nil {
+		t.Errorf("%s: %s", msg, err)
+	}
 	if _, err = m.db.Exec(fmt.Sprintf("PRAGMA user_version=%d;", lowerVersion)); err != nil {
 		t.Errorf("%s: %s", msg, err)
 	}
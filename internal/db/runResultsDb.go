@@ -0,0 +1,314 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fermitools/managed-tokens/internal/tracing"
+	_ "github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SQL statements to be used by API
+
+// Query db actions
+var (
+	getServiceRunResultsStatement = `
+	SELECT
+		services.name,
+		service_run_results.success,
+		service_run_results.failed_stage
+	FROM
+		service_run_results
+		INNER JOIN services ON services.id = service_run_results.service_id
+	;
+	`
+	// We only want the node push results that were recorded in the same run as each service's run result, so that we don't
+	// get results from an older run if a service's last run didn't get to pushing tokens
+	getNodePushResultsStatement = `
+	SELECT
+		services.name,
+		nodes.name,
+		node_push_results.success
+	FROM
+		node_push_results
+		INNER JOIN services ON services.id = node_push_results.service_id
+		INNER JOIN nodes ON nodes.id = node_push_results.node_id
+		INNER JOIN service_run_results ON service_run_results.service_id = node_push_results.service_id
+	WHERE
+		node_push_results.run_start = service_run_results.run_start
+	;
+	`
+)
+
+// INSERT/UPDATE actions
+var (
+	insertOrUpdateServiceRunResultsStatement = `
+	INSERT INTO service_run_results(service_id, success, failed_stage, run_start)
+	SELECT
+		(SELECT services.id FROM services WHERE services.name = ?) AS service_id,
+		? AS success,
+		? AS failed_stage,
+		? AS run_start
+	ON CONFLICT(service_id) DO
+		UPDATE SET success = ?, failed_stage = ?, run_start = ?
+	;
+	`
+	insertOrUpdateNodePushResultsStatement = `
+	INSERT INTO node_push_results(service_id, node_id, success, run_start)
+	SELECT
+		(SELECT services.id FROM services WHERE services.name = ?) AS service_id,
+		(SELECT nodes.id FROM nodes WHERE nodes.name = ?) AS node_id,
+		? AS success,
+		? AS run_start
+	ON CONFLICT(service_id, node_id) DO
+		UPDATE SET success = ?, run_start = ?
+	;
+	`
+)
+
+// Service run results
+
+// ServiceRunResult is an interface that wraps the Service, Success, and FailedStage methods.  It is meant to be used both by this package
+// and importing packages to store and retrieve the outcome of the last run for a service.  FailedStage should return the stage that
+// the service failed at, if it is known, or an empty string otherwise.
+type ServiceRunResult interface {
+	Service() string
+	Success() bool
+	FailedStage() string
+}
+
+// serviceRunResult is an internal-facing type that implements both ServiceRunResult and insertValues
+type serviceRunResult struct {
+	service     string
+	success     bool
+	failedStage string
+	runStart    int
+}
+
+func (s *serviceRunResult) Service() string     { return s.service }
+func (s *serviceRunResult) Success() bool       { return s.success }
+func (s *serviceRunResult) FailedStage() string { return s.failedStage }
+
+// The values are doubled here because of the ON CONFLICT...UPDATE clause
+func (s *serviceRunResult) insertValues() []any {
+	success := boolToInt(s.success)
+	return []any{s.service, success, s.failedStage, s.runStart, success, s.failedStage, s.runStart}
+}
+
+func (s *serviceRunResult) unpackDataRow(resultRow []any) (dataRowUnpacker, error) {
+	// Make sure we have the right number of values
+	if len(resultRow) != 3 {
+		msg := "service run result data has wrong structure"
+		log.Errorf("%s: %v", msg, resultRow)
+		return nil, errDatabaseDataWrongStructure
+	}
+	// Type check each element
+	serviceVal, serviceTypeOk := resultRow[0].(string)
+	successVal, successTypeOk := resultRow[1].(int64)
+	failedStageVal, failedStageTypeOk := resultRow[2].(string)
+	if !(serviceTypeOk && successTypeOk && failedStageTypeOk) {
+		msg := "service run results query result has wrong type.  Expected (string, int64, string)"
+		log.Errorf("%s: got (%T, %T, %T)", msg, resultRow[0], resultRow[1], resultRow[2])
+		return nil, errDatabaseDataWrongType
+	}
+	log.Debugf("Got ServiceRunResult row: %s, %d, %s", serviceVal, successVal, failedStageVal)
+	return &serviceRunResult{service: serviceVal, success: successVal != 0, failedStage: failedStageVal}, nil
+}
+
+// GetServiceRunResults queries the ManagedTokensDatabase for the result of the last run of each service.  It returns the data in the form of
+// a slice of ServiceRunResults that the caller can unpack using the interface methods Service(), Success(), and FailedStage()
+func (m *ManagedTokensDatabase) GetServiceRunResults(ctx context.Context) ([]ServiceRunResult, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "db.GetServiceRunResults")
+	span.SetAttributes(attribute.String("dbLocation", m.filename))
+	defer span.End()
+
+	funcLogger := log.WithField("dbLocation", m.filename)
+	data, err := getValuesTransactionRunner(ctx, m.db, getServiceRunResultsStatement)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not get service run results from ManagedTokensDatabase")
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		funcLogger.Debug("No service run results in database")
+		return nil, sql.ErrNoRows
+	}
+
+	// Unpack data
+	unpackedData, err := unpackData[*serviceRunResult](data)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Error unpacking serviceRunResult data")
+		return nil, err
+	}
+	convertedData := make([]ServiceRunResult, 0, len(unpackedData))
+	for _, datum := range unpackedData {
+		convertedData = append(convertedData, datum)
+	}
+	tracing.LogSuccessWithTrace(span, funcLogger, "Got service run results from ManagedTokensDatabase")
+	return convertedData, nil
+}
+
+// UpdateServiceRunResultsTable records the results of the run that started at runStart for the given services in the ManagedTokensDatabase,
+// replacing the results of any earlier run for those services
+func (m *ManagedTokensDatabase) UpdateServiceRunResultsTable(ctx context.Context, runStart time.Time, results []ServiceRunResult) error {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "db.UpdateServiceRunResultsTable")
+	span.SetAttributes(attribute.String("dbLocation", m.filename))
+	defer span.End()
+
+	funcLogger := log.WithField("dbLocation", m.filename)
+
+	data := make([]insertValues, 0, len(results))
+	for _, datum := range results {
+		data = append(data,
+			&serviceRunResult{
+				service:     datum.Service(),
+				success:     datum.Success(),
+				failedStage: datum.FailedStage(),
+				runStart:    int(runStart.Unix()),
+			})
+	}
+
+	if err := insertValuesTransactionRunner(ctx, m.db, insertOrUpdateServiceRunResultsStatement, data); err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not update service run results in ManagedTokensDatabase")
+		return err
+	}
+	tracing.LogSuccessWithTrace(span, funcLogger, "Updated service run results in ManagedTokensDatabase")
+	return nil
+}
+
+// Node push results
+
+// NodePushResult is an interface that wraps the Service, Node, and Success methods.  It is meant to be used both by this package and
+// importing packages to store and retrieve whether pushing a service's vault token to a node succeeded in the last run for that service.
+type NodePushResult interface {
+	Service() string
+	Node() string
+	Success() bool
+}
+
+// nodePushResult is an internal-facing type that implements both NodePushResult and insertValues
+type nodePushResult struct {
+	service  string
+	node     string
+	success  bool
+	runStart int
+}
+
+func (n *nodePushResult) Service() string { return n.service }
+func (n *nodePushResult) Node() string    { return n.node }
+func (n *nodePushResult) Success() bool   { return n.success }
+
+// The values are doubled here because of the ON CONFLICT...UPDATE clause
+func (n *nodePushResult) insertValues() []any {
+	success := boolToInt(n.success)
+	return []any{n.service, n.node, success, n.runStart, success, n.runStart}
+}
+
+func (n *nodePushResult) unpackDataRow(resultRow []any) (dataRowUnpacker, error) {
+	// Make sure we have the right number of values
+	if len(resultRow) != 3 {
+		msg := "node push result data has wrong structure"
+		log.Errorf("%s: %v", msg, resultRow)
+		return nil, errDatabaseDataWrongStructure
+	}
+	// Type check each element
+	serviceVal, serviceTypeOk := resultRow[0].(string)
+	nodeVal, nodeTypeOk := resultRow[1].(string)
+	successVal, successTypeOk := resultRow[2].(int64)
+	if !(serviceTypeOk && nodeTypeOk && successTypeOk) {
+		msg := "node push results query result has wrong type.  Expected (string, string, int64)"
+		log.Errorf("%s: got (%T, %T, %T)", msg, resultRow[0], resultRow[1], resultRow[2])
+		return nil, errDatabaseDataWrongType
+	}
+	log.Debugf("Got NodePushResult row: %s, %s, %d", serviceVal, nodeVal, successVal)
+	return &nodePushResult{service: serviceVal, node: nodeVal, success: successVal != 0}, nil
+}
+
+// GetNodePushResults queries the ManagedTokensDatabase for the node push results that were recorded in the last run of each service.
+// It returns the data in the form of a slice of NodePushResults that the caller can unpack using the interface methods Service(),
+// Node(), and Success()
+func (m *ManagedTokensDatabase) GetNodePushResults(ctx context.Context) ([]NodePushResult, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "db.GetNodePushResults")
+	span.SetAttributes(attribute.String("dbLocation", m.filename))
+	defer span.End()
+
+	funcLogger := log.WithField("dbLocation", m.filename)
+	data, err := getValuesTransactionRunner(ctx, m.db, getNodePushResultsStatement)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not get node push results from ManagedTokensDatabase")
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		funcLogger.Debug("No node push results in database")
+		return nil, sql.ErrNoRows
+	}
+
+	// Unpack data
+	unpackedData, err := unpackData[*nodePushResult](data)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Error unpacking nodePushResult data")
+		return nil, err
+	}
+	convertedData := make([]NodePushResult, 0, len(unpackedData))
+	for _, datum := range unpackedData {
+		convertedData = append(convertedData, datum)
+	}
+	tracing.LogSuccessWithTrace(span, funcLogger, "Got node push results from ManagedTokensDatabase")
+	return convertedData, nil
+}
+
+// UpdateNodePushResultsTable records the node push results of the run that started at runStart in the ManagedTokensDatabase.  It should be
+// called after UpdateServiceRunResultsTable for the same run, so that GetNodePushResults returns these results.
+func (m *ManagedTokensDatabase) UpdateNodePushResultsTable(ctx context.Context, runStart time.Time, results []NodePushResult) error {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "db.UpdateNodePushResultsTable")
+	span.SetAttributes(attribute.String("dbLocation", m.filename))
+	defer span.End()
+
+	funcLogger := log.WithField("dbLocation", m.filename)
+
+	data := make([]insertValues, 0, len(results))
+	for _, datum := range results {
+		data = append(data,
+			&nodePushResult{
+				service:  datum.Service(),
+				node:     datum.Node(),
+				success:  datum.Success(),
+				runStart: int(runStart.Unix()),
+			})
+	}
+
+	if err := insertValuesTransactionRunner(ctx, m.db, insertOrUpdateNodePushResultsStatement, data); err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Could not update node push results in ManagedTokensDatabase")
+		return err
+	}
+	tracing.LogSuccessWithTrace(span, funcLogger, "Updated node push results in ManagedTokensDatabase")
+	return nil
+}
+
+// boolToInt converts a bool to the integer that we store for it in the database
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestServiceRunResults checks that the service run results we store with UpdateServiceRunResultsTable are returned by
+// GetServiceRunResults, and that storing the results of a later run replaces the earlier results
+func TestServiceRunResults(t *testing.T) {
+	ctx := context.Background()
+	m, err := OpenOrCreateDatabase(path.Join(t.TempDir(), fmt.Sprintf("managed-tokens-test-%d.db", rand.Intn(10000))))
+	if err != nil {
+		t.Fatalf("Could not create new database, %s", err)
+	}
+	defer m.Close()
+
+	_, err = m.GetServiceRunResults(ctx)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	if err := m.UpdateServices(ctx, []string{"foo", "bar"}); err != nil {
+		t.Fatalf("Could not insert services into database: %s", err)
+	}
+
+	firstRun := time.Unix(1000, 0)
+	results := []ServiceRunResult{
+		&serviceRunResult{service: "foo", success: true},
+		&serviceRunResult{service: "bar", success: false, failedStage: "getToken"},
+	}
+	assert.NoError(t, m.UpdateServiceRunResultsTable(ctx, firstRun, results))
+	got, err := m.GetServiceRunResults(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, results, got)
+
+	secondRun := time.Unix(2000, 0)
+	results = []ServiceRunResult{&serviceRunResult{service: "foo", success: false, failedStage: "pushTokens"}}
+	assert.NoError(t, m.UpdateServiceRunResultsTable(ctx, secondRun, results))
+	got, err = m.GetServiceRunResults(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t,
+		[]ServiceRunResult{
+			&serviceRunResult{service: "foo", success: false, failedStage: "pushTokens"},
+			&serviceRunResult{service: "bar", success: false, failedStage: "getToken"},
+		},
+		got,
+	)
+}
+
+// TestNodePushResults checks that GetNodePushResults only returns the node push results that were recorded in the same run as
+// each service's last run result
+func TestNodePushResults(t *testing.T) {
+	ctx := context.Background()
+	m, err := OpenOrCreateDatabase(path.Join(t.TempDir(), fmt.Sprintf("managed-tokens-test-%d.db", rand.Intn(10000))))
+	if err != nil {
+		t.Fatalf("Could not create new database, %s", err)
+	}
+	defer m.Close()
+
+	_, err = m.GetNodePushResults(ctx)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	if err := m.UpdateServices(ctx, []string{"foo", "bar"}); err != nil {
+		t.Fatalf("Could not insert services into database: %s", err)
+	}
+	if err := m.UpdateNodes(ctx, []string{"node1", "node2"}); err != nil {
+		t.Fatalf("Could not insert nodes into database: %s", err)
+	}
+
+	// In the first run, both services got to pushing tokens
+	firstRun := time.Unix(1000, 0)
+	assert.NoError(t, m.UpdateServiceRunResultsTable(ctx, firstRun, []ServiceRunResult{
+		&serviceRunResult{service: "foo", success: false, failedStage: "pushTokens"},
+		&serviceRunResult{service: "bar", success: true},
+	}))
+	assert.NoError(t, m.UpdateNodePushResultsTable(ctx, firstRun, []NodePushResult{
+		&nodePushResult{service: "foo", node: "node1", success: true},
+		&nodePushResult{service: "foo", node: "node2", success: false},
+		&nodePushResult{service: "bar", node: "node1", success: true},
+	}))
+	got, err := m.GetNodePushResults(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, got, 3)
+
+	// In the second run, bar failed before pushing tokens, so its node push results from the first run should not be returned
+	secondRun := time.Unix(2000, 0)
+	assert.NoError(t, m.UpdateServiceRunResultsTable(ctx, secondRun, []ServiceRunResult{
+		&serviceRunResult{service: "foo", success: false, failedStage: "pushTokens"},
+		&serviceRunResult{service: "bar", success: false, failedStage: "getToken"},
+	}))
+	assert.NoError(t, m.UpdateNodePushResultsTable(ctx, secondRun, []NodePushResult{
+		&nodePushResult{service: "foo", node: "node1", success: false},
+		&nodePushResult{service: "foo", node: "node2", success: true},
+	}))
+	got, err = m.GetNodePushResults(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t,
+		[]NodePushResult{
+			&nodePushResult{service: "foo", node: "node1", success: false},
+			&nodePushResult{service: "foo", node: "node2", success: true},
+		},
+		got,
+	)
+}
+
+func TestUnpackServiceRunResultDataRow(t *testing.T) {
+	s := &serviceRunResult{}
+	datum, err := s.unpackDataRow([]any{"foo", int64(0), "getToken"})
+	assert.NoError(t, err)
+	assert.Equal(t, &serviceRunResult{service: "foo", failedStage: "getToken"}, datum)
+
+	_, err = s.unpackDataRow([]any{"foo", int64(0)})
+	assert.True(t, errors.Is(err, errDatabaseDataWrongStructure))
+	_, err = s.unpackDataRow([]any{"foo", true, "getToken"})
+	assert.True(t, errors.Is(err, errDatabaseDataWrongType))
+}
+
+func TestUnpackNodePushResultDataRow(t *testing.T) {
+	n := &nodePushResult{}
+	datum, err := n.unpackDataRow([]any{"foo", "node1", int64(1)})
+	assert.NoError(t, err)
+	assert.Equal(t, &nodePushResult{service: "foo", node: "node1", success: true}, datum)
+
+	_, err = n.unpackDataRow([]any{"foo", "node1"})
+	assert.True(t, errors.Is(err, errDatabaseDataWrongStructure))
+	_, err = n.unpackDataRow([]any{"foo", 1, int64(1)})
+	assert.True(t, errors.Is(err, errDatabaseDataWrongType))
+}
@@ -0,0 +1,101 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileCopier
+
+import (
+	"regexp"
+
+	"github.com/fermitools/managed-tokens/internal/utils"
+)
+
+// ErrSSHAuth is returned when the file copier could not authenticate to the destination node over ssh
+type ErrSSHAuth struct{ utils.CommandError }
+
+func (e *ErrSSHAuth) Error() string {
+	return e.Message("ssh authentication to destination node failed")
+}
+
+// Remediation returns the suggested action to take when ssh authentication fails
+func (e *ErrSSHAuth) Remediation() string {
+	return "Check that the destination account's .k5login (or authorized keys) allows the service's kerberos principal, and that the node's host key is known"
+}
+
+// ErrHostUnreachable is returned when the file copier could not reach the destination node
+type ErrHostUnreachable struct{ utils.CommandError }
+
+func (e *ErrHostUnreachable) Error() string { return e.Message("could not reach destination node") }
+
+// Remediation returns the suggested action to take when the destination node could not be reached
+func (e *ErrHostUnreachable) Remediation() string {
+	return "Check that the destination node is up, and that its ssh server is reachable from the Managed Tokens host"
+}
+
+// ErrRemotePermissionDenied is returned when the destination account may not write the file at its destination on the node
+type ErrRemotePermissionDenied struct{ utils.CommandError }
+
+func (e *ErrRemotePermissionDenied) Error() string {
+	return e.Message("permission denied writing file on destination node")
+}
+
+// Remediation returns the suggested action to take when writing the file on the destination node is not permitted
+func (e *ErrRemotePermissionDenied) Remediation() string {
+	return "Check the ownership and permissions of the destination path, and of any existing file there, for the destination account"
+}
+
+// ErrDiskFull is returned when the destination node has no room left for the file
+type ErrDiskFull struct{ utils.CommandError }
+
+func (e *ErrDiskFull) Error() string { return e.Message("no space left on destination node") }
+
+// Remediation returns the suggested action to take when the destination node has no room for the file
+func (e *ErrDiskFull) Remediation() string {
+	return "Free up space, or raise the destination account's quota, on the filesystem holding the destination path"
+}
+
+// ErrTimeout is returned when copying the file did not finish before its deadline.  It wraps context.DeadlineExceeded.
+type ErrTimeout struct{ utils.CommandError }
+
+func (e *ErrTimeout) Error() string { return e.Message("timed out copying file to destination node") }
+
+// Remediation returns the suggested action to take when copying the file times out
+func (e *ErrTimeout) Remediation() string {
+	return "Check the load and network latency of the destination node, and raise pushTimeout if it is just slow"
+}
+
+var (
+	sshAuthRegexp                = regexp.MustCompile(`Permission denied \([a-z-]+(,[a-z-]+)*\)|Host key verification failed|Too many authentication failures`)
+	hostUnreachableRegexp        = regexp.MustCompile(`(?i)could not resolve hostname|no route to host|connection refused|connection timed out|network is unreachable|name or service not known`)
+	diskFullRegexp               = regexp.MustCompile(`(?i)no space left on device|disk quota exceeded`)
+	remotePermissionDeniedRegexp = regexp.MustCompile(`(?i)permission denied \(13\)|rsync.*permission denied`)
+)
+
+// classifyCopyError returns the typed error for a failed copy with output output and error err, or err itself if the failure
+// could not be classified
+func classifyCopyError(output []byte, err error) error {
+	c := utils.CommandError{Output: string(output), Err: err}
+	switch {
+	case sshAuthRegexp.Match(output):
+		return &ErrSSHAuth{c}
+	case hostUnreachableRegexp.Match(output):
+		return &ErrHostUnreachable{c}
+	case diskFullRegexp.Match(output):
+		return &ErrDiskFull{c}
+	case remotePermissionDeniedRegexp.Match(output):
+		return &ErrRemotePermissionDenied{c}
+	default:
+		return err
+	}
+}
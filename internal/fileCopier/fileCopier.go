@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"text/template"
@@ -45,10 +46,46 @@ type fileCopier interface {
 	copyToDestination(ctx context.Context) error
 }
 
+// SSHFileCopierOption is a functional option that can be given to NewSSHFileCopier to change how it connects to the node
+type SSHFileCopierOption func(*sshConnection)
+
+// sshConnection holds the settings of the ssh connection to a node that aren't given as ssh options
+type sshConnection struct {
+	port     int
+	jumpHost string
+}
+
+// WithPort returns an SSHFileCopierOption that connects to the node's ssh server on the given port, instead of the default port
+func WithPort(port int) SSHFileCopierOption {
+	return func(s *sshConnection) { s.port = port }
+}
+
+// WithJumpHost returns an SSHFileCopierOption that connects to the node through the given jump host (bastion), e.g. user@host:port
+func WithJumpHost(jumpHost string) SSHFileCopierOption {
+	return func(s *sshConnection) { s.jumpHost = jumpHost }
+}
+
+// sshOptions returns the ssh options that correspond to the settings of the connection
+func (s *sshConnection) sshOptions() []string {
+	opts := make([]string, 0)
+	if s.port != 0 {
+		opts = append(opts, "-o", fmt.Sprintf("Port=%d", s.port))
+	}
+	if s.jumpHost != "" {
+		opts = append(opts, "-o", "ProxyJump="+s.jumpHost)
+	}
+	return opts
+}
+
 // NewSSHFileCopier returns a FileCopier object that copies a file via ssh
-func NewSSHFileCopier(source, account, node, destination string, fileCopierOptions []string, sshOptions []string, env environment.CommandEnvironment) *rsyncSetup {
+func NewSSHFileCopier(source, account, node, destination string, fileCopierOptions []string, sshOptions []string, env environment.CommandEnvironment, opts ...SSHFileCopierOption) *rsyncSetup {
+	conn := new(sshConnection)
+	for _, opt := range opts {
+		opt(conn)
+	}
+
 	// Default ssh options
-	sshOpts := mergeSshOpts(sshOptions)
+	sshOpts := mergeSshOpts(slices.Concat(sshOptions, conn.sshOptions()))
 	sshOptsString := strings.Join(sshOpts, " ")
 
 	// We don't have any default fileCopierOptions, so we just use whatever is passed in
@@ -168,15 +205,19 @@ func rsyncFile(ctx context.Context, source, node, account, dest, sshOptions, rsy
 		"environment": environ.String(),
 	}).Debug("Running commmand to rsync file")
 
-	if err := cmd.Run(); err != nil {
+	if output, err := cmd.CombinedOutput(); err != nil {
 		msg := fmt.Sprintf("rsync command failed: %s", err.Error())
 		tracing.LogErrorWithTrace(
 			span,
 			funcLogger,
 			msg,
 			tracing.KeyValueForLog{Key: "command", Value: cmd.String()},
+			tracing.KeyValueForLog{Key: "output", Value: string(output)},
 		)
-		return errors.New(msg)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return &ErrTimeout{utils.CommandError{Output: string(output), Err: ctx.Err()}}
+		}
+		return classifyCopyError(output, errors.New(msg))
 	}
 
 	log.WithFields(log.Fields{
@@ -22,6 +22,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/environment"
 )
 
 type fakeCopierProtocolSetup struct {
@@ -142,6 +144,22 @@ func TestMergeSshArgs(t *testing.T) {
 
 }
 
+func TestNewSSHFileCopierConnectionOptions(t *testing.T) {
+	env := environment.CommandEnvironment{}
+
+	f := NewSSHFileCopier("source", "account", "node", "destination", nil, []string{"MyArg=value"}, env)
+	assert.NotContains(t, f.sshOpts, "Port=")
+	assert.NotContains(t, f.sshOpts, "ProxyJump=")
+
+	f = NewSSHFileCopier("source", "account", "node", "destination", nil, []string{"MyArg=value"}, env,
+		WithPort(2222),
+		WithJumpHost("user@bastion"),
+	)
+	assert.Contains(t, f.sshOpts, "-o MyArg=value")
+	assert.Contains(t, f.sshOpts, "-o Port=2222")
+	assert.Contains(t, f.sshOpts, "-o ProxyJump=user@bastion")
+}
+
 func TestPreProcessSshOpts(t *testing.T) {
 	type testCase struct {
 		description  string
@@ -277,3 +295,49 @@ func TestCorrectMergedSshOpts(t *testing.T) {
 // 		t.Errorf("Test destination file %s does not exist", destFile)
 // 	}
 // }
+
+func TestClassifyCopyError(t *testing.T) {
+	underlying := errors.New("rsync command failed: exit status 255")
+	testCases := []struct {
+		description string
+		output      string
+		checkFunc   func(error) bool
+	}{
+		{
+			"ssh auth failure",
+			"user@node: Permission denied (publickey,gssapi-keyex,gssapi-with-mic).\nrsync: connection unexpectedly closed",
+			func(err error) bool { var e *ErrSSHAuth; return errors.As(err, &e) },
+		},
+		{
+			"host unreachable",
+			"ssh: connect to host node port 22: No route to host",
+			func(err error) bool { var e *ErrHostUnreachable; return errors.As(err, &e) },
+		},
+		{
+			"remote permission denied",
+			`rsync: [receiver] mkstemp "/tmp/.vt_u1234.abcdef" failed: Permission denied (13)`,
+			func(err error) bool { var e *ErrRemotePermissionDenied; return errors.As(err, &e) },
+		},
+		{
+			"disk full",
+			`rsync: [receiver] write failed on "/tmp/vt_u1234": No space left on device (28)`,
+			func(err error) bool { var e *ErrDiskFull; return errors.As(err, &e) },
+		},
+		{
+			"unclassified",
+			"something else happened",
+			func(err error) bool { return err == underlying },
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(
+			test.description,
+			func(t *testing.T) {
+				err := classifyCopyError([]byte(test.output), underlying)
+				assert.True(t, test.checkFunc(err), fmt.Sprintf("Got wrong error type %T", err))
+				assert.ErrorIs(t, err, underlying)
+			},
+		)
+	}
+}
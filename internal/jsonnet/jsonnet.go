@@ -0,0 +1,139 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jsonnet evaluates the jsonnet configuration files of the managed tokens executables, so that they can be read in without first
+// compiling them to JSON or YAML
+package jsonnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/fermitools/managed-tokens/internal/tracing"
+)
+
+// DefaultImportPath is the directory that the libsonnet libraries are installed under.  Configuration files import them as
+// libsonnet/<library>.libsonnet, relative to this directory or to the directory of the configuration file itself.
+const DefaultImportPath = "/etc/managed-tokens"
+
+// IsJsonnetFile returns whether the file at path is a jsonnet file, based on its extension
+func IsJsonnetFile(path string) bool {
+	return filepath.Ext(path) == ".jsonnet"
+}
+
+// evaluateConfig holds the settings that a jsonnet file is evaluated with
+type evaluateConfig struct {
+	extVars     map[string]string
+	importPaths []string
+}
+
+// EvaluateOption is a functional option that changes how EvaluateFile evaluates a jsonnet file
+type EvaluateOption func(*evaluateConfig) error
+
+// WithExtVar sets the external variable key, which the jsonnet file can read with std.extVar(key), to value.  The value can be a
+// secret, so it is never logged.
+func WithExtVar(key, value string) EvaluateOption {
+	return func(e *evaluateConfig) error {
+		if key == "" {
+			return errors.New("jsonnet external variable name cannot be empty")
+		}
+		e.extVars[key] = value
+		return nil
+	}
+}
+
+// WithExtVarAssignment sets an external variable from an assignment of the form key=value, like the jsonnet --ext-str flag
+func WithExtVarAssignment(assignment string) EvaluateOption {
+	return func(e *evaluateConfig) error {
+		key, value, found := strings.Cut(assignment, "=")
+		if !found {
+			return fmt.Errorf("jsonnet external variable %s is not of the form key=value", assignment)
+		}
+		return WithExtVar(key, value)(e)
+	}
+}
+
+// WithImportPaths adds directories to search for imported files in.  Directories that are added first are searched first.
+func WithImportPaths(paths ...string) EvaluateOption {
+	return func(e *evaluateConfig) error {
+		e.importPaths = append(e.importPaths, paths...)
+		return nil
+	}
+}
+
+// EvaluateFile evaluates the jsonnet file at path, and returns the resulting JSON document.  Imports are resolved relative to the
+// file's directory, then in the import paths given with WithImportPaths, and then in DefaultImportPath.
+func EvaluateFile(ctx context.Context, path string, opts ...EvaluateOption) ([]byte, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "jsonnet.EvaluateFile")
+	span.SetAttributes(attribute.String("path", path))
+	defer span.End()
+
+	funcLogger := log.WithField("path", path)
+
+	e := &evaluateConfig{extVars: make(map[string]string)}
+	for _, opt := range opts {
+		if err := opt(e); err != nil {
+			tracing.LogErrorWithTrace(span, funcLogger, fmt.Sprintf("Could not apply jsonnet evaluation option: %s", err))
+			return nil, err
+		}
+	}
+	e.importPaths = append(e.importPaths, DefaultImportPath)
+
+	// The external variables can hold secrets, so only their names are logged and traced
+	extVarNames := slices.Sorted(maps.Keys(e.extVars))
+	span.SetAttributes(attribute.StringSlice("extVars", extVarNames))
+	funcLogger.WithFields(log.Fields{
+		"extVars":     extVarNames,
+		"importPaths": e.importPaths,
+	}).Debug("Evaluating jsonnet file")
+
+	// The evaluation itself can't be canceled, so we only check the context before we start
+	if err := ctx.Err(); err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, fmt.Sprintf("Context error: %s", err.Error()))
+		return nil, err
+	}
+
+	out, err := e.vm().EvaluateFile(path)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, fmt.Sprintf("Could not evaluate jsonnet file: %s", strings.TrimSpace(err.Error())))
+		return nil, fmt.Errorf("could not evaluate jsonnet file %s: %w", path, err)
+	}
+	span.SetStatus(codes.Ok, "Evaluated jsonnet file")
+	return []byte(out), nil
+}
+
+// vm returns a *jsonnet.VM that evaluates files with the external variables and import paths of e
+func (e *evaluateConfig) vm() *jsonnet.VM {
+	vm := jsonnet.MakeVM()
+	for key, value := range e.extVars {
+		vm.ExtVar(key, value)
+	}
+	// The FileImporter searches the import paths from the last one to the first
+	jPaths := slices.Clone(e.importPaths)
+	slices.Reverse(jPaths)
+	vm.Importer(&jsonnet.FileImporter{JPaths: jPaths})
+	return vm
+}
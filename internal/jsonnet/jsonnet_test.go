@@ -0,0 +1,106 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonnet
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsJsonnetFile(t *testing.T) {
+	assert.True(t, IsJsonnetFile("/etc/managed-tokens/managedTokens.jsonnet"))
+	assert.False(t, IsJsonnetFile("/etc/managed-tokens/managedTokens.yml"))
+	assert.False(t, IsJsonnetFile("libsonnet/experimentConfig.libsonnet"))
+}
+
+func TestEvaluateOptions(t *testing.T) {
+	e := &evaluateConfig{extVars: make(map[string]string)}
+	for _, opt := range []EvaluateOption{
+		WithExtVar("b", "2"),
+		WithExtVarAssignment("a=1=one"),
+		WithImportPaths("/first", "/second"),
+	} {
+		assert.NoError(t, opt(e))
+	}
+	assert.Equal(t, map[string]string{"a": "1=one", "b": "2"}, e.extVars)
+	assert.Equal(t, []string{"/first", "/second"}, e.importPaths)
+
+	assert.Error(t, WithExtVarAssignment("novalue")(e))
+	assert.Error(t, WithExtVar("", "value")(e))
+}
+
+// TestEvaluateFile evaluates a jsonnet file that imports libraries from the import paths and reads an external variable.  The value of
+// the external variable must not show up in the logs.
+func TestEvaluateFile(t *testing.T) {
+	configDir, firstLibDir, secondLibDir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFile := func(path, contents string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configFile := filepath.Join(configDir, "config.jsonnet")
+	writeFile(configFile, `{
+  first: (import "libsonnet/first.libsonnet").name,
+  second: (import "libsonnet/second.libsonnet").name,
+  secret: std.extVar("secret"),
+}`)
+	// Imports are resolved relative to the file first, and then in the import paths in the order they were given
+	writeFile(filepath.Join(configDir, "libsonnet", "first.libsonnet"), `{name: "configDir"}`)
+	writeFile(filepath.Join(firstLibDir, "libsonnet", "first.libsonnet"), `{name: "firstLibDir"}`)
+	writeFile(filepath.Join(firstLibDir, "libsonnet", "second.libsonnet"), `{name: "firstLibDir"}`)
+	writeFile(filepath.Join(secondLibDir, "libsonnet", "second.libsonnet"), `{name: "secondLibDir"}`)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	log.SetLevel(log.DebugLevel)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetLevel(log.InfoLevel)
+	})
+
+	out, err := EvaluateFile(context.Background(), configFile, WithImportPaths(firstLibDir, secondLibDir), WithExtVar("secret", "hunter2"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"first": "configDir", "second": "firstLibDir", "secret": "hunter2"}`, string(out))
+	assert.Contains(t, logs.String(), "secret")
+	assert.NotContains(t, logs.String(), "hunter2")
+
+	failingFile := filepath.Join(configDir, "failing.jsonnet")
+	writeFile(failingFile, `error "failed"`)
+	_, err = EvaluateFile(context.Background(), failingFile)
+	assert.ErrorContains(t, err, "RUNTIME ERROR: failed")
+
+	extVarFile := filepath.Join(configDir, "extVar.jsonnet")
+	writeFile(extVarFile, `std.extVar("secret")`)
+	_, err = EvaluateFile(context.Background(), extVarFile)
+	assert.ErrorContains(t, err, "Undefined external variable: secret")
+
+	_, err = EvaluateFile(context.Background(), configFile, WithExtVarAssignment("novalue"))
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = EvaluateFile(ctx, configFile, WithExtVar("secret", "hunter2"))
+	assert.ErrorIs(t, err, context.Canceled)
+}
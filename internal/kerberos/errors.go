@@ -0,0 +1,74 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kerberos
+
+import (
+	"regexp"
+
+	"github.com/fermitools/managed-tokens/internal/utils"
+)
+
+// ErrKDCUnreachable is returned when kinit could not reach any KDC for the principal's realm
+type ErrKDCUnreachable struct{ utils.CommandError }
+
+func (e *ErrKDCUnreachable) Error() string { return e.Message("could not reach kerberos KDC") }
+
+// Remediation returns the suggested action to take when the KDC could not be reached
+func (e *ErrKDCUnreachable) Remediation() string {
+	return "Check that the kerberos KDCs for the principal's realm are up and reachable from the Managed Tokens host"
+}
+
+// ErrBadKeytabOrPrincipal is returned when a kerberos ticket could not be obtained with the keytab and principal, or when the
+// principal in the kerberos cache is not the configured one
+type ErrBadKeytabOrPrincipal struct{ utils.CommandError }
+
+func (e *ErrBadKeytabOrPrincipal) Error() string {
+	return e.Message("bad keytab or kerberos principal")
+}
+
+// Remediation returns the suggested action to take when the keytab or principal is bad
+func (e *ErrBadKeytabOrPrincipal) Remediation() string {
+	return "Check that the keytab exists, is readable by the Managed Tokens user, and has current keys for the configured kerberos principal"
+}
+
+// ErrTimeout is returned when a kerberos command did not finish before its deadline.  It wraps context.DeadlineExceeded.
+type ErrTimeout struct{ utils.CommandError }
+
+func (e *ErrTimeout) Error() string { return e.Message("timed out running kerberos command") }
+
+// Remediation returns the suggested action to take when a kerberos command times out
+func (e *ErrTimeout) Remediation() string {
+	return "Check the response time of the kerberos KDCs, and raise kerberosTimeout if they are just slow"
+}
+
+var (
+	kdcUnreachableRegexp       = regexp.MustCompile(`Cannot contact any KDC|Cannot find KDC|Cannot resolve network address for KDC`)
+	badKeytabOrPrincipalRegexp = regexp.MustCompile(`Keytab contains no suitable keys|Key table file .* not found|Key table entry not found|No key table entry found|Client .* not found in Kerberos database|Preauthentication failed|Password incorrect|Unsupported key table format`)
+)
+
+// classifyKinitError returns the typed error for a failed kinit run with output output and error err, or err itself if the failure
+// could not be classified
+func classifyKinitError(output []byte, err error) error {
+	c := utils.CommandError{Output: string(output), Err: err}
+	switch {
+	case kdcUnreachableRegexp.Match(output):
+		return &ErrKDCUnreachable{c}
+	case badKeytabOrPrincipalRegexp.Match(output):
+		return &ErrBadKeytabOrPrincipal{c}
+	default:
+		return err
+	}
+}
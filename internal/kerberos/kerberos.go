@@ -71,11 +71,11 @@ func GetTicket(ctx context.Context, keytabPath, userPrincipal string, environ en
 	if stdoutstdErr, err := createKerberosTicket.CombinedOutput(); err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			tracing.LogErrorWithTrace(span, funcLogger, "Context timeout")
-			return ctx.Err()
+			return &ErrTimeout{utils.CommandError{Output: string(stdoutstdErr), Err: ctx.Err()}}
 		}
 		tracing.LogErrorWithTrace(span, funcLogger, "Error running kinit to create new kerberos ticket")
 		funcLogger.Errorf("%s", stdoutstdErr)
-		return err
+		return classifyKinitError(stdoutstdErr, err)
 	}
 	tracing.LogSuccessWithTrace(span, funcLogger, "Successfully created new kerberos ticket")
 	return nil
@@ -95,7 +95,7 @@ func CheckPrincipal(ctx context.Context, checkPrincipal string, environ environm
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			tracing.LogErrorWithTrace(span, funcLogger, "Context timeout")
-			return ctx.Err()
+			return &ErrTimeout{utils.CommandError{Output: string(stdoutStderr), Err: ctx.Err()}}
 		}
 		tracing.LogErrorWithTrace(span, funcLogger, "Error running klist to check kerberos principal")
 		funcLogger.Error(stdoutStderr)
@@ -114,7 +114,7 @@ func CheckPrincipal(ctx context.Context, checkPrincipal string, environ environm
 	if principal != checkPrincipal {
 		err := fmt.Errorf("klist yielded a principal that did not match the configured user prinicpal.  Expected %s, got %s", checkPrincipal, principal)
 		tracing.LogErrorWithTrace(span, funcLogger, err.Error())
-		return err
+		return &ErrBadKeytabOrPrincipal{utils.CommandError{Output: string(stdoutStderr), Err: err}}
 	}
 	tracing.LogSuccessWithTrace(span, funcLogger, "Kerberos principal matches configured principal")
 	return nil
@@ -16,6 +16,7 @@
 package kerberos
 
 import (
+	"errors"
 	"slices"
 	"testing"
 )
@@ -76,3 +77,50 @@ func TestGetKerberosPrincipalFromKerbListOutput(t *testing.T) {
 		)
 	}
 }
+
+func TestClassifyKinitError(t *testing.T) {
+	underlying := errors.New("exit status 1")
+	type testCase struct {
+		description string
+		output      []byte
+		checkFunc   func(error) bool
+	}
+
+	testCases := []testCase{
+		{
+			"KDC unreachable",
+			[]byte("kinit: Cannot contact any KDC for realm 'FNAL.GOV' while getting initial credentials"),
+			func(err error) bool { var e *ErrKDCUnreachable; return errors.As(err, &e) },
+		},
+		{
+			"Bad keytab",
+			[]byte("kinit: Key table file '/path/to/keytab' not found while getting initial credentials"),
+			func(err error) bool { var e *ErrBadKeytabOrPrincipal; return errors.As(err, &e) },
+		},
+		{
+			"Bad principal",
+			[]byte("kinit: Client 'user@FNAL.GOV' not found in Kerberos database while getting initial credentials"),
+			func(err error) bool { var e *ErrBadKeytabOrPrincipal; return errors.As(err, &e) },
+		},
+		{
+			"Unclassified error",
+			[]byte("something else happened"),
+			func(err error) bool { return err == underlying },
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(
+			test.description,
+			func(t *testing.T) {
+				err := classifyKinitError(test.output, underlying)
+				if !test.checkFunc(err) {
+					t.Errorf("Got wrong error type %T: %v", err, err)
+				}
+				if !errors.Is(err, underlying) {
+					t.Errorf("Expected error to wrap %v.  Got %v", underlying, err)
+				}
+			},
+		)
+	}
+}
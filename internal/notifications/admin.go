@@ -19,6 +19,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -179,6 +180,7 @@ func sendSlackNoErrorTestMessages(ctx context.Context, sendMessagers []SendMessa
 type AdminDataFinal struct {
 	SetupErrors     []string
 	PushErrorsTable string
+	ConfigChanges   []string
 }
 
 func prepareFullAndAbridgedMessages(operation string) (fullMessage string, abridgedMessage string, err error) {
@@ -191,15 +193,25 @@ func prepareFullAndAbridgedMessages(operation string) (fullMessage string, abrid
 	// If there are errors, prepare the long-form and abridged messages
 	// Prepare the full and abridged messages
 	adminErrorsMapFinal := prepareAdminErrorsForFullMessage()
+	// If the only thing we have to report is configuration changes, the message shouldn't say that there were errors
+	var hasErrors bool
+	for _, aData := range adminErrorsMapFinal {
+		if len(aData.SetupErrors) > 0 || aData.PushErrorsTable != "" {
+			hasErrors = true
+			break
+		}
+	}
 	fullMessageStruct := struct {
 		Timestamp   string
 		Operation   string
 		AdminErrors map[string]AdminDataFinal
+		HasErrors   bool
 		Abridged    bool
 	}{
 		Timestamp:   timestamp,
 		Operation:   operation,
 		AdminErrors: adminErrorsMapFinal,
+		HasErrors:   hasErrors,
 		Abridged:    false,
 	}
 	fullMessage, err = prepareMessageFromTemplate(strings.NewReader(adminErrorsTemplate), fullMessageStruct)
@@ -210,17 +222,21 @@ func prepareFullAndAbridgedMessages(operation string) (fullMessage string, abrid
 
 	setupErrorsCombined, pushErrorsCombined := prepareAbridgedAdminSlices()
 	abridgedMessageStruct := struct {
-		Timestamp           string
-		Operation           string
-		SetupErrorsCombined []string
-		PushErrorsCombined  []string
-		Abridged            bool
+		Timestamp             string
+		Operation             string
+		SetupErrorsCombined   []string
+		PushErrorsCombined    []string
+		ConfigChangesCombined []string
+		HasErrors             bool
+		Abridged              bool
 	}{
-		Timestamp:           timestamp,
-		Operation:           operation,
-		SetupErrorsCombined: setupErrorsCombined,
-		PushErrorsCombined:  pushErrorsCombined,
-		Abridged:            true,
+		Timestamp:             timestamp,
+		Operation:             operation,
+		SetupErrorsCombined:   setupErrorsCombined,
+		PushErrorsCombined:    pushErrorsCombined,
+		ConfigChangesCombined: prepareAbridgedConfigChanges(),
+		HasErrors:             hasErrors,
+		Abridged:              true,
 	}
 	abridgedMessage, err = prepareMessageFromTemplate(strings.NewReader(adminErrorsTemplate), abridgedMessageStruct)
 	if err != nil {
@@ -245,6 +261,7 @@ func prepareAdminErrorsForFullMessage() map[string]AdminDataFinal {
 				"The following is a list of nodes on which all vault tokens were not refreshed, and the corresponding roles for those failed token refreshes:",
 				[]string{"Node", "Error"},
 			),
+			ConfigChanges: aData.ConfigChanges,
 		}
 		adminErrorsMapFinal[service] = a
 	}
@@ -265,3 +282,16 @@ func prepareAbridgedAdminSlices() (setupErrorsCombined []string, pushErrorsCombi
 	}
 	return setupErrorsCombined, pushErrorsCombined
 }
+
+// prepareAbridgedConfigChanges takes the stored adminErrors and returns a sorted []string containing the configuration changes for all
+// services, each prefixed by the service name.  This is for abridged messages like slack messages.
+func prepareAbridgedConfigChanges() []string {
+	configChangesCombined := make([]string, 0)
+	for service, data := range adminErrorsToAdminDataUnsync() {
+		for _, configChange := range data.ConfigChanges {
+			configChangesCombined = append(configChangesCombined, fmt.Sprintf("%s: %s", service, configChange))
+		}
+	}
+	slices.Sort(configChangesCombined)
+	return configChangesCombined
+}
@@ -29,8 +29,9 @@ var (
 
 // adminData stores the information needed to generate the admin message
 type adminData struct {
-	SetupErrors []string
-	PushErrors  sync.Map
+	SetupErrors   []string
+	PushErrors    sync.Map
+	ConfigChanges []string
 }
 
 // addErrorToAdminErrors takes the passed in Notification, type-checks it, and adds it to the appropriate field of adminErrors
@@ -63,6 +64,20 @@ func addErrorToAdminErrors(n Notification) {
 				accumulatedAdminData.SetupErrors = append(accumulatedAdminData.SetupErrors, nValue.message)
 			}
 		}
+	// *configChanges are stored the same way as *setupErrors
+	case *configChange:
+		if data, loaded := adminErrors.errorsMap.LoadOrStore(
+			nValue.service,
+			&adminData{
+				ConfigChanges: []string{nValue.message},
+			},
+		); loaded {
+			if accumulatedAdminData, ok := data.(*adminData); !ok {
+				funcLogger.Panic("Invalid data stored in admin errors map.")
+			} else {
+				accumulatedAdminData.ConfigChanges = append(accumulatedAdminData.ConfigChanges, nValue.message)
+			}
+		}
 	// This case is a bit more complicated, since the pushErrors are stored in a sync.Map
 	case *pushError:
 		data, loaded := adminErrors.errorsMap.LoadOrStore(
@@ -97,8 +112,9 @@ func addErrorToAdminErrors(n Notification) {
 // adminDataUnsync is an intermediate data structure between adminData and AdminDataFinal that translates the adminData.PushErrors sync.Map
 // to a regular map[string]string
 type adminDataUnsync struct {
-	SetupErrors []string
-	PushErrors  map[string]string
+	SetupErrors   []string
+	PushErrors    map[string]string
+	ConfigChanges []string
 }
 
 // adminErrorsToAdminDataUnsync translates the accumulated adminErrors.errorsMap into a map[string]adminDataUnsync so that
@@ -128,8 +144,9 @@ func adminErrorsToAdminDataUnsync() map[string]adminDataUnsync {
 	// 2. Take adminErrorsMap, convert so that values are adminErrorUnsync objects.
 	for service, aData := range adminErrorsMap {
 		a := adminDataUnsync{
-			SetupErrors: aData.SetupErrors,
-			PushErrors:  make(map[string]string),
+			SetupErrors:   aData.SetupErrors,
+			PushErrors:    make(map[string]string),
+			ConfigChanges: aData.ConfigChanges,
 		}
 		aData.PushErrors.Range(func(node, err any) bool {
 			n, ok := node.(string)
@@ -153,7 +170,7 @@ func adminErrorsToAdminDataUnsync() map[string]adminDataUnsync {
 
 // isEmpty checks to see if a variable of type adminData has any data
 func (a *adminData) isEmpty() bool {
-	return ((len(a.SetupErrors) == 0) && (syncMapLength(&a.PushErrors) == 0))
+	return ((len(a.SetupErrors) == 0) && (syncMapLength(&a.PushErrors) == 0) && (len(a.ConfigChanges) == 0))
 }
 
 // adminErrorsIsEmpty checks to see if there are no adminErrors
@@ -331,7 +331,7 @@ func TestRunAdminNotificationHandler(t *testing.T) {
 	t.Run(
 		"If we send SourceNotification to AdminNotificationHandler, it should get forwarded on adminErrorChan",
 		func(t *testing.T) {
-			sn := SourceNotification{&setupError{"message1", "service1"}}
+			sn := SourceNotification{&setupError{message: "message1", service: "service1"}}
 
 			// Sender
 			go func() {
@@ -347,7 +347,7 @@ func TestRunAdminNotificationHandler(t *testing.T) {
 	t.Run(
 		"If we send Notification, we get shouldSend = false and we don't send",
 		func(t *testing.T) {
-			n := &setupError{"message1", "service1"}
+			n := &setupError{message: "message1", service: "service1"}
 
 			senderDone := make(chan struct{})
 			// Sender
@@ -369,7 +369,7 @@ func TestRunAdminNotificationHandler(t *testing.T) {
 	t.Run(
 		"If we send another Notification, we get shouldSend = true and we forward the Notification on adminErrorChan",
 		func(t *testing.T) {
-			n := &setupError{"message2", "service1"}
+			n := &setupError{message: "message2", service: "service1"}
 
 			// Sender
 			go func() {
@@ -533,8 +533,8 @@ func TestStartAdminErrorAdder(t *testing.T) {
 	a.adminErrorChan = make(chan Notification)
 	a.startAdminErrorAdder()
 
-	a.adminErrorChan <- &setupError{"message", "service1"}
-	a.adminErrorChan <- &pushError{"message", "service1", "node1"}
+	a.adminErrorChan <- &setupError{message: "message", service: "service1"}
+	a.adminErrorChan <- &pushError{message: "message", service: "service1", node: "node1"}
 	close(a.adminErrorChan)
 	adminErrors.writerCount.Wait()
 
@@ -20,6 +20,8 @@ import (
 	"sort"
 	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // TestPrepareAdminErrorsForFull Message checks that a set of setup errors and push errors gets properly translated into a table for sending notifications
@@ -188,3 +190,34 @@ func TestPrepareAbridgedAdminSlice(t *testing.T) {
 		t.Errorf("Push Errors slice did not match.  Expected %s, got %s", expectedPushErrors, testPushErrors)
 	}
 }
+
+// TestPrepareMessagesWithConfigChanges checks that configuration changes are included in the full and abridged admin messages, and that
+// the messages only say that errors were reported if there were any
+func TestPrepareMessagesWithConfigChanges(t *testing.T) {
+	adminErrors = packageErrors{}
+	addErrorToAdminErrors(NewConfigChange("destinationNodes changed: added node2", "test_service1"))
+	addErrorToAdminErrors(NewConfigChange("service added", "test_service2"))
+
+	assert.Equal(t,
+		[]string{"test_service1: destinationNodes changed: added node2", "test_service2: service added"},
+		prepareAbridgedConfigChanges(),
+	)
+	assert.Equal(t, []string{"service added"}, prepareAdminErrorsForFullMessage()["test_service2"].ConfigChanges)
+
+	fullMessage, abridgedMessage, err := prepareFullAndAbridgedMessages("test_operation")
+	assert.NoError(t, err)
+	for _, message := range []string{fullMessage, abridgedMessage} {
+		assert.Contains(t, message, "The following configuration changes were detected")
+		assert.Contains(t, message, "destinationNodes changed: added node2")
+		assert.NotContains(t, message, "errors were reported")
+	}
+
+	addErrorToAdminErrors(&setupError{message: "Setup error 1", service: "test_service1"})
+	fullMessage, abridgedMessage, err = prepareFullAndAbridgedMessages("test_operation")
+	assert.NoError(t, err)
+	for _, message := range []string{fullMessage, abridgedMessage} {
+		assert.Contains(t, message, "The following errors were reported")
+		assert.Contains(t, message, "service added")
+		assert.Contains(t, message, "Setup error 1")
+	}
+}
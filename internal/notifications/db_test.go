@@ -774,8 +774,8 @@ func TestAdjustErrorCountsByServiceAndDirectNotification(t *testing.T) {
 		{
 			description: "No pre-existing errors, get setupError",
 			Notification: &setupError{
-				"This is a setup error",
-				"service1",
+				message: "This is a setup error",
+				service: "service1",
 			},
 			errorCounts: &serviceErrorCounts{
 				setupErrors: errorCount{0, false},
@@ -791,8 +791,8 @@ func TestAdjustErrorCountsByServiceAndDirectNotification(t *testing.T) {
 		{
 			description: "Pre-existing errors, get setupError, not enough for threshhold",
 			Notification: &setupError{
-				"This is a setup error",
-				"service1",
+				message: "This is a setup error",
+				service: "service1",
 			},
 			errorCounts: &serviceErrorCounts{
 				setupErrors: errorCount{1, true},
@@ -808,8 +808,8 @@ func TestAdjustErrorCountsByServiceAndDirectNotification(t *testing.T) {
 		{
 			description: "Pre-existing errors, get setupError, enough for threshhold",
 			Notification: &setupError{
-				"This is a setup error",
-				"service1",
+				message: "This is a setup error",
+				service: "service1",
 			},
 			errorCounts: &serviceErrorCounts{
 				setupErrors: errorCount{2, true},
@@ -825,8 +825,8 @@ func TestAdjustErrorCountsByServiceAndDirectNotification(t *testing.T) {
 		{
 			description: "Pre-existing errors mixed, get setupError, not enough for threshhold",
 			Notification: &setupError{
-				"This is a setup error",
-				"service1",
+				message: "This is a setup error",
+				service: "service1",
 			},
 			errorCounts: &serviceErrorCounts{
 				setupErrors: errorCount{1, true},
@@ -850,8 +850,8 @@ func TestAdjustErrorCountsByServiceAndDirectNotification(t *testing.T) {
 		{
 			description: "Pre-existing errors mixed, get setupError, enough for threshhold",
 			Notification: &setupError{
-				"This is a setup error",
-				"service1",
+				message: "This is a setup error",
+				service: "service1",
 			},
 			errorCounts: &serviceErrorCounts{
 				setupErrors: errorCount{2, true},
@@ -875,9 +875,9 @@ func TestAdjustErrorCountsByServiceAndDirectNotification(t *testing.T) {
 		{
 			description: "No pre-existing errors, get pushError on node1",
 			Notification: &pushError{
-				"This is a push error",
-				"service1",
-				"node1",
+				message: "This is a push error",
+				service: "service1",
+				node:    "node1",
 			},
 			errorCounts: &serviceErrorCounts{
 				setupErrors: errorCount{0, true},
@@ -895,9 +895,9 @@ func TestAdjustErrorCountsByServiceAndDirectNotification(t *testing.T) {
 		{
 			description: "Pre-existing errors, get pushError on node1, not enough for threshhold",
 			Notification: &pushError{
-				"This is a push error",
-				"service1",
-				"node1",
+				message: "This is a push error",
+				service: "service1",
+				node:    "node1",
 			},
 			errorCounts: &serviceErrorCounts{
 				setupErrors: errorCount{0, true},
@@ -917,9 +917,9 @@ func TestAdjustErrorCountsByServiceAndDirectNotification(t *testing.T) {
 		{
 			description: "Pre-existing errors mixed, get pushError on node1, not enough for threshhold",
 			Notification: &pushError{
-				"This is a push error",
-				"service1",
-				"node1",
+				message: "This is a push error",
+				service: "service1",
+				node:    "node1",
 			},
 			errorCounts: &serviceErrorCounts{
 				setupErrors: errorCount{2, true},
@@ -943,9 +943,9 @@ func TestAdjustErrorCountsByServiceAndDirectNotification(t *testing.T) {
 		{
 			description: "Pre-existing errors mixed, get pushError on node1, enough for threshhold",
 			Notification: &pushError{
-				"This is a push error",
-				"service1",
-				"node1",
+				message: "This is a push error",
+				service: "service1",
+				node:    "node1",
 			},
 			errorCounts: &serviceErrorCounts{
 				setupErrors: errorCount{2, true},
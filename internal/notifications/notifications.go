@@ -38,6 +38,7 @@ type Notification interface {
 type setupError struct {
 	message string
 	service string
+	cause   error
 }
 
 // NewSetupError returns a *setupError that can be populated and then sent through an EmailManager
@@ -50,11 +51,18 @@ func NewSetupError(message, service string) *setupError {
 func (s *setupError) GetMessage() string { return s.message }
 func (s *setupError) GetService() string { return s.service }
 
+// WithCause sets the error that caused the setupError, so that any remediation it suggests can be sent along with the message
+func (s *setupError) WithCause(err error) *setupError {
+	s.cause = err
+	return s
+}
+
 // pushError is a Notification for an error that occurs while pushing tokens to service nodes
 type pushError struct {
 	message string
 	service string
 	node    string
+	cause   error
 }
 
 // NewPushError returns a *pushError that can be populated and then sent through an EmailManager
@@ -68,3 +76,25 @@ func NewPushError(message, service, node string) *pushError {
 func (p *pushError) GetMessage() string { return p.message }
 func (p *pushError) GetService() string { return p.service }
 func (p *pushError) GetNode() string    { return p.node }
+
+// WithCause sets the error that caused the pushError, so that any remediation it suggests can be sent along with the message
+func (p *pushError) WithCause(err error) *pushError {
+	p.cause = err
+	return p
+}
+
+// configChange is a Notification for a change to a service's configuration since the last run.  It is only meant to be sent to admins.
+type configChange struct {
+	message string
+	service string
+}
+
+// NewConfigChange returns a *configChange that can be populated and then sent through an AdminNotificationManager
+func NewConfigChange(message, service string) *configChange {
+	return &configChange{
+		message: message,
+		service: service,
+	}
+}
+func (c *configChange) GetMessage() string { return c.message }
+func (c *configChange) GetService() string { return c.service }
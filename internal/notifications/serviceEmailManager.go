@@ -204,18 +204,36 @@ func (em *ServiceEmailManager) runServiceNotificationHandler(ctx context.Context
 	}()
 }
 
+// setupErrorsTableKey is the key in the service errors table of the setup errors that are sent to the stakeholders.  A setup error
+// keeps the service's tokens from being pushed to any of its nodes.
+const setupErrorsTableKey = "All nodes"
+
 func addPushErrorNotificationToServiceErrorsTable(n Notification, serviceErrorsTable map[string]string) {
-	// Note that we ONLY send push errors to the stakeholders.  Only admins will get all Notifications.
+	// Note that we ONLY send push errors, and setup errors whose cause suggests a remediation, to the stakeholders.  Only admins will get
+	// all Notifications.
 	funcLogger := log.WithFields(log.Fields{
 		"caller":  "notifications.addPushErrorNotificationToServiceErrorsTable",
 		"service": n.GetService(),
 	})
 
 	msg := "Error counts either not tracked or exceeded error limit.  Sending notification"
-	if nValue, ok := n.(*pushError); ok {
-		serviceErrorsTable[nValue.node] = n.GetMessage()
+	switch nValue := n.(type) {
+	case *pushError:
+		serviceErrorsTable[nValue.node] = messageWithRemediation(nValue.message, nValue.cause)
 		funcLogger.WithField("node", nValue.node).Debug(msg)
 		return
+	case *setupError:
+		// Other setup errors are problems with the Managed Tokens Service itself, that the stakeholders can't do anything about
+		if remediation(nValue.cause) == "" {
+			break
+		}
+		message := messageWithRemediation(nValue.message, nValue.cause)
+		if previous, ok := serviceErrorsTable[setupErrorsTableKey]; ok {
+			message = previous + "; " + message
+		}
+		serviceErrorsTable[setupErrorsTableKey] = message
+		funcLogger.Debug(msg)
+		return
 	}
 	funcLogger.Debug(msg)
 }
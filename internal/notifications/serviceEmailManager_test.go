@@ -18,11 +18,16 @@ package notifications
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/kerberos"
+	"github.com/fermitools/managed-tokens/internal/utils"
 )
 
 // ServiceEmailManager tests
@@ -134,7 +139,7 @@ func testBackupServiceEmailManager(t *testing.T, s1 *ServiceEmailManager) {
 
 	// Check that we get a valid new ReceiveChan that can actually receive
 	go func() {
-		s2.ReceiveChan <- &setupError{"this is a test message", "test_service"}
+		s2.ReceiveChan <- &setupError{message: "this is a test message", service: "test_service"}
 		close(s2.ReceiveChan)
 	}()
 	assert.Eventually(t, func() bool {
@@ -347,6 +352,12 @@ type fakeNotification struct{}
 func (f *fakeNotification) GetMessage() string { return "" }
 func (f *fakeNotification) GetService() string { return "" }
 
+// fakeRemediatorError is an error that suggests a remediation, like the typed errors of the packages that run commands
+type fakeRemediatorError struct{}
+
+func (f *fakeRemediatorError) Error() string       { return "fake error" }
+func (f *fakeRemediatorError) Remediation() string { return "Fix the node" }
+
 func TestAddPushErrorNotificationToServiceErrorsTable(t *testing.T) {
 	type testCase struct {
 		description   string
@@ -383,6 +394,38 @@ func TestAddPushErrorNotificationToServiceErrorsTable(t *testing.T) {
 				"mynode2": "This is a push error as well",
 			},
 		},
+		{
+			"No previous errors, add push error with a cause that suggests a remediation",
+			make(map[string]string),
+			NewPushError("This is a push error", "myservice", "mynode").WithCause(fmt.Errorf("could not push: %w", &fakeRemediatorError{})),
+			map[string]string{"mynode": "This is a push error.  Suggested action: Fix the node"},
+		},
+		{
+			"No previous errors, add push error with a cause that does not suggest a remediation",
+			make(map[string]string),
+			NewPushError("This is a push error", "myservice", "mynode").WithCause(errors.New("exit status 23")),
+			map[string]string{"mynode": "This is a push error"},
+		},
+		{
+			"No previous errors, add setup error with a cause that suggests a remediation",
+			make(map[string]string),
+			NewSetupError("This is a setup error", "myservice").WithCause(fmt.Errorf("could not set up: %w", &fakeRemediatorError{})),
+			map[string]string{setupErrorsTableKey: "This is a setup error.  Suggested action: Fix the node"},
+		},
+		{
+			"Previous setup error, add another setup error with a cause that suggests a remediation",
+			map[string]string{setupErrorsTableKey: "This is a setup error.  Suggested action: Fix the node"},
+			NewSetupError("This is another setup error", "myservice").WithCause(&fakeRemediatorError{}),
+			map[string]string{
+				setupErrorsTableKey: "This is a setup error.  Suggested action: Fix the node; This is another setup error.  Suggested action: Fix the node",
+			},
+		},
+		{
+			"No previous errors, add setup error with a cause that does not suggest a remediation",
+			make(map[string]string),
+			NewSetupError("This is a setup error", "myservice").WithCause(errors.New("exit status 1")),
+			map[string]string{},
+		},
 		{
 			"Previous errors, add fake notification",
 			map[string]string{"mynode1": "This is a push error"},
@@ -478,6 +521,38 @@ func TestSendServiceEmailIfErrors(t *testing.T) {
 	}
 }
 
+// TestServiceEmailForKinitFailure checks that the service email for a kinit failure has the remediation that the kerberos error suggests
+func TestServiceEmailForKinitFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	kinitErr := &kerberos.ErrBadKeytabOrPrincipal{CommandError: utils.CommandError{Output: "Keytab contains no suitable keys", Err: errors.New("exit status 1")}}
+	table := make(map[string]string)
+	addPushErrorNotificationToServiceErrorsTable(
+		NewSetupError("Could not obtain and verify kerberos ticket", "myexpt_myrole").WithCause(fmt.Errorf("wrapped: %w", kinitErr)),
+		table,
+	)
+
+	email := &recordingEmail{}
+	sendServiceEmailIfErrors(ctx, table, &ServiceEmailManager{Service: "myexpt_myrole", Email: email})
+	assert.Len(t, email.messages, 1)
+	for _, message := range email.messages {
+		// The error table wraps its cells, so compare the words in it
+		words := strings.Join(strings.Fields(strings.ReplaceAll(message, "|", " ")), " ")
+		assert.Contains(t, words, setupErrorsTableKey+" Could not obtain and verify kerberos ticket. Suggested action: "+kinitErr.Remediation())
+	}
+}
+
+// recordingEmail is a SendMessager that records the messages it is asked to send
+type recordingEmail struct {
+	messages []string
+}
+
+func (r *recordingEmail) sendMessage(ctx context.Context, message string) error {
+	r.messages = append(r.messages, message)
+	return nil
+}
+
 // Note: No test exists for prepareServiceEmail, since that just sets a couple of values and then calls prepareMessageFromTemplate, a tested function,
 // to handle any further logic
 
@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/fermitools/managed-tokens/internal/secrets"
 	"github.com/fermitools/managed-tokens/internal/tracing"
 	log "github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel"
@@ -74,7 +75,7 @@ func (s *slackMessage) sendMessage(ctx context.Context, message string) error {
 	msg := []byte(fmt.Sprintf(`{"text": "%s"}`, strings.Replace(message, "\"", "\\\"", -1)))
 	req, err := http.NewRequest("POST", s.url, bytes.NewBuffer(msg))
 	if err != nil {
-		tracing.LogErrorWithTrace(span, log.NewEntry(log.StandardLogger()), fmt.Sprintf("Error sending slack message: %s", err.Error()))
+		tracing.LogErrorWithTrace(span, log.NewEntry(log.StandardLogger()), fmt.Sprintf("Error sending slack message: %s", secrets.Redact(err.Error())))
 		return err
 	}
 
@@ -84,7 +85,7 @@ func (s *slackMessage) sendMessage(ctx context.Context, message string) error {
 	client := http.DefaultClient
 	resp, err := client.Do(req)
 	if err != nil {
-		tracing.LogErrorWithTrace(span, log.NewEntry(log.StandardLogger()), fmt.Sprintf("Error sending slack message: %s", err.Error()))
+		tracing.LogErrorWithTrace(span, log.NewEntry(log.StandardLogger()), fmt.Sprintf("Error sending slack message: %s", secrets.Redact(err.Error())))
 		return err
 	}
 
@@ -101,13 +102,13 @@ func (s *slackMessage) sendMessage(ctx context.Context, message string) error {
 		body, _ := io.ReadAll(resp.Body)
 		err := errors.New("could not send slack message")
 		log.WithFields(log.Fields{
-			"url":              s.url,
+			"url":              secrets.Redact(s.url),
 			"response status":  resp.Status,
 			"response headers": resp.Header,
 			"response body":    string(body),
 		}).Error(err)
 		span.SetAttributes(
-			attribute.String("url", s.url),
+			attribute.String("url", secrets.Redact(s.url)),
 			attribute.String("response status", resp.Status),
 		)
 		span.SetStatus(codes.Error, err.Error())
@@ -15,7 +15,10 @@
 
 package notifications
 
-import "sync"
+import (
+	"errors"
+	"sync"
+)
 
 // syncMapLength returns the length (number of keys) in a sync.Map
 func syncMapLength(m *sync.Map) (length int) {
@@ -28,3 +31,26 @@ func syncMapLength(m *sync.Map) (length int) {
 	})
 	return length
 }
+
+// remediator is implemented by the typed errors of the kerberos, vaultToken, fileCopier, and ping packages that can suggest an action
+// to fix the failure they represent
+type remediator interface {
+	Remediation() string
+}
+
+// remediation returns the suggested action to fix err, or the empty string if err does not suggest one
+func remediation(err error) string {
+	var r remediator
+	if errors.As(err, &r) {
+		return r.Remediation()
+	}
+	return ""
+}
+
+// messageWithRemediation returns message, followed by the suggested action to fix cause if cause suggests one
+func messageWithRemediation(message string, cause error) string {
+	if r := remediation(cause); r != "" {
+		return message + ".  Suggested action: " + r
+	}
+	return message
+}
@@ -16,6 +16,8 @@
 package notifications
 
 import (
+	"errors"
+	"fmt"
 	"math/rand"
 	"sync"
 	"testing"
@@ -39,3 +41,23 @@ func TestSyncMapLength(t *testing.T) {
 	}
 
 }
+
+func TestRemediation(t *testing.T) {
+	testCases := []struct {
+		description string
+		err         error
+		expected    string
+	}{
+		{"nil error", nil, ""},
+		{"error without remediation", errors.New("exit status 23"), ""},
+		{"wrapped error with remediation", fmt.Errorf("could not push: %w", &fakeRemediatorError{}), "Fix the node"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.description, func(t *testing.T) {
+			if result := remediation(test.err); result != test.expected {
+				t.Errorf("Got wrong remediation.  Expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
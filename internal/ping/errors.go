@@ -0,0 +1,53 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ping
+
+import (
+	"regexp"
+
+	"github.com/fermitools/managed-tokens/internal/utils"
+)
+
+// ErrHostUnreachable is returned when the node could not be reached by ping
+type ErrHostUnreachable struct{ utils.CommandError }
+
+func (e *ErrHostUnreachable) Error() string { return e.Message("node is unreachable") }
+
+// Remediation returns the suggested action to take when the node could not be reached
+func (e *ErrHostUnreachable) Remediation() string {
+	return "Check that the node is up, that its name resolves, and that it answers pings from the Managed Tokens host"
+}
+
+// ErrTimeout is returned when pinging the node did not finish before its deadline.  It wraps context.DeadlineExceeded.
+type ErrTimeout struct{ utils.CommandError }
+
+func (e *ErrTimeout) Error() string { return e.Message("timed out pinging node") }
+
+// Remediation returns the suggested action to take when pinging the node times out
+func (e *ErrTimeout) Remediation() string {
+	return "Check the network latency to the node, and raise pingTimeout if it is just slow"
+}
+
+var hostUnreachableRegexp = regexp.MustCompile(`(?i)unknown host|name or service not known|temporary failure in name resolution|100% packet loss|destination host unreachable|network is unreachable`)
+
+// classifyPingError returns the typed error for a failed ping with output output and error err, or err itself if the failure
+// could not be classified
+func classifyPingError(output []byte, err error) error {
+	if hostUnreachableRegexp.Match(output) {
+		return &ErrHostUnreachable{utils.CommandError{Output: string(output), Err: err}}
+	}
+	return err
+}
@@ -67,13 +67,16 @@ func (n Node) Ping(ctx context.Context, extraPingOpts []string) error {
 			tracing.LogErrorWithTrace(span, funcLogger, fmt.Sprintf("Context error: %s", e.Error()),
 				tracing.KeyValueForLog{Key: "command", Value: cmd.String()},
 			)
+			if errors.Is(e, context.DeadlineExceeded) {
+				return &ErrTimeout{utils.CommandError{Output: string(cmdOut), Err: e}}
+			}
 			return e
 		}
 
 		tracing.LogErrorWithTrace(span, funcLogger, fmt.Sprintf("Error running ping command: %s %s", string(cmdOut), cmdErr.Error()),
 			tracing.KeyValueForLog{Key: "command", Value: cmd.String()},
 		)
-		return fmt.Errorf("%s %s", cmdOut, cmdErr)
+		return classifyPingError(cmdOut, fmt.Errorf("%s %s", cmdOut, cmdErr))
 
 	}
 	span.SetStatus(codes.Ok, "Ping successful")
@@ -17,6 +17,7 @@ package ping
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -181,3 +182,20 @@ func TestMergePingOpts(t *testing.T) {
 		)
 	}
 }
+
+func TestClassifyPingError(t *testing.T) {
+	underlying := errors.New("exit status 1")
+
+	t.Run("host unreachable", func(t *testing.T) {
+		err := classifyPingError([]byte("1 packets transmitted, 0 received, 100% packet loss, time 0ms"), underlying)
+		var e *ErrHostUnreachable
+		assert.ErrorAs(t, err, &e)
+		assert.ErrorIs(t, err, underlying)
+		assert.Contains(t, e.Output, "100% packet loss")
+	})
+
+	t.Run("unclassified", func(t *testing.T) {
+		err := classifyPingError([]byte("ping: invalid argument"), underlying)
+		assert.Equal(t, underlying, err)
+	})
+}
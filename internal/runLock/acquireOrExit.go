@@ -0,0 +1,100 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runLock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/fermitools/managed-tokens/internal/notifications"
+)
+
+// ExitCodeLockHeld is the exit code an executable uses when it does not run because another instance is already running
+const ExitCodeLockHeld = 75
+
+// exitFunc is how AcquireOrExit exits the executable.  It is a variable so that tests can replace it.
+var exitFunc = os.Exit
+
+// Notifier sends msg to the administrators of an executable
+type Notifier func(ctx context.Context, msg string) error
+
+// NewNotifier returns a Notifier that sends messages directly with each of sendMessagers, for example the admin email and slack
+// channel.  Executables use this instead of their AdminNotificationManager, since that gets set up as part of the run that a
+// held lock keeps from happening.
+func NewNotifier(sendMessagers ...notifications.SendMessager) Notifier {
+	return func(ctx context.Context, msg string) error {
+		var errs error
+		for _, sm := range sendMessagers {
+			errs = errors.Join(errs, notifications.SendMessage(ctx, sm, msg))
+		}
+		return errs
+	}
+}
+
+// Path returns the location of the run lock file for executable.  This is configuredPath if it is set.  Otherwise, it is a file
+// named after the executable in dir.
+func Path(configuredPath, dir, executable string) string {
+	if configuredPath != "" {
+		return configuredPath
+	}
+	return filepath.Join(dir, executable+".lock")
+}
+
+// AcquireOrExit acquires the run lock at path for executable, waiting up to wait for another instance of executable to finish.  If
+// another instance is still running after that, it sends a message with notify (unless notify is nil) and exits with
+// ExitCodeLockHeld.  If the lock cannot be acquired for any other reason, it exits with code 1.
+func AcquireOrExit(ctx context.Context, path, executable string, wait time.Duration, notify Notifier) *Lock {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "runLock.AcquireOrExit")
+	span.SetAttributes(
+		attribute.String("path", path),
+		attribute.String("executable", executable),
+	)
+	defer span.End()
+
+	funcLogger := log.WithFields(log.Fields{
+		"executable": executable,
+		"path":       path,
+	})
+
+	l, err := Acquire(ctx, path, executable, wait)
+	if err == nil {
+		return l
+	}
+
+	var errHeld *ErrLockHeld
+	if !errors.As(err, &errHeld) {
+		funcLogger.Errorf("Could not acquire run lock: %s", err)
+		exitFunc(1)
+		return nil
+	}
+
+	msg := "Not running " + executable + " because another instance is already running: " + err.Error()
+	funcLogger.Error(msg)
+	if notify == nil {
+		funcLogger.Debug("Notifications are disabled.  Not sending run lock notification")
+	} else if err := notify(ctx, msg); err != nil {
+		funcLogger.Errorf("Could not send run lock notification: %s", err)
+	}
+	exitFunc(ExitCodeLockHeld)
+	return nil
+}
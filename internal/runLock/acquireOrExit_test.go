@@ -0,0 +1,85 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runLock
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/path/to/db/myexecutable.lock", Path("", "/path/to/db", "myexecutable"))
+	assert.Equal(t, "/path/to/lockfile", Path("/path/to/lockfile", "/path/to/db", "myexecutable"))
+}
+
+// TestAcquireOrExit checks that AcquireOrExit returns the lock when it is free, and that it notifies and exits with ExitCodeLockHeld
+// when another holder has it
+func TestAcquireOrExit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	ctx := context.Background()
+
+	var exitCode int
+	exitCalled := false
+	oldExitFunc := exitFunc
+	exitFunc = func(code int) {
+		exitCalled = true
+		exitCode = code
+	}
+	t.Cleanup(func() { exitFunc = oldExitFunc })
+
+	var notified []string
+	notify := func(ctx context.Context, msg string) error {
+		notified = append(notified, msg)
+		return nil
+	}
+
+	l := AcquireOrExit(ctx, path, "test-exe", 0, notify)
+	if !assert.NotNil(t, l) {
+		return
+	}
+	defer l.Release()
+	assert.False(t, exitCalled)
+	assert.Empty(t, notified)
+
+	type testCase struct {
+		description    string
+		notify         Notifier
+		expectedNotify int
+	}
+	testCases := []testCase{
+		{"Notify", notify, 1},
+		{"Notify error", func(ctx context.Context, msg string) error {
+			notified = append(notified, msg)
+			return errors.New("could not send")
+		}, 1},
+		{"Notifications disabled", nil, 0},
+	}
+	for _, test := range testCases {
+		t.Run(test.description, func(t *testing.T) {
+			exitCalled, exitCode, notified = false, 0, nil
+			assert.Nil(t, AcquireOrExit(ctx, path, "test-exe", 0, test.notify))
+			assert.True(t, exitCalled)
+			assert.Equal(t, ExitCodeLockHeld, exitCode)
+			if assert.Len(t, notified, test.expectedNotify) && test.expectedNotify > 0 {
+				assert.Contains(t, notified[0], "Not running test-exe because another instance is already running")
+			}
+		})
+	}
+}
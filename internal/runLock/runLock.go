@@ -0,0 +1,221 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runLock provides an advisory, file-based lock that an executable can hold for the duration of a run, so that only one
+// instance of that executable runs at a time
+package runLock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// pollInterval is how often Acquire tries to take a held lock again while it is waiting
+var pollInterval = time.Second
+
+// Info is the information about the holder of a Lock that is recorded in the lock file
+type Info struct {
+	PID        int       `json:"pid"`
+	Host       string    `json:"host"`
+	Executable string    `json:"executable"`
+	StartTime  time.Time `json:"startTime"`
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%s (PID %d on %s, started %s)", i.Executable, i.PID, i.Host, i.StartTime.Format(time.RFC3339))
+}
+
+// ErrLockHeld is returned by Acquire when another process holds the lock
+type ErrLockHeld struct {
+	Path string
+	// Holder is the information recorded by the process holding the lock.  It is empty if that information could not be read.
+	Holder Info
+}
+
+func (e *ErrLockHeld) Error() string {
+	if e.Holder.PID == 0 {
+		return fmt.Sprintf("lock %s is held by another process", e.Path)
+	}
+	return fmt.Sprintf("lock %s is held by %s", e.Path, e.Holder)
+}
+
+// Lock is an advisory lock on a file.  While it is held, the lock file contains the Info of the holder.
+type Lock struct {
+	path string
+	file *os.File
+	Info
+}
+
+// errRetry is returned by tryAcquire when the lock file was changed while we were trying to take the lock, so we should try again
+var errRetry = errors.New("lock file changed while acquiring lock")
+
+// Acquire takes the lock at path for the executable.  If another process holds the lock, Acquire waits up to wait for it to be released
+// before returning an *ErrLockHeld.  If wait is 0, it does not wait at all.  A lock left behind by a process that is no longer
+// running is considered stale, and is taken over.
+func Acquire(ctx context.Context, path, executable string, wait time.Duration) (*Lock, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "runLock.Acquire")
+	span.SetAttributes(
+		attribute.String("path", path),
+		attribute.String("wait", wait.String()),
+	)
+	defer span.End()
+
+	host, err := os.Hostname()
+	if err != nil {
+		log.WithField("path", path).Warn("Could not get hostname to record in lock file")
+	}
+	info := Info{PID: os.Getpid(), Host: host, Executable: executable, StartTime: time.Now()}
+
+	deadline := time.Now().Add(wait)
+	for {
+		l, err := tryAcquire(path, info)
+		if err == nil {
+			return l, nil
+		}
+		if errors.Is(err, errRetry) {
+			continue
+		}
+		var errHeld *ErrLockHeld
+		if !errors.As(err, &errHeld) || !time.Now().Before(deadline) {
+			return nil, err
+		}
+
+		log.WithField("path", path).Infof("Waiting for %s to release lock", errHeld.Holder)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", err, ctx.Err())
+		case <-time.After(min(pollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+// tryAcquire makes a single attempt to take the lock at path, without waiting
+func tryAcquire(path string, info Info) (*Lock, error) {
+	funcLogger := log.WithField("path", path)
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		holder, _ := readInfo(f)
+		f.Close()
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("could not lock lock file: %w", err)
+		}
+		// The lock can still be held by a process that's gone if, for example, a child process inherited the lock file.  If the holder
+		// was on our host and isn't running anymore, break the lock by removing the file, so that the next attempt creates a new one
+		if isStale(holder, info.Host) {
+			funcLogger.Warnf("Breaking stale lock held by %s, which is no longer running", holder)
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("could not remove stale lock file: %w", err)
+			}
+			return nil, errRetry
+		}
+		return nil, &ErrLockHeld{Path: path, Holder: holder}
+	}
+
+	// Make sure that nobody removed the lock file and created a new one while we were locking it
+	fInfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not stat lock file: %w", err)
+	}
+	pathInfo, err := os.Stat(path)
+	if err != nil || !os.SameFile(fInfo, pathInfo) {
+		f.Close()
+		return nil, errRetry
+	}
+
+	// If there's information in the lock file, its holder exited without releasing the lock
+	if previous, err := readInfo(f); err == nil && previous.PID != 0 {
+		funcLogger.Warnf("Taking over stale lock left behind by %s", previous)
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not encode lock information: %w", err)
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not truncate lock file: %w", err)
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not write lock information: %w", err)
+	}
+	f.Sync()
+
+	funcLogger.Debug("Acquired run lock")
+	return &Lock{path: path, file: f, Info: info}, nil
+}
+
+// Release releases the lock and removes the lock file
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	// We remove the file while we still hold the lock, so that another process can't lock the file just before we remove it
+	var errs error
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		errs = errors.Join(errs, fmt.Errorf("could not remove lock file: %w", err))
+	}
+	if err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("could not unlock lock file: %w", err))
+	}
+	if err := l.file.Close(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("could not close lock file: %w", err))
+	}
+	l.file = nil
+	log.WithField("path", l.path).Debug("Released run lock")
+	return errs
+}
+
+// readInfo reads the Info recorded in an open lock file
+func readInfo(f *os.File) (Info, error) {
+	var info Info
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 1<<16))
+	if err != nil {
+		return info, err
+	}
+	if len(data) == 0 {
+		return info, nil
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// isStale returns whether the lock holder is a process on host that is no longer running
+func isStale(holder Info, host string) bool {
+	if holder.PID <= 0 || holder.Host == "" || holder.Host != host || holder.PID == os.Getpid() {
+		return false
+	}
+	// Signal 0 checks whether we could signal the process without actually sending a signal.  EPERM means the process exists,
+	// but belongs to someone else
+	err := syscall.Kill(holder.PID, syscall.Signal(0))
+	return errors.Is(err, syscall.ESRCH)
+}
@@ -0,0 +1,154 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runLock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// deadPID returns the PID of a process that has already exited
+func deadPID(t *testing.T) int {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Could not run process to get a dead PID: %s", err)
+	}
+	return cmd.Process.Pid
+}
+
+func writeInfo(t *testing.T, path string, info Info) {
+	data, _ := json.Marshal(info)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Could not write lock file: %s", err)
+	}
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	ctx := context.Background()
+
+	l, err := Acquire(ctx, path, "test-exe", 0)
+	if err != nil {
+		t.Fatalf("Could not acquire lock: %s", err)
+	}
+
+	// The lock file should record our information
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read lock file: %s", err)
+	}
+	var info Info
+	assert.NoError(t, json.Unmarshal(data, &info))
+	assert.Equal(t, os.Getpid(), info.PID)
+	assert.Equal(t, "test-exe", info.Executable)
+
+	// A second attempt should fail right away, and report who holds the lock
+	_, err = Acquire(ctx, path, "test-exe", 0)
+	var errHeld *ErrLockHeld
+	if assert.True(t, errors.As(err, &errHeld)) {
+		assert.Equal(t, os.Getpid(), errHeld.Holder.PID)
+	}
+
+	assert.NoError(t, l.Release())
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	l, err = Acquire(ctx, path, "test-exe", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release())
+	assert.NoError(t, l.Release()) // Releasing twice is a no-op
+}
+
+func TestAcquireWait(t *testing.T) {
+	oldPollInterval := pollInterval
+	pollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { pollInterval = oldPollInterval })
+
+	path := filepath.Join(t.TempDir(), "test.lock")
+	ctx := context.Background()
+
+	l, err := Acquire(ctx, path, "test-exe", 0)
+	if err != nil {
+		t.Fatalf("Could not acquire lock: %s", err)
+	}
+
+	// Time out waiting
+	start := time.Now()
+	_, err = Acquire(ctx, path, "test-exe", 50*time.Millisecond)
+	var errHeld *ErrLockHeld
+	assert.True(t, errors.As(err, &errHeld))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// Get the lock once it's released
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l.Release()
+	}()
+	l2, err := Acquire(ctx, path, "test-exe", 5*time.Second)
+	assert.NoError(t, err)
+	l2.Release()
+}
+
+func TestAcquireStale(t *testing.T) {
+	host, _ := os.Hostname()
+	ctx := context.Background()
+
+	t.Run("Lock file left behind", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.lock")
+		writeInfo(t, path, Info{PID: deadPID(t), Host: host, Executable: "test-exe"})
+		l, err := Acquire(ctx, path, "test-exe", 0)
+		assert.NoError(t, err)
+		l.Release()
+	})
+
+	t.Run("Lock held for a process that is no longer running", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.lock")
+		writeInfo(t, path, Info{PID: deadPID(t), Host: host, Executable: "test-exe"})
+		f, _ := os.OpenFile(path, os.O_RDWR, 0644)
+		defer f.Close()
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			t.Fatalf("Could not lock file: %s", err)
+		}
+
+		l, err := Acquire(ctx, path, "test-exe", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, os.Getpid(), l.PID)
+		l.Release()
+	})
+
+	t.Run("Lock held for a process on another host", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.lock")
+		writeInfo(t, path, Info{PID: deadPID(t), Host: host + ".otherhost", Executable: "test-exe"})
+		f, _ := os.OpenFile(path, os.O_RDWR, 0644)
+		defer f.Close()
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			t.Fatalf("Could not lock file: %s", err)
+		}
+
+		_, err := Acquire(ctx, path, "test-exe", 0)
+		var errHeld *ErrLockHeld
+		assert.True(t, errors.As(err, &errHeld))
+	})
+}
@@ -0,0 +1,99 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Redacted is what Redact replaces secrets with
+const Redacted = "[REDACTED]"
+
+// registry holds the secrets that have been resolved, longest first, so that a secret that contains another one is redacted whole
+var registry struct {
+	secrets []string
+	mu      sync.RWMutex
+}
+
+// Register adds secret to the secrets that Redact replaces.  Resolve registers the secrets it resolves, so callers only need to
+// register secrets that they get some other way.
+func Register(secret string) {
+	if secret == "" {
+		return
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if slices.Contains(registry.secrets, secret) {
+		return
+	}
+	registry.secrets = append(registry.secrets, secret)
+	slices.SortFunc(registry.secrets, func(a, b string) int { return len(b) - len(a) })
+}
+
+// Redact returns s with every registered secret replaced by Redacted
+func Redact(s string) string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	for _, secret := range registry.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+// RedactHook is a logrus.Hook that redacts the registered secrets from the message and the string and error fields of every log entry.
+// Since logrus fires hooks in the order they were added, it should be added before any hooks that write log entries somewhere.
+type RedactHook struct{}
+
+func (RedactHook) Levels() []log.Level { return log.AllLevels }
+
+func (RedactHook) Fire(entry *log.Entry) error {
+	entry.Message = Redact(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = Redact(v)
+		case error:
+			if redacted := Redact(v.Error()); redacted != v.Error() {
+				entry.Data[key] = errors.New(redacted)
+			}
+		}
+	}
+	return nil
+}
+
+// redactingWriter is an io.Writer that redacts the registered secrets from everything written to it before passing it on
+type redactingWriter struct {
+	w io.Writer
+}
+
+// NewRedactingWriter returns an io.Writer that writes to w with the registered secrets redacted.  Each call to Write is redacted on its
+// own, so a secret that is split across calls is not redacted.
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return &redactingWriter{w}
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,66 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	Register("hunter2")
+	Register("hunter2andmore")
+	Register("")
+
+	assert.Equal(t, "password is "+Redacted, Redact("password is hunter2"))
+	// The longer secret is redacted whole
+	assert.Equal(t, "token is "+Redacted, Redact("token is hunter2andmore"))
+	assert.Equal(t, "nothing to see here", Redact("nothing to see here"))
+}
+
+func TestRedactHook(t *testing.T) {
+	Register("https://hooks.example.com/secret")
+
+	var b bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&b)
+	logger.AddHook(RedactHook{})
+
+	logger.WithFields(log.Fields{
+		"url":   "https://hooks.example.com/secret",
+		"error": errors.New(`Post "https://hooks.example.com/secret": connection refused`),
+		"count": 1,
+	}).Error("Could not send to https://hooks.example.com/secret")
+
+	assert.NotContains(t, b.String(), "https://hooks.example.com/secret")
+	assert.Contains(t, b.String(), Redacted)
+	assert.Contains(t, b.String(), "count=1")
+}
+
+func TestRedactingWriter(t *testing.T) {
+	Register("s3cr3tvalue")
+
+	var b bytes.Buffer
+	w := NewRedactingWriter(&b)
+	n, err := w.Write([]byte(`{"url": "s3cr3tvalue"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, len(`{"url": "s3cr3tvalue"}`), n)
+	assert.Equal(t, `{"url": "`+Redacted+`"}`, b.String())
+}
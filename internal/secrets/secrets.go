@@ -0,0 +1,163 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secrets resolves configuration values that refer to secrets that are kept outside of the configuration, and keeps the
+// resolved secrets out of logs and output.  A reference is one of:
+//
+//	file:<path>            The contents of the file at path, without any trailing newline
+//	env:<name>             The value of the environment variable name
+//	encrypted-file:<path>  The contents of the file at path, decrypted with the Resolver's key.  The file is made with Encrypt
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	filePrefix          = "file:"
+	envPrefix           = "env:"
+	encryptedFilePrefix = "encrypted-file:"
+)
+
+// keySize is the size of the AES-256 keys that encrypted files are encrypted with
+const keySize = 32
+
+// IsReference reports whether value refers to a secret instead of being a value itself
+func IsReference(value string) bool {
+	for _, prefix := range []string{filePrefix, envPrefix, encryptedFilePrefix} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver resolves secret references.  The zero value can resolve every kind of reference except encrypted-file references.
+type Resolver struct {
+	// KeyFile is the path of the file that holds the key to decrypt encrypted-file references with.  See ReadKey.
+	KeyFile string
+	key     []byte
+}
+
+// Resolve returns the secret that reference refers to, and registers it so that Redact replaces it from then on.  If reference isn't a
+// reference, it is returned as is.  The returned errors never contain the secret.
+func (r *Resolver) Resolve(reference string) (string, error) {
+	var secret string
+	switch {
+	case strings.HasPrefix(reference, filePrefix):
+		path := strings.TrimPrefix(reference, filePrefix)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read secret file %s: %w", path, err)
+		}
+		secret = strings.TrimRight(string(data), "\r\n")
+	case strings.HasPrefix(reference, envPrefix):
+		name := strings.TrimPrefix(reference, envPrefix)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		secret = value
+	case strings.HasPrefix(reference, encryptedFilePrefix):
+		path := strings.TrimPrefix(reference, encryptedFilePrefix)
+		if r.key == nil {
+			if r.KeyFile == "" {
+				return "", fmt.Errorf("no key file was given to decrypt secret file %s with", path)
+			}
+			key, err := ReadKey(r.KeyFile)
+			if err != nil {
+				return "", err
+			}
+			r.key = key
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read encrypted secret file %s: %w", path, err)
+		}
+		if secret, err = decrypt(r.key, strings.TrimSpace(string(data))); err != nil {
+			return "", fmt.Errorf("could not decrypt secret file %s: %w", path, err)
+		}
+	default:
+		return reference, nil
+	}
+	Register(secret)
+	return secret, nil
+}
+
+// ReadKey reads the key to encrypt and decrypt secrets with from the file at path.  The file holds a base64-encoded 32-byte key, like
+// the output of openssl rand -base64 32.
+func ReadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read secrets key file %s: %w", path, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("secrets key file %s does not hold a base64-encoded %d-byte key", path, keySize)
+	}
+	return key, nil
+}
+
+// Encrypt encrypts secret with key using AES-256-GCM, and returns the result, base64-encoded.  Writing the result to a file makes a file
+// that an encrypted-file reference can refer to.
+func Encrypt(key []byte, secret string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("could not generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// decrypt reverses Encrypt
+func decrypt(key []byte, encoded string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.New("encrypted secret is not base64-encoded")
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("wrong key, or the encrypted secret was modified")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes long", keySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
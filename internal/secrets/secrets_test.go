@@ -0,0 +1,94 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKeyFile(t *testing.T, dir string) (string, []byte) {
+	t.Helper()
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "secrets.key")
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, key
+}
+
+func TestIsReference(t *testing.T) {
+	assert.True(t, IsReference("file:/etc/managed-tokens/slack-url"))
+	assert.True(t, IsReference("env:SLACK_URL"))
+	assert.True(t, IsReference("encrypted-file:/etc/managed-tokens/slack-url.enc"))
+	assert.False(t, IsReference("https://hooks.slack.com/services/abc"))
+	assert.False(t, IsReference(""))
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, key := writeKeyFile(t, dir)
+	os.WriteFile(filepath.Join(dir, "secret"), []byte("fileSecret\n"), 0o600)
+	encrypted, err := Encrypt(key, "encryptedSecret")
+	assert.NoError(t, err)
+	os.WriteFile(filepath.Join(dir, "secret.enc"), []byte(encrypted+"\n"), 0o600)
+	otherKeyFile, _ := writeKeyFile(t, t.TempDir())
+	t.Setenv("MANAGED_TOKENS_TEST_SECRET", "envSecret")
+
+	type testCase struct {
+		description string
+		resolver    *Resolver
+		reference   string
+		expected    string
+		errContains string
+	}
+
+	testCases := []testCase{
+		{"Not a reference", &Resolver{}, "plainValue", "plainValue", ""},
+		{"File", &Resolver{}, "file:" + filepath.Join(dir, "secret"), "fileSecret", ""},
+		{"Missing file", &Resolver{}, "file:" + filepath.Join(dir, "doesntexist"), "", "could not read secret file"},
+		{"Environment variable", &Resolver{}, "env:MANAGED_TOKENS_TEST_SECRET", "envSecret", ""},
+		{"Unset environment variable", &Resolver{}, "env:MANAGED_TOKENS_TEST_SECRET_UNSET", "", "environment variable MANAGED_TOKENS_TEST_SECRET_UNSET is not set"},
+		{"Encrypted file", &Resolver{KeyFile: keyFile}, "encrypted-file:" + filepath.Join(dir, "secret.enc"), "encryptedSecret", ""},
+		{"Encrypted file without key", &Resolver{}, "encrypted-file:" + filepath.Join(dir, "secret.enc"), "", "no key file"},
+		{"Encrypted file with wrong key", &Resolver{KeyFile: otherKeyFile}, "encrypted-file:" + filepath.Join(dir, "secret.enc"), "", "wrong key"},
+		{"Bad key file", &Resolver{KeyFile: filepath.Join(dir, "secret")}, "encrypted-file:" + filepath.Join(dir, "secret.enc"), "", "does not hold a base64-encoded 32-byte key"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			secret, err := tc.resolver.Resolve(tc.reference)
+			assert.Equal(t, tc.expected, secret)
+			if tc.errContains != "" {
+				assert.ErrorContains(t, err, tc.errContains)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	// Resolved secrets are redacted from then on
+	assert.Equal(t, "url is "+Redacted, Redact("url is encryptedSecret"))
+	assert.Equal(t, "plainValue", Redact("plainValue"))
+}
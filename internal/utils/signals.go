@@ -0,0 +1,88 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// InterruptSignals are the signals that ContextWithInterruptHandling listens for
+var InterruptSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// ErrInterrupted is the cause of the cancellation of a context returned by ContextWithInterruptHandling when the process receives
+// one of the InterruptSignals
+type ErrInterrupted struct {
+	Signal os.Signal
+}
+
+func (e *ErrInterrupted) Error() string { return "interrupted by signal " + e.Signal.String() }
+
+// ContextWithInterruptHandling returns a copy of ctx that is canceled when the process receives one of the InterruptSignals.  The cause
+// of that cancellation (see context.Cause) is an *ErrInterrupted.  Callers should call the returned stop func when they no longer need to
+// handle the signals, after which the signals get their default behavior again.
+func ContextWithInterruptHandling(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, InterruptSignals...)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigChan:
+			log.WithField("signal", sig.String()).Warn("Received signal.  Canceling run and cleaning up")
+			cancel(&ErrInterrupted{Signal: sig})
+		case <-done:
+		}
+	}()
+
+	stop := func() {
+		signal.Stop(sigChan)
+		select {
+		case <-done:
+		default:
+			close(done)
+		}
+		cancel(context.Canceled)
+	}
+	return ctx, stop
+}
+
+// GetInterruptSignal returns the signal that canceled ctx, if ctx, or one of its parents, was returned by ContextWithInterruptHandling and
+// was canceled because the process received one of the InterruptSignals.  Otherwise, it returns nil and false.
+func GetInterruptSignal(ctx context.Context) (os.Signal, bool) {
+	var errInterrupted *ErrInterrupted
+	if errors.As(context.Cause(ctx), &errInterrupted) {
+		return errInterrupted.Signal, true
+	}
+	return nil, false
+}
+
+// ContextWithoutInterrupt returns a copy of ctx that is not canceled when ctx is, so that cleanup operations can still run after
+// an interrupt.  If ctx has a deadline, the returned context's deadline is gracePeriod after it.
+func ContextWithoutInterrupt(ctx context.Context, gracePeriod time.Duration) (context.Context, context.CancelFunc) {
+	newCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(newCtx, deadline.Add(gracePeriod))
+	}
+	return context.WithCancel(newCtx)
+}
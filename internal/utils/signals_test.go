@@ -0,0 +1,86 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextWithInterruptHandling(t *testing.T) {
+	t.Run("Signal cancels context", func(t *testing.T) {
+		ctx, stop := ContextWithInterruptHandling(context.Background())
+		defer stop()
+
+		if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+			t.Fatalf("Could not send signal: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("Context was not canceled after signal")
+		}
+		sig, ok := GetInterruptSignal(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, syscall.SIGTERM, sig)
+	})
+
+	t.Run("Stop cancels context without interrupt", func(t *testing.T) {
+		ctx, stop := ContextWithInterruptHandling(context.Background())
+		stop()
+		stop() // Calling stop twice is OK
+
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+		_, ok := GetInterruptSignal(ctx)
+		assert.False(t, ok)
+	})
+
+	t.Run("Parent timeout is not an interrupt", func(t *testing.T) {
+		parent, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		ctx, stop := ContextWithInterruptHandling(parent)
+		defer stop()
+
+		<-ctx.Done()
+		_, ok := GetInterruptSignal(ctx)
+		assert.False(t, ok)
+	})
+}
+
+func TestContextWithoutInterrupt(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	parent, cancel := context.WithDeadline(context.Background(), deadline)
+	ctx, ctxCancel := ContextWithoutInterrupt(parent, time.Minute)
+	defer ctxCancel()
+
+	cancel()
+	assert.NoError(t, ctx.Err())
+	newDeadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, deadline.Add(time.Minute), newDeadline)
+
+	// No deadline on the parent means no deadline on the new context
+	ctx, ctxCancel = ContextWithoutInterrupt(context.Background(), time.Minute)
+	defer ctxCancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+}
@@ -141,6 +141,27 @@ type TemplateArgsError struct{ msg string }
 
 func (t *TemplateArgsError) Error() string { return t.msg }
 
+// CommandError holds the details of an external command that failed.  It is meant to be embedded in the error types that packages
+// return for specific classes of command failures, so that callers can get the command's output from any of them
+type CommandError struct {
+	// Output is the combined stdout and stderr of the command, if it was captured
+	Output string
+	// Err is the error from running the command
+	Err error
+}
+
+// Unwrap returns the error from running the command
+func (c CommandError) Unwrap() error { return c.Err }
+
+// Message returns description, followed by the error from running the command if there is one.  Embedding error types can use it
+// to build their error messages.
+func (c CommandError) Message(description string) string {
+	if c.Err == nil {
+		return description
+	}
+	return description + ": " + c.Err.Error()
+}
+
 // MergeCmdArgs is meant to take a FlagSet that defines defaults and flags for a particular command,
 // for example ping, and merges the extraArgs with the defaults.  So for example:
 //
@@ -317,3 +317,12 @@ func TestMergeCmdArgs(t *testing.T) {
 		)
 	}
 }
+
+func TestCommandError(t *testing.T) {
+	errRun := errors.New("exit status 1")
+	c := CommandError{Output: "some output", Err: errRun}
+	assert.Equal(t, "could not run command: exit status 1", c.Message("could not run command"))
+	assert.ErrorIs(t, c.Unwrap(), errRun)
+
+	assert.Equal(t, "could not run command", CommandError{}.Message("could not run command"))
+}
@@ -27,6 +27,8 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+
+	"github.com/fermitools/managed-tokens/internal/utils"
 )
 
 // commandExecutor defines an interface for executing commands.
@@ -54,7 +56,7 @@ func (i *interactiveExecutor) executeCommand(ctx context.Context, c *exec.Cmd) e
 	if err := c.Start(); err != nil {
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			span.SetStatus(codes.Error, "Context timeout")
-			return ctx.Err()
+			return &ErrTimeout{utils.CommandError{Err: ctx.Err()}}
 		}
 		span.SetStatus(codes.Error, "Error starting command")
 		return err
@@ -63,7 +65,7 @@ func (i *interactiveExecutor) executeCommand(ctx context.Context, c *exec.Cmd) e
 	if err := c.Wait(); err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			span.SetStatus(codes.Error, "Context timeout")
-			return ctx.Err()
+			return &ErrTimeout{utils.CommandError{Err: ctx.Err()}}
 		}
 		span.SetStatus(codes.Error, fmt.Sprintf("Error waiting for command; %s", err.Error()))
 		return err
@@ -89,7 +91,7 @@ func (n *nonInteractiveExecutor) executeCommand(ctx context.Context, c *exec.Cmd
 	if stdoutStderr, err := c.CombinedOutput(); err != nil {
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			span.SetStatus(codes.Error, "Context timeout")
-			return ctx.Err()
+			return &ErrTimeout{utils.CommandError{Output: string(stdoutStderr), Err: ctx.Err()}}
 		}
 		funcLogger.Errorf("%s", stdoutStderr)
 		authErr := checkStdoutStderrForAuthNeededError(stdoutStderr)
@@ -97,6 +99,10 @@ func (n *nonInteractiveExecutor) executeCommand(ctx context.Context, c *exec.Cmd
 			span.SetStatus(codes.Error, "Authentication needed")
 			return authErr
 		}
+		if unreachableErr := checkStdoutStderrForUnreachableError(stdoutStderr, err); unreachableErr != nil {
+			span.SetStatus(codes.Error, "Could not reach vault server or credd")
+			return unreachableErr
+		}
 		span.SetStatus(codes.Error, "Command execution failed")
 		return err
 	} else if len(stdoutStderr) > 0 {
@@ -115,7 +121,7 @@ func checkStdoutStderrForAuthNeededError(stdoutStderr []byte) error {
 		return nil
 	}
 
-	errToReturn := &ErrAuthNeeded{}
+	errToReturn := &ErrAuthNeeded{Output: string(stdoutStderr)}
 	htgettokenTimeoutRegexp := regexp.MustCompile(`htgettoken: Polling for response took longer than.*`)
 	if htgettokenTimeoutRegexp.Match(stdoutStderr) {
 		errToReturn.underlyingError = errHtgettokenTimeout
@@ -131,6 +137,8 @@ func checkStdoutStderrForAuthNeededError(stdoutStderr []byte) error {
 // ErrAuthNeeded represents an error indicating that authentication is required.
 // It wraps an underlying error that provides more context about the authentication failure.
 type ErrAuthNeeded struct {
+	// Output is the combined stdout and stderr of the command that failed
+	Output          string
 	underlyingError error
 }
 
@@ -143,3 +151,8 @@ func (e *ErrAuthNeeded) Error() string {
 }
 
 func (e *ErrAuthNeeded) Unwrap() error { return e.underlyingError }
+
+// Remediation returns the suggested action to take when authentication is needed
+func (e *ErrAuthNeeded) Remediation() string {
+	return "Run token-push -r -s <service> interactively to authenticate with the token issuer and generate a new refresh token"
+}
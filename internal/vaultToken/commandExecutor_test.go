@@ -233,3 +233,44 @@ exit 1
 
 	return badCommandPath
 }
+
+func TestCheckStdoutStderrForUnreachableError(t *testing.T) {
+	underlying := errors.New("exit status 1")
+	type testCase struct {
+		description  string
+		stdoutStderr []byte
+		checkFunc    func(error) bool
+	}
+
+	testCases := []testCase{
+		{
+			"Random string - should not find result",
+			[]byte("This is a random string"),
+			func(err error) bool { return err == nil },
+		},
+		{
+			"Vault unreachable",
+			[]byte("htgettoken: Vault server https://vaultserver.domain:8200 failed: <urlopen error [Errno 111] Connection refused>"),
+			func(err error) bool { var e *ErrVaultUnreachable; return errors.As(err, &e) },
+		},
+		{
+			"Credd unreachable",
+			[]byte("ERROR: AUTHENTICATE:1003:Failed to authenticate with any method\nCEDAR:6001:Failed to connect to <127.0.0.1:9618>"),
+			func(err error) bool { var e *ErrCreddUnreachable; return errors.As(err, &e) },
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(
+			test.description,
+			func(t *testing.T) {
+				err := checkStdoutStderrForUnreachableError(test.stdoutStderr, underlying)
+				assert.True(t, test.checkFunc(err))
+				if err != nil {
+					assert.ErrorIs(t, err, underlying)
+					assert.Contains(t, err.Error(), underlying.Error())
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,71 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaultToken
+
+import (
+	"regexp"
+
+	"github.com/fermitools/managed-tokens/internal/utils"
+)
+
+// ErrVaultUnreachable is returned when the token-getting command could not reach the vault server
+type ErrVaultUnreachable struct{ utils.CommandError }
+
+func (e *ErrVaultUnreachable) Error() string { return e.Message("could not reach vault server") }
+
+// Remediation returns the suggested action to take when the vault server could not be reached
+func (e *ErrVaultUnreachable) Remediation() string {
+	return "Check that the vault server is up and reachable from the Managed Tokens host"
+}
+
+// ErrCreddUnreachable is returned when the token-storing command could not reach the condor credd
+type ErrCreddUnreachable struct{ utils.CommandError }
+
+func (e *ErrCreddUnreachable) Error() string { return e.Message("could not reach condor credd") }
+
+// Remediation returns the suggested action to take when the credd could not be reached
+func (e *ErrCreddUnreachable) Remediation() string {
+	return "Check that the condor credd on the schedd is up and reachable from the Managed Tokens host"
+}
+
+// ErrTimeout is returned when a vault token command did not finish before its deadline.  It wraps context.DeadlineExceeded.
+type ErrTimeout struct{ utils.CommandError }
+
+func (e *ErrTimeout) Error() string { return e.Message("timed out running vault token command") }
+
+// Remediation returns the suggested action to take when a vault token command times out
+func (e *ErrTimeout) Remediation() string {
+	return "Check the response time of the vault server and credd, and raise vaultStorerTimeout if they are just slow"
+}
+
+var (
+	vaultUnreachableRegexp = regexp.MustCompile(`(?i)htgettoken:.*(urlopen error|connection refused|name or service not known|no route to host|network is unreachable|timed out|temporary failure in name resolution)`)
+	creddUnreachableRegexp = regexp.MustCompile(`(?i)CEDAR:6001|Failed to connect to|Can't find address|Unable to (connect|contact)`)
+)
+
+// checkStdoutStderrForUnreachableError inspects the provided stdout and stderr output for errors reaching the vault server or
+// condor credd, and returns the corresponding typed error wrapping err.  If no such error is found, it returns nil.
+func checkStdoutStderrForUnreachableError(stdoutStderr []byte, err error) error {
+	c := utils.CommandError{Output: string(stdoutStderr), Err: err}
+	switch {
+	case vaultUnreachableRegexp.Match(stdoutStderr):
+		return &ErrVaultUnreachable{c}
+	case creddUnreachableRegexp.Match(stdoutStderr):
+		return &ErrCreddUnreachable{c}
+	default:
+		return nil
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 
 	log "github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel"
@@ -50,7 +51,8 @@ func init() {
 type VaultStorerClient struct {
 	credd              string
 	vaultServer        string
-	verbose            bool // Whether to enable verbose mode for vault storer command
+	verbose            bool   // Whether to enable verbose mode for vault storer command
+	vaultTokenFile     string // Where the vault storer command should read and write the vault token.  If empty, the command's default is used
 	CommandEnvironment *environment.CommandEnvironment
 }
 
@@ -77,6 +79,14 @@ func (v *VaultStorerClient) WithVerbose() *VaultStorerClient {
 	return v
 }
 
+// WithVaultTokenFile sets the path where the vault storer command reads and writes the vault token, instead of the standard HTCondor
+// location.  The vault storer command also gets the directory of vaultTokenFile as its TMPDIR.  This lets multiple VaultStorerClients
+// for the same service run at the same time without sharing a vault token file.
+func (v *VaultStorerClient) WithVaultTokenFile(vaultTokenFile string) *VaultStorerClient {
+	v.vaultTokenFile = vaultTokenFile
+	return v
+}
+
 // GetCredd returns the value of the credd field from the VaultStorerClient.
 func (v *VaultStorerClient) GetCredd() string { return v.credd }
 
@@ -144,6 +154,12 @@ func (v *VaultStorerClient) setupCmdWithEnvironment(ctx context.Context, service
 	newEnv := v.setupCmdEnvironment()
 	getTokensAndStoreInVaultCmd := environment.EnvironmentWrappedCommand(ctx, newEnv, vaultExecutables["condor_vault_storer"], cmdArgs...)
 
+	// Any temporary files the vault storer command writes, including its own copy of the vault token, should go next to our vault token file,
+	// so that they don't clash with those of other vault storer commands for the same service
+	if v.vaultTokenFile != "" {
+		getTokensAndStoreInVaultCmd.Env = append(getTokensAndStoreInVaultCmd.Env, "TMPDIR="+filepath.Dir(v.vaultTokenFile))
+	}
+
 	funcLogger.Info("Storing and obtaining vault token")
 	funcLogger.WithFields(log.Fields{
 		"command":     getTokensAndStoreInVaultCmd.String(),
@@ -162,7 +178,8 @@ func (v *VaultStorerClient) getCmdArgs(serviceName string) []string {
 	return cmdArgs
 }
 
-// setupCmdEnvironment sets _condor_CREDD_HOST and _condor_SEC_CREDENTIAL_GETTOKEN_OPTS in a new environment for condor_vault_storer
+// setupCmdEnvironment sets _condor_CREDD_HOST and _condor_SEC_CREDENTIAL_GETTOKEN_OPTS in a new environment for condor_vault_storer.
+// If the VaultStorerClient has a vault token file set, it is passed to htgettoken in _condor_SEC_CREDENTIAL_GETTOKEN_OPTS.
 func (v *VaultStorerClient) setupCmdEnvironment() *environment.CommandEnvironment {
 	newEnv := v.CommandEnvironment.Copy()
 	newEnv.SetCondorCreddHost(v.credd)
@@ -171,7 +188,11 @@ func (v *VaultStorerClient) setupCmdEnvironment() *environment.CommandEnvironmen
 	if oldCondorSecCredentialGettokenOpts != "" {
 		maybeSpace = " "
 	}
-	newEnv.SetCondorSecCredentialGettokenOpts(oldCondorSecCredentialGettokenOpts + maybeSpace + fmt.Sprintf("-a %s", v.vaultServer))
+	newOpts := oldCondorSecCredentialGettokenOpts + maybeSpace + fmt.Sprintf("-a %s", v.vaultServer)
+	if v.vaultTokenFile != "" {
+		newOpts += fmt.Sprintf(" --vaulttokenfile %s", v.vaultTokenFile)
+	}
+	newEnv.SetCondorSecCredentialGettokenOpts(newOpts)
 	return newEnv
 }
 
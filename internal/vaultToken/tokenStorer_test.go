@@ -24,6 +24,7 @@ import (
 	"path"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/fermitools/managed-tokens/internal/environment"
@@ -195,6 +196,68 @@ func TestVaultStorerClientSetupCmdWithEnvironment(t *testing.T) {
 	}
 }
 
+// TestVaultStorerClientGetAndStoreTokenWithVaultTokenFile checks that concurrent vault storer commands for the same service only read
+// and write the vault token file and temporary directory they were given, and leave the shared temporary directory alone
+func TestVaultStorerClientGetAndStoreTokenWithVaultTokenFile(t *testing.T) {
+	serviceName := "test_service"
+	sharedTempDir := t.TempDir()
+	t.Setenv("TMPDIR", sharedTempDir)
+
+	// This mock condor_vault_storer rewrites the vault token file passed to htgettoken, and writes a scratch file in TMPDIR, the way
+	// condor_vault_storer does with its own copy of the vault token
+	oldPath := vaultExecutables["condor_vault_storer"]
+	vaultExecutables["condor_vault_storer"] = path.Join(t.TempDir(), "mock_condor_vault_storer.sh")
+	t.Cleanup(func() { vaultExecutables["condor_vault_storer"] = oldPath })
+	scriptContent := `#!/bin/bash
+service="${@: -1}"
+tokenfile=$(echo "$_condor_SEC_CREDENTIAL_GETTOKEN_OPTS" | sed -n 's/.*--vaulttokenfile \([^ ]*\).*/\1/p')
+[ -n "$tokenfile" ] || exit 1
+prior=$(cat "$tokenfile") || exit 1
+sleep 0.1
+echo "${prior} stored by ${_condor_CREDD_HOST}" > "$tokenfile"
+echo "$_condor_CREDD_HOST" > "${TMPDIR:-/tmp}/scratch_${service}"
+`
+	if err := os.WriteFile(vaultExecutables["condor_vault_storer"], []byte(scriptContent), 0755); err != nil {
+		t.Fatalf("Could not write mock condor_vault_storer script: %s", err)
+	}
+
+	credds := []string{"credd1", "credd2", "credd3"}
+	stagingDirs := make([]string, len(credds))
+	errs := make([]error, len(credds))
+	var wg sync.WaitGroup
+	for i, credd := range credds {
+		stagingDirs[i] = t.TempDir()
+		vaultTokenFile := GetCondorVaultTokenLocationInDir(stagingDirs[i], serviceName)
+		if err := os.WriteFile(vaultTokenFile, []byte("prior token for "+credd), 0600); err != nil {
+			t.Fatalf("Could not write prior vault token: %s", err)
+		}
+		v := NewVaultStorerClient(credd, "mockVaultServer", new(environment.CommandEnvironment)).WithVaultTokenFile(vaultTokenFile)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = v.GetAndStoreToken(context.Background(), serviceName, false)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, credd := range credds {
+		if errs[i] != nil {
+			t.Errorf("Expected nil error for %s, got %s", credd, errs[i])
+		}
+		expectedToken := fmt.Sprintf("prior token for %s stored by %s\n", credd, credd)
+		if token, err := os.ReadFile(GetCondorVaultTokenLocationInDir(stagingDirs[i], serviceName)); err != nil || string(token) != expectedToken {
+			t.Errorf("Wrong vault token for %s.  Expected %q, got %q (error %v)", credd, expectedToken, token, err)
+		}
+		if scratch, err := os.ReadFile(path.Join(stagingDirs[i], "scratch_"+serviceName)); err != nil || string(scratch) != credd+"\n" {
+			t.Errorf("Wrong scratch file in TMPDIR for %s.  Expected %q, got %q (error %v)", credd, credd+"\n", scratch, err)
+		}
+	}
+	if entries, _ := os.ReadDir(sharedTempDir); len(entries) != 0 {
+		t.Errorf("Expected nothing to be written in the shared temporary directory, got %v", entries)
+	}
+}
+
 func TestVaultStorerClientGetCmdArgs(t *testing.T) {
 	baseV := &VaultStorerClient{
 		credd:              "test.credd",
@@ -305,6 +368,20 @@ func TestVaultStorerClientSetupCmdEnvironment(t *testing.T) {
 				return env
 			},
 		},
+		{
+			"Vault token file set",
+			func() *VaultStorerClient {
+				v := copyTestVaultStorerClient(baseV)
+				v.CommandEnvironment.SetCondorSecCredentialGettokenOpts("--foo bar")
+				return v.WithVaultTokenFile("/path/to/staging/vt_u1234-myservice")
+			}(),
+			func() *environment.CommandEnvironment {
+				env := new(environment.CommandEnvironment)
+				env.SetCondorCreddHost(baseV.credd)
+				env.SetCondorSecCredentialGettokenOpts(fmt.Sprintf("--foo bar -a %s --vaulttokenfile /path/to/staging/vt_u1234-myservice", baseV.vaultServer))
+				return env
+			},
+		},
 	}
 
 	for _, test := range testCases {
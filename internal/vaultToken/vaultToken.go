@@ -111,6 +111,12 @@ func RemoveServiceVaultTokens(serviceName string) error {
 // If for some reason the current user cannot be determined, we will fall back to using os.GetUid(), but that doesn't cache the user info,
 // which is why user.Current() is preferred.
 func GetCondorVaultTokenLocation(serviceName string) string {
+	return GetCondorVaultTokenLocationInDir(os.TempDir(), serviceName)
+}
+
+// GetCondorVaultTokenLocationInDir returns the location that the vault token for serviceName would have in the directory dir, with the same
+// file name that HTCondor uses for its vault tokens.  It is meant for staging a vault token outside of the standard HTCondor location.
+func GetCondorVaultTokenLocationInDir(dir, serviceName string) string {
 	var uid string
 	currentUser, err := user.Current()
 	if err != nil {
@@ -120,7 +126,7 @@ func GetCondorVaultTokenLocation(serviceName string) string {
 		uid = currentUser.Uid
 	}
 	filename := fmt.Sprintf("vt_u%s-%s", uid, serviceName)
-	return path.Join(os.TempDir(), filename)
+	return path.Join(dir, filename)
 }
 
 // getDefaultVaultTokenLocation returns the location of vault token that most OSG grid tools use based on the current user's UID
@@ -237,6 +237,16 @@ func TestGetCondorVaultTokenLocation(t *testing.T) {
 	}
 }
 
+func TestGetCondorVaultTokenLocationInDir(t *testing.T) {
+	currentUser, _ := user.Current()
+	uid := currentUser.Uid
+	serviceName := "myService"
+	expectedResult := fmt.Sprintf("/path/to/staging/vt_u%s-%s", uid, serviceName)
+	if result := GetCondorVaultTokenLocationInDir("/path/to/staging", serviceName); result != expectedResult {
+		t.Errorf("Got wrong result for condor vault token location.  Expected %s, got %s", expectedResult, result)
+	}
+}
+
 func TestGetDefaultVaultTokenLocation(t *testing.T) {
 	currentUser, _ := user.Current()
 	uid := currentUser.Uid
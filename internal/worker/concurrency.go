@@ -0,0 +1,152 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ConcurrencyLimits holds the limits on how many operations (each of which runs one or more child processes, like kinit, ping, or rsync)
+// the workers run at the same time.  A limit of 0 means that there is no limit.
+type ConcurrencyLimits struct {
+	// Global is the maximum number of operations that all of the workers together may run at once
+	Global int
+	// PerWorkerType is the maximum number of operations the Worker for each WorkerType may run at once
+	PerWorkerType map[WorkerType]int
+	// PerNode is the maximum number of operations that all of the workers together may run against a single destination node at once
+	PerNode int
+}
+
+// concurrencyLimiter enforces a set of ConcurrencyLimits.  Each limit is a semaphore, implemented as a buffered channel
+type concurrencyLimiter struct {
+	global        chan struct{}
+	perWorkerType map[WorkerType]chan struct{}
+	perNodeLimit  int
+	perNode       map[string]chan struct{}
+	mu            sync.Mutex
+}
+
+var (
+	// limiter is the concurrencyLimiter shared by all of the workers.  By default, there are no limits
+	limiter    = newConcurrencyLimiter(ConcurrencyLimits{})
+	limiterMux sync.RWMutex
+)
+
+// SetConcurrencyLimits sets the limits on how many operations the workers run at once.  It should be called before any workers are
+// started.  It returns an error if any of the limits are negative or if there is a limit for an invalid WorkerType.
+func SetConcurrencyLimits(limits ConcurrencyLimits) error {
+	if limits.Global < 0 {
+		return fmt.Errorf("global concurrency limit cannot be negative: %d", limits.Global)
+	}
+	if limits.PerNode < 0 {
+		return fmt.Errorf("per-node concurrency limit cannot be negative: %d", limits.PerNode)
+	}
+	for wt, limit := range limits.PerWorkerType {
+		if !isValidWorkerType(wt) {
+			return fmt.Errorf("invalid worker type %d for concurrency limit", wt)
+		}
+		if limit < 0 {
+			return fmt.Errorf("concurrency limit for worker type %s cannot be negative: %d", wt, limit)
+		}
+	}
+
+	limiterMux.Lock()
+	defer limiterMux.Unlock()
+	limiter = newConcurrencyLimiter(limits)
+	return nil
+}
+
+func newConcurrencyLimiter(limits ConcurrencyLimits) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		perWorkerType: make(map[WorkerType]chan struct{}),
+		perNodeLimit:  limits.PerNode,
+		perNode:       make(map[string]chan struct{}),
+	}
+	if limits.Global > 0 {
+		l.global = make(chan struct{}, limits.Global)
+	}
+	for wt, limit := range limits.PerWorkerType {
+		if limit > 0 {
+			l.perWorkerType[wt] = make(chan struct{}, limit)
+		}
+	}
+	return l
+}
+
+// acquireSlot blocks until the operation for WorkerType wt against node can run within the current ConcurrencyLimits, or until ctx is
+// done.  node can be empty if the operation is not run against a destination node.  On success, the caller must call the returned release
+// func when the operation is finished.
+func acquireSlot(ctx context.Context, wt WorkerType, node string) (release func(), err error) {
+	limiterMux.RLock()
+	l := limiter
+	limiterMux.RUnlock()
+	return l.acquire(ctx, wt, node)
+}
+
+func (l *concurrencyLimiter) acquire(ctx context.Context, wt WorkerType, node string) (func(), error) {
+	_, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "worker.acquireSlot")
+	span.SetAttributes(
+		attribute.String("workerType", wt.String()),
+		attribute.String("node", node),
+	)
+	defer span.End()
+
+	// We always acquire the semaphores in the same order (worker type, node, global) so that two callers can never each be holding a
+	// semaphore that the other is waiting on
+	sems := make([]chan struct{}, 0, 3)
+	if sem, ok := l.perWorkerType[wt]; ok {
+		sems = append(sems, sem)
+	}
+	if node != "" && l.perNodeLimit > 0 {
+		sems = append(sems, l.nodeSemaphore(node))
+	}
+	if l.global != nil {
+		sems = append(sems, l.global)
+	}
+
+	release := func(acquired []chan struct{}) {
+		for i := len(acquired) - 1; i >= 0; i-- {
+			<-acquired[i]
+		}
+	}
+
+	for i, sem := range sems {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			release(sems[:i])
+			return nil, fmt.Errorf("could not start %s operation within concurrency limits: %w", wt, ctx.Err())
+		}
+	}
+	return func() { release(sems) }, nil
+}
+
+// nodeSemaphore returns the semaphore for node, creating it if needed
+func (l *concurrencyLimiter) nodeSemaphore(node string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sem, ok := l.perNode[node]
+	if !ok {
+		sem = make(chan struct{}, l.perNodeLimit)
+		l.perNode[node] = sem
+	}
+	return sem
+}
@@ -0,0 +1,135 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetConcurrencyLimits(t *testing.T) {
+	defer SetConcurrencyLimits(ConcurrencyLimits{})
+
+	assert.Error(t, SetConcurrencyLimits(ConcurrencyLimits{Global: -1}))
+	assert.Error(t, SetConcurrencyLimits(ConcurrencyLimits{PerNode: -1}))
+	assert.Error(t, SetConcurrencyLimits(ConcurrencyLimits{PerWorkerType: map[WorkerType]int{PushTokens: -1}}))
+	assert.Error(t, SetConcurrencyLimits(ConcurrencyLimits{PerWorkerType: map[WorkerType]int{invalid: 1}}))
+	assert.NoError(t, SetConcurrencyLimits(ConcurrencyLimits{Global: 1, PerNode: 1, PerWorkerType: map[WorkerType]int{PushTokens: 1}}))
+}
+
+// runConcurrently runs numOps operations through the concurrencyLimiter at the same time, using nodeFunc to pick the node for each
+// operation, and returns the maximum number of operations that were running at once for each node
+func runConcurrently(l *concurrencyLimiter, wt WorkerType, numOps int, nodeFunc func(int) string) (maxTotal int32, maxPerNode map[string]int32) {
+	var running atomic.Int32
+	var mu sync.Mutex
+	runningPerNode := make(map[string]int32)
+	maxPerNode = make(map[string]int32)
+
+	var wg sync.WaitGroup
+	for i := range numOps {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			release, err := l.acquire(context.Background(), wt, node)
+			if err != nil {
+				return
+			}
+			defer release()
+
+			now := running.Add(1)
+			mu.Lock()
+			if now > maxTotal {
+				maxTotal = now
+			}
+			runningPerNode[node]++
+			if runningPerNode[node] > maxPerNode[node] {
+				maxPerNode[node] = runningPerNode[node]
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			runningPerNode[node]--
+			mu.Unlock()
+			running.Add(-1)
+		}(nodeFunc(i))
+	}
+	wg.Wait()
+	return maxTotal, maxPerNode
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	oneNode := func(int) string { return "node1" }
+	twoNodes := func(i int) string {
+		if i%2 == 0 {
+			return "node1"
+		}
+		return "node2"
+	}
+
+	t.Run("No limits", func(t *testing.T) {
+		l := newConcurrencyLimiter(ConcurrencyLimits{})
+		maxTotal, _ := runConcurrently(l, PushTokens, 10, oneNode)
+		assert.Equal(t, int32(10), maxTotal)
+	})
+
+	t.Run("Global limit", func(t *testing.T) {
+		l := newConcurrencyLimiter(ConcurrencyLimits{Global: 3})
+		maxTotal, _ := runConcurrently(l, PushTokens, 10, twoNodes)
+		assert.Equal(t, int32(3), maxTotal)
+	})
+
+	t.Run("Worker type limit only applies to that worker type", func(t *testing.T) {
+		l := newConcurrencyLimiter(ConcurrencyLimits{PerWorkerType: map[WorkerType]int{PushTokens: 2}})
+		maxTotal, _ := runConcurrently(l, PushTokens, 10, twoNodes)
+		assert.Equal(t, int32(2), maxTotal)
+		maxTotal, _ = runConcurrently(l, PingAggregator, 10, twoNodes)
+		assert.Equal(t, int32(10), maxTotal)
+	})
+
+	t.Run("Per-node limit", func(t *testing.T) {
+		l := newConcurrencyLimiter(ConcurrencyLimits{PerNode: 2})
+		maxTotal, maxPerNode := runConcurrently(l, PushTokens, 10, twoNodes)
+		assert.Equal(t, int32(4), maxTotal)
+		assert.Equal(t, map[string]int32{"node1": 2, "node2": 2}, maxPerNode)
+	})
+}
+
+func TestConcurrencyLimiterContextDone(t *testing.T) {
+	l := newConcurrencyLimiter(ConcurrencyLimits{Global: 1, PerWorkerType: map[WorkerType]int{PushTokens: 2}})
+	release, err := l.acquire(context.Background(), PushTokens, "node1")
+	if err != nil {
+		t.Fatalf("Could not acquire first slot: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx, PushTokens, "node1")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// The worker type slot that the failed call got should have been given back
+	assert.Len(t, l.perWorkerType[PushTokens], 1)
+	release()
+	assert.Len(t, l.perWorkerType[PushTokens], 0)
+	assert.Len(t, l.global, 0)
+}
@@ -19,6 +19,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -30,7 +32,6 @@ import (
 	"github.com/fermitools/managed-tokens/internal/contextStore"
 	"github.com/fermitools/managed-tokens/internal/metrics"
 	"github.com/fermitools/managed-tokens/internal/notifications"
-	"github.com/fermitools/managed-tokens/internal/service"
 	"github.com/fermitools/managed-tokens/internal/tracing"
 	"github.com/fermitools/managed-tokens/internal/vaultToken"
 )
@@ -80,25 +81,11 @@ func init() {
 
 }
 
-// vaultStorerSuccess is a type that conveys whether StoreAndGetTokenWorker successfully stores and obtains tokens for each service
-type vaultStorerSuccess struct {
-	service.Service
-	success bool
-}
-
-func (v *vaultStorerSuccess) GetService() service.Service {
-	return v.Service
-}
-
-func (v *vaultStorerSuccess) GetSuccess() bool {
-	return v.success
-}
-
-// TODO Tests for both this worker func and the helper
-
 // storeAndGetTokenWorker is a worker that listens on chans.GetServiceConfigChan(), and for the received worker.Config objects,
-// stores a refresh token in the configured vault and obtains vault and bearer tokens.  It returns when chans.GetServiceConfigChan() is closed,
-// and it will in turn close the other chans in the passed in ChannelsForWorkers
+// stores a refresh token in the configured vault and obtains vault and bearer tokens.  The services, and the schedds for each service,
+// are handled concurrently, with at most as many token storers running at once as the concurrency limits allow.  Each token storer
+// stages its vault token in its own directory.
+// It returns when chans.GetServiceConfigChan() is closed, and it will in turn close the other chans in the passed in ChannelsForWorkers
 func storeAndGetTokenWorker(ctx context.Context, chans channelGroup) {
 	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "worker.StoreAndGetTokenWorker")
 	defer span.End()
@@ -118,16 +105,25 @@ func storeAndGetTokenWorker(ctx context.Context, chans channelGroup) {
 		log.Debug("Using default timeout for vault storer")
 	}
 
+	var configWg sync.WaitGroup
 	for sc := range chans.serviceConfigChan {
-		func(sc *Config) {
-			success := &vaultStorerSuccess{
+		configWg.Add(1)
+		go func(sc *Config) {
+			defer configWg.Done()
+			ctx, cancel := serviceContext(ctx, sc, StoreAndGetToken)
+			defer cancel()
+
+			// Each schedd's goroutine records its outcome at the schedd's index
+			result := &StoreAndGetTokenResult{
 				Service: sc.Service,
-				success: true,
+				Schedds: make([]OperationResult, len(sc.Schedds)),
+				Start:   time.Now(),
 			}
 
-			defer func(s *vaultStorerSuccess) {
-				chans.successChan <- s
-			}(success)
+			defer func(r *StoreAndGetTokenResult) {
+				r.End = time.Now()
+				chans.successChan <- r
+			}(result)
 
 			configLogger := log.WithFields(log.Fields{
 				"experiment": sc.Service.Experiment(),
@@ -141,9 +137,18 @@ func storeAndGetTokenWorker(ctx context.Context, chans channelGroup) {
 				interactive = false
 			}
 
-			errsToReport := make([]error, 0) // slice of errors we need to specifically highlight
-			for _, schedd := range sc.Schedds {
-				func(ctx context.Context, schedd string) {
+			// Authentication can't happen without someone to do it, so don't retry non-interactive token storers that need it
+			retryPolicy := getRetryPolicyFromConfig(*sc, StoreAndGetToken)
+			if !interactive {
+				retryPolicy = retryPolicy.withRetryable(isNotAuthNeededError)
+			}
+
+			errsToReport := make([]error, len(sc.Schedds)) // errors we need to specifically highlight, at each schedd's index
+			var scheddWg sync.WaitGroup
+			for i, schedd := range sc.Schedds {
+				scheddWg.Add(1)
+				go func(ctx context.Context, i int, schedd string) {
+					defer scheddWg.Done()
 					ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "worker.StoreAndGetTokenWorker_anonFunc")
 					span.SetAttributes(attribute.String("service", sc.ServiceNameFromExperimentAndRole()))
 					span.SetAttributes(attribute.String("schedd", schedd))
@@ -151,30 +156,69 @@ func storeAndGetTokenWorker(ctx context.Context, chans channelGroup) {
 
 					scheddLogger := configLogger.WithField("schedd", schedd)
 
+					// Record the outcome for this schedd, however we return
+					start := time.Now()
+					var attempts uint
+					var scheddErr error
+					defer func() {
+						result.Schedds[i] = newOperationResult(schedd, start, attempts, scheddErr)
+					}()
+
+					// Wait for our turn, so that we stay within the configured concurrency limits
+					release, err := acquireSlot(ctx, StoreAndGetToken, "")
+					if err != nil {
+						scheddErr = err
+						errsToReport[i] = fmt.Errorf("%s: %w", schedd, err)
+						tracing.LogErrorWithTrace(span, scheddLogger, "Could not start storing and getting vault token for schedd")
+						return
+					}
+					defer release()
+
+					// Stage the vault token for this schedd in its own directory, so that it doesn't clash with the other schedds' token storers
+					stagingDir, err := os.MkdirTemp(os.TempDir(), "managed_tokens_vault_storer_")
+					if err != nil {
+						scheddErr = fmt.Errorf("could not create staging directory for vault token: %w", err)
+						errsToReport[i] = fmt.Errorf("%s: %w", schedd, scheddErr)
+						tracing.LogErrorWithTrace(span, scheddLogger, scheddErr.Error())
+						return
+					}
+					defer func() {
+						if err := keepUnstoredVaultToken(sc.Service.Name(), stagingDir); err != nil {
+							scheddLogger.Errorf("Could not keep vault token that was not stored for schedd: %s", err)
+						}
+						if err := os.RemoveAll(stagingDir); err != nil {
+							scheddLogger.Errorf("Could not remove vault token staging directory %s: %s", stagingDir, err)
+						}
+					}()
+
 					var useTokenStorerAndGetter TokenStorerAndGetter
 					if alternateTokenStorerAndGetter, err := getAlternateTokenStorerAndGetterOptionFromConfig(*sc, StoreAndGetToken); err == nil && alternateTokenStorerAndGetter != nil {
 						useTokenStorerAndGetter = alternateTokenStorerAndGetter
 						scheddLogger.Debug("Using alternate token storer and getter from service config")
 					} else {
-						useTokenStorerAndGetter = vaultToken.NewVaultStorerClient(schedd, sc.VaultServer, &sc.CommandEnvironment)
+						useTokenStorerAndGetter = vaultToken.NewVaultStorerClient(schedd, sc.VaultServer, &sc.CommandEnvironment).
+							WithVaultTokenFile(vaultToken.GetCondorVaultTokenLocationInDir(stagingDir, sc.Service.Name()))
 					}
 
-					vaultStorerContext, vaultStorerCancel := context.WithTimeout(ctx, vaultStorerTimeout)
-					defer vaultStorerCancel()
-
-					if err := storeAndGetTokensForSchedd(
-						vaultStorerContext,
-						useTokenStorerAndGetter,
-						sc.Service.Name(),
-						sc.ServiceCreddVaultTokenPathRoot,
-						interactive); err != nil {
-						success.success = false
+					// Each attempt gets the whole vault storer timeout, so that one that hangs can still be retried
+					attempts, err = retry(ctx, retryPolicy, StoreAndGetToken, sc.Service.Name(),
+						withAttemptTimeout(getServiceTimeout(ctx, vaultStorerTimeout), func(ctx context.Context) error {
+							return storeAndGetTokensForSchedd(
+								ctx,
+								useTokenStorerAndGetter,
+								sc.Service.Name(),
+								sc.ServiceCreddVaultTokenPathRoot,
+								stagingDir,
+								interactive)
+						}))
+					if err != nil {
+						scheddErr = err
 
 						// Check to see if we need to report a specific error
 						var msg string
 						if errors.Is(err, context.DeadlineExceeded) {
 							msg = "timeout error"
-							errsToReport = append(errsToReport, fmt.Errorf("%s: %s", schedd, msg))
+							errsToReport[i] = fmt.Errorf("%s: %s", schedd, msg)
 						} else {
 							msg = "could not store and get vault tokens for schedd"
 							unwrappedErr := errors.Unwrap(err)
@@ -183,7 +227,7 @@ func storeAndGetTokenWorker(ctx context.Context, chans channelGroup) {
 								var authNeededErrorPtr *vaultToken.ErrAuthNeeded
 								if errors.As(unwrappedErr, &authNeededErrorPtr) {
 									msg = fmt.Sprintf("%s: %s", msg, unwrappedErr.Error())
-									errsToReport = append(errsToReport, fmt.Errorf("%s: %w", schedd, unwrappedErr))
+									errsToReport[i] = fmt.Errorf("%s: %w", schedd, unwrappedErr)
 								}
 							}
 						}
@@ -191,31 +235,40 @@ func storeAndGetTokenWorker(ctx context.Context, chans channelGroup) {
 						return
 					}
 					tracing.LogSuccessWithTrace(span, scheddLogger, "Successfully got and stored vault token for schedd")
-				}(ctx, schedd)
+				}(ctx, i, schedd)
 			}
+			scheddWg.Wait()
 
-			if !success.success {
+			if !result.GetSuccess() {
 				msg := "Could not store and get vault tokens"
 				for _, err := range errsToReport {
-					msg = fmt.Sprintf("%s; %s", msg, err.Error())
+					if err != nil {
+						msg = fmt.Sprintf("%s; %s", msg, err.Error())
+					}
+				}
+				// The schedds' errors are the cause, so that the notification can suggest how to fix them
+				causes := make([]error, 0, len(result.Schedds))
+				for _, r := range result.Schedds {
+					causes = append(causes, r.Err)
 				}
 				tracing.LogErrorWithTrace(span, configLogger, msg)
-				chans.notificationsChan <- notifications.NewSetupError(msg, sc.ServiceNameFromExperimentAndRole())
+				chans.notificationsChan <- notifications.NewSetupError(msg, sc.ServiceNameFromExperimentAndRole()).WithCause(errors.Join(causes...))
 				return
 			}
 			tracing.LogSuccessWithTrace(span, configLogger, "Successfully got and stored vault tokens for all schedds")
 		}(sc)
 	}
+	configWg.Wait()
 }
 
 // storeAndGetTokensForSchedd handles the process of staging, storing, and retrieving vault tokens
 // for a given service and credd (credential daemon) combination. It performs the following steps:
-//  1. Attempts to stage a previously stored token file, handling cases where no prior token exists
+//  1. Attempts to stage a previously stored token file in stagingDir, handling cases where no prior token exists
 //     or where staging fails.
 //  2. Ensures that any new token obtained is stored for future use, provided the operation succeeds.
 //  3. Calls the provided TokenStorerAndGetter to obtain and store a new vault token, optionally
-//     using interactive mode.
-func storeAndGetTokensForSchedd(ctx context.Context, t TokenStorerAndGetter, serviceName string, tokenRootPath string, interactive bool) error {
+//     using interactive mode.  The TokenStorerAndGetter is expected to use the vault token staged in stagingDir.
+func storeAndGetTokensForSchedd(ctx context.Context, t TokenStorerAndGetter, serviceName, tokenRootPath, stagingDir string, interactive bool) error {
 	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "worker.StoreAndGetTokensForSchedd")
 	span.SetAttributes(attribute.String("tokenRootPath", tokenRootPath))
 	span.SetAttributes(attribute.String("service", serviceName))
@@ -238,17 +291,7 @@ func storeAndGetTokensForSchedd(ctx context.Context, t TokenStorerAndGetter, ser
 	}
 
 	// Stage prior vault token, if it exists
-	restorePriorTokenFunc, err := backupCondorVaultToken(serviceName)
-	if err != nil {
-		funcLogger.Errorf("Error backing up current vault token at %s.  Will overwrite this with a new vault token.", vaultToken.GetCondorVaultTokenLocation(serviceName))
-	}
-	defer func() {
-		if err := restorePriorTokenFunc(); err != nil {
-			funcLogger.Errorf("Error restoring prior condor vault token.  Please see the logs to see where the token might have been backed up.")
-		}
-	}()
-
-	if err = stageStoredTokenFile(tokenRootPath, serviceName, t.GetCredd()); err != nil {
+	if err := stageStoredTokenFile(tokenRootPath, serviceName, t.GetCredd(), stagingDir); err != nil {
 		switch {
 		case errors.Is(err, errNoServiceCreddToken):
 			funcLogger.Info("No prior vault token exists for this service/credd combination.  Will get a new vault token")
@@ -262,12 +305,10 @@ func storeAndGetTokensForSchedd(ctx context.Context, t TokenStorerAndGetter, ser
 
 	// Make sure we store whatever comes out of storing the vault token, if that is a successful operation.
 	// Note that if this operation fails, assuming we got a condor vault token, that will
-	// stick around unless something else cleans up vault tokens.  This is actually OK, since
-	// eventually that vault token will expire, and htgettoken will determine that a new one is
-	// needed.
+	// stick around in stagingDir for the caller to deal with.
 	defer func() {
 		if success {
-			if err = storeServiceTokenForCreddFile(tokenRootPath, serviceName, t.GetCredd()); err != nil {
+			if err := storeServiceTokenForCreddFile(tokenRootPath, serviceName, t.GetCredd(), stagingDir); err != nil {
 				funcLogger.Error("Could not store condor vault token for credd for future runs.  Please investigate")
 			}
 		}
@@ -3,12 +3,16 @@ package worker
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/vaultToken"
 )
 
 func TestStoreAndGetTokenWorker(t *testing.T) {
@@ -50,6 +54,15 @@ func TestStoreAndGetTokenWorker(t *testing.T) {
 		case s := <-chans.GetSuccessChan():
 			assert.Equal(t, s.GetService().Name(), "testbad_service", "Expected service name to be 'testbad_service'")
 			assert.False(t, s.GetSuccess(), "Expected success=false on getTokenSuccess, got success=true")
+			if r, ok := s.(*StoreAndGetTokenResult); assert.True(t, ok, "Expected a *StoreAndGetTokenResult, got %T", s) {
+				if assert.Len(t, r.Schedds, 1) {
+					assert.Equal(t, "bad_schedd", r.Schedds[0].Target)
+					assert.Error(t, r.Schedds[0].Err)
+					assert.Equal(t, ErrorClassOther, r.Schedds[0].ErrorClass)
+					assert.Equal(t, uint(1), r.Schedds[0].Attempts)
+				}
+				assert.False(t, r.End.Before(r.Start))
+			}
 		case <-time.After(10 * time.Second):
 			t.Error("Expected getTokenSuccess on SuccessChan, got none after 10 second timeout")
 		}
@@ -95,6 +108,149 @@ func TestStoreAndGetTokenWorker(t *testing.T) {
 	})
 }
 
+func TestStoreAndGetTokenWorkerConcurrentSchedds(t *testing.T) {
+	schedds := []string{"schedd1", "schedd2", "schedd3"}
+	f := &blockingTokenStorerAndGetter{started: make(chan struct{}), release: make(chan struct{})}
+
+	chans := NewChannelsForWorkers(1)
+	s := service.NewService("testconcurrent_service")
+	sc, _ := NewConfig(s, SetSchedds(schedds), SetAlternateTokenStorerAndGetterOption(StoreAndGetToken, f))
+	chans.GetServiceConfigChan() <- sc
+	close(chans.GetServiceConfigChan())
+	go storeAndGetTokenWorker(context.Background(), chans)
+
+	// Every schedd's token storer has to be running at the same time for this to finish
+	for range schedds {
+		select {
+		case <-f.started:
+		case <-time.After(10 * time.Second):
+			t.Fatal("Token storers for all schedds did not start concurrently")
+		}
+	}
+	close(f.release)
+
+	select {
+	case s := <-chans.GetSuccessChan():
+		assert.True(t, s.GetSuccess())
+		if r, ok := s.(*StoreAndGetTokenResult); assert.True(t, ok, "Expected a *StoreAndGetTokenResult, got %T", s) && assert.Len(t, r.Schedds, len(schedds)) {
+			for i, schedd := range schedds {
+				assert.Equal(t, schedd, r.Schedds[i].Target)
+				assert.True(t, r.Schedds[i].Success())
+			}
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("Expected storeAndGetTokenSuccess on SuccessChan, got none after 10 second timeout")
+	}
+}
+
+func TestStoreAndGetTokenWorkerStagesAndStoresVaultToken(t *testing.T) {
+	// Keep the staging directories and the standard HTCondor vault token location out of the real temporary directory
+	t.Setenv("TMPDIR", t.TempDir())
+	schedd := "test_schedd"
+
+	type testCase struct {
+		description           string
+		shouldFail            bool
+		removeTokenRootPath   bool   // Whether the token storer should remove the service-credd vault token storage path, so that storing fails
+		expectedStoredToken   string // What should be left in the service-credd vault token storage path
+		expectedUnstoredToken string // What should be left in the standard HTCondor vault token location
+	}
+
+	testCases := []testCase{
+		{
+			description:         "Token storer succeeds",
+			expectedStoredToken: "new token from prior token",
+		},
+		{
+			description:         "Token storer fails after getting new vault token",
+			shouldFail:          true,
+			expectedStoredToken: "new token from prior token",
+		},
+		{
+			description:           "New vault token cannot be stored for credd",
+			removeTokenRootPath:   true,
+			expectedUnstoredToken: "new token from prior token",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.description, func(t *testing.T) {
+			serviceName := "teststaging_service"
+			tokenRootPath := t.TempDir()
+			storedTokenLocation := getServiceTokenForCreddLocation(tokenRootPath, serviceName, schedd)
+			unstoredTokenLocation := vaultToken.GetCondorVaultTokenLocation(serviceName)
+			t.Cleanup(func() { os.Remove(unstoredTokenLocation) })
+			if err := os.WriteFile(storedTokenLocation, []byte("prior token"), 0400); err != nil {
+				t.Fatalf("Could not write prior vault token: %s", err)
+			}
+
+			f := &stagingTokenStorerAndGetter{credd: schedd, shouldFail: test.shouldFail}
+			if test.removeTokenRootPath {
+				f.removeDir = tokenRootPath
+			}
+			chans := NewChannelsForWorkers(1)
+			sc, _ := NewConfig(service.NewService(serviceName), SetSchedds([]string{schedd}), SetServiceCreddVaultTokenPathRoot(tokenRootPath),
+				SetAlternateTokenStorerAndGetterOption(StoreAndGetToken, f))
+			chans.GetServiceConfigChan() <- sc
+			close(chans.GetServiceConfigChan())
+			go storeAndGetTokenWorker(context.Background(), chans)
+			go func() {
+				for range chans.GetNotificationsChan() {
+				}
+			}()
+
+			select {
+			case s := <-chans.GetSuccessChan():
+				assert.Equal(t, !test.shouldFail, s.GetSuccess())
+			case <-time.After(10 * time.Second):
+				t.Fatal("Expected storeAndGetTokenSuccess on SuccessChan, got none after 10 second timeout")
+			}
+
+			// The token storer should have been given the prior vault token in its own staging directory
+			if assert.Len(t, f.stagingDirs, 1) {
+				assert.NotEqual(t, os.TempDir(), f.stagingDirs[0])
+				assert.NoDirExists(t, f.stagingDirs[0], "Staging directory should have been removed")
+			}
+			assert.Equal(t, "prior token", f.stagedToken)
+
+			if test.expectedStoredToken != "" {
+				contents, err := os.ReadFile(storedTokenLocation)
+				assert.NoError(t, err)
+				assert.Equal(t, test.expectedStoredToken, string(contents))
+			} else {
+				assert.NoFileExists(t, storedTokenLocation)
+			}
+			if test.expectedUnstoredToken != "" {
+				contents, err := os.ReadFile(unstoredTokenLocation)
+				assert.NoError(t, err)
+				assert.Equal(t, test.expectedUnstoredToken, string(contents))
+			} else {
+				assert.NoFileExists(t, unstoredTokenLocation)
+			}
+		})
+	}
+}
+
+// blockingTokenStorerAndGetter is a TokenStorerAndGetter that signals on started when GetAndStoreToken is called, and then waits for release
+// to be closed
+type blockingTokenStorerAndGetter struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingTokenStorerAndGetter) GetAndStoreToken(ctx context.Context, serviceName string, interactive bool) error {
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *blockingTokenStorerAndGetter) GetCredd() string       { return "test_schedd" }
+func (b *blockingTokenStorerAndGetter) GetVaultServer() string { return "test_vault_server" }
+
 type fakeTokenStorerAndGetter struct {
 	t           *testing.T
 	credd       string
@@ -112,3 +268,45 @@ func (f *fakeTokenStorerAndGetter) GetAndStoreToken(ctx context.Context, service
 
 func (f *fakeTokenStorerAndGetter) GetCredd() string       { return f.credd }
 func (f *fakeTokenStorerAndGetter) GetVaultServer() string { return f.vaultServer }
+
+// stagingTokenStorerAndGetter is a TokenStorerAndGetter that, like condor_vault_storer, reads the vault token staged for it and replaces it
+// with a new one.  It finds the staging directory by looking for the only one in os.TempDir().
+type stagingTokenStorerAndGetter struct {
+	credd       string
+	shouldFail  bool
+	removeDir   string // If set, this directory is removed after the new vault token is written
+	stagingDirs []string
+	stagedToken string
+}
+
+func (s *stagingTokenStorerAndGetter) GetAndStoreToken(ctx context.Context, serviceName string, interactive bool) error {
+	stagingDirs, err := filepath.Glob(filepath.Join(os.TempDir(), "managed_tokens_vault_storer_*"))
+	if err != nil || len(stagingDirs) != 1 {
+		return fmt.Errorf("expected one staging directory, got %v: %w", stagingDirs, err)
+	}
+	s.stagingDirs = stagingDirs
+	stagedTokenLocation := vaultToken.GetCondorVaultTokenLocationInDir(stagingDirs[0], serviceName)
+	stagedToken, err := os.ReadFile(stagedTokenLocation)
+	if err != nil {
+		return err
+	}
+	s.stagedToken = string(stagedToken)
+	if err := os.Remove(stagedTokenLocation); err != nil {
+		return err
+	}
+	if err := os.WriteFile(stagedTokenLocation, []byte("new token from "+s.stagedToken), 0400); err != nil {
+		return err
+	}
+	if s.removeDir != "" {
+		if err := os.RemoveAll(s.removeDir); err != nil {
+			return err
+		}
+	}
+	if s.shouldFail {
+		return errors.New("simulated error")
+	}
+	return nil
+}
+
+func (s *stagingTokenStorerAndGetter) GetCredd() string       { return s.credd }
+func (s *stagingTokenStorerAndGetter) GetVaultServer() string { return "test_vault_server" }
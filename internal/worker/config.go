@@ -21,10 +21,13 @@
 package worker
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/fermitools/managed-tokens/internal/contextStore"
 	"github.com/fermitools/managed-tokens/internal/environment"
 	"github.com/fermitools/managed-tokens/internal/service"
 )
@@ -33,6 +36,16 @@ const (
 	retryDefault = 0
 )
 
+// NodeOptions holds the settings for a single destination node that differ from the settings of its service
+type NodeOptions struct {
+	Account           string   `json:"account,omitempty"`           // If set, the user account to connect to the node as, instead of Config.Account
+	Port              int      `json:"port,omitempty"`              // If nonzero, the port of the node's ssh server
+	JumpHost          string   `json:"jumpHost,omitempty"`          // If set, the jump host (bastion) to connect to the node through.  The node is pinged through this host too
+	SSHOptions        []string `json:"sshOptions,omitempty"`        // ssh options to use for this node, in addition to the service's SSHOptions
+	FileCopierOptions []string `json:"fileCopierOptions,omitempty"` // File copier options to use for this node, in addition to the service's FileCopierOptions
+	PingOptions       []string `json:"pingOptions,omitempty"`       // ping options to use for this node, in addition to the service's PingOptions
+}
+
 // unPingableNodes holds the set of nodes that do not respond to a ping request
 type unPingableNodes struct {
 	sync.Map
@@ -54,6 +67,12 @@ type Config struct {
 	// intends to use a GetTokenWorker, keep this field as nil or set it to nil
 	Schedds     []string
 	VaultServer string // The vault server hosting the Hashicorp Vault that the refresh token should be saved to
+	// PipelineTimeout, if positive, is the most time the Config may spend going through a Pipeline, from when it is sent to the Pipeline's
+	// first stage.  Once it is up, the operations that the Workers are running for the Config are canceled
+	PipelineTimeout time.Duration
+	// NodeOptions holds the settings of the destination nodes that differ from those of the service, keyed by node.  Nodes that are not
+	// in NodeOptions use the service's settings
+	NodeOptions map[string]NodeOptions
 	// Extras is a map where any value can be stored that may not fit into the above categories.
 	// To allow an external package to set an Extras value, define an exported func that sets
 	// the value directly.  For example:
@@ -71,6 +90,8 @@ type Config struct {
 	//  }
 	// Then the caller should check ok to make sure it's true before using the value
 	Extras map[supportedExtrasKey]any
+	// pipelineDeadline is set by Pipeline.Run from PipelineTimeout when the Config is sent through a Pipeline
+	pipelineDeadline time.Time
 	// workerSpecificConfig is a map of values that are specific to a worker type.  This is useful for setting values that are specific to a worker
 	workerSpecificConfig map[WorkerType]map[WorkerSpecificConfigOption]any
 	environment.CommandEnvironment
@@ -122,6 +143,8 @@ func backupConfig(c1 *Config) *Config {
 		Service:                        c1.Service,
 		UserPrincipal:                  c1.UserPrincipal,
 		Nodes:                          c1.Nodes,
+		NodeOptions:                    c1.NodeOptions,
+		PipelineTimeout:                c1.PipelineTimeout,
 		Account:                        c1.Account,
 		KeytabPath:                     c1.KeytabPath,
 		ServiceCreddVaultTokenPathRoot: c1.ServiceCreddVaultTokenPathRoot,
@@ -155,6 +178,42 @@ func (c *Config) IsNodeUnpingable(node string) bool {
 	return ok
 }
 
+// nodeOptions returns the NodeOptions for node.  If there are none, the zero NodeOptions is returned
+func (c *Config) nodeOptions(node string) NodeOptions {
+	return c.NodeOptions[node]
+}
+
+// accountForNode returns the user account that should be used to connect to node
+func (c *Config) accountForNode(node string) string {
+	if account := c.nodeOptions(node).Account; account != "" {
+		return account
+	}
+	return c.Account
+}
+
+// serviceContext returns the context that the Worker of WorkerType wt should run its operations for c with.  If c has its own timeout
+// for wt, it is stored in the returned context as the override timeout (see contextStore.WithOverrideTimeout), so that it takes precedence
+// over the timeout the Worker was started with.  If c has a Pipeline deadline, the returned context is canceled at that deadline.  Callers
+// must call the returned context.CancelFunc once they are done.
+func serviceContext(ctx context.Context, c *Config, wt WorkerType) (context.Context, context.CancelFunc) {
+	if timeout, ok := getWorkerTimeoutValueFromConfig(*c, wt); ok && timeout > 0 {
+		ctx = contextStore.WithOverrideTimeout(ctx, timeout)
+	}
+	if !c.pipelineDeadline.IsZero() {
+		return context.WithDeadline(ctx, c.pipelineDeadline)
+	}
+	return context.WithCancel(ctx)
+}
+
+// getServiceTimeout returns the timeout for an operation that is run with ctx, as returned by serviceContext.  If neither the Config nor
+// the Worker has an override timeout, workerTimeout is returned.
+func getServiceTimeout(ctx context.Context, workerTimeout time.Duration) time.Duration {
+	if timeout, err := contextStore.GetOverrideTimeout(ctx); err == nil {
+		return timeout
+	}
+	return workerTimeout
+}
+
 // initializeWorkerSpecificConfigDefaults initializes and returns a map of default configuration values for each worker type.
 func initializeWorkerSpecificConfigDefaults() map[WorkerType]map[WorkerSpecificConfigOption]any {
 	m := make(map[WorkerType]map[WorkerSpecificConfigOption]any, 0)
@@ -16,6 +16,8 @@
 package worker
 
 import (
+	"time"
+
 	"github.com/fermitools/managed-tokens/internal/environment"
 )
 
@@ -66,6 +68,20 @@ func SetNodes(value []string) ConfigOption {
 	})
 }
 
+func SetNodeOptions(value map[string]NodeOptions) ConfigOption {
+	return ConfigOption(func(c *Config) error {
+		c.NodeOptions = value
+		return nil
+	})
+}
+
+func SetPipelineTimeout(value time.Duration) ConfigOption {
+	return ConfigOption(func(c *Config) error {
+		c.PipelineTimeout = value
+		return nil
+	})
+}
+
 func SetAccount(value string) ConfigOption {
 	return ConfigOption(func(c *Config) error {
 		c.Account = value
@@ -17,6 +17,7 @@ package worker
 
 import (
 	"testing"
+	"time"
 
 	"github.com/fermitools/managed-tokens/internal/environment"
 	"github.com/stretchr/testify/assert"
@@ -59,6 +60,22 @@ func TestAllConfigOptions(t *testing.T) {
 			[]string{"node1", "node2"},
 			func() any { return c.Nodes },
 		},
+		{
+			"SetNodeOptions",
+			func() ConfigOption {
+				return SetNodeOptions(map[string]NodeOptions{"node1": {Account: "nodeaccount", Port: 2222}})
+			},
+			map[string]NodeOptions{"node1": {Account: "nodeaccount", Port: 2222}},
+			func() any { return c.NodeOptions },
+		},
+		{
+			"SetPipelineTimeout",
+			func() ConfigOption {
+				return SetPipelineTimeout(5 * time.Minute)
+			},
+			5 * time.Minute,
+			func() any { return c.PipelineTimeout },
+		},
 		{
 			"TestSetAccount",
 			func() ConfigOption {
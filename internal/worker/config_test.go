@@ -16,10 +16,13 @@
 package worker
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/fermitools/managed-tokens/internal/contextStore"
 	"github.com/fermitools/managed-tokens/internal/environment"
 	"github.com/fermitools/managed-tokens/internal/service"
 	testUtils "github.com/fermitools/managed-tokens/internal/testUtils"
@@ -196,6 +199,8 @@ func TestBackupConfig(t *testing.T) {
 		Service:                        s,
 		UserPrincipal:                  "user_principal",
 		Nodes:                          []string{"node1", "node2"},
+		NodeOptions:                    map[string]NodeOptions{"node2": {Port: 2222}},
+		PipelineTimeout:                time.Minute,
 		Account:                        "myaccount",
 		KeytabPath:                     "/path/to/keytab",
 		ServiceCreddVaultTokenPathRoot: "/path/to/service/credd/vaulttoken/path/root",
@@ -219,6 +224,8 @@ func TestBackupConfig(t *testing.T) {
 	assert.Equal(t, c1.Service, c2.Service)
 	assert.Equal(t, c1.UserPrincipal, c2.UserPrincipal)
 	assert.Equal(t, c1.Nodes, c2.Nodes)
+	assert.Equal(t, c1.NodeOptions, c2.NodeOptions)
+	assert.Equal(t, c1.PipelineTimeout, c2.PipelineTimeout)
 	assert.Equal(t, c1.Account, c2.Account)
 	assert.Equal(t, c1.KeytabPath, c2.KeytabPath)
 	assert.Equal(t, c1.ServiceCreddVaultTokenPathRoot, c2.ServiceCreddVaultTokenPathRoot)
@@ -253,3 +260,55 @@ func TestInitializeWorkerSpecificConfigDefaults(t *testing.T) {
 		assert.Equal(t, retryDefault, valInt)
 	}
 }
+
+func TestAccountForNode(t *testing.T) {
+	c := &Config{
+		Account:     "myaccount",
+		NodeOptions: map[string]NodeOptions{"node2": {Account: "nodeaccount"}, "node3": {Port: 2222}},
+	}
+	assert.Equal(t, "myaccount", c.accountForNode("node1"))
+	assert.Equal(t, "nodeaccount", c.accountForNode("node2"))
+	assert.Equal(t, "myaccount", c.accountForNode("node3"))
+	assert.Equal(t, NodeOptions{Port: 2222}, c.nodeOptions("node3"))
+	assert.Equal(t, NodeOptions{}, c.nodeOptions("node1"))
+}
+
+func TestServiceContext(t *testing.T) {
+	t.Run("No timeout or deadline set", func(t *testing.T) {
+		c := &Config{}
+		ctx, cancel := serviceContext(context.Background(), c, StoreAndGetToken)
+		defer cancel()
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+		assert.Equal(t, 10*time.Second, getServiceTimeout(ctx, 10*time.Second))
+	})
+
+	t.Run("Worker override timeout is used if the Config has none", func(t *testing.T) {
+		c := &Config{}
+		ctx, cancel := serviceContext(contextStore.WithOverrideTimeout(context.Background(), 20*time.Second), c, StoreAndGetToken)
+		defer cancel()
+		assert.Equal(t, 20*time.Second, getServiceTimeout(ctx, 10*time.Second))
+	})
+
+	t.Run("Config timeout takes precedence", func(t *testing.T) {
+		c, _ := NewConfig(service.NewService("myexpt_myrole"), SetTimeoutOption(StoreAndGetToken, time.Minute))
+		ctx, cancel := serviceContext(contextStore.WithOverrideTimeout(context.Background(), 20*time.Second), c, StoreAndGetToken)
+		defer cancel()
+		assert.Equal(t, time.Minute, getServiceTimeout(ctx, 10*time.Second))
+
+		// Other worker types are not affected
+		ctx2, cancel2 := serviceContext(context.Background(), c, PushTokens)
+		defer cancel2()
+		assert.Equal(t, 10*time.Second, getServiceTimeout(ctx2, 10*time.Second))
+	})
+
+	t.Run("Pipeline deadline", func(t *testing.T) {
+		deadline := time.Now().Add(time.Hour)
+		c := &Config{pipelineDeadline: deadline}
+		ctx, cancel := serviceContext(context.Background(), c, PingAggregator)
+		defer cancel()
+		d, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.Equal(t, deadline, d)
+	})
+}
@@ -22,7 +22,7 @@ import (
 	"os"
 	"os/user"
 	"path"
-	"time"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 
@@ -31,87 +31,15 @@ import (
 
 // These are functions that deal with staging and storing credd-specific vault tokens
 
-// backupCondorVaultToken looks in the standard HTCondor location for a vault token.  If it finds
-// one there, it will create a backup copy.  It returns a function that will restore the backup
-// copy to the standard HTCondor location.  This returned func should ideally be defer called
-// by the caller.
-func backupCondorVaultToken(serviceName string) (restorePriorTokenFunc func() error, retErr error) {
-	funcLogger := log.WithField("service", serviceName)
-
-	// Default value for return func
-	restorePriorTokenFunc = func() error { return nil }
-
-	// Check for token at condorVaultTokenLocation, and move it out if needed
-	// 1. If file doesn't exist, do nothing, return
-	// 2. If file exists, but can't stat it, return error, do nothing so we overwrite with good file
-	// 3. If file exists, and there is no error stat-ing it, stash it
-
-	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocation(serviceName)
-
-	_, err := os.Stat(condorVaultTokenLocation)
-	switch {
-	// (1)
-	case errors.Is(err, os.ErrNotExist):
-		funcLogger.Debugf("No existing condor vault token at %s.  No backup needed.", condorVaultTokenLocation)
-		return restorePriorTokenFunc, nil
-	// (2)
-	case err != nil:
-		funcLogger.Errorf("Could not stat condor vault token file that exists at %s: %s", condorVaultTokenLocation, err)
-		return restorePriorTokenFunc, err
-	// (3)
-	default:
-		// We had a vault token at condorVaultTokenLocation.  Move it to a temp file for now
-		previousTokenTempFile, err := os.CreateTemp(os.TempDir(), "managed_tokens_condor_vault_token")
-		if err != nil {
-			funcLogger.Error("Could not create temp file for old token file")
-			return restorePriorTokenFunc, err
-		}
-		funcLogger.Debugf("condor vault token already exists at %s.  Moving to temp location %s", condorVaultTokenLocation, previousTokenTempFile.Name())
-		// TODO:  Think about how to test this
-		if err := moveFileCrossDevice(condorVaultTokenLocation, previousTokenTempFile.Name()); err != nil {
-			if errors.Is(err, errCannotRemoveFile) {
-				funcLogger.Debug("Currently-existing condor vault token was backed up, but the original vault token was not removed.  Will try to force removal now.")
-				if err2 := os.Remove(condorVaultTokenLocation); err2 != nil {
-					funcLogger.Error("Could back up condor vault token, but could not clear vault token location.")
-					return restorePriorTokenFunc, err2
-				}
-			}
-			funcLogger.Error("Could not move currently-existing condor vault token to staging location")
-			return restorePriorTokenFunc, err
-		}
-		// Create a func to return that will restore the now-stashed token back to condorVaultTokenLocation
-		restorePriorTokenFunc = func() error {
-			// TODO:  This part is not tested.  Think about how to do that
-			if err := moveFileCrossDevice(previousTokenTempFile.Name(), condorVaultTokenLocation); err != nil {
-				if errors.Is(err, errCannotRemoveFile) {
-					funcLogger.Debug("Restored previously-existing vault token, but could not delete backup copy. Will proceed")
-					return nil
-				}
-				// Create location in os.TempDir() that is stamped for possible later retrieval
-				now := time.Now().Format(time.RFC3339)
-				finalBackupLocation := path.Join(os.TempDir(), fmt.Sprintf("managed_tokens_vt_bak-%s-%s", serviceName, now))
-				funcLogger.Errorf("Could not move previous token back to condor vault location.  Attempting to save it to %s", finalBackupLocation)
-				if err := moveFileCrossDevice(previousTokenTempFile.Name(), finalBackupLocation); err != nil {
-					funcLogger.Errorf("Could not restore previously-existing vault token.  Will not delete backup copy made at %s", previousTokenTempFile.Name())
-				}
-				return errors.New("could not restore previous token")
-			}
-			funcLogger.Debugf("Restored prior condor vault token from %s to %s", previousTokenTempFile.Name(), condorVaultTokenLocation)
-			return nil
-		}
-		return restorePriorTokenFunc, nil
-	}
-}
-
 // stageStoredTokenFile checks to see if there already exists a vault token for the given service and
-// credd.  If so, it will move that file to where HTCondor expects it (as defined by the return value of
-// getCondorVaultLocation)
-func stageStoredTokenFile(tokenRootPath, serviceName, credd string) error {
+// credd.  If so, it will move that file into the staging directory stagingDir, with the file name HTCondor expects
+// (as defined by the return value of vaultToken.GetCondorVaultTokenLocationInDir)
+func stageStoredTokenFile(tokenRootPath, serviceName, credd, stagingDir string) error {
 	funcLogger := log.WithFields(log.Fields{
 		"service": serviceName,
 		"credd":   credd,
 	})
-	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocation(serviceName)
+	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocationInDir(stagingDir, serviceName)
 
 	storedServiceCreddTokenLocation := getServiceTokenForCreddLocation(tokenRootPath, serviceName, credd)
 	if _, err := os.Stat(storedServiceCreddTokenLocation); errors.Is(err, os.ErrNotExist) {
@@ -142,14 +70,14 @@ func stageStoredTokenFile(tokenRootPath, serviceName, credd string) error {
 	return nil
 }
 
-// storeServiceTokenForCreddFile moves the vault token in the condor staging path (defined by getCondorVaultLocation)
-// to the service-credd storage path (defined by getServiceTokenForCreddLocation)
-func storeServiceTokenForCreddFile(tokenRootPath, serviceName, credd string) error {
+// storeServiceTokenForCreddFile moves the vault token in the staging directory stagingDir (defined by
+// vaultToken.GetCondorVaultTokenLocationInDir) to the service-credd storage path (defined by getServiceTokenForCreddLocation)
+func storeServiceTokenForCreddFile(tokenRootPath, serviceName, credd, stagingDir string) error {
 	funcLogger := log.WithFields(log.Fields{
 		"service": serviceName,
 		"credd":   credd,
 	})
-	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocation(serviceName)
+	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocationInDir(stagingDir, serviceName)
 	storedServiceCreddTokenLocation := getServiceTokenForCreddLocation(tokenRootPath, serviceName, credd)
 
 	funcLogger.Debug("Attempting to move condor vault token to service-credd vault token storage path")
@@ -168,6 +96,31 @@ func storeServiceTokenForCreddFile(tokenRootPath, serviceName, credd string) err
 	return nil
 }
 
+// condorVaultTokenLocationMux guards the standard HTCondor vault token location while keepUnstoredVaultToken checks and fills it
+var condorVaultTokenLocationMux sync.Mutex
+
+// keepUnstoredVaultToken moves a vault token that is still in the staging directory stagingDir, because it was not stored for its
+// credd, to the standard HTCondor location (defined by vaultToken.GetCondorVaultTokenLocation), unless there is already a vault token
+// there.  The token there will eventually expire, and htgettoken will then determine that a new one is needed.
+func keepUnstoredVaultToken(serviceName, stagingDir string) error {
+	stagedTokenLocation := vaultToken.GetCondorVaultTokenLocationInDir(stagingDir, serviceName)
+	if _, err := os.Stat(stagedTokenLocation); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	condorVaultTokenLocationMux.Lock()
+	defer condorVaultTokenLocationMux.Unlock()
+	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocation(serviceName)
+	if _, err := os.Stat(condorVaultTokenLocation); !errors.Is(err, os.ErrNotExist) {
+		log.WithField("service", serviceName).Debugf("Vault token already exists at %s.  Will not replace it with unstored vault token", condorVaultTokenLocation)
+		return nil
+	}
+	if err := moveFileCrossDevice(stagedTokenLocation, condorVaultTokenLocation); err != nil && !errors.Is(err, errCannotRemoveFile) {
+		return err
+	}
+	return nil
+}
+
 // getServiceTokenForCreddLocation returns the path where the vault token for the given service and credd
 // is stored
 func getServiceTokenForCreddLocation(tokenRootPath, serviceName, credd string) string {
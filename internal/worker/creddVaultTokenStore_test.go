@@ -68,98 +68,12 @@ func TestGetServiceTokenForCreddLocation(t *testing.T) {
 	}
 }
 
-func TestBackupCondorVaultToken(t *testing.T) {
-	service := "my_service"
-	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocation(service)
-
-	if cleanupFunc := stashCondorVaultTokenFileIfExists(t, service); cleanupFunc != nil {
-		t.Cleanup(cleanupFunc)
-	} else {
-		t.Cleanup(func() { os.Remove(condorVaultTokenLocation) })
-	}
-
-	type testCase struct {
-		description                       string
-		setupFunc                         func() (cleanupFunc func())
-		expectedRestorePriorTokenFuncNoop bool
-		expectedErrNil                    bool
-	}
-
-	testCases := []testCase{
-		{
-			"No condor vault token exists prior",
-			func() func() { return nil },
-			true,
-			true,
-		},
-		{
-			"condor vault token exists prior",
-			func() func() {
-				_, err := os.Create(condorVaultTokenLocation)
-				if err != nil {
-					t.FailNow()
-				}
-				return func() { os.Remove(condorVaultTokenLocation) }
-			},
-			false,
-			true,
-		},
-		{
-			"condor vault token exists prior, but can't be statted for some reason",
-			func() func() {
-				_, err := os.Create(condorVaultTokenLocation)
-				if err != nil {
-					t.FailNow()
-				}
-				os.Setenv("TMPDIR", "/dev/null")
-				return func() {
-					os.Remove(condorVaultTokenLocation)
-					os.Unsetenv("TMPDIR")
-				}
-			},
-			true,
-			false,
-		},
-		// TODO Need to have real test where we can't make the tempfile
-	}
-
-	for _, test := range testCases {
-		t.Run(
-			test.description,
-			func(t *testing.T) {
-				if cleanupFunc := test.setupFunc(); cleanupFunc != nil {
-					t.Cleanup(cleanupFunc)
-				}
-				restorePriorTokenFunc, err := backupCondorVaultToken(service)
-				if test.expectedRestorePriorTokenFuncNoop {
-					assert.Nil(t, restorePriorTokenFunc())
-				} else {
-					if assert.NotNil(t, restorePriorTokenFunc) {
-						t.Cleanup(func() { restorePriorTokenFunc() })
-					}
-				}
-				if test.expectedErrNil {
-					assert.NoError(t, err)
-					assert.NoFileExists(t, condorVaultTokenLocation)
-				} else {
-					assert.Error(t, err)
-				}
-			},
-		)
-	}
-
-}
-
 func TestStageStoredTokenFile(t *testing.T) {
 	service := "my_service"
 	credd := "mycredd"
 
-	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocation(service)
-	if cleanupFunc := stashCondorVaultTokenFileIfExists(t, service); cleanupFunc != nil {
-		t.Cleanup(cleanupFunc)
-	} else {
-		t.Cleanup(func() { os.Remove(condorVaultTokenLocation) })
-	}
+	stagingDir := t.TempDir()
+	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocationInDir(stagingDir, service)
 
 	testTokenContents := []byte("thisisatesttoken")
 	type testCase struct {
@@ -197,7 +111,7 @@ func TestStageStoredTokenFile(t *testing.T) {
 				if cleanupFunc := test.setupFunc(); cleanupFunc != nil {
 					t.Cleanup(cleanupFunc)
 				}
-				err := stageStoredTokenFile(tokenRootPath, service, credd)
+				err := stageStoredTokenFile(tokenRootPath, service, credd, stagingDir)
 				if test.expectedErr != nil {
 					assert.ErrorIs(t, err, test.expectedErr)
 				} else {
@@ -223,16 +137,11 @@ func TestStoreServiceTokenForCreddFile(t *testing.T) {
 	tempDir := t.TempDir()
 	defaultTokenRootPath := tempDir
 
-	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocation(service)
+	stagingDir := t.TempDir()
+	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocationInDir(stagingDir, service)
 	serviceCreddTokenStorePath := getServiceTokenForCreddLocation(defaultTokenRootPath, service, credd)
 	testTokenContents := []byte("thisisatesttoken")
 
-	if cleanupFunc := stashCondorVaultTokenFileIfExists(t, service); cleanupFunc != nil {
-		t.Cleanup(cleanupFunc)
-	} else {
-		t.Cleanup(func() { os.Remove(condorVaultTokenLocation) })
-	}
-
 	type testCase struct {
 		description    string
 		setupFunc      func() (cleanupFunc func())
@@ -274,7 +183,7 @@ func TestStoreServiceTokenForCreddFile(t *testing.T) {
 				if cleanupFunc := test.setupFunc; cleanupFunc != nil {
 					t.Cleanup(cleanupFunc())
 				}
-				err := storeServiceTokenForCreddFile(test.tokenRootPath, service, credd)
+				err := storeServiceTokenForCreddFile(test.tokenRootPath, service, credd, stagingDir)
 				if !test.expectedErrNil {
 					assert.Error(t, err)
 					return
@@ -291,6 +200,45 @@ func TestStoreServiceTokenForCreddFile(t *testing.T) {
 	}
 }
 
+func TestKeepUnstoredVaultToken(t *testing.T) {
+	service := "my_service"
+	condorVaultTokenLocation := vaultToken.GetCondorVaultTokenLocation(service)
+	if cleanupFunc := stashCondorVaultTokenFileIfExists(t, service); cleanupFunc != nil {
+		t.Cleanup(cleanupFunc)
+	} else {
+		t.Cleanup(func() { os.Remove(condorVaultTokenLocation) })
+	}
+
+	t.Run("No unstored vault token", func(t *testing.T) {
+		assert.NoError(t, keepUnstoredVaultToken(service, t.TempDir()))
+		assert.NoFileExists(t, condorVaultTokenLocation)
+	})
+
+	t.Run("Unstored vault token is kept", func(t *testing.T) {
+		stagingDir := t.TempDir()
+		stagedTokenLocation := vaultToken.GetCondorVaultTokenLocationInDir(stagingDir, service)
+		if err := os.WriteFile(stagedTokenLocation, []byte("unstoredtoken"), 0400); err != nil {
+			t.FailNow()
+		}
+		assert.NoError(t, keepUnstoredVaultToken(service, stagingDir))
+		assert.NoFileExists(t, stagedTokenLocation)
+		contents, err := os.ReadFile(condorVaultTokenLocation)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("unstoredtoken"), contents)
+	})
+
+	t.Run("Existing vault token is not replaced", func(t *testing.T) {
+		stagingDir := t.TempDir()
+		if err := os.WriteFile(vaultToken.GetCondorVaultTokenLocationInDir(stagingDir, service), []byte("othertoken"), 0400); err != nil {
+			t.FailNow()
+		}
+		assert.NoError(t, keepUnstoredVaultToken(service, stagingDir))
+		contents, err := os.ReadFile(condorVaultTokenLocation)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("unstoredtoken"), contents)
+	})
+}
+
 func TestMoveFileCrossDevice(t *testing.T) {
 	// Base case
 	curUser, _ := user.Current()
@@ -103,76 +103,96 @@ func getTokenWorker(ctx context.Context, chans channelGroup) {
 		log.Debug("Using default timeout for getToken")
 	}
 
-	// // For all the serviceConfigChans being sent in, get token
+	// For all the serviceConfigChans being sent in, get token.  Each service's success status is sent as soon as that service is
+	// processed, so that callers can act on each service without waiting for the rest
 	for sc := range chans.serviceConfigChan {
-		scLogger := log.WithField("service", sc.Service.Name())
+		func(sc *Config) {
+			scLogger := log.WithField("service", sc.Service.Name())
 
-		success := &getTokenSuccess{
-			Service: sc.Service,
-			success: true,
-		}
+			ctx, cancel := serviceContext(ctx, sc, GetToken)
+			defer cancel()
 
-		defer func(s *getTokenSuccess) {
-			chans.successChan <- s
-		}(success)
+			success := &getTokenSuccess{
+				Service: sc.Service,
+				success: true,
+			}
 
-		getTokenTimeoutCtx, getTokenCancel := context.WithTimeout(ctx, getTokenTimeout)
-		defer getTokenCancel()
+			defer func(s *getTokenSuccess) {
+				chans.successChan <- s
+			}(success)
+
+			// Wait for our turn, so that we stay within the configured concurrency limits
+			release, err := acquireSlot(ctx, GetToken, "")
+			if err != nil {
+				success.success = false
+				chans.notificationsChan <- notifications.NewSetupError(fmt.Sprintf("could not start getting vault token: %s", err), sc.Service.Name())
+				tracing.LogErrorWithTrace(span, scLogger, "Could not start getting vault token")
+				return
+			}
+			defer release()
 
-		interactive, err := getInteractiveTokenGetterOptionFromConfig(*sc, GetToken)
-		if err != nil {
-			scLogger.Errorf("Could not get interactive token getter option from config. Assuming false: %s", err.Error())
-			interactive = false
-		}
+			interactive, err := getInteractiveTokenGetterOptionFromConfig(*sc, GetToken)
+			if err != nil {
+				scLogger.Errorf("Could not get interactive token getter option from config. Assuming false: %s", err.Error())
+				interactive = false
+			}
 
-		if interactive {
-			scLogger.Debug("Using interactive token getter as per service config")
-		}
+			if interactive {
+				scLogger.Debug("Using interactive token getter as per service config")
+			}
 
-		// Check the kind of TokenGetter to use. If there's no AlternateTokenGetterOption set, use the default token getter
-		var useTokenGetter TokenGetter
-		useTokenGetter = &tokenGetterConfig{
-			vaultServer:   sc.VaultServer,
-			tokenRootPath: sc.ServiceCreddVaultTokenPathRoot,
-			serviceName:   sc.Service.Name(),
-			interactive:   interactive,
-			environ:       &sc.CommandEnvironment,
-		} // Default
-
-		if alternateTokenGetter, err := getAlternateTokenGetterOptionFromConfig(*sc, GetToken); err == nil && alternateTokenGetter != nil {
-			useTokenGetter = alternateTokenGetter
-			scLogger.Debug("Using alternate token getter from service config")
-		}
+			// Check the kind of TokenGetter to use. If there's no AlternateTokenGetterOption set, use the default token getter
+			var useTokenGetter TokenGetter
+			useTokenGetter = &tokenGetterConfig{
+				vaultServer:   sc.VaultServer,
+				tokenRootPath: sc.ServiceCreddVaultTokenPathRoot,
+				serviceName:   sc.Service.Name(),
+				interactive:   interactive,
+				environ:       &sc.CommandEnvironment,
+			} // Default
+
+			if alternateTokenGetter, err := getAlternateTokenGetterOptionFromConfig(*sc, GetToken); err == nil && alternateTokenGetter != nil {
+				useTokenGetter = alternateTokenGetter
+				scLogger.Debug("Using alternate token getter from service config")
+			}
 
-		// Get the token
-		if err = useTokenGetter.GetToken(getTokenTimeoutCtx); err != nil {
-			// Send notification of error
-			success.success = false
-
-			// Check to see if we need to report a specific error
-			var msg string
-			var errToReport error
-			if errors.Is(err, context.DeadlineExceeded) {
-				msg = "timeout error"
-				errToReport = fmt.Errorf("%s: %s", err, "timeout error")
-			} else {
-				msg = "could not store and get vault tokens"
-				unwrappedErr := errors.Unwrap(err)
-				errToReport = fmt.Errorf("%s: %s", msg, err.Error())
-				if unwrappedErr != nil {
-					// Check to see if authentication is needed.  This is an error condition for non-interactive token storing
-					var authNeededErrorPtr *vaultToken.ErrAuthNeeded
-					if errors.As(unwrappedErr, &authNeededErrorPtr) && !interactive {
-						errToReport = fmt.Errorf("%s: %s", msg, unwrappedErr.Error())
+			// Get the token
+			// Authentication can't happen without someone to do it, so don't retry non-interactive token getters that need it
+			retryPolicy := getRetryPolicyFromConfig(*sc, GetToken)
+			if !interactive {
+				retryPolicy = retryPolicy.withRetryable(isNotAuthNeededError)
+			}
+			// Each attempt gets the whole timeout, so that one that hangs can still be retried
+			_, err = retry(ctx, retryPolicy, GetToken, sc.Service.Name(), withAttemptTimeout(getServiceTimeout(ctx, getTokenTimeout), useTokenGetter.GetToken))
+			if err != nil {
+				// Send notification of error
+				success.success = false
+
+				// Check to see if we need to report a specific error
+				var msg string
+				var errToReport error
+				if errors.Is(err, context.DeadlineExceeded) {
+					msg = "timeout error"
+					errToReport = fmt.Errorf("%s: %s", err, "timeout error")
+				} else {
+					msg = "could not store and get vault tokens"
+					unwrappedErr := errors.Unwrap(err)
+					errToReport = fmt.Errorf("%s: %s", msg, err.Error())
+					if unwrappedErr != nil {
+						// Check to see if authentication is needed.  This is an error condition for non-interactive token storing
+						var authNeededErrorPtr *vaultToken.ErrAuthNeeded
+						if errors.As(unwrappedErr, &authNeededErrorPtr) && !interactive {
+							errToReport = fmt.Errorf("%s: %s", msg, unwrappedErr.Error())
+						}
 					}
 				}
+				chans.notificationsChan <- notifications.NewSetupError(errToReport.Error(), sc.Service.Name()).WithCause(err)
+				tracing.LogErrorWithTrace(span, scLogger, msg)
+				return
 			}
-			chans.notificationsChan <- notifications.NewSetupError(errToReport.Error(), sc.Service.Name())
-			tracing.LogErrorWithTrace(span, scLogger, msg)
-			return
-		}
-		success.success = true
-		tracing.LogSuccessWithTrace(span, scLogger, "Successfully got vault token")
+			success.success = true
+			tracing.LogSuccessWithTrace(span, scLogger, "Successfully got vault token")
+		}(sc)
 	}
 }
 
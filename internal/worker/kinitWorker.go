@@ -18,6 +18,7 @@ package worker
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -111,6 +112,9 @@ func getKerberosTicketsWorker(ctx context.Context, chans channelGroup) {
 			)
 			defer span.End()
 
+			ctx, cancel := serviceContext(ctx, sc, GetKerberosTickets)
+			defer cancel()
+
 			success := &kinitSuccess{
 				Service: sc.Service,
 			}
@@ -118,10 +122,22 @@ func getKerberosTicketsWorker(ctx context.Context, chans channelGroup) {
 				chans.successChan <- k
 			}(success)
 
-			kerbContext, kerbCancel := context.WithTimeout(ctx, kerberosTimeout)
-			defer kerbCancel()
-
-			if err := getKerberosTicketandVerify(kerbContext, sc); err != nil {
+			// Wait for our turn to run kinit, so that we stay within the configured concurrency limits
+			release, err := acquireSlot(ctx, GetKerberosTickets, "")
+			if err != nil {
+				msg := "Could not start obtaining kerberos ticket"
+				tracing.LogErrorWithTrace(span, log.WithField("service", sc.Service.Name()), fmt.Sprintf("%s: %s", msg, err))
+				chans.notificationsChan <- notifications.NewSetupError(msg, sc.ServiceNameFromExperimentAndRole())
+				return
+			}
+			defer release()
+
+			// Each attempt gets the whole kerberos timeout, so that one that hangs can still be retried
+			_, err = retry(ctx, getRetryPolicyFromConfig(*sc, GetKerberosTickets), GetKerberosTickets, sc.Service.Name(),
+				withAttemptTimeout(getServiceTimeout(ctx, kerberosTimeout), func(ctx context.Context) error {
+					return getKerberosTicketandVerify(ctx, sc)
+				}))
+			if err != nil {
 				var msg string
 				if errors.Is(err, context.DeadlineExceeded) {
 					msg = "Timeout error"
@@ -133,7 +149,7 @@ func getKerberosTicketsWorker(ctx context.Context, chans channelGroup) {
 					"role":       sc.Service.Role(),
 					"account":    sc.Account,
 				}), msg)
-				chans.notificationsChan <- notifications.NewSetupError(msg, sc.ServiceNameFromExperimentAndRole())
+				chans.notificationsChan <- notifications.NewSetupError(msg, sc.ServiceNameFromExperimentAndRole()).WithCause(err)
 				return
 			}
 			span.SetStatus(codes.Ok, "Kerberos ticket obtained and verified")
@@ -18,6 +18,7 @@ package worker
 import (
 	"context"
 	"errors"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -32,7 +33,6 @@ import (
 	"github.com/fermitools/managed-tokens/internal/metrics"
 	"github.com/fermitools/managed-tokens/internal/notifications"
 	"github.com/fermitools/managed-tokens/internal/ping"
-	"github.com/fermitools/managed-tokens/internal/service"
 	"github.com/fermitools/managed-tokens/internal/tracing"
 )
 
@@ -65,20 +65,6 @@ func init() {
 	metrics.MetricsRegistry.MustRegister(pingFailureCount)
 }
 
-// pingSuccess is a type that conveys whether PingAggregatorWorker successfully pings all the configured destination nodes for each service
-type pingSuccess struct {
-	service.Service
-	success bool
-}
-
-func (p *pingSuccess) GetService() service.Service {
-	return p.Service
-}
-
-func (p *pingSuccess) GetSuccess() bool {
-	return p.success
-}
-
 // pingAggregatorWorker is a worker that listens on chans.GetServiceConfigChan(), and for the received worker.Config objects,
 // concurrently pings all of the Config's destination nodes.  It returns when chans.GetServiceConfigChan() is closed,
 // and it will in turn close the other chans in the passed in ChannelsForWorkers
@@ -112,19 +98,30 @@ func pingAggregatorWorker(ctx context.Context, chans channelGroup) {
 			)
 			defer span.End()
 
-			success := &pingSuccess{
+			ctx, cancel := serviceContext(ctx, sc, PingAggregator)
+			defer cancel()
+
+			result := &PingResult{
 				Service: sc.Service,
+				Nodes:   make([]OperationResult, 0, len(sc.Nodes)),
+				Start:   time.Now(),
 			}
 			serviceLogger := log.WithField("service", sc.Service.Name())
 
-			defer func(p *pingSuccess) {
-				chans.successChan <- p
-			}(success)
+			defer func(r *PingResult) {
+				r.End = time.Now()
+				chans.successChan <- r
+			}(result)
 
 			// Prepare slice of nodes to ping
+			retryPolicy := getRetryPolicyFromConfig(*sc, PingAggregator)
 			nodes := make([]nodePinger, 0, len(sc.Nodes))
 			for _, node := range sc.Nodes {
-				nodes = append(nodes, ping.NewNode(node))
+				nodes = append(nodes, &retryingNodePinger{
+					nodePinger:  newNodePingerForConfig(sc, node),
+					policy:      retryPolicy,
+					serviceName: sc.Service.Name(),
+				})
 			}
 
 			var extraPingOpts []string
@@ -133,12 +130,21 @@ func pingAggregatorWorker(ctx context.Context, chans channelGroup) {
 				extraPingOpts = make([]string, 0)
 			}
 
-			pingContext, pingCancel := context.WithTimeout(ctx, pingTimeout)
+			pingContext, pingCancel := context.WithTimeout(ctx, getServiceTimeout(ctx, pingTimeout))
 			defer pingCancel()
 			pingStatus := pingAllNodes(pingContext, extraPingOpts, nodes...)
 
 			failedNodes := make([]ping.Node, 0, len(sc.Nodes))
+			nodeResults := make(map[string]OperationResult, len(sc.Nodes))
 			for status := range pingStatus {
+				nodeResults[status.String()] = OperationResult{
+					Target:     status.String(),
+					Err:        status.err,
+					ErrorClass: ClassifyError(status.err),
+					Attempts:   status.attempts,
+					Start:      status.start,
+					End:        status.end,
+				}
 				nodeLogger := serviceLogger.WithField("node", status.String())
 				if status.err != nil {
 					var msg string
@@ -154,6 +160,11 @@ func pingAggregatorWorker(ctx context.Context, chans channelGroup) {
 					nodeLogger.Debug("Successfully pinged node")
 				}
 			}
+			for _, node := range sc.Nodes {
+				if r, ok := nodeResults[node]; ok {
+					result.Nodes = append(result.Nodes, r)
+				}
+			}
 
 			if len(failedNodes) != 0 {
 				failedNodesStrings := make([]string, 0, len(failedNodes))
@@ -168,7 +179,6 @@ func pingAggregatorWorker(ctx context.Context, chans channelGroup) {
 				)
 				return
 			}
-			success.success = true
 			tracing.LogSuccessWithTrace(span, serviceLogger, "Successfully pinged all nodes for service")
 		}(sc)
 	}
@@ -193,10 +203,19 @@ func pingAllNodes(ctx context.Context, extraPingOpts []string, nodes ...nodePing
 			span.SetAttributes(attribute.String("node", n.String()))
 			defer span.End()
 
-			p := pingNodeStatus{
-				nodePinger: n,
-				err:        n.Ping(ctx, extraPingOpts),
+			p := pingNodeStatus{nodePinger: n, start: start}
+			// Note that the time spent waiting for our turn counts against the ping timeout in ctx
+			if release, err := acquireSlot(ctx, PingAggregator, n.String()); err != nil {
+				p.err = err
+			} else {
+				p.err = n.Ping(ctx, extraPingOpts)
+				p.attempts = 1
+				if r, ok := n.(*retryingNodePinger); ok {
+					p.attempts = r.attempts
+				}
+				release()
 			}
+			p.end = time.Now()
 			if p.err != nil {
 				span.SetStatus(codes.Error, "Failed to ping node")
 				pingFailureCount.WithLabelValues(n.String()).Inc()
@@ -225,8 +244,73 @@ type nodePinger interface {
 	String() string
 }
 
+// nodePingerWithOptions is a nodePinger that pings a node with the node-specific ping options from its Config.  If the node is
+// reached through a jump host, the jump host is pinged instead, since the node itself is usually not reachable.  It is reported
+// under the node's name either way.
+type nodePingerWithOptions struct {
+	nodePinger
+	name     string
+	pingOpts []string
+}
+
+func (n *nodePingerWithOptions) Ping(ctx context.Context, extraPingOpts []string) error {
+	return n.nodePinger.Ping(ctx, slices.Concat(extraPingOpts, n.pingOpts))
+}
+
+func (n *nodePingerWithOptions) String() string { return n.name }
+
+// retryingNodePinger is a nodePinger that retries failed pings of the wrapped nodePinger according to a RetryPolicy.  After each call
+// to Ping, attempts holds the number of attempts that call made.
+type retryingNodePinger struct {
+	nodePinger
+	policy      RetryPolicy
+	serviceName string
+	attempts    uint
+}
+
+func (n *retryingNodePinger) Ping(ctx context.Context, extraPingOpts []string) error {
+	var err error
+	n.attempts, err = retry(ctx, n.policy, PingAggregator, n.serviceName, func(ctx context.Context) error {
+		return n.nodePinger.Ping(ctx, extraPingOpts)
+	})
+	return err
+}
+
+// newNodePingerForConfig returns the nodePinger that should be used to ping node, given the NodeOptions in c
+func newNodePingerForConfig(c *Config, node string) nodePinger {
+	nodeOptions := c.nodeOptions(node)
+	if nodeOptions.JumpHost == "" && len(nodeOptions.PingOptions) == 0 {
+		return ping.NewNode(node)
+	}
+	target := node
+	if nodeOptions.JumpHost != "" {
+		target = jumpHostName(nodeOptions.JumpHost)
+	}
+	return &nodePingerWithOptions{
+		nodePinger: ping.NewNode(target),
+		name:       node,
+		pingOpts:   nodeOptions.PingOptions,
+	}
+}
+
+// jumpHostName returns the host name of a jump host given in the ssh ProxyJump form [user@]host[:port].  If more than one jump host is
+// given, separated by commas, the first one is returned, since it is the only one that we connect to directly
+func jumpHostName(jumpHost string) string {
+	host, _, _ := strings.Cut(jumpHost, ",")
+	if _, h, ok := strings.Cut(host, "@"); ok {
+		host = h
+	}
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	return host
+}
+
 // pingNodeStatus conveys the status of a ping operation
 type pingNodeStatus struct {
 	nodePinger
-	err error
+	err      error
+	attempts uint
+	start    time.Time
+	end      time.Time
 }
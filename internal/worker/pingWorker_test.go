@@ -21,6 +21,10 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/ping"
 )
 
 const (
@@ -76,6 +80,29 @@ func TestPingAllNodes(t *testing.T) {
 	}
 }
 
+// TestPingAllNodesRecordsAttempts makes sure that pingAllNodes reports the number of attempts a retryingNodePinger made, and when the
+// ping started and ended
+func TestPingAllNodesRecordsAttempts(t *testing.T) {
+	nodes := []nodePinger{
+		&retryingNodePinger{nodePinger: badNode(badhost), policy: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}},
+		goodNode("goodnode"),
+	}
+	for n := range pingAllNodes(context.Background(), nil, nodes...) {
+		switch n.String() {
+		case badhost:
+			assert.Error(t, n.err)
+			assert.Equal(t, uint(3), n.attempts)
+		case "goodnode":
+			assert.NoError(t, n.err)
+			assert.Equal(t, uint(1), n.attempts)
+		default:
+			t.Errorf("Got status for unexpected node %s", n.String())
+		}
+		assert.False(t, n.start.IsZero())
+		assert.False(t, n.end.Before(n.start))
+	}
+}
+
 // TestPingALlNodesTimeout pings a series of nodes with a 1 ns timeout and makes sure we get the timeout error we expect
 func TestPingAllNodesTimeout(t *testing.T) {
 	// Timeout
@@ -98,3 +125,44 @@ func TestPingAllNodesTimeout(t *testing.T) {
 	}
 	cancelTimeout()
 }
+
+func TestNewNodePingerForConfig(t *testing.T) {
+	c := &Config{
+		NodeOptions: map[string]NodeOptions{
+			"node2": {Port: 2222},
+			"node3": {PingOptions: []string{"-4"}},
+			"node4": {JumpHost: "user@bastion.example.com:2200,otherbastion", PingOptions: []string{"-4"}},
+		},
+	}
+
+	assert.Equal(t, ping.NewNode("node1"), newNodePingerForConfig(c, "node1"))
+	assert.Equal(t, ping.NewNode("node2"), newNodePingerForConfig(c, "node2"))
+	assert.Equal(t,
+		&nodePingerWithOptions{nodePinger: ping.NewNode("node3"), name: "node3", pingOpts: []string{"-4"}},
+		newNodePingerForConfig(c, "node3"),
+	)
+
+	n := newNodePingerForConfig(c, "node4")
+	assert.Equal(t, "node4", n.String())
+	assert.Equal(t,
+		&nodePingerWithOptions{nodePinger: ping.NewNode("bastion.example.com"), name: "node4", pingOpts: []string{"-4"}},
+		n,
+	)
+}
+
+func TestNodePingerWithOptions(t *testing.T) {
+	var gotOpts []string
+	n := &nodePingerWithOptions{nodePinger: &recordingNode{opts: &gotOpts}, name: "node", pingOpts: []string{"-4"}}
+	assert.NoError(t, n.Ping(context.Background(), []string{"-W", "2"}))
+	assert.Equal(t, []string{"-W", "2", "-4"}, gotOpts)
+	assert.Equal(t, "node", n.String())
+}
+
+type recordingNode struct{ opts *[]string }
+
+func (r *recordingNode) Ping(ctx context.Context, extraPingOpts []string) error {
+	*r.opts = extraPingOpts
+	return nil
+}
+
+func (r *recordingNode) String() string { return "recordingNode" }
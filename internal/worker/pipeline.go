@@ -0,0 +1,281 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/fermitools/managed-tokens/internal/contextStore"
+	"github.com/fermitools/managed-tokens/internal/notifications"
+	"github.com/fermitools/managed-tokens/internal/service"
+)
+
+// PipelineStage defines one stage of a Pipeline
+type PipelineStage struct {
+	// WorkerType is the type of the Worker that is run for this stage
+	WorkerType WorkerType
+	// Timeout, if positive, is set as the override timeout for the stage's Worker (see contextStore.WithOverrideTimeout)
+	Timeout time.Duration
+	// Selector, if not nil, determines whether a *Config is sent through this stage.  *Configs that are not selected skip the stage.
+	Selector func(*Config) bool
+	// ContinueOnFailure indicates that *Configs that fail this stage should still be sent on to the next stage
+	ContinueOnFailure bool
+}
+
+// selects returns whether the *Config should be sent through the PipelineStage
+func (s PipelineStage) selects(c *Config) bool {
+	return s.Selector == nil || s.Selector(c)
+}
+
+// StageResult is the outcome of a single *Config going through a single PipelineStage.  It implements SuccessReporter.
+type StageResult struct {
+	WorkerType WorkerType
+	Config     *Config
+	Success    bool
+	// Start is the time the *Config was sent to the stage's Worker, and End is the time the Worker reported on it
+	Start time.Time
+	End   time.Time
+	// Final is true if the *Config will not be sent through any more stages after this one
+	Final bool
+	// Details is what the stage's Worker reported for the *Config, for example a *PushTokensResult for the PushTokens worker.  It is nil
+	// if the Worker did not report on the *Config.
+	Details SuccessReporter
+}
+
+// GetService returns the service associated with the StageResult
+func (r StageResult) GetService() service.Service {
+	return r.Config.Service
+}
+
+// GetSuccess returns whether the *Config succeeded in the stage
+func (r StageResult) GetSuccess() bool {
+	return r.Success
+}
+
+// Pipeline runs *Configs through a series of PipelineStages.  Unlike running each Worker to completion before starting the next,
+// each *Config is sent on to its next stage as soon as the Worker for its current stage reports on it, so one slow service
+// does not hold up the others.
+type Pipeline struct {
+	stages         []PipelineStage
+	stageStartFunc func(WorkerType, *Config)
+}
+
+// PipelineOption is a functional option that modifies a Pipeline
+type PipelineOption func(*Pipeline) error
+
+// WithStageStartFunc sets a function that the Pipeline calls each time it sends a *Config to a stage's Worker
+func WithStageStartFunc(f func(WorkerType, *Config)) PipelineOption {
+	return func(p *Pipeline) error {
+		p.stageStartFunc = f
+		return nil
+	}
+}
+
+// NewPipeline returns a *Pipeline that will run the given stages in order.  It returns an error if there are no stages, or if any
+// of the stages has an invalid WorkerType
+func NewPipeline(stages []PipelineStage, opts ...PipelineOption) (*Pipeline, error) {
+	if len(stages) == 0 {
+		return nil, errors.New("no stages given for pipeline")
+	}
+	for _, stage := range stages {
+		if !isValidWorkerType(stage.WorkerType) || stage.WorkerType.Worker() == nil {
+			return nil, fmt.Errorf("invalid worker type %d for pipeline stage", stage.WorkerType)
+		}
+	}
+
+	p := &Pipeline{stages: stages}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// pipelineEntry tracks a *Config that has been sent to a stage's Worker
+type pipelineEntry struct {
+	config *Config
+	start  time.Time
+}
+
+// pipelineRun holds the state for a single call to Pipeline.Run
+type pipelineRun struct {
+	*Pipeline
+	stageChans []channelGroup
+	results    chan StageResult
+
+	// inFlight holds, for each stage, the *Configs that have been sent to that stage's Worker and not yet reported on
+	inFlight []map[service.Service]pipelineEntry
+	mu       sync.Mutex
+}
+
+// Run starts the Workers for all of the Pipeline's stages and sends configs through them.  It returns right away.  The returned
+// StageResult channel gets a StageResult for each stage that each *Config goes through, and the returned Notification channel
+// gets all of the Notifications that the stages' Workers send.  Both channels are closed once every *Config has left the Pipeline.
+// *Configs that are not selected by any of the stages are not reported on.
+func (p *Pipeline) Run(ctx context.Context, configs []*Config) (<-chan StageResult, <-chan notifications.Notification) {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "worker.Pipeline.Run")
+	span.SetAttributes(attribute.Int("numConfigs", len(configs)))
+
+	// Each *Config goes through each stage at most once, so if we size the buffers to the number of configs, none of the sends
+	// between stages will block
+	r := &pipelineRun{
+		Pipeline:   p,
+		stageChans: make([]channelGroup, len(p.stages)),
+		results:    make(chan StageResult, len(configs)),
+		inFlight:   make([]map[service.Service]pipelineEntry, len(p.stages)),
+	}
+	notificationsChan := make(chan notifications.Notification, len(configs))
+
+	var notificationsWg sync.WaitGroup
+	for i, stage := range p.stages {
+		r.stageChans[i] = NewChannelsForWorkers(len(configs))
+		r.inFlight[i] = make(map[service.Service]pipelineEntry)
+
+		stageCtx := ctx
+		if stage.Timeout > 0 {
+			stageCtx = contextStore.WithOverrideTimeout(ctx, stage.Timeout)
+		}
+		go stage.WorkerType.Worker()(stageCtx, r.stageChans[i])
+
+		notificationsWg.Add(1)
+		go func(c <-chan notifications.Notification) {
+			defer notificationsWg.Done()
+			for n := range c {
+				notificationsChan <- n
+			}
+		}(r.stageChans[i].GetNotificationsChan())
+	}
+
+	forwardersDone := make([]chan struct{}, len(p.stages))
+	for i := range p.stages {
+		forwardersDone[i] = make(chan struct{})
+		go func(i int) {
+			defer close(forwardersDone[i])
+			r.forwardResults(i)
+		}(i)
+	}
+
+	for _, c := range configs {
+		if c.PipelineTimeout > 0 {
+			c.pipelineDeadline = time.Now().Add(c.PipelineTimeout)
+		}
+		r.sendToNextStage(-1, c)
+	}
+
+	// A stage can only get *Configs from earlier stages, so once everything before it is done, we can close its input
+	go func() {
+		defer span.End()
+		for i := range p.stages {
+			close(r.stageChans[i].serviceConfigChan)
+			<-forwardersDone[i]
+		}
+		close(r.results)
+		notificationsWg.Wait()
+		close(notificationsChan)
+		log.Debug("All configs have gone through the pipeline")
+	}()
+
+	return r.results, notificationsChan
+}
+
+// sendToNextStage sends the *Config to the first stage after stage from that selects it, if there is one
+func (r *pipelineRun) sendToNextStage(from int, c *Config) {
+	for i := from + 1; i < len(r.stages); i++ {
+		if !r.stages[i].selects(c) {
+			continue
+		}
+		r.mu.Lock()
+		r.inFlight[i][c.Service] = pipelineEntry{config: c, start: time.Now()}
+		r.mu.Unlock()
+		if r.stageStartFunc != nil {
+			r.stageStartFunc(r.stages[i].WorkerType, c)
+		}
+		r.stageChans[i].serviceConfigChan <- c
+		return
+	}
+}
+
+// forwardResults listens for the SuccessReporters from stage i's Worker, sends a StageResult for each one, and sends each *Config
+// on to its next stage if appropriate.  Any *Config that the Worker did not report on by the time it finished is counted as a failure.
+func (r *pipelineRun) forwardResults(i int) {
+	stage := r.stages[i]
+	funcLogger := log.WithField("workerType", stage.WorkerType.String())
+
+	for sr := range r.stageChans[i].GetSuccessChan() {
+		r.mu.Lock()
+		entry, ok := r.inFlight[i][sr.GetService()]
+		delete(r.inFlight[i], sr.GetService())
+		r.mu.Unlock()
+		if !ok {
+			funcLogger.WithField("service", sr.GetService().Name()).Error("Got result for a service that was not sent to this stage.  Ignoring")
+			continue
+		}
+		r.handleResult(i, entry, sr)
+	}
+
+	r.mu.Lock()
+	leftover := r.inFlight[i]
+	r.inFlight[i] = make(map[service.Service]pipelineEntry)
+	r.mu.Unlock()
+	for _, entry := range leftover {
+		funcLogger.WithField("service", entry.config.Service.Name()).Error("Worker did not report a result for service.  Treating it as a failure")
+		r.handleResult(i, entry, nil)
+	}
+}
+
+// handleResult sends the StageResult for a *Config that finished stage i, and sends that *Config on to its next stage if appropriate.
+// sr is what the stage's Worker reported for the *Config.  If it is nil, the *Config is counted as a failure.
+func (r *pipelineRun) handleResult(i int, entry pipelineEntry, sr SuccessReporter) {
+	success := sr != nil && sr.GetSuccess()
+	result := StageResult{
+		WorkerType: r.stages[i].WorkerType,
+		Config:     entry.config,
+		Success:    success,
+		Start:      entry.start,
+		End:        time.Now(),
+		Details:    sr,
+	}
+	if !success && !r.stages[i].ContinueOnFailure {
+		result.Final = true
+	} else {
+		// We have to check this before sending the result, so that the consumer knows whether or not it's the last one for the *Config
+		result.Final = !r.hasNextStage(i, entry.config)
+	}
+	r.results <- result
+
+	if !result.Final {
+		r.sendToNextStage(i, entry.config)
+	}
+}
+
+// hasNextStage returns whether there is a stage after stage i that selects the *Config
+func (r *pipelineRun) hasNextStage(i int, c *Config) bool {
+	for j := i + 1; j < len(r.stages); j++ {
+		if r.stages[j].selects(c) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/service"
+)
+
+type failingTokenGetter struct{}
+
+func (f *failingTokenGetter) GetToken(ctx context.Context) error {
+	return errors.New("could not get token")
+}
+
+// blockingTokenGetter blocks until release is closed
+type blockingTokenGetter struct {
+	release chan struct{}
+}
+
+func (b *blockingTokenGetter) GetToken(ctx context.Context) error {
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestNewPipeline(t *testing.T) {
+	_, err := NewPipeline(nil)
+	assert.Error(t, err)
+
+	_, err = NewPipeline([]PipelineStage{{WorkerType: GetToken}, {WorkerType: invalid}})
+	assert.Error(t, err)
+
+	p, err := NewPipeline([]PipelineStage{{WorkerType: GetToken}}, WithStageStartFunc(func(WorkerType, *Config) {}))
+	assert.NoError(t, err)
+	assert.NotNil(t, p.stageStartFunc)
+}
+
+func TestPipelineRun(t *testing.T) {
+	ctx := context.Background()
+	goodConfig, _ := NewConfig(service.NewService("expt1_good"), SetAlternateTokenGetterOption(GetToken, &fakeTokenGetter{}))
+	badConfig, _ := NewConfig(service.NewService("expt1_bad"), SetAlternateTokenGetterOption(GetToken, &failingTokenGetter{}))
+	skipConfig, _ := NewConfig(service.NewService("expt1_skip"), SetAlternateTokenGetterOption(GetToken, &fakeTokenGetter{}))
+
+	type resultKey struct {
+		service string
+		stage   int
+	}
+
+	type testCase struct {
+		description       string
+		continueOnFailure bool
+		expectedResults   map[resultKey]StageResult
+	}
+
+	testCases := []testCase{
+		{
+			"Failed configs stop",
+			false,
+			map[resultKey]StageResult{
+				{"expt1_good", 0}: {Config: goodConfig, Success: true, Final: false},
+				{"expt1_good", 1}: {Config: goodConfig, Success: true, Final: true},
+				{"expt1_bad", 0}:  {Config: badConfig, Success: false, Final: true},
+				{"expt1_skip", 1}: {Config: skipConfig, Success: true, Final: true},
+			},
+		},
+		{
+			"Failed configs continue",
+			true,
+			map[resultKey]StageResult{
+				{"expt1_good", 0}: {Config: goodConfig, Success: true, Final: false},
+				{"expt1_good", 1}: {Config: goodConfig, Success: true, Final: true},
+				{"expt1_bad", 0}:  {Config: badConfig, Success: false, Final: false},
+				{"expt1_bad", 1}:  {Config: badConfig, Success: false, Final: true},
+				{"expt1_skip", 1}: {Config: skipConfig, Success: true, Final: true},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(
+			test.description,
+			func(t *testing.T) {
+				stages := []PipelineStage{
+					{
+						WorkerType:        GetToken,
+						Selector:          func(c *Config) bool { return c != skipConfig },
+						ContinueOnFailure: test.continueOnFailure,
+					},
+					{WorkerType: GetToken, Timeout: 10 * time.Second},
+				}
+
+				var mu sync.Mutex
+				startCount := 0
+				p, err := NewPipeline(stages, WithStageStartFunc(func(WorkerType, *Config) {
+					mu.Lock()
+					defer mu.Unlock()
+					startCount++
+				}))
+				if err != nil {
+					t.Fatalf("Could not create pipeline: %s", err)
+				}
+
+				results, notificationsChan := p.Run(ctx, []*Config{goodConfig, badConfig, skipConfig})
+
+				numNotifications := 0
+				notificationsDone := make(chan struct{})
+				go func() {
+					defer close(notificationsDone)
+					for n := range notificationsChan {
+						assert.Equal(t, "expt1_bad", n.GetService())
+						numNotifications++
+					}
+				}()
+
+				// Keep track of which stage each result came from by the order we got them in for each service
+				stageIndex := make(map[string]int)
+				for _, config := range []*Config{goodConfig, badConfig} {
+					stageIndex[config.Service.Name()] = 0
+				}
+				stageIndex["expt1_skip"] = 1
+
+				gotResults := make(map[resultKey]StageResult)
+				for r := range results {
+					assert.Equal(t, GetToken, r.WorkerType)
+					assert.False(t, r.End.Before(r.Start))
+					if assert.NotNil(t, r.Details) {
+						assert.Equal(t, r.GetService(), r.Details.GetService())
+						assert.Equal(t, r.GetSuccess(), r.Details.GetSuccess())
+					}
+					key := resultKey{r.GetService().Name(), stageIndex[r.GetService().Name()]}
+					stageIndex[r.GetService().Name()]++
+					r.WorkerType, r.Start, r.End, r.Details = 0, time.Time{}, time.Time{}, nil
+					gotResults[key] = r
+				}
+				<-notificationsDone
+
+				assert.Equal(t, test.expectedResults, gotResults)
+				assert.Equal(t, len(test.expectedResults), startCount)
+				if test.continueOnFailure {
+					assert.Equal(t, 2, numNotifications)
+				} else {
+					assert.Equal(t, 1, numNotifications)
+				}
+			},
+		)
+	}
+}
+
+// TestPipelineRunStreaming checks that a config can go through all of the stages while another config is still stuck in the first stage
+func TestPipelineRunStreaming(t *testing.T) {
+	ctx := context.Background()
+	blocker := &blockingTokenGetter{release: make(chan struct{})}
+	fastConfig, _ := NewConfig(service.NewService("expt1_fast"), SetAlternateTokenGetterOption(GetToken, &fakeTokenGetter{}))
+	slowConfig, _ := NewConfig(service.NewService("expt1_slow"), SetAlternateTokenGetterOption(GetToken, blocker))
+
+	p, err := NewPipeline([]PipelineStage{{WorkerType: GetToken}, {WorkerType: GetToken}})
+	if err != nil {
+		t.Fatalf("Could not create pipeline: %s", err)
+	}
+	results, notificationsChan := p.Run(ctx, []*Config{fastConfig, slowConfig})
+	go func() {
+		for range notificationsChan {
+		}
+	}()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case r := <-results:
+			assert.Equal(t, "expt1_fast", r.GetService().Name())
+			assert.True(t, r.GetSuccess())
+			assert.NotNil(t, r.Details)
+			if !r.Final {
+				continue
+			}
+		case <-timeout:
+			close(blocker.release)
+			t.Fatal("Timed out waiting for fast config to get through pipeline")
+		}
+		break
+	}
+
+	close(blocker.release)
+	numSlowResults := 0
+	for r := range results {
+		assert.Equal(t, "expt1_slow", r.GetService().Name())
+		assert.True(t, r.GetSuccess())
+		numSlowResults++
+	}
+	assert.Equal(t, 2, numSlowResults)
+}
@@ -39,14 +39,10 @@ import (
 	"github.com/fermitools/managed-tokens/internal/fileCopier"
 	"github.com/fermitools/managed-tokens/internal/metrics"
 	"github.com/fermitools/managed-tokens/internal/notifications"
-	"github.com/fermitools/managed-tokens/internal/service"
 	"github.com/fermitools/managed-tokens/internal/tracing"
 	"github.com/fermitools/managed-tokens/internal/vaultToken"
 )
 
-// Sleep time between each retry
-const defaultRetrySleepDuration = 60 * time.Second
-
 // Metrics
 var (
 	tokenPushTimestamp = prometheus.NewGaugeVec(
@@ -91,27 +87,6 @@ func init() {
 	metrics.MetricsRegistry.MustRegister(pushFailureCount)
 }
 
-// pushTokenSuccess is a type that conveys whether PushTokensWorker successfully pushes vault tokens to destination nodes for a service
-type pushTokenSuccess struct {
-	service.Service
-	success bool
-	mux     sync.Mutex
-}
-
-func (p *pushTokenSuccess) changeSuccessValue(changeTo bool) {
-	p.mux.Lock()
-	defer p.mux.Unlock()
-	p.success = changeTo
-}
-
-func (v *pushTokenSuccess) GetService() service.Service {
-	return v.Service
-}
-
-func (v *pushTokenSuccess) GetSuccess() bool {
-	return v.success
-}
-
 // pushTokenWorker is a worker that listens on chans.GetServiceConfigChan(), and for the received worker.Config objects,
 // pushes vault tokens to all the configured destination nodes.  It returns when chans.GetServiceConfigChan() is closed,
 // and it will in turn close the other chans in the passed in ChannelsForWorkers
@@ -148,50 +123,47 @@ func pushTokensWorker(ctx context.Context, chans channelGroup) {
 				attribute.String("service", sc.Service.Name()),
 			)
 
+			ctx, cancel := serviceContext(ctx, sc, PushTokens)
+			defer cancel()
+
 			serviceLogger := log.WithFields(log.Fields{
 				"service":    sc.Service.Name(),
 				"experiment": sc.Service.Experiment(),
 				"role":       sc.Service.Role(),
 			})
 
-			var successNodes, failNodes nodeMap // Maps to store successful and failed nodes
-			var nodesNotifyOnce nodeMap         // Map to store sync.Once values for each node, so we only send one
+			var nodesNotifyOnce nodeMap // Map to store sync.Once values for each node, so we only send one
 			// notification per node on chans.notificationsChan
-
-			// Preload successNodes and nodesNotifyOnce
-			successNodes.m = make(map[string]any)
 			nodesNotifyOnce.m = make(map[string]any)
 			for _, node := range sc.Nodes {
-				successNodes.m[node] = struct{}{}
 				nodesNotifyOnce.m[node] = &sync.Once{}
 			}
 
-			// Initialize failNodes
-			failNodes.m = make(map[string]any)
-
-			// Push success value for this service config
-			pushSuccess := &pushTokenSuccess{
+			// Push result for this service config
+			result := &PushTokensResult{
 				Service: sc.Service,
-				success: true,
+				Start:   time.Now(),
 			}
-			defer func(p *pushTokenSuccess) {
-				chans.successChan <- p
-			}(pushSuccess)
+			defer func(r *PushTokensResult) {
+				r.End = time.Now()
+				chans.successChan <- r
+			}(result)
 
 			// Extract values from the service config that we need, compile those into a slice
 			pushConfigs, err := getPushTokensValuesFromConfig(sc)
 			if err != nil {
 				tracing.LogErrorWithTrace(span, serviceLogger, err.Error())
-				pushSuccess.changeSuccessValue(false)
+				result.Err = err
 				chans.notificationsChan <- notifications.NewSetupError("Error retrieving one or more values from the configuration to push tokens", sc.Service.Name())
 				return
 			}
 
-			// Errgroup for all pushConfigs
+			// Errgroup for all pushConfigs.  Each goroutine records its result at the pushConfig's index in fileResults
 			var g errgroup.Group
+			fileResults := make([]FilePushResult, len(pushConfigs))
 
 			// For each pushConfig, try to push to node concurrently
-			for _, pc := range pushConfigs {
+			for i, pc := range pushConfigs {
 				if pc.cleanupFunc != nil {
 					defer func() {
 						if err := pc.cleanupFunc(); err != nil {
@@ -218,24 +190,32 @@ func pushTokensWorker(ctx context.Context, chans channelGroup) {
 						"destinationFilename": pc.destinationPath,
 					})
 
-					// Add timeout to context
-					pushContext, cancel := context.WithTimeout(ctx, pushTimeout)
-					defer cancel()
+					// Wait for our turn to push to this node, so that we stay within the configured concurrency limits.  We only start the
+					// push timeout once we have our turn
+					start := time.Now()
+					attempts, err := func() (uint, error) {
+						release, err := acquireSlot(ctx, PushTokens, pc.node)
+						if err != nil {
+							return 0, err
+						}
+						defer release()
+
+						// Add timeout to context
+						pushContext, cancel := context.WithTimeout(ctx, getServiceTimeout(ctx, pushTimeout))
+						defer cancel()
 
-					err := pushToNode(pushContext, sc, pc.sourcePath, pc.node, pc.destinationPath, int(pc.numRetries), pc.retrySleepDuration)
+						return pushToNode(pushContext, sc, pc.sourcePath, pc.node, pc.destinationPath, pc.retryPolicy)
+					}()
+					fileResults[i] = FilePushResult{
+						OperationResult: newOperationResult(pc.node, start, attempts, err),
+						Source:          pc.sourcePath,
+						Destination:     pc.destinationPath,
+						Required:        pc.errorOnFail,
+					}
 					if err != nil && pc.errorOnFail {
 						errMsg := fmt.Sprintf("Error pushing vault tokens to destination node %s", pc.node)
 						pushConfigLogger.Errorf("%s: %s", errMsg, err.Error())
 
-						// Mark this node as failed by adding it to failNodes and removing it from successNodes
-						failNodes.mux.Lock()
-						failNodes.m[pc.node] = struct{}{}
-						failNodes.mux.Unlock()
-
-						successNodes.mux.Lock()
-						delete(successNodes.m, pc.node)
-						successNodes.mux.Unlock()
-
 						// Send notification for this node, if it's not already been done
 						func() {
 							nodesNotifyOnce.mux.Lock()
@@ -260,7 +240,7 @@ func pushTokensWorker(ctx context.Context, chans channelGroup) {
 								chans.notificationsChan <- notifications.NewPushError(
 									fmt.Sprintf("%s: %s", errMsg, _add),
 									sc.ServiceNameFromExperimentAndRole(),
-									pc.node)
+									pc.node).WithCause(err)
 							})
 						}()
 
@@ -268,35 +248,36 @@ func pushTokensWorker(ctx context.Context, chans channelGroup) {
 						pushFailureCount.WithLabelValues(sc.Service.Name(), pc.node).Inc()
 						return err
 					}
+					if err != nil {
+						pushConfigLogger.Warnf("Error pushing optional file to destination node %s.  Will not mark node as failed: %s", pc.node, err.Error())
+					}
 
 					return nil
 				})
 			}
 
-			// Wait until all pushConfigs have been processed
-			if err := g.Wait(); err != nil {
-				pushSuccess.changeSuccessValue(false)
+			// Wait until all pushConfigs have been processed, then collect the results by node
+			groupErr := g.Wait()
+			result.Nodes = nodePushResults(sc.Nodes, fileResults)
+
+			successesSlice := make([]string, 0, len(result.Nodes))
+			failuresSlice := make([]string, 0, len(result.Nodes))
+			for _, n := range result.Nodes {
+				if n.Success() {
+					successesSlice = append(successesSlice, n.Node)
+				} else {
+					failuresSlice = append(failuresSlice, n.Node)
+				}
+			}
+
+			if groupErr != nil {
 				tracing.LogErrorWithTrace(span, serviceLogger, "Error pushing tokens to one or more nodes")
 			} else {
 				span.SetStatus(codes.Ok, "Successfully pushed tokens to nodes")
-				for node := range successNodes.m {
+				for _, node := range successesSlice {
 					tokenPushTimestamp.WithLabelValues(sc.Service.Name(), node).SetToCurrentTime()
 				}
 			}
-			// In Go 1.23, we can possibly change this to use maps.Keys() to return an iter.Seq
-			successesSlice := make([]string, 0, len(successNodes.m))
-			failuresSlice := make([]string, 0, len(failNodes.m))
-
-			successNodes.mux.Lock()
-			for node := range successNodes.m {
-				successesSlice = append(successesSlice, node)
-			}
-			successNodes.mux.Unlock()
-			failNodes.mux.Lock()
-			for node := range failNodes.m {
-				failuresSlice = append(failuresSlice, node)
-			}
-			failNodes.mux.Unlock()
 
 			log.WithField("service", sc.Service.Name()).Infof("Successful nodes: %s", strings.Join(successesSlice, ", "))
 			log.WithField("service", sc.Service.Name()).Infof("Failed nodes: %s", strings.Join(failuresSlice, ", "))
@@ -305,8 +286,9 @@ func pushTokensWorker(ctx context.Context, chans channelGroup) {
 	configWg.Wait() // Don't close the NotificationsChan or SuccessChan until we're done sending notifications and success statuses
 }
 
-// pushToNode copies a file from a specified source to a destination path, using the environment and account configured in the worker.Config object
-func pushToNode(ctx context.Context, c *Config, sourceFile, node, destinationFile string, numRetries int, retrySleep time.Duration) error {
+// pushToNode copies a file from a specified source to a destination path, using the environment and account configured in the worker.Config object.
+// Failed copies are retried according to policy, unless the node could not be pinged earlier.  It returns the number of attempts made.
+func pushToNode(ctx context.Context, c *Config, sourceFile, node, destinationFile string, policy RetryPolicy) (uint, error) {
 	startTime := time.Now()
 	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "worker.pushToNode")
 	span.SetAttributes(
@@ -339,60 +321,71 @@ func pushToNode(ctx context.Context, c *Config, sourceFile, node, destinationFil
 		sshOptions = []string{}
 	}
 
+	nodeOptions := c.nodeOptions(node)
 	f := fileCopier.NewSSHFileCopier(
 		sourceFile,
-		c.Account,
+		c.accountForNode(node),
 		node,
 		destinationFile,
-		fileCopierOptions,
-		sshOptions,
+		slices.Concat(fileCopierOptions, nodeOptions.FileCopierOptions),
+		slices.Concat(sshOptions, nodeOptions.SSHOptions),
 		c.CommandEnvironment,
+		fileCopier.WithPort(nodeOptions.Port),
+		fileCopier.WithJumpHost(nodeOptions.JumpHost),
 	)
 
-	for i := 0; i <= numRetries; i++ {
-		funcLogger.Debugf("Try %d, %d retries left", i+1, numRetries-i)
-		if ctx.Err() != nil {
-			msg := "did not try to push file to destination node: context error"
-			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-				msg := fmt.Sprintf("%s: (timeout error)", msg)
-				tracing.LogErrorWithTrace(span, funcLogger, msg)
-				return fmt.Errorf("failed to push file to destination node: %w", ctx.Err())
-			}
+	// Unpingable node - no reason to retry
+	policy = policy.withRetryable(func(error) bool { return !c.IsNodeUnpingable(node) })
+	attempts, err := retry(ctx, policy, PushTokens, c.Service.Name(), func(ctx context.Context) error {
+		if err := ctx.Err(); err != nil {
+			funcLogger.Debug("did not try to push file to destination node: context error")
+			return err
 		}
-
 		err := fileCopier.CopyToDestination(ctx, f)
-		// Success
-		if err == nil {
-			break
+		if err != nil {
+			funcLogger.Error("failed to push file to destination node")
 		}
-		// Unpingable node - no reason to retry
+		return err
+	})
+	if err != nil {
 		if c.IsNodeUnpingable(node) {
-			notificationErrorString := fmt.Sprintf("failed to push file to destination node: Node %s was not pingable earlier prior to attempt to push tokens; ", node)
-			tracing.LogErrorWithTrace(span, funcLogger, notificationErrorString+"will not retry")
-			return errors.New(notificationErrorString)
+			notificationErr := fmt.Errorf("failed to push file to destination node %s: %w", node, errNodeUnpingable)
+			tracing.LogErrorWithTrace(span, funcLogger, notificationErr.Error()+"; will not retry")
+			return attempts, notificationErr
 		}
 		// Context has errored out - no reason to retry
 		if ctx.Err() != nil {
 			tracing.LogErrorWithTrace(span, funcLogger, fmt.Sprintf("failed to push file to destination node: %s: will not retry", ctx.Err()))
-			return fmt.Errorf("failed to push file to destination node: %w", ctx.Err())
-		}
-		// Some other error - retry
-		funcLogger.Error("failed to push file to destination node")
-		if i == int(numRetries) {
-			funcLogger.Debug("Max retries reached. Will not retry")
-			return err
+			// Keep the typed error from the file copier if it already wraps the context error
+			if !errors.Is(err, ctx.Err()) {
+				err = ctx.Err()
+			}
+			return attempts, fmt.Errorf("failed to push file to destination node: %w", err)
 		}
-		funcLogger.Debugf("Will retry. First sleeping for %s", retrySleep.String())
-		time.Sleep(retrySleep)
+		tracing.LogErrorWithTrace(span, funcLogger, "failed to push file to destination node")
+		return attempts, err
 	}
 
 	dur := time.Since(startTime).Seconds()
 	tokenPushDuration.WithLabelValues(c.Service.Name(), node).Set(dur)
 	tracing.LogSuccessWithTrace(span, funcLogger, "Success copying file to destination")
-	return nil
+	return attempts, nil
 
 }
 
+// nodePushResults groups fileResults by node into NodePushResults, one for each of nodes, in the same order
+func nodePushResults(nodes []string, fileResults []FilePushResult) []NodePushResult {
+	byNode := make(map[string][]FilePushResult, len(nodes))
+	for _, f := range fileResults {
+		byNode[f.Target] = append(byNode[f.Target], f)
+	}
+	results := make([]NodePushResult, 0, len(nodes))
+	for _, node := range nodes {
+		results = append(results, NodePushResult{Node: node, Files: byNode[node]})
+	}
+	return results
+}
+
 // Note that these funcs were implemented as functions with the *Config object as an argument, and not
 // with a pointer receiver, because they are not meant to be inherent behaviors of a *Config object.
 
@@ -484,19 +477,132 @@ func findFirstCreddVaultToken(tokenRootPath, serviceName string, credds []string
 	return "", errors.New("could not find any vault tokens to return")
 }
 
+// FindStoredVaultToken returns the location of the vault token that the PushTokens worker would push for the given *Config, without
+// obtaining or storing a new one.  It returns an error if no stored vault token could be found.
+func FindStoredVaultToken(c *Config) (string, error) {
+	if c == nil {
+		return "", errors.New("nil Config object passed to FindStoredVaultToken")
+	}
+	return findFirstCreddVaultToken(c.ServiceCreddVaultTokenPathRoot, c.Service.Name(), c.Schedds)
+}
+
+// TokenDestination is a template for a path on each destination node that the PushTokens worker should push the vault token to.
+// The template is executed against a TokenDestinationTemplateArgs value.  If Optional is true, a failure to push
+// to the destination is logged, but does not mark the node as failed.
+type TokenDestination struct {
+	Template string `json:"template"`
+	Optional bool   `json:"optional"`
+}
+
+// TokenDestinationTemplateArgs holds the values that are available to a TokenDestination template
+type TokenDestinationTemplateArgs struct {
+	DesiredUID uint32
+	Account    string
+	Service    string
+	Experiment string
+	Role       string
+}
+
+// DefaultTokenDestinations returns the vault token destinations used when none are configured:  /tmp/vt_u<uid> and
+// /tmp/vt_u<uid>-<service>, both of which are required
+func DefaultTokenDestinations() []TokenDestination {
+	return []TokenDestination{
+		{Template: "/tmp/vt_u{{.DesiredUID}}"},
+		{Template: "/tmp/vt_u{{.DesiredUID}}-{{.Service}}"},
+	}
+}
+
+// ExecuteTokenDestinationTemplate executes the given TokenDestination template string against args
+func ExecuteTokenDestinationTemplate(templateString string, args TokenDestinationTemplateArgs) (string, error) {
+	tmpl, err := template.New("tokenDestination").Parse(templateString)
+	if err != nil {
+		return "", fmt.Errorf("could not parse token destination template %q: %w", templateString, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, args); err != nil {
+		return "", fmt.Errorf("could not execute token destination template %q: %w", templateString, err)
+	}
+	if b.Len() == 0 {
+		return "", fmt.Errorf("token destination template %q rendered an empty path", templateString)
+	}
+	return b.String(), nil
+}
+
+// tokenDestinationPath is a rendered TokenDestination
+type tokenDestinationPath struct {
+	path        string
+	errorOnFail bool
+}
+
+// getDestinationTokenFilenames returns the paths on the destination nodes that the vault token for the *Config should be pushed to.
+// Optional destinations whose template cannot be executed are skipped.  If a required destination's template cannot be executed,
+// the error is returned along with the destinations that could be rendered.
+func getDestinationTokenFilenames(c *Config) ([]tokenDestinationPath, error) {
+	funcLogger := log.WithField("service", c.Service.Name())
+	tokenDestinations, ok := GetTokenDestinationsFromExtras(c)
+	if !ok {
+		return nil, errors.New("stored TokenDestinations in config is not a []TokenDestination")
+	}
+
+	args := TokenDestinationTemplateArgs{
+		DesiredUID: c.DesiredUID,
+		Account:    c.Account,
+		Service:    c.Service.Name(),
+		Experiment: c.Service.Experiment(),
+		Role:       c.Service.Role(),
+	}
+
+	paths := make([]tokenDestinationPath, 0, len(tokenDestinations))
+	var errs error
+	for _, d := range tokenDestinations {
+		p, err := ExecuteTokenDestinationTemplate(d.Template, args)
+		if err != nil {
+			if d.Optional {
+				funcLogger.Warnf("Will not push vault token to optional destination: %s", err)
+				continue
+			}
+			errs = errors.Join(errs, err)
+			continue
+		}
+		paths = append(paths, tokenDestinationPath{path: p, errorOnFail: !d.Optional})
+	}
+	return paths, errs
+}
+
+// GetPushDestinations returns the paths on each destination node that the PushTokens worker would push files to for the given *Config.
+// The vault token destinations are returned first, followed by the default role file destination.  Unlike the PushTokens worker,
+// GetPushDestinations does not look for the vault token to push, or create any files.
+func GetPushDestinations(c *Config) ([]string, error) {
+	if c == nil {
+		return nil, errors.New("nil Config object passed to GetPushDestinations")
+	}
+	tokenDestinations, err := getDestinationTokenFilenames(c)
+	destinations := make([]string, 0, len(tokenDestinations)+1)
+	for _, d := range tokenDestinations {
+		destinations = append(destinations, d.path)
+	}
+	if err != nil {
+		return destinations, fmt.Errorf("could not obtain vault token destinations: %w", err)
+	}
+	defaultRoleFileDestinationFilename, err := parseDefaultRoleFileDestinationTemplateFromConfig(c)
+	if err != nil {
+		return destinations, fmt.Errorf("could not obtain default role file destination: %w", err)
+	}
+	return append(destinations, defaultRoleFileDestinationFilename), nil
+}
+
 type pushTokensConfig struct {
-	sourcePath         string
-	node               string
-	account            string
-	destinationPath    string
-	env                environment.CommandEnvironment
-	unpingable         bool
-	fileCopierOptions  []string
-	sshOptions         []string
-	errorOnFail        bool
-	numRetries         uint
-	retrySleepDuration time.Duration
-	cleanupFunc        func() error
+	sourcePath        string
+	node              string
+	account           string
+	destinationPath   string
+	env               environment.CommandEnvironment
+	unpingable        bool
+	fileCopierOptions []string
+	sshOptions        []string
+	errorOnFail       bool
+	retryPolicy       RetryPolicy
+	cleanupFunc       func() error
 }
 
 func getPushTokensValuesFromConfig(c *Config) ([]pushTokensConfig, error) {
@@ -511,9 +617,9 @@ func getPushTokensValuesFromConfig(c *Config) ([]pushTokensConfig, error) {
 		return nil, fmt.Errorf("could not find suitable vault token to push: %w", err)
 	}
 
-	destinationTokenFilenames := []string{
-		fmt.Sprintf("/tmp/vt_u%d", c.DesiredUID),
-		fmt.Sprintf("/tmp/vt_u%d-%s", c.DesiredUID, c.Service.Name()),
+	destinationTokenFilenames, err := getDestinationTokenFilenames(c)
+	if err != nil {
+		return nil, fmt.Errorf("could not obtain vault token destinations: %w", err)
 	}
 
 	// Default role files
@@ -530,28 +636,7 @@ func getPushTokensValuesFromConfig(c *Config) ([]pushTokensConfig, error) {
 	}
 	sendDefaultRoleFile := !dontSendDefaultRoleFile
 
-	var numRetries uint
-	var retrySleepDuration time.Duration
-	// Retry values
-	numRetries, err = getWorkerNumRetriesValueFromConfig(*c, PushTokens)
-	switch {
-	case errors.Is(err, errNoWorkerTypeMapInConfig):
-		log.Debug("No retry configuration found for PushTokens worker type.  Using default values")
-		numRetries = 0
-	case err != nil:
-		log.Debug("Could not get retry value from config.  Using default value")
-		numRetries = 0
-	}
-
-	retrySleepDuration, err = getWorkerRetrySleepValueFromConfig(*c, PushTokens)
-	switch {
-	case errors.Is(err, errNoWorkerTypeMapInConfig):
-		log.Debug("No retry configuration found for PushTokens worker type.  Using default values")
-		retrySleepDuration = defaultRetrySleepDuration
-	case err != nil:
-		log.Debug("Could not get retry sleep value from config.  Using default value")
-		retrySleepDuration = defaultRetrySleepDuration
-	}
+	retryPolicy := getRetryPolicyFromConfig(*c, PushTokens)
 
 	var fileCopierOptions []string
 	fileCopierOptions, ok := GetFileCopierOptionsFromExtras(c)
@@ -568,20 +653,22 @@ func getPushTokensValuesFromConfig(c *Config) ([]pushTokensConfig, error) {
 	}
 
 	for _, node := range c.Nodes {
+		nodeOptions := c.nodeOptions(node)
+		nodeFileCopierOptions := slices.Concat(fileCopierOptions, nodeOptions.FileCopierOptions)
+		nodeSSHOptions := slices.Concat(sshOptions, nodeOptions.SSHOptions)
 		for _, destinationTokenFilename := range destinationTokenFilenames {
 			// Vault tokens
 			pushTokensConfigs = append(pushTokensConfigs, pushTokensConfig{
-				sourcePath:         sourceFilename,
-				node:               node,
-				account:            c.Account,
-				destinationPath:    destinationTokenFilename,
-				env:                c.CommandEnvironment,
-				unpingable:         c.IsNodeUnpingable(node),
-				fileCopierOptions:  fileCopierOptions,
-				sshOptions:         sshOptions,
-				errorOnFail:        true,
-				numRetries:         numRetries,
-				retrySleepDuration: retrySleepDuration,
+				sourcePath:        sourceFilename,
+				node:              node,
+				account:           c.accountForNode(node),
+				destinationPath:   destinationTokenFilename.path,
+				env:               c.CommandEnvironment,
+				unpingable:        c.IsNodeUnpingable(node),
+				fileCopierOptions: nodeFileCopierOptions,
+				sshOptions:        nodeSSHOptions,
+				errorOnFail:       destinationTokenFilename.errorOnFail,
+				retryPolicy:       retryPolicy,
 			})
 		}
 		// Default role file
@@ -589,12 +676,12 @@ func getPushTokensValuesFromConfig(c *Config) ([]pushTokensConfig, error) {
 			pushTokensConfigs = append(pushTokensConfigs, pushTokensConfig{
 				sourcePath:        defaultRoleFileName,
 				node:              node,
-				account:           c.Account,
+				account:           c.accountForNode(node),
 				destinationPath:   defaultRoleFileDestinationFilename,
 				env:               c.CommandEnvironment,
 				unpingable:        c.IsNodeUnpingable(node),
-				fileCopierOptions: fileCopierOptions,
-				sshOptions:        sshOptions,
+				fileCopierOptions: nodeFileCopierOptions,
+				sshOptions:        nodeSSHOptions,
 				errorOnFail:       false,
 				cleanupFunc: func() error {
 					if err := os.Remove(defaultRoleFileName); err != nil && !errors.Is(err, os.ErrNotExist) {
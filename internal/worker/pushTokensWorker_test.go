@@ -264,3 +264,129 @@ func TestFindFirstCreddVaultToken(t *testing.T) {
 		)
 	}
 }
+
+func TestGetPushDestinations(t *testing.T) {
+	s := service.NewService("myexpt_myrole")
+
+	t.Run("Nil config", func(t *testing.T) {
+		_, err := GetPushDestinations(nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("Valid default role file template", func(t *testing.T) {
+		c, _ := NewConfig(
+			s,
+			SetDesiredUID(12345),
+			SetSupportedExtrasKeyValue(DefaultRoleFileDestinationTemplate, "/tmp/default_role_{{.Experiment}}_{{.DesiredUID}}"),
+		)
+		destinations, err := GetPushDestinations(c)
+		assert.NoError(t, err)
+		assert.Equal(t,
+			[]string{"/tmp/vt_u12345", "/tmp/vt_u12345-myexpt_myrole", "/tmp/default_role_myexpt_12345"},
+			destinations,
+		)
+	})
+
+	t.Run("Invalid default role file template", func(t *testing.T) {
+		c, _ := NewConfig(
+			s,
+			SetDesiredUID(12345),
+			SetSupportedExtrasKeyValue(DefaultRoleFileDestinationTemplate, "/tmp/{{.Doesntexist}}"),
+		)
+		destinations, err := GetPushDestinations(c)
+		assert.Error(t, err)
+		assert.Equal(t, []string{"/tmp/vt_u12345", "/tmp/vt_u12345-myexpt_myrole"}, destinations)
+	})
+
+	t.Run("Configured token destinations", func(t *testing.T) {
+		c, _ := NewConfig(
+			s,
+			SetDesiredUID(12345),
+			SetAccount("myaccount"),
+			SetSupportedExtrasKeyValue(DefaultRoleFileDestinationTemplate, "/tmp/default_role_{{.Experiment}}_{{.DesiredUID}}"),
+			SetSupportedExtrasKeyValue(TokenDestinations, []TokenDestination{
+				{Template: "/home/{{.Account}}/.vt/{{.Experiment}}/{{.Role}}"},
+				{Template: "/tmp/{{.Doesntexist}}", Optional: true},
+				{Template: "/tmp/vt_u{{.DesiredUID}}-{{.Service}}", Optional: true},
+			}),
+		)
+		destinations, err := GetPushDestinations(c)
+		assert.NoError(t, err)
+		assert.Equal(t,
+			[]string{"/home/myaccount/.vt/myexpt/myrole", "/tmp/vt_u12345-myexpt_myrole", "/tmp/default_role_myexpt_12345"},
+			destinations,
+		)
+	})
+
+	t.Run("Invalid required token destination", func(t *testing.T) {
+		c, _ := NewConfig(
+			s,
+			SetDesiredUID(12345),
+			SetSupportedExtrasKeyValue(DefaultRoleFileDestinationTemplate, "/tmp/default_role_{{.Experiment}}_{{.DesiredUID}}"),
+			SetSupportedExtrasKeyValue(TokenDestinations, []TokenDestination{
+				{Template: "/tmp/vt_u{{.DesiredUID}}"},
+				{Template: "/tmp/{{.Doesntexist}}"},
+			}),
+		)
+		destinations, err := GetPushDestinations(c)
+		assert.Error(t, err)
+		assert.Equal(t, []string{"/tmp/vt_u12345"}, destinations)
+	})
+}
+
+func TestGetDestinationTokenFilenames(t *testing.T) {
+	c, _ := NewConfig(
+		service.NewService("myexpt_myrole"),
+		SetDesiredUID(12345),
+		SetSupportedExtrasKeyValue(TokenDestinations, []TokenDestination{
+			{Template: "/tmp/vt_u{{.DesiredUID}}"},
+			{Template: "/tmp/vt_u{{.DesiredUID}}-{{.Service}}", Optional: true},
+		}),
+	)
+	paths, err := getDestinationTokenFilenames(c)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]tokenDestinationPath{
+			{path: "/tmp/vt_u12345", errorOnFail: true},
+			{path: "/tmp/vt_u12345-myexpt_myrole", errorOnFail: false},
+		},
+		paths,
+	)
+}
+
+func TestExecuteTokenDestinationTemplate(t *testing.T) {
+	args := TokenDestinationTemplateArgs{DesiredUID: 12345, Account: "myaccount", Service: "myexpt_myrole", Experiment: "myexpt", Role: "myrole"}
+
+	result, err := ExecuteTokenDestinationTemplate("/tmp/{{.Account}}_{{.DesiredUID}}_{{.Service}}", args)
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/myaccount_12345_myexpt_myrole", result)
+
+	for _, tmpl := range []string{"/tmp/{{.Account", "/tmp/{{.Doesntexist}}", "{{.Account}}"} {
+		_, err := ExecuteTokenDestinationTemplate(tmpl, TokenDestinationTemplateArgs{})
+		assert.Error(t, err, tmpl)
+	}
+}
+
+func TestFindStoredVaultToken(t *testing.T) {
+	tempTokenRootPath := t.TempDir()
+	curUser, _ := user.Current()
+
+	_, err := FindStoredVaultToken(nil)
+	assert.Error(t, err)
+
+	c, _ := NewConfig(
+		service.NewService("myexpt_myrole"),
+		SetSchedds([]string{"credd01"}),
+		SetServiceCreddVaultTokenPathRoot(tempTokenRootPath),
+	)
+	_, err = FindStoredVaultToken(c)
+	assert.Error(t, err)
+
+	expectedPath := path.Join(tempTokenRootPath, fmt.Sprintf("vt_u%s-%s-%s", curUser.Uid, "credd01", "myexpt_myrole"))
+	if _, err := os.Create(expectedPath); err != nil {
+		t.Fatalf("Could not create vault token file: %s", err)
+	}
+	result, err := FindStoredVaultToken(c)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedPath, result)
+}
@@ -0,0 +1,237 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fermitools/managed-tokens/internal/fileCopier"
+	"github.com/fermitools/managed-tokens/internal/kerberos"
+	"github.com/fermitools/managed-tokens/internal/ping"
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/vaultToken"
+)
+
+// ErrorClass is a coarse classification of why a worker operation failed, so that consumers of worker results can tell failures
+// apart without parsing error messages
+type ErrorClass string
+
+const (
+	// ErrorClassNone is the ErrorClass of an operation that succeeded
+	ErrorClassNone ErrorClass = ""
+	// ErrorClassTimeout means that the operation's deadline was exceeded
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassCanceled means that the operation was canceled before it could finish
+	ErrorClassCanceled ErrorClass = "canceled"
+	// ErrorClassAuthNeeded means that someone needs to authenticate to the vault server before the operation can succeed
+	ErrorClassAuthNeeded ErrorClass = "authNeeded"
+	// ErrorClassUnpingable means that the operation was not retried because its node could not be pinged earlier
+	ErrorClassUnpingable ErrorClass = "unpingable"
+	// ErrorClassKDCUnreachable means that no kerberos KDC could be reached
+	ErrorClassKDCUnreachable ErrorClass = "kdcUnreachable"
+	// ErrorClassBadKeytabOrPrincipal means that no kerberos ticket could be obtained with the configured keytab and principal
+	ErrorClassBadKeytabOrPrincipal ErrorClass = "badKeytabOrPrincipal"
+	// ErrorClassVaultUnreachable means that the vault server could not be reached
+	ErrorClassVaultUnreachable ErrorClass = "vaultUnreachable"
+	// ErrorClassCreddUnreachable means that the condor credd could not be reached
+	ErrorClassCreddUnreachable ErrorClass = "creddUnreachable"
+	// ErrorClassSSHAuth means that ssh authentication to the destination node failed
+	ErrorClassSSHAuth ErrorClass = "sshAuth"
+	// ErrorClassHostUnreachable means that the node could not be reached
+	ErrorClassHostUnreachable ErrorClass = "hostUnreachable"
+	// ErrorClassPermissionDenied means that the destination account may not write the file on the node
+	ErrorClassPermissionDenied ErrorClass = "permissionDenied"
+	// ErrorClassDiskFull means that the node had no room left for the file
+	ErrorClassDiskFull ErrorClass = "diskFull"
+	// ErrorClassOther is the ErrorClass of any other failure
+	ErrorClassOther ErrorClass = "other"
+)
+
+// errNodeUnpingable is wrapped by the errors returned for pushes to nodes that could not be pinged earlier
+var errNodeUnpingable = errors.New("node was not pingable earlier prior to attempt to push tokens")
+
+// ClassifyError returns the ErrorClass of err, based on the typed errors of the kerberos, vaultToken, fileCopier, and ping packages it
+// wraps.  A nil error is classified as ErrorClassNone.
+func ClassifyError(err error) ErrorClass {
+	switch {
+	case err == nil:
+		return ErrorClassNone
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errorIsType[*vaultToken.ErrAuthNeeded](err):
+		return ErrorClassAuthNeeded
+	case errors.Is(err, errNodeUnpingable):
+		return ErrorClassUnpingable
+	case errorIsType[*kerberos.ErrKDCUnreachable](err):
+		return ErrorClassKDCUnreachable
+	case errorIsType[*kerberos.ErrBadKeytabOrPrincipal](err):
+		return ErrorClassBadKeytabOrPrincipal
+	case errorIsType[*vaultToken.ErrVaultUnreachable](err):
+		return ErrorClassVaultUnreachable
+	case errorIsType[*vaultToken.ErrCreddUnreachable](err):
+		return ErrorClassCreddUnreachable
+	case errorIsType[*fileCopier.ErrSSHAuth](err):
+		return ErrorClassSSHAuth
+	case errorIsType[*fileCopier.ErrHostUnreachable](err), errorIsType[*ping.ErrHostUnreachable](err):
+		return ErrorClassHostUnreachable
+	case errorIsType[*fileCopier.ErrRemotePermissionDenied](err):
+		return ErrorClassPermissionDenied
+	case errorIsType[*fileCopier.ErrDiskFull](err):
+		return ErrorClassDiskFull
+	default:
+		return ErrorClassOther
+	}
+}
+
+// errorIsType reports whether any error in err's tree is of type T
+func errorIsType[T error](err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
+
+// OperationResult is the outcome of a single operation that a worker ran against a single target, like storing a vault token in
+// a schedd's credd or pinging a node
+type OperationResult struct {
+	// Target is what the operation was run against, for example a schedd or a node
+	Target string
+	// Err is the error from the last attempt at the operation, or nil if the operation succeeded
+	Err        error
+	ErrorClass ErrorClass
+	// Attempts is the number of attempts made at the operation, including retries
+	Attempts uint
+	Start    time.Time
+	End      time.Time
+}
+
+// newOperationResult returns the OperationResult for an operation against target that started at start and ended now
+func newOperationResult(target string, start time.Time, attempts uint, err error) OperationResult {
+	return OperationResult{
+		Target:     target,
+		Err:        err,
+		ErrorClass: ClassifyError(err),
+		Attempts:   attempts,
+		Start:      start,
+		End:        time.Now(),
+	}
+}
+
+// Success returns whether the operation succeeded
+func (o OperationResult) Success() bool { return o.Err == nil }
+
+// Duration returns how long the operation took, including all of its attempts
+func (o OperationResult) Duration() time.Duration { return o.End.Sub(o.Start) }
+
+// StoreAndGetTokenResult is the result of the StoreAndGetToken worker for a service.  It implements SuccessReporter.
+type StoreAndGetTokenResult struct {
+	service.Service
+	// Schedds holds the result of storing and getting the vault token for each of the service's schedds, in the order they were configured
+	Schedds []OperationResult
+	Start   time.Time
+	End     time.Time
+}
+
+// GetService returns the service associated with the StoreAndGetTokenResult
+func (r *StoreAndGetTokenResult) GetService() service.Service { return r.Service }
+
+// GetSuccess returns whether the vault token was stored in and obtained from every schedd
+func (r *StoreAndGetTokenResult) GetSuccess() bool { return allSucceeded(r.Schedds) }
+
+// PingResult is the result of the PingAggregator worker for a service.  It implements SuccessReporter.
+type PingResult struct {
+	service.Service
+	// Nodes holds the result of pinging each of the service's destination nodes, in the order they were configured
+	Nodes []OperationResult
+	Start time.Time
+	End   time.Time
+}
+
+// GetService returns the service associated with the PingResult
+func (r *PingResult) GetService() service.Service { return r.Service }
+
+// GetSuccess returns whether every node was pinged successfully
+func (r *PingResult) GetSuccess() bool { return allSucceeded(r.Nodes) }
+
+// PushTokensResult is the result of the PushTokens worker for a service.  It implements SuccessReporter.
+type PushTokensResult struct {
+	service.Service
+	// Err is set if the worker could not push anything for the service, for example because no vault token was found.  In that
+	// case, Nodes is empty.
+	Err error
+	// Nodes holds the results of pushing files to each of the service's destination nodes, in the order they were configured
+	Nodes []NodePushResult
+	Start time.Time
+	End   time.Time
+}
+
+// GetService returns the service associated with the PushTokensResult
+func (r *PushTokensResult) GetService() service.Service { return r.Service }
+
+// GetSuccess returns whether all of the required files were pushed to every node
+func (r *PushTokensResult) GetSuccess() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, n := range r.Nodes {
+		if !n.Success() {
+			return false
+		}
+	}
+	return true
+}
+
+// NodePushResult holds the results of pushing files to a single destination node
+type NodePushResult struct {
+	Node  string
+	Files []FilePushResult
+}
+
+// Success returns whether all of the required files were pushed to the node.  Failures to push optional files are ignored.
+func (n NodePushResult) Success() bool {
+	return n.FirstFailure() == nil
+}
+
+// FirstFailure returns the first required file that could not be pushed to the node, or nil if there was none
+func (n NodePushResult) FirstFailure() *FilePushResult {
+	for i := range n.Files {
+		if n.Files[i].Required && !n.Files[i].Success() {
+			return &n.Files[i]
+		}
+	}
+	return nil
+}
+
+// FilePushResult is the result of pushing a single file to a destination node.  The embedded OperationResult's Target is the node.
+type FilePushResult struct {
+	OperationResult
+	Source      string
+	Destination string
+	// Required is false if a failure to push this file does not mark the node as failed
+	Required bool
+}
+
+// allSucceeded returns whether every OperationResult in results succeeded
+func allSucceeded(results []OperationResult) bool {
+	for _, r := range results {
+		if !r.Success() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/fileCopier"
+	"github.com/fermitools/managed-tokens/internal/kerberos"
+	"github.com/fermitools/managed-tokens/internal/ping"
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/utils"
+	"github.com/fermitools/managed-tokens/internal/vaultToken"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		description string
+		err         error
+		expected    ErrorClass
+	}{
+		{"No error", nil, ErrorClassNone},
+		{"Deadline exceeded", fmt.Errorf("could not push: %w", context.DeadlineExceeded), ErrorClassTimeout},
+		{"Deadline exceeded while waiting to retry", errors.Join(errors.New("exit status 1"), context.DeadlineExceeded), ErrorClassTimeout},
+		{"Canceled", context.Canceled, ErrorClassCanceled},
+		{"Auth needed", fmt.Errorf("could not store token: %w", &vaultToken.ErrAuthNeeded{}), ErrorClassAuthNeeded},
+		{"Unpingable node", fmt.Errorf("failed to push file to destination node node1: %w", errNodeUnpingable), ErrorClassUnpingable},
+		{"KDC unreachable", fmt.Errorf("could not get ticket: %w", &kerberos.ErrKDCUnreachable{}), ErrorClassKDCUnreachable},
+		{"Bad keytab", &kerberos.ErrBadKeytabOrPrincipal{}, ErrorClassBadKeytabOrPrincipal},
+		{"Kerberos timeout", &kerberos.ErrTimeout{CommandError: utils.CommandError{Err: context.DeadlineExceeded}}, ErrorClassTimeout},
+		{"Vault unreachable", &vaultToken.ErrVaultUnreachable{}, ErrorClassVaultUnreachable},
+		{"Credd unreachable", &vaultToken.ErrCreddUnreachable{}, ErrorClassCreddUnreachable},
+		{"SSH auth", &fileCopier.ErrSSHAuth{}, ErrorClassSSHAuth},
+		{"Host unreachable on push", &fileCopier.ErrHostUnreachable{}, ErrorClassHostUnreachable},
+		{"Host unreachable on ping", fmt.Errorf("could not ping: %w", &ping.ErrHostUnreachable{}), ErrorClassHostUnreachable},
+		{"Remote permission denied", &fileCopier.ErrRemotePermissionDenied{}, ErrorClassPermissionDenied},
+		{"Disk full", &fileCopier.ErrDiskFull{}, ErrorClassDiskFull},
+		{"Other error", errors.New("exit status 23"), ErrorClassOther},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ClassifyError(tc.err))
+		})
+	}
+}
+
+func TestNewOperationResult(t *testing.T) {
+	start := time.Now().Add(-time.Second)
+	err := fmt.Errorf("could not ping: %w", context.DeadlineExceeded)
+
+	r := newOperationResult("node1", start, 2, err)
+	assert.Equal(t, "node1", r.Target)
+	assert.False(t, r.Success())
+	assert.Equal(t, ErrorClassTimeout, r.ErrorClass)
+	assert.Equal(t, uint(2), r.Attempts)
+	assert.GreaterOrEqual(t, r.Duration(), time.Second)
+
+	r = newOperationResult("node1", start, 1, nil)
+	assert.True(t, r.Success())
+	assert.Equal(t, ErrorClassNone, r.ErrorClass)
+}
+
+func TestNodePushResults(t *testing.T) {
+	errPush := errors.New("exit status 23")
+	fileResults := []FilePushResult{
+		{OperationResult: OperationResult{Target: "node2"}, Destination: "/tmp/file1", Required: true},
+		{OperationResult: OperationResult{Target: "node1", Err: errPush}, Destination: "/tmp/file1", Required: true},
+		{OperationResult: OperationResult{Target: "node1"}, Destination: "/tmp/file2", Required: true},
+		{OperationResult: OperationResult{Target: "node2", Err: errPush}, Destination: "/tmp/file2", Required: false},
+	}
+
+	results := nodePushResults([]string{"node1", "node2", "node3"}, fileResults)
+	if !assert.Len(t, results, 3) {
+		return
+	}
+
+	// Results are in the order of the nodes, with each node's files in the order they were given
+	assert.Equal(t, "node1", results[0].Node)
+	assert.Equal(t, []FilePushResult{fileResults[1], fileResults[2]}, results[0].Files)
+	assert.False(t, results[0].Success())
+	if f := results[0].FirstFailure(); assert.NotNil(t, f) {
+		assert.Equal(t, "/tmp/file1", f.Destination)
+	}
+
+	// A failure to push an optional file does not fail the node
+	assert.Equal(t, "node2", results[1].Node)
+	assert.Equal(t, []FilePushResult{fileResults[0], fileResults[3]}, results[1].Files)
+	assert.True(t, results[1].Success())
+	assert.Nil(t, results[1].FirstFailure())
+
+	assert.Equal(t, "node3", results[2].Node)
+	assert.Empty(t, results[2].Files)
+	assert.True(t, results[2].Success())
+}
+
+func TestResultsGetSuccess(t *testing.T) {
+	s := service.NewService("expt_role")
+	errTest := errors.New("test error")
+	failedNode := NodePushResult{Node: "node1", Files: []FilePushResult{{OperationResult: OperationResult{Target: "node1", Err: errTest}, Required: true}}}
+	goodNode := NodePushResult{Node: "node2", Files: []FilePushResult{{OperationResult: OperationResult{Target: "node2"}, Required: true}}}
+
+	testCases := []struct {
+		description string
+		result      SuccessReporter
+		expected    bool
+	}{
+		{"No schedds", &StoreAndGetTokenResult{Service: s}, true},
+		{"All schedds succeeded", &StoreAndGetTokenResult{Service: s, Schedds: []OperationResult{{Target: "schedd1"}, {Target: "schedd2"}}}, true},
+		{"One schedd failed", &StoreAndGetTokenResult{Service: s, Schedds: []OperationResult{{Target: "schedd1"}, {Target: "schedd2", Err: errTest}}}, false},
+		{"All nodes pinged", &PingResult{Service: s, Nodes: []OperationResult{{Target: "node1"}}}, true},
+		{"One node not pinged", &PingResult{Service: s, Nodes: []OperationResult{{Target: "node1", Err: errTest}}}, false},
+		{"All nodes pushed", &PushTokensResult{Service: s, Nodes: []NodePushResult{goodNode}}, true},
+		{"One node failed push", &PushTokensResult{Service: s, Nodes: []NodePushResult{goodNode, failedNode}}, false},
+		{"Push could not start", &PushTokensResult{Service: s, Err: errTest}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, s, tc.result.GetService())
+			assert.Equal(t, tc.expected, tc.result.GetSuccess())
+		})
+	}
+}
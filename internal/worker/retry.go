@@ -0,0 +1,246 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fermitools/managed-tokens/internal/metrics"
+	"github.com/fermitools/managed-tokens/internal/tracing"
+	"github.com/fermitools/managed-tokens/internal/vaultToken"
+)
+
+// Sleep time between each retry, if retries are configured without one
+const defaultRetrySleepDuration = 60 * time.Second
+
+// Metrics
+var (
+	workerOperationAttemptCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "managed_tokens",
+			Name:      "worker_operation_attempts_total",
+			Help:      "The number of attempts the Managed Tokens Service made at worker operations, including retries",
+		},
+		[]string{
+			"worker_type",
+			"service",
+		},
+	)
+	workerOperationOutcomeCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "managed_tokens",
+			Name:      "worker_operation_outcomes_total",
+			Help:      "The number of worker operations that finally succeeded or failed after all of their attempts",
+		},
+		[]string{
+			"worker_type",
+			"service",
+			"outcome",
+		},
+	)
+)
+
+func init() {
+	metrics.MetricsRegistry.MustRegister(workerOperationAttemptCount)
+	metrics.MetricsRegistry.MustRegister(workerOperationOutcomeCount)
+}
+
+// RetryPolicy describes how a worker retries a failed operation.  The delay before the nth retry is BaseDelay*Multiplier^(n-1), moved
+// up or down by a random fraction of up to Jitter of itself.  The zero value of a RetryPolicy makes a single attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.  0 is treated as 1.
+	MaxAttempts uint
+	// BaseDelay is the delay before the first retry
+	BaseDelay time.Duration
+	// Multiplier is the factor by which the delay grows after each retry.  Values less than 1 are treated as 1, meaning a fixed delay.
+	Multiplier float64
+	// Jitter is the fraction of each delay, between 0 and 1, by which the delay is randomly moved up or down
+	Jitter float64
+	// MaxElapsedTime, if nonzero, limits the total time of all of the attempts and the waits between them.  No retry is started that
+	// would start after it.
+	MaxElapsedTime time.Duration
+	// Retryable, if not nil, decides whether an error is worth retrying.  Errors from canceled contexts, and any error once the context
+	// that the retries are run with is done, are never retried.
+	Retryable func(error) bool
+}
+
+// getRetryPolicyFromConfig returns the RetryPolicy for the WorkerType w in c.  If no RetryPolicyOption is set, the policy is built from
+// NumRetriesOption and RetrySleepOption, with a fixed delay.  If none of those are set, the policy makes a single attempt.
+func getRetryPolicyFromConfig(c Config, w WorkerType) RetryPolicy {
+	p := RetryPolicy{MaxAttempts: 1, BaseDelay: defaultRetrySleepDuration}
+	m, err := getWorkerTypeMapFromConfig(c, w, slices.Collect(ValidRetryWorkerTypes()))
+	if err != nil {
+		return p
+	}
+	if policy, ok := m[RetryPolicyOption].(RetryPolicy); ok {
+		return policy
+	}
+	if numRetries, err := getWorkerNumRetriesValueFromConfig(c, w); err == nil {
+		p.MaxAttempts = numRetries + 1
+	}
+	if retrySleep, err := getWorkerRetrySleepValueFromConfig(c, w); err == nil {
+		p.BaseDelay = retrySleep
+	}
+	return p
+}
+
+// withRetryable returns a copy of p that only retries errors that both p and retryable consider retryable
+func (p RetryPolicy) withRetryable(retryable func(error) bool) RetryPolicy {
+	policyRetryable := p.Retryable
+	p.Retryable = func(err error) bool {
+		return (policyRetryable == nil || policyRetryable(err)) && retryable(err)
+	}
+	return p
+}
+
+// isRetryable reports whether err, returned by an attempt run with ctx, should be retried.  An attempt that timed out on its own, while
+// ctx is still live, is retried.
+func (p RetryPolicy) isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || isPermanentError(err) {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// delay returns the time to wait before the retry that follows attempt number attempt, where the first attempt is 1
+func (p RetryPolicy) delay(attempt uint) time.Duration {
+	multiplier := max(p.Multiplier, 1)
+	d := float64(p.BaseDelay) * math.Pow(multiplier, float64(attempt-1))
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		d *= 1 + jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(min(d, float64(math.MaxInt64)))
+}
+
+// isPermanentError reports whether err is one of the typed errors that won't go away by retrying without someone fixing the keytab,
+// the destination node's ssh setup, or its filesystem
+func isPermanentError(err error) bool {
+	switch ClassifyError(err) {
+	case ErrorClassBadKeytabOrPrincipal, ErrorClassSSHAuth, ErrorClassPermissionDenied, ErrorClassDiskFull:
+		return true
+	default:
+		return false
+	}
+}
+
+// isNotAuthNeededError reports whether err is not a *vaultToken.ErrAuthNeeded, which retrying won't fix without someone to authenticate
+func isNotAuthNeededError(err error) bool {
+	var authNeededErrorPtr *vaultToken.ErrAuthNeeded
+	return !errors.As(err, &authNeededErrorPtr)
+}
+
+// withAttemptTimeout returns op, with each attempt at it run with its own timeout of timeout, so that an attempt that hangs doesn't use
+// up the time for the attempts after it
+func withAttemptTimeout(timeout time.Duration, op func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return op(ctx)
+	}
+}
+
+// retry runs op until it succeeds, or until the RetryPolicy p says to stop:  the error op returned is not retryable, there are no
+// attempts left, or the next retry would start after p.MaxElapsedTime.  If p.MaxElapsedTime is set, the attempts are run with a context
+// that expires that long after the first attempt started.  Waiting between attempts stops if ctx is done.  It returns the
+// number of attempts made and the error from the last attempt, joined with the context error if ctx ended while waiting to retry.  The
+// attempts and final outcome are recorded in the metrics and the trace for the WorkerType w and the service serviceName.
+func retry(ctx context.Context, p RetryPolicy, w WorkerType, serviceName string, op func(context.Context) error) (uint, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("managed-tokens").Start(ctx, "worker.retry")
+	span.SetAttributes(
+		attribute.String("workerType", w.String()),
+		attribute.String("service", serviceName),
+	)
+	defer span.End()
+
+	funcLogger := log.WithFields(log.Fields{
+		"workerType": w.String(),
+		"service":    serviceName,
+	})
+
+	start := time.Now()
+	if p.MaxElapsedTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.MaxElapsedTime)
+		defer cancel()
+	}
+	maxAttempts := max(p.MaxAttempts, 1)
+	var attempt uint
+	var err error
+	for attempt = 1; ; attempt++ {
+		workerOperationAttemptCount.WithLabelValues(w.String(), serviceName).Inc()
+		if err = op(ctx); err == nil {
+			break
+		}
+		span.AddEvent("Attempt failed", trace.WithAttributes(
+			attribute.Int("attempt", int(attempt)),
+			attribute.String("error", err.Error()),
+		))
+
+		if attempt >= maxAttempts {
+			funcLogger.Debugf("Attempt %d failed, and no attempts are left.  Will not retry", attempt)
+			break
+		}
+		if !p.isRetryable(ctx, err) {
+			funcLogger.Debugf("Attempt %d failed with an error that should not be retried.  Will not retry", attempt)
+			break
+		}
+		delay := p.delay(attempt)
+		if p.MaxElapsedTime > 0 && time.Since(start)+delay > p.MaxElapsedTime {
+			funcLogger.Debugf("Attempt %d failed, and retrying would take longer than %s.  Will not retry", attempt, p.MaxElapsedTime)
+			break
+		}
+
+		funcLogger.Debugf("Attempt %d failed: %s.  Will retry in %s", attempt, err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = errors.Join(err, ctx.Err())
+		case <-timer.C:
+			continue
+		}
+		break
+	}
+
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	workerOperationOutcomeCount.WithLabelValues(w.String(), serviceName, outcome).Inc()
+	span.SetAttributes(
+		attribute.Int("attempts", int(attempt)),
+		attribute.String("outcome", outcome),
+	)
+	if err != nil {
+		tracing.LogErrorWithTrace(span, funcLogger, "Operation failed after "+strconv.Itoa(int(attempt))+" attempt(s)")
+		return attempt, err
+	}
+	span.SetStatus(codes.Ok, "Operation succeeded")
+	return attempt, nil
+}
@@ -0,0 +1,276 @@
+// COPYRIGHT 2024 FERMI NATIONAL ACCELERATOR LABORATORY
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+//
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fermitools/managed-tokens/internal/fileCopier"
+	"github.com/fermitools/managed-tokens/internal/kerberos"
+	"github.com/fermitools/managed-tokens/internal/service"
+	"github.com/fermitools/managed-tokens/internal/vaultToken"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, Multiplier: 2}
+	assert.Equal(t, time.Second, p.delay(1))
+	assert.Equal(t, 2*time.Second, p.delay(2))
+	assert.Equal(t, 4*time.Second, p.delay(3))
+
+	// Multipliers less than 1 mean a fixed delay
+	p.Multiplier = 0.5
+	assert.Equal(t, time.Second, p.delay(3))
+
+	p = RetryPolicy{BaseDelay: time.Second, Jitter: 0.25}
+	for range 100 {
+		d := p.delay(1)
+		assert.GreaterOrEqual(t, d, 750*time.Millisecond)
+		assert.LessOrEqual(t, d, 1250*time.Millisecond)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errTest := errors.New("test error")
+	errPermanent := errors.New("permanent error")
+
+	type testCase struct {
+		description      string
+		policy           RetryPolicy
+		failures         int
+		opErr            error
+		expectedAttempts int
+		expectedErr      error
+	}
+
+	testCases := []testCase{
+		{
+			description:      "Zero policy makes a single attempt",
+			policy:           RetryPolicy{},
+			failures:         1,
+			expectedAttempts: 1,
+			expectedErr:      errTest,
+		},
+		{
+			description:      "Succeeds on first attempt",
+			policy:           RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			failures:         0,
+			expectedAttempts: 1,
+		},
+		{
+			description:      "Succeeds after retries",
+			policy:           RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, Multiplier: 2, Jitter: 0.5},
+			failures:         2,
+			expectedAttempts: 3,
+		},
+		{
+			description:      "Runs out of attempts",
+			policy:           RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			failures:         5,
+			expectedAttempts: 3,
+			expectedErr:      errTest,
+		},
+		{
+			description: "Error is not retryable",
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+				BaseDelay:   time.Millisecond,
+				Retryable:   func(err error) bool { return !errors.Is(err, errPermanent) },
+			},
+			failures:         5,
+			opErr:            fmt.Errorf("wrapped: %w", errPermanent),
+			expectedAttempts: 1,
+			expectedErr:      errPermanent,
+		},
+		{
+			description:      "Canceled contexts are not retried",
+			policy:           RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			failures:         5,
+			opErr:            context.Canceled,
+			expectedAttempts: 1,
+			expectedErr:      context.Canceled,
+		},
+		{
+			description:      "Attempts that time out on their own are retried",
+			policy:           RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			failures:         1,
+			opErr:            context.DeadlineExceeded,
+			expectedAttempts: 2,
+		},
+		{
+			description:      "Next retry would start after max elapsed time",
+			policy:           RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxElapsedTime: time.Minute},
+			failures:         5,
+			expectedAttempts: 1,
+			expectedErr:      errTest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			opErr := tc.opErr
+			if opErr == nil {
+				opErr = errTest
+			}
+			var attempts int
+			reportedAttempts, err := retry(context.Background(), tc.policy, PushTokens, "myexpt_myrole", func(context.Context) error {
+				attempts++
+				if attempts <= tc.failures {
+					return opErr
+				}
+				return nil
+			})
+			assert.Equal(t, tc.expectedAttempts, attempts)
+			assert.Equal(t, uint(tc.expectedAttempts), reportedAttempts)
+			if tc.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestRetryContextDoneWhileWaiting(t *testing.T) {
+	errTest := errors.New("test error")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var attempts int
+	start := time.Now()
+	reportedAttempts, err := retry(ctx, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}, GetKerberosTickets, "myexpt_myrole", func(context.Context) error {
+		attempts++
+		return errTest
+	})
+	assert.Less(t, time.Since(start), time.Minute)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, uint(1), reportedAttempts)
+	assert.ErrorIs(t, err, errTest)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestRetryWithAttemptTimeout checks that an attempt that hangs times out on its own and is retried, and that the attempts together
+// can't run past MaxElapsedTime
+func TestRetryWithAttemptTimeout(t *testing.T) {
+	var attempts int
+	op := withAttemptTimeout(10*time.Millisecond, func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	reportedAttempts, err := retry(context.Background(), RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, GetToken, "myexpt_myrole", op)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, uint(2), reportedAttempts)
+
+	// Hanging attempts are cut off at MaxElapsedTime, even though each one could run for longer
+	attempts = 0
+	start := time.Now()
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxElapsedTime: 20 * time.Millisecond}
+	reportedAttempts, err = retry(context.Background(), policy, GetToken, "myexpt_myrole", withAttemptTimeout(time.Hour, func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	assert.Less(t, time.Since(start), time.Minute)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, uint(1), reportedAttempts)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRetryPolicyWithRetryable(t *testing.T) {
+	errA := errors.New("a")
+	errB := errors.New("b")
+
+	p := RetryPolicy{}.withRetryable(func(err error) bool { return !errors.Is(err, errA) })
+	assert.False(t, p.isRetryable(context.Background(), errA))
+	assert.True(t, p.isRetryable(context.Background(), errB))
+
+	// Both predicates have to allow the retry
+	p = p.withRetryable(func(err error) bool { return !errors.Is(err, errB) })
+	assert.False(t, p.isRetryable(context.Background(), errA))
+	assert.False(t, p.isRetryable(context.Background(), errB))
+	assert.True(t, p.isRetryable(context.Background(), errors.New("c")))
+}
+
+func TestRetryPolicyIsRetryablePermanentErrors(t *testing.T) {
+	p := RetryPolicy{}
+	assert.True(t, p.isRetryable(context.Background(), &fileCopier.ErrHostUnreachable{}))
+	assert.True(t, p.isRetryable(context.Background(), &kerberos.ErrKDCUnreachable{}))
+	assert.False(t, p.isRetryable(context.Background(), &kerberos.ErrBadKeytabOrPrincipal{}))
+	assert.False(t, p.isRetryable(context.Background(), fmt.Errorf("could not push: %w", &fileCopier.ErrSSHAuth{})))
+	assert.False(t, p.isRetryable(context.Background(), &fileCopier.ErrRemotePermissionDenied{}))
+	assert.False(t, p.isRetryable(context.Background(), &fileCopier.ErrDiskFull{}))
+}
+
+func TestIsNotAuthNeededError(t *testing.T) {
+	assert.True(t, isNotAuthNeededError(errors.New("some error")))
+	assert.False(t, isNotAuthNeededError(fmt.Errorf("could not get token: %w", &vaultToken.ErrAuthNeeded{})))
+}
+
+func TestGetRetryPolicyFromConfig(t *testing.T) {
+	s := service.NewService("myexpt_myrole")
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, Multiplier: 2, Jitter: 0.1, MaxElapsedTime: time.Minute}
+
+	type testCase struct {
+		description string
+		opts        []ConfigOption
+		expected    RetryPolicy
+	}
+
+	testCases := []testCase{
+		{
+			description: "Nothing set",
+			expected:    RetryPolicy{MaxAttempts: 1, BaseDelay: defaultRetrySleepDuration},
+		},
+		{
+			description: "Only legacy retry options set",
+			opts:        []ConfigOption{SetNumRetriesOption(GetToken, 2), SetRetrySleepOption(GetToken, 5*time.Second)},
+			expected:    RetryPolicy{MaxAttempts: 3, BaseDelay: 5 * time.Second},
+		},
+		{
+			description: "Only numRetries set",
+			opts:        []ConfigOption{SetNumRetriesOption(GetToken, 2)},
+			expected:    RetryPolicy{MaxAttempts: 3, BaseDelay: defaultRetrySleepDuration},
+		},
+		{
+			description: "Retry policy set",
+			opts:        []ConfigOption{SetNumRetriesOption(GetToken, 2), SetRetryPolicyOption(GetToken, policy)},
+			expected:    policy,
+		},
+		{
+			description: "Retry policy set for another worker type",
+			opts:        []ConfigOption{SetRetryPolicyOption(PushTokens, policy)},
+			expected:    RetryPolicy{MaxAttempts: 1, BaseDelay: defaultRetrySleepDuration},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			c, err := NewConfig(s, tc.opts...)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, getRetryPolicyFromConfig(*c, GetToken))
+		})
+	}
+}
@@ -29,6 +29,8 @@ const (
 	PingOptions
 	// SSHOptions allows the user to specify options for the PushTokensWorker to use when pushing files to the destination nodes
 	SSHOptions
+	// TokenDestinations allows the user to specify the destinations on each node that the PushTokensWorker should push vault tokens to
+	TokenDestinations
 )
 
 func (s supportedExtrasKey) String() string {
@@ -41,6 +43,8 @@ func (s supportedExtrasKey) String() string {
 		return "PingOptions"
 	case SSHOptions:
 		return "SSHOptions"
+	case TokenDestinations:
+		return "TokenDestinations"
 	default:
 		return "unsupported extras key"
 	}
@@ -113,3 +117,15 @@ func GetSSHOptionsFromExtras(c *Config) ([]string, bool) {
 	SSHOpts, ok := _sshOpts.([]string)
 	return SSHOpts, ok
 }
+
+// GetTokenDestinationsFromExtras retrieves the vault token destinations slice from the worker.Config, and asserts
+// that it is a []TokenDestination.  If no value was stored, the default destinations are returned.  Callers should
+// check the bool return value to make sure that the type assertion passes.
+func GetTokenDestinationsFromExtras(c *Config) ([]TokenDestination, bool) {
+	_tokenDestinations, ok := c.Extras[TokenDestinations]
+	if !ok {
+		return DefaultTokenDestinations(), true
+	}
+	tokenDestinations, ok := _tokenDestinations.([]TokenDestination)
+	return tokenDestinations, ok
+}
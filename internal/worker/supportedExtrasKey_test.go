@@ -164,3 +164,55 @@ func TestGetSSHOptionsFromExtras(t *testing.T) {
 		)
 	}
 }
+
+func TestGetTokenDestinationsFromExtras(t *testing.T) {
+	type testCase struct {
+		description          string
+		setupFunc            func() *Config
+		expectedDestinations []TokenDestination
+		expectedOk           bool
+	}
+
+	testCases := []testCase{
+		{
+			"No destinations stored",
+			func() *Config { return &Config{} },
+			DefaultTokenDestinations(),
+			true,
+		},
+		{
+			"Valid destinations",
+			func() *Config {
+				c := new(Config)
+				c.Extras = make(map[supportedExtrasKey]any)
+				c.Extras[TokenDestinations] = []TokenDestination{{Template: "/tmp/foo", Optional: true}}
+				return c
+			},
+			[]TokenDestination{{Template: "/tmp/foo", Optional: true}},
+			true,
+		},
+		{
+			"Invalid destinations",
+			func() *Config {
+				c := new(Config)
+				c.Extras = make(map[supportedExtrasKey]any)
+				c.Extras[TokenDestinations] = []string{"/tmp/foo"}
+				return c
+			},
+			nil,
+			false,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(
+			test.description,
+			func(t *testing.T) {
+				c := test.setupFunc()
+				destinations, ok := GetTokenDestinationsFromExtras(c)
+				assert.Equal(t, test.expectedDestinations, destinations)
+				assert.Equal(t, test.expectedOk, ok)
+			},
+		)
+	}
+}
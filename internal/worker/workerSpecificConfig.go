@@ -42,6 +42,14 @@ const (
 	// supported by the StoreAndGetToken WorkerType, and the value of the AlternateTokenStorerAndGetterOption must be of a type that
 	// implements the TokenStorerAndGetter interface.
 	AlternateTokenStorerAndGetterOption
+	// TimeoutOption is a worker-specific configuration option that represents the time.Duration a worker should use as the timeout of each
+	// operation it runs for the Config.  It takes precedence over the timeout the worker was started with.  It is supported by the
+	// WorkerTypes returned by ValidTimeoutWorkerTypes
+	TimeoutOption
+	// RetryPolicyOption is a worker-specific configuration option that represents the RetryPolicy a worker should use for each operation
+	// it runs for the Config.  It takes precedence over NumRetriesOption and RetrySleepOption.  It is supported by the WorkerTypes
+	// returned by ValidRetryWorkerTypes
+	RetryPolicyOption
 	invalidWorkerSpecificConfigOption
 )
 
@@ -84,6 +92,24 @@ func SetRetrySleepOption(w WorkerType, retrySleep time.Duration) ConfigOption {
 	return SetWorkerSpecificConfigOption(w, RetrySleepOption, retrySleep)
 }
 
+// SetRetryPolicyOption returns a ConfigOption that sets the RetryPolicy for the specified WorkerType.
+// If the WorkerType does not support retry configuration, it returns a no-op ConfigOption.
+func SetRetryPolicyOption(w WorkerType, p RetryPolicy) ConfigOption {
+	if !slices.Contains(slices.Collect(ValidRetryWorkerTypes()), w) {
+		return ConfigOption(func(*Config) error { return nil }) // No-op
+	}
+	return SetWorkerSpecificConfigOption(w, RetryPolicyOption, p)
+}
+
+// SetTimeoutOption returns a ConfigOption that sets the timeout for the specified WorkerType's operations for the Config.
+// If the WorkerType does not support per-Config timeouts, it returns a no-op ConfigOption.
+func SetTimeoutOption(w WorkerType, timeout time.Duration) ConfigOption {
+	if !slices.Contains(slices.Collect(ValidTimeoutWorkerTypes()), w) {
+		return ConfigOption(func(*Config) error { return nil }) // No-op
+	}
+	return SetWorkerSpecificConfigOption(w, TimeoutOption, timeout)
+}
+
 // SetInteractiveTokenGetterOption sets the interactive option for the token getter of the specified WorkerType.
 // If the WorkerType is not valid for token getters, it returns a no-op ConfigOption.
 func SetInteractiveTokenGetterOption(w WorkerType, interactive bool) ConfigOption {
@@ -110,6 +136,28 @@ func SetAlternateTokenStorerAndGetterOption(w WorkerType, ts TokenStorerAndGette
 // ValidRetryWorkerTypes returns an iterator over the valid WorkerTypes that support retry configuration options
 func ValidRetryWorkerTypes() iter.Seq[WorkerType] {
 	validWorkerTypes := []WorkerType{
+		GetKerberosTickets,
+		GetToken,
+		StoreAndGetToken,
+		PingAggregator,
+		PushTokens,
+	}
+	return func(yield func(w WorkerType) bool) {
+		for _, wt := range validWorkerTypes {
+			if !yield(wt) {
+				return
+			}
+		}
+	}
+}
+
+// ValidTimeoutWorkerTypes returns an iterator over the valid WorkerTypes that support per-Config timeouts
+func ValidTimeoutWorkerTypes() iter.Seq[WorkerType] {
+	validWorkerTypes := []WorkerType{
+		GetKerberosTickets,
+		GetToken,
+		StoreAndGetToken,
+		PingAggregator,
 		PushTokens,
 	}
 	return func(yield func(w WorkerType) bool) {
@@ -184,6 +232,17 @@ func getWorkerRetrySleepValueFromConfig(c Config, w WorkerType) (time.Duration,
 	return valTime, nil
 }
 
+// getWorkerTimeoutValueFromConfig retrieves the timeout for a specific worker type from the given configuration.  The returned bool
+// is false if no timeout is set for the worker type, or if it is not a time.Duration.
+func getWorkerTimeoutValueFromConfig(c Config, w WorkerType) (time.Duration, bool) {
+	m, err := getWorkerTypeMapFromConfig(c, w, slices.Collect(ValidTimeoutWorkerTypes()))
+	if err != nil {
+		return 0, false
+	}
+	val, ok := m[TimeoutOption].(time.Duration)
+	return val, ok
+}
+
 // getInteractiveTokenGetterOptionFromConfig retrieves the interactiveTokenGetterOption for a specific worker type from the given configuration.
 // If the worker type is not supported or invalid, an error is returned.
 func getInteractiveTokenGetterOptionFromConfig(c Config, w WorkerType) (bool, error) {
@@ -20,6 +20,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/fermitools/managed-tokens/internal/service"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -331,3 +332,17 @@ func TestGetWorkerTypeMapFromConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestSetTimeoutOption(t *testing.T) {
+	c, err := NewConfig(service.NewService("myexpt_myrole"), SetTimeoutOption(StoreAndGetToken, 5*time.Minute), SetTimeoutOption(invalid, time.Second))
+	assert.NoError(t, err)
+
+	val, ok := getWorkerTimeoutValueFromConfig(*c, StoreAndGetToken)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Minute, val)
+
+	_, ok = getWorkerTimeoutValueFromConfig(*c, GetKerberosTickets)
+	assert.False(t, ok)
+	_, ok = getWorkerTimeoutValueFromConfig(*c, invalid)
+	assert.False(t, ok)
+}
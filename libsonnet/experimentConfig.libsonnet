@@ -9,7 +9,11 @@ local supportedOverrides = [
     "condorScheddConstraintOverride",
     "defaultRoleFileDestinationTemplateOverride",
     "disableNotificationsOverride",
-    "tokenGetterOverride"
+    "tokenGetterOverride",
+    "daemonIntervalOverride",
+    "tokenDestinationsOverride",
+    "timeoutsOverride",
+    "workerTypeOverride"
 ];
 
 {